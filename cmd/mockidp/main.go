@@ -0,0 +1,56 @@
+// Локальный OpenID-провайдер для проверки входа через SSO без настоящего регионального IdP.
+//
+//	go run ./cmd/mockidp -addr :9000 -issuer http://localhost:9000
+//
+// В админке добавьте провайдера с этим issuer, client_id и client_secret.
+package main
+
+import (
+	"edugame/internal/oidc/mockidp"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+var defaultUsers = []mockidp.User{
+	{Subject: "1001", Username: "sso_teacher", Name: "Иванова Мария Петровна", Roles: []string{"teacher"}},
+	{Subject: "1002", Username: "sso_director", Name: "Петров Сергей Иванович", Roles: []string{"director"}},
+	{Subject: "1003", Username: "sso_staff", Name: "Сидорова Анна Олеговна", Roles: []string{"staff"}},
+	{Subject: "2001", Username: "student1", Name: "Ученик Первый", Roles: []string{"student"}},
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "адрес, на котором слушает провайдер")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer, он же базовый адрес провайдера")
+	clientID := flag.String("client-id", "edugame", "client_id приложения")
+	clientSecret := flag.String("client-secret", "edugame-secret", "client_secret приложения")
+	usersFile := flag.String("users", "", "JSON-файл со списком пользователей (по умолчанию - встроенный набор)")
+	flag.Parse()
+
+	users := defaultUsers
+	if *usersFile != "" {
+		data, err := os.ReadFile(*usersFile)
+		if err != nil {
+			slog.Error("failed to read users file", "error", err)
+			os.Exit(1)
+		}
+		if err := json.Unmarshal(data, &users); err != nil {
+			slog.Error("failed to parse users file", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	server, err := mockidp.New(*issuer, *clientID, *clientSecret, users)
+	if err != nil {
+		slog.Error("failed to create mock idp", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("mock idp started", "addr", *addr, "issuer", *issuer, "client_id", *clientID, "users", len(users))
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		slog.Error("mock idp stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -2,15 +2,20 @@ package main
 
 import (
 	"context"
+	"edugame/internal"
 	"edugame/internal/database"
+	"edugame/internal/entity"
 	"edugame/internal/handler"
 	middleware "edugame/internal/midlleware"
+	"edugame/internal/oidc"
 	"edugame/internal/repository"
 	"edugame/internal/session"
 	"errors"
 	"log"
 	"log/slog"
+	"net"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -41,42 +46,121 @@ func main() {
 		return
 	}
 
-	err = database.InitDB(connStr)
+	db, err := database.InitDB(connStr)
 	if err != nil {
 		fmt.Printf("Ошибка инициализации БД: %v\n", err)
 		return
 	}
-	defer database.CloseDB()
+	defer database.CloseDB(db)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrate(db, os.Args[2:])
+		database.CloseDB(db)
+		os.Exit(code)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		code := runSeed(db, os.Args[2:])
+		database.CloseDB(db)
+		os.Exit(code)
+	}
+
+	if autoMigrate, _ := strconv.ParseBool(os.Getenv("AUTO_MIGRATE")); autoMigrate {
+		applied, err := database.MigrateUp(db)
+		for _, m := range applied {
+			slog.Info("migration applied", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			slog.Error("failed to migrate database", "error", err)
+			return
+		}
+	} else {
+		warnPendingMigrations(db)
+	}
 
 	secretKey := os.Getenv("SESSION_SECRET_KEY")
 	if secretKey == "" {
 		log.Fatal("SESSION_SECRET_KEY is required")
 	}
 
+	offlineSigningKey := os.Getenv("OFFLINE_SIGNING_KEY")
+	if offlineSigningKey == "" {
+		offlineSigningKey = secretKey
+	}
+
 	session.InitStore(secretKey)
 	store := session.GetStore()
 
+	// Адреса прокси, которым доверяется X-Forwarded-For, например "10.0.0.0/8"
+	trustedProxies, err := middleware.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal("TRUSTED_PROXIES: ", err)
+	}
+
+	// Адрес сайта для ссылок и обратного адреса SSO, например "https://edugame.example"
+	publicURL, err := middleware.ParsePublicURL(os.Getenv("PUBLIC_URL"))
+	if err != nil {
+		log.Fatal("PUBLIC_URL: ", err)
+	}
+	if publicURL == "" {
+		slog.Warn("PUBLIC_URL is not set, links are built from the request Host header")
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3000"
 	}
 
-	teacherRepo := repository.NewTeacherRepository(database.DB)
-	typeRepo := repository.NewTypeRepository(database.DB)
-	userRepo := repository.NewUserRepository(database.DB)
-	userProgressRepo := repository.NewUserProgressRepository(database.DB)
-	schoolRepo := repository.NewSchoolRepository(database.DB)
-	classRepo := repository.NewClassRepository(database.DB)
-	roleRepo := repository.NewRoleRepository(database.DB)
+	timeouts := repository.QueryTimeouts{
+		Query:  envDuration("DB_QUERY_TIMEOUT", internal.DBQueryTimeout),
+		Report: envDuration("DB_REPORT_TIMEOUT", internal.DBReportTimeout),
+	}
+
+	teacherRepo := repository.NewTeacherRepository(db, timeouts)
+	throttleRepo := repository.NewLoginThrottleRepository(db, timeouts)
+	sessionRepo := repository.NewSessionRepository(db, timeouts)
+	resetRepo := repository.NewPasswordResetRepository(db, timeouts)
+	typeRepo := repository.NewTypeRepository(db, timeouts)
+	userRepo := repository.NewUserRepository(db, timeouts)
+	userProgressRepo := repository.NewUserProgressRepository(db, timeouts)
+	schoolRepo := repository.NewSchoolRepository(db, timeouts)
+	classRepo := repository.NewClassRepository(db, timeouts)
+	classStaffRepo := repository.NewClassStaffRepository(db, timeouts)
+	roleRepo := repository.NewRoleRepository(db, timeouts)
+	attemptRepo := repository.NewAttemptRepository(db, timeouts)
+	offlineRepo := repository.NewOfflineRepository(db, timeouts)
+	quizRepo := repository.NewQuizRepository(db, timeouts)
+	inviteRepo := repository.NewInviteRepository(db, timeouts)
+	permissionRepo := repository.NewPermissionRepository(db, timeouts)
+	auditRepo := repository.NewAuditRepository(db, timeouts)
+	oidcRepo := repository.NewOIDCRepository(db, timeouts)
+	guardianRepo := repository.NewGuardianRepository(db, timeouts)
+	trashRepo := repository.NewTrashRepository(db, timeouts)
+	yearRepo := repository.NewAcademicYearRepository(db, timeouts)
+	studentDataRepo := repository.NewStudentDataRepository(db, timeouts)
+
+	maxItemTries := internal.MaxItemTries
+	if v := os.Getenv("ITEM_MAX_TRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxItemTries = n
+		}
+	}
 
 	indexHandler := handler.NewIndexHandler()
-	equationHandler := handler.NewEquationHandler(userRepo, typeRepo, userProgressRepo, store)
+	equationHandler := handler.NewEquationHandler(userRepo, typeRepo, userProgressRepo, attemptRepo, quizRepo, store, maxItemTries)
 	statsHandler := handler.NewStatsHandler(userProgressRepo, userRepo, store)
-	loginHandler := handler.NewLoginHandler(userRepo, store)
-	registrationHandler := handler.NewRegistrationHandler(userRepo, store)
+	loginHandler := handler.NewLoginHandler(userRepo, sessionRepo, throttleRepo, oidcRepo, store)
+	registrationHandler := handler.NewRegistrationHandler(userRepo, teacherRepo, inviteRepo, sessionRepo, throttleRepo, store)
 	homeHandler := handler.NewHomeHandler()
-	teacherHandlers := handler.NewTeacherHandlers(teacherRepo, store)
-	adminHandler := handler.NewAdminHandler(schoolRepo, classRepo, userRepo, roleRepo, typeRepo)
+	sessionHandler := handler.NewSessionHandler(sessionRepo, store)
+	passwordResetHandler := handler.NewPasswordResetHandler(resetRepo, throttleRepo)
+	pictureLoginHandler := handler.NewPictureLoginHandler(userRepo, teacherRepo, sessionRepo, throttleRepo, auditRepo, store)
+	offlineHandler := handler.NewOfflineHandler(userRepo, typeRepo, userProgressRepo, offlineRepo, store, offlineSigningKey)
+	teacherHandlers := handler.NewTeacherHandlers(teacherRepo, userRepo, schoolRepo, resetRepo, guardianRepo, studentDataRepo, auditRepo, store)
+	parentHandler := handler.NewParentHandler(guardianRepo, teacherRepo, userRepo, sessionRepo, throttleRepo, auditRepo, store)
+	oidcProviders := oidc.NewCache(&http.Client{Timeout: internal.OIDCHTTPTimeout}, internal.OIDCDiscoveryTTL)
+	oidcHandler := handler.NewOIDCHandler(oidcRepo, userRepo, sessionRepo, auditRepo, oidcProviders, store)
+	adminHandler := handler.NewAdminHandler(schoolRepo, classRepo, classStaffRepo, userRepo, roleRepo, typeRepo, sessionRepo, inviteRepo, permissionRepo, auditRepo, oidcRepo, trashRepo, yearRepo, studentDataRepo, store)
 
 	mux := http.NewServeMux()
 
@@ -86,109 +170,261 @@ func main() {
 	mux.HandleFunc("/", indexHandler.IndexHandler)
 	mux.HandleFunc("/login", loginHandler.LoginPage)
 	mux.HandleFunc("/auth/login", loginHandler.Login)
+	mux.HandleFunc("/auth/oidc/start", oidcHandler.Start)
+	mux.HandleFunc("/auth/oidc/callback", oidcHandler.Callback)
 	mux.HandleFunc("/register", registrationHandler.RegisterPage)
 	mux.HandleFunc("/auth/register", registrationHandler.Register)
+	mux.HandleFunc("/invite", registrationHandler.InvitePage)
+	mux.HandleFunc("/auth/invite", registrationHandler.AcceptInvite)
+	mux.HandleFunc("/guardian", parentHandler.JoinPage)
+	mux.HandleFunc("/auth/guardian", parentHandler.Join)
+	mux.HandleFunc("/reset", passwordResetHandler.ResetPage)
+	mux.HandleFunc("/auth/reset", passwordResetHandler.Reset)
+	mux.HandleFunc("/picture-login", pictureLoginHandler.LoginPage)
+	mux.HandleFunc("/auth/picture-login", pictureLoginHandler.Login)
 
 	mux.Handle("/home",
-		middleware.RequireRoles([]string{"student"})(http.HandlerFunc(homeHandler.HomePage)))
+		middleware.RequirePermission(entity.PermQuizSolve)(http.HandlerFunc(homeHandler.HomePage)))
 
 	mux.Handle("/equation",
-		middleware.RequireRoles([]string{"student"})(http.HandlerFunc(equationHandler.EquationHandler)))
+		middleware.RequirePermission(entity.PermQuizSolve)(http.HandlerFunc(equationHandler.EquationHandler)))
 
 	mux.Handle("/stats",
-		middleware.RequireRoles([]string{"student"})(http.HandlerFunc(statsHandler.StatsPage)))
+		middleware.RequirePermission(entity.PermQuizSolve)(http.HandlerFunc(statsHandler.StatsPage)))
 
 	mux.Handle("/api/check",
-		middleware.RequireRoles([]string{"student"})(http.HandlerFunc(equationHandler.CheckAnswersHandler)))
+		middleware.RequirePermission(entity.PermQuizSolve)(http.HandlerFunc(equationHandler.CheckAnswersHandler)))
+
+	mux.Handle("/api/check/item",
+		middleware.RequirePermission(entity.PermQuizSolve)(http.HandlerFunc(equationHandler.CheckItemHandler)))
+
+	mux.Handle("/offline",
+		middleware.RequirePermission(entity.PermQuizSolve)(http.HandlerFunc(offlineHandler.OfflinePage)))
+
+	mux.Handle("/api/offline/bundle",
+		middleware.RequirePermission(entity.PermQuizSolve)(http.HandlerFunc(offlineHandler.BundleHandler)))
+
+	mux.Handle("/api/offline/sync",
+		middleware.RequirePermission(entity.PermQuizSolve)(http.HandlerFunc(offlineHandler.SyncHandler)))
 
 	mux.Handle("/director",
-		middleware.RequireRoles([]string{"director"})(http.HandlerFunc(teacherHandlers.DirectorHome)))
+		middleware.RequirePermission(entity.PermSchoolStatsView)(http.HandlerFunc(teacherHandlers.DirectorHome)))
 
 	mux.Handle("/director/class",
-		middleware.RequireRoles([]string{"director"})(http.HandlerFunc(teacherHandlers.DirectorClassStats)))
+		middleware.RequirePermission(entity.PermSchoolStatsView)(http.HandlerFunc(teacherHandlers.DirectorClassStats)))
 
 	mux.Handle("/director/student",
-		middleware.RequireRoles([]string{"director"})(http.HandlerFunc(teacherHandlers.DirectorStudentStatistics)))
+		middleware.RequirePermission(entity.PermSchoolStatsView)(http.HandlerFunc(teacherHandlers.DirectorStudentStatistics)))
 
 	mux.Handle("/director/student/attempts",
-		middleware.RequireRoles([]string{"director"})(http.HandlerFunc(teacherHandlers.DirectorStudentAttemptsByType)))
+		middleware.RequirePermission(entity.PermSchoolStatsView)(http.HandlerFunc(teacherHandlers.DirectorStudentAttemptsByType)))
 
-	mux.Handle("/teacher/class", middleware.RequireRoles([]string{"teacher"})(http.HandlerFunc(teacherHandlers.ClassStatistics)))
+	mux.Handle("/teacher",
+		middleware.RequirePermission(entity.PermClassStatsView)(http.HandlerFunc(teacherHandlers.TeacherHome)))
+
+	mux.Handle("/teacher/class", middleware.RequirePermission(entity.PermClassStatsView)(http.HandlerFunc(teacherHandlers.ClassStatistics)))
 
 	mux.Handle("/teacher/student",
-		middleware.RequireRoles([]string{"teacher"})(http.HandlerFunc(teacherHandlers.StudentStatistics)))
+		middleware.RequirePermission(entity.PermClassStatsView)(http.HandlerFunc(teacherHandlers.StudentStatistics)))
 
 	mux.Handle("/teacher/student/attempts",
-		middleware.RequireRoles([]string{"teacher"})(http.HandlerFunc(teacherHandlers.StudentAttemptsByType)))
+		middleware.RequirePermission(entity.PermClassStatsView)(http.HandlerFunc(teacherHandlers.StudentAttemptsByType)))
+
+	mux.Handle("/teacher/student/unlock",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(teacherHandlers.UnlockStudent)))
+
+	mux.Handle("/teacher/student/reset-code",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(teacherHandlers.IssueResetCode)))
+
+	mux.Handle("/teacher/student/guardian-code",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(teacherHandlers.IssueGuardianCode)))
+
+	mux.Handle("/teacher/reset-codes",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(teacherHandlers.ResetCodes)))
+
+	mux.Handle("/teacher/student/picture-password",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(pictureLoginHandler.PicturePasswordPage)))
+
+	mux.Handle("/teacher/class/login-code",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(pictureLoginHandler.RotateClassCode)))
+
+	mux.Handle("/teacher/student/block",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(teacherHandlers.SetStudentBlocked)))
+
+	mux.Handle("/teacher/student/review",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(teacherHandlers.ReviewStudent)))
+
+	mux.Handle("/teacher/class/join-code",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(teacherHandlers.RotateJoinCode)))
+
+	mux.Handle("/teacher/student/export",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(teacherHandlers.ExportStudentData)))
+
+	mux.Handle("/teacher/student/erase",
+		middleware.RequirePermission(entity.PermClassStudentsManage)(http.HandlerFunc(teacherHandlers.EraseStudentData)))
+
+	// Кабинет родителя
+	mux.Handle("/parent",
+		middleware.RequirePermission(entity.PermChildrenView)(http.HandlerFunc(parentHandler.Home)))
+	mux.Handle("/parent/child",
+		middleware.RequirePermission(entity.PermChildrenView)(http.HandlerFunc(parentHandler.Child)))
+	mux.Handle("/parent/link",
+		middleware.RequirePermission(entity.PermChildrenView)(http.HandlerFunc(parentHandler.Link)))
+	mux.Handle("/parent/summary",
+		middleware.RequirePermission(entity.PermChildrenView)(http.HandlerFunc(parentHandler.SetSummary)))
 
 	mux.Handle("/logout",
 		middleware.RequireAuth(http.HandlerFunc(loginHandler.Logout)))
 
+	mux.Handle("/sessions",
+		middleware.RequireAuth(http.HandlerFunc(sessionHandler.SessionsPage)))
+	mux.Handle("/sessions/revoke",
+		middleware.RequireAuth(http.HandlerFunc(sessionHandler.Revoke)))
+	mux.Handle("/sessions/revoke-others",
+		middleware.RequireAuth(http.HandlerFunc(sessionHandler.RevokeOthers)))
+
 	// Админ-панель маршруты
 	mux.Handle("/admin",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.Dashboard)))
+		middleware.RequirePermission(entity.PermAdminPanel)(http.HandlerFunc(adminHandler.Dashboard)))
 	mux.Handle("/admin/dashboard",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.Dashboard)))
+		middleware.RequirePermission(entity.PermAdminPanel)(http.HandlerFunc(adminHandler.Dashboard)))
 
 	// Школы
 	mux.Handle("/admin/schools",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.Schools)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.Schools)))
 	mux.Handle("/admin/schools/new",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.SchoolForm)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.SchoolForm)))
 	mux.Handle("/admin/schools/edit",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.SchoolForm)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.SchoolForm)))
 	mux.Handle("/admin/schools/create",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.SchoolCreate)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.SchoolCreate)))
 	mux.Handle("/admin/schools/update",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.SchoolUpdate)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.SchoolUpdate)))
 	mux.Handle("/admin/schools/delete",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.SchoolDelete)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.SchoolDelete)))
 
 	// Классы
 	mux.Handle("/admin/classes",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.Classes)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.Classes)))
 	mux.Handle("/admin/classes/new",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.ClassForm)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.ClassForm)))
 	mux.Handle("/admin/classes/edit",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.ClassForm)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.ClassForm)))
 	mux.Handle("/admin/classes/create",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.ClassCreate)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.ClassCreate)))
 	mux.Handle("/admin/classes/update",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.ClassUpdate)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.ClassUpdate)))
 	mux.Handle("/admin/classes/delete",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.ClassDelete)))
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.ClassDelete)))
+	mux.Handle("/admin/classes/staff",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.ClassStaffSet)))
+	mux.Handle("/admin/classes/staff/remove",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.ClassStaffRemove)))
 
 	// Пользователи
 	mux.Handle("/admin/users",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.Users)))
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.Users)))
 	mux.Handle("/admin/users/new",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.UserForm)))
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserForm)))
 	mux.Handle("/admin/users/edit",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.UserForm)))
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserForm)))
 	mux.Handle("/admin/users/create",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.UserCreate)))
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserCreate)))
 	mux.Handle("/admin/users/update",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.UserUpdate)))
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserUpdate)))
 	mux.Handle("/admin/users/delete",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.UserDelete)))
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserDelete)))
+	mux.Handle("/admin/users/logout",
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserLogout)))
+	mux.Handle("/admin/users/block",
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserBlock)))
+	mux.Handle("/admin/users/unblock",
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserUnblock)))
+	mux.Handle("/admin/users/export",
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserExport)))
+	mux.Handle("/admin/users/erase",
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.UserErase)))
+
+	// Приглашения сотрудников
+	mux.Handle("/admin/invites",
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.Invites)))
+	mux.Handle("/admin/invites/create",
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.InviteCreate)))
+	mux.Handle("/admin/invites/revoke",
+		middleware.RequirePermission(entity.PermUsersManage)(http.HandlerFunc(adminHandler.InviteRevoke)))
+
+	// Роли и права
+	mux.Handle("/admin/roles",
+		middleware.RequirePermission(entity.PermRolesManage)(http.HandlerFunc(adminHandler.Roles)))
+	mux.Handle("/admin/roles/new",
+		middleware.RequirePermission(entity.PermRolesManage)(http.HandlerFunc(adminHandler.RoleForm)))
+	mux.Handle("/admin/roles/edit",
+		middleware.RequirePermission(entity.PermRolesManage)(http.HandlerFunc(adminHandler.RoleForm)))
+	mux.Handle("/admin/roles/create",
+		middleware.RequirePermission(entity.PermRolesManage)(http.HandlerFunc(adminHandler.RoleCreate)))
+	mux.Handle("/admin/roles/update",
+		middleware.RequirePermission(entity.PermRolesManage)(http.HandlerFunc(adminHandler.RoleUpdate)))
+	mux.Handle("/admin/roles/delete",
+		middleware.RequirePermission(entity.PermRolesManage)(http.HandlerFunc(adminHandler.RoleDelete)))
+
+	// Провайдеры единого входа
+	mux.Handle("/admin/sso",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.OIDCProviders)))
+	mux.Handle("/admin/sso/new",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.OIDCProviderForm)))
+	mux.Handle("/admin/sso/edit",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.OIDCProviderForm)))
+	mux.Handle("/admin/sso/create",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.OIDCProviderCreate)))
+	mux.Handle("/admin/sso/update",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.OIDCProviderUpdate)))
+	mux.Handle("/admin/sso/delete",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.OIDCProviderDelete)))
+
+	// Журнал аудита
+	mux.Handle("/admin/audit",
+		middleware.RequirePermission(entity.PermAuditView)(http.HandlerFunc(adminHandler.Audit)))
+	mux.Handle("/admin/audit/export",
+		middleware.RequirePermission(entity.PermAuditView)(http.HandlerFunc(adminHandler.AuditExport)))
+
+	// Корзина: видимость и восстановление проверяются по виду объекта
+	mux.Handle("/admin/trash",
+		middleware.RequirePermission(entity.PermAdminPanel)(http.HandlerFunc(adminHandler.Trash)))
+	mux.Handle("/admin/trash/restore",
+		middleware.RequirePermission(entity.PermAdminPanel)(http.HandlerFunc(adminHandler.TrashRestore)))
+
+	// Учебные годы
+	mux.Handle("/admin/years",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.Years)))
+	mux.Handle("/admin/years/rollover",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.YearRolloverForm)))
+	mux.Handle("/admin/years/rollover/confirm",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.YearRollover)))
+	mux.Handle("/admin/years/view",
+		middleware.RequirePermission(entity.PermSchoolsManage)(http.HandlerFunc(adminHandler.YearView)))
 
 	// Типы уравнений
 	mux.Handle("/admin/equation-types",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.EquationTypes)))
+		middleware.RequirePermission(entity.PermEquationTypesManage)(http.HandlerFunc(adminHandler.EquationTypes)))
 	mux.Handle("/admin/equation-types/new",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.EquationTypeForm)))
+		middleware.RequirePermission(entity.PermEquationTypesManage)(http.HandlerFunc(adminHandler.EquationTypeForm)))
 	mux.Handle("/admin/equation-types/edit",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.EquationTypeForm)))
+		middleware.RequirePermission(entity.PermEquationTypesManage)(http.HandlerFunc(adminHandler.EquationTypeForm)))
 	mux.Handle("/admin/equation-types/create",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.EquationTypeCreate)))
+		middleware.RequirePermission(entity.PermEquationTypesManage)(http.HandlerFunc(adminHandler.EquationTypeCreate)))
 	mux.Handle("/admin/equation-types/update",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.EquationTypeUpdate)))
+		middleware.RequirePermission(entity.PermEquationTypesManage)(http.HandlerFunc(adminHandler.EquationTypeUpdate)))
 	mux.Handle("/admin/equation-types/delete",
-		middleware.RequireRoles([]string{"admin"})(http.HandlerFunc(adminHandler.EquationTypeDelete)))
+		middleware.RequirePermission(entity.PermEquationTypesManage)(http.HandlerFunc(adminHandler.EquationTypeDelete)))
+
+	// Контекст всех запросов: отменяется, если они не успели завершиться при остановке сервера
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	server := &http.Server{
 		Addr:         ":" + port,
-		Handler:      mux,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
+		Handler:      middleware.RealIP(trustedProxies)(middleware.PublicURL(publicURL)(middleware.CSRF(middleware.ValidateSession(sessionRepo)(middleware.LoadPermissions(permissionRepo)(mux))))),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  120 * time.Second,
@@ -203,19 +439,108 @@ func main() {
 		}
 	}()
 
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go cleanupExpiredSessions(cleanupCtx, sessionRepo, internal.SessionCleanupInterval)
+	go generateWeeklySummaries(cleanupCtx, guardianRepo, internal.WeeklySummaryInterval)
+	go purgeTrash(cleanupCtx, trashRepo, internal.TrashRetention, internal.TrashPurgeInterval)
+
 	signalChan := make(chan os.Signal, 1)
 
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 	<-signalChan
 
 	slog.Info("server is shutting down")
+	stopCleanup()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), internal.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
 		slog.Error("server forced to shutdown", "error", err)
+		cancelRequests()
 	}
 
 	slog.Info("server exiting")
 }
+
+// envDuration читает длительность вида "5s" из переменной окружения, при ошибке - значение по умолчанию
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		slog.Warn("invalid duration, using default", "name", name, "value", v, "default", def)
+		return def
+	}
+	return d
+}
+
+// cleanupExpiredSessions периодически удаляет истекшие строки user_sessions
+func cleanupExpiredSessions(ctx context.Context, sessionRepo repository.Sessions, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := sessionRepo.DeleteExpired(ctx)
+			if err != nil {
+				slog.Error("failed to delete expired sessions", "error", err)
+				continue
+			}
+			if deleted > 0 {
+				slog.Info("expired sessions deleted", "count", deleted)
+			}
+		}
+	}
+}
+
+// generateWeeklySummaries периодически подводит итоги прошедшей недели для родителей.
+// Сводка за неделю создается один раз, повторные запуски ничего не меняют.
+func generateWeeklySummaries(ctx context.Context, guardianRepo repository.Guardians, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			created, err := guardianRepo.GenerateWeeklySummaries(ctx)
+			if err != nil {
+				slog.Error("failed to generate weekly summaries", "error", err)
+				continue
+			}
+			if created > 0 {
+				slog.Info("weekly summaries generated", "count", created)
+			}
+		}
+	}
+}
+
+// purgeTrash периодически окончательно удаляет объекты, пролежавшие в корзине дольше retention
+func purgeTrash(ctx context.Context, trashRepo repository.Trash, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := trashRepo.Purge(ctx, time.Now().Add(-retention))
+			if err != nil {
+				slog.Error("failed to purge trash", "error", err)
+				continue
+			}
+			if purged > 0 {
+				slog.Info("trash purged", "count", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"edugame/internal/database"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `Использование: server migrate <команда>
+
+Команды:
+  up          применить все новые миграции
+  down [N]    откатить N последних миграций (по умолчанию 1)
+  status      показать примененные и ожидающие миграции
+
+Демо-данные для разработки загружает команда seed.`
+
+// runMigrate выполняет подкоманду migrate и возвращает код завершения
+func runMigrate(db *sql.DB, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(db)
+		for _, m := range applied {
+			fmt.Printf("применена %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка миграции: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("новых миграций нет")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "N должно быть положительным числом")
+				return 2
+			}
+			steps = n
+		}
+
+		reverted, err := database.MigrateDown(db, steps)
+		for _, m := range reverted {
+			fmt.Printf("откачена %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка отката: %v\n", err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("нет примененных миграций")
+		}
+
+	case "status":
+		statuses, err := database.MigrationStatuses(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка получения статуса: %v\n", err)
+			return 1
+		}
+		for _, s := range statuses {
+			switch {
+			case s.AppliedAt == nil:
+				fmt.Printf("%04d_%s\tожидает\n", s.Version, s.Name)
+			case s.Name == "":
+				fmt.Printf("%04d\tприменена %s, нет в этой сборке\n", s.Version, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			default:
+				fmt.Printf("%04d_%s\tприменена %s\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			}
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
+
+// warnPendingMigrations предупреждает в логе, что схема базы отстает от сборки
+func warnPendingMigrations(db *sql.DB) {
+	statuses, err := database.MigrationStatuses(db)
+	if err != nil {
+		slog.Error("failed to check migrations", "error", err)
+		return
+	}
+
+	pending := 0
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+
+	if pending > 0 {
+		slog.Warn("database schema is out of date, run \"migrate up\" or set AUTO_MIGRATE=true", "pending", pending)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/repository"
+	"edugame/internal/seed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+const seedUsage = `Использование: server seed [-weeks N] [-students N] [-seed N] [-force]
+
+Создает демо-школы, классы, учителей и учеников с паролем "` + seed.Password + `"
+и историю попыток за несколько недель. Запускать после "migrate up".`
+
+// runSeed выполняет подкоманду seed и возвращает код завершения
+func runSeed(db *sql.DB, args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, seedUsage)
+		fs.PrintDefaults()
+	}
+	weeks := fs.Int("weeks", 6, "недель истории попыток")
+	students := fs.Int("students", 12, "учеников в каждом классе")
+	seedValue := fs.Int64("seed", 1, "зерно случайности: одинаковое зерно дает одинаковые данные")
+	force := fs.Bool("force", false, "разрешить запуск при ENVIRONMENT=production")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if os.Getenv("ENVIRONMENT") == "production" && !*force {
+		fmt.Fprintln(os.Stderr, "ENVIRONMENT=production: демо-данные не загружаются без -force")
+		return 1
+	}
+
+	// Генератор пишет в лог каждую попытку подобрать пример - тысячи строк
+	log.SetOutput(io.Discard)
+
+	// Наполнение идет одной долгой серией запросов, ограничения времени запросов не нужны
+	timeouts := repository.QueryTimeouts{}
+	repos := seed.Repos{
+		Schools:   repository.NewSchoolRepository(db, timeouts),
+		Classes:   repository.NewClassRepository(db, timeouts),
+		Staff:     repository.NewClassStaffRepository(db, timeouts),
+		Users:     repository.NewUserRepository(db, timeouts),
+		Guardians: repository.NewGuardianRepository(db, timeouts),
+		Types:     repository.NewTypeRepository(db, timeouts),
+		Attempts:  repository.NewAttemptRepository(db, timeouts),
+	}
+
+	result, err := seed.Run(context.Background(), repos, seed.Options{
+		Weeks:            *weeks,
+		StudentsPerClass: *students,
+		Seed:             *seedValue,
+	})
+	if errors.Is(err, seed.ErrAlreadySeeded) {
+		fmt.Println("демо-данные уже загружены")
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка загрузки демо-данных: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("школ: %d, классов: %d, учеников: %d, попыток: %d\n\n",
+		result.Schools, result.Classes, len(result.Students()), result.Attempts)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ЛОГИН\tРОЛЬ\tКЛАСС\tИМЯ")
+	for _, a := range result.Accounts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Username, a.Role, a.Class, a.FullName)
+	}
+	tw.Flush()
+	fmt.Printf("\nпароль всех учетных записей: %s\n", seed.Password)
+
+	return 0
+}
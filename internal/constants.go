@@ -1,9 +1,109 @@
 package internal
 
+import "time"
+
 const (
 	CountEqs = 10
 )
 
+const (
+	// MaxItemTries - количество попыток ответа на один пример при поштучной проверке
+	MaxItemTries = 1
+)
+
+const (
+	// OfflineBundleSize - количество примеров в офлайн-наборе по умолчанию
+	OfflineBundleSize    = 50
+	OfflineBundleMaxSize = 200
+	// OfflineBundleTTL - срок, в течение которого ответы из набора принимаются к синхронизации
+	OfflineBundleTTL = 7 * 24 * time.Hour
+	// OfflineClockSkew - допустимое расхождение часов устройства и сервера
+	OfflineClockSkew = 5 * time.Minute
+)
+
+const (
+	// Ограничение подбора паролей: задержка растет экспоненциально после бесплатных попыток
+	LoginUserFreeAttempts = 3
+	LoginIPFreeAttempts   = 30 // за одним IP школы может быть целый класс
+	LoginBackoffBase      = 2 * time.Second
+	LoginBackoffMax       = 15 * time.Minute
+	LoginFailureWindow    = 30 * time.Minute
+	// Временная блокировка учетной записи после серии неудачных входов
+	AccountLockThreshold = 10
+	AccountLockDuration  = 30 * time.Minute
+)
+
+const (
+	// SessionTTL - срок жизни сессии без активности (продлевается при каждом запросе)
+	SessionTTL = 24 * time.Hour
+	// SessionTouchInterval - как часто записывать в БД продление сессии
+	SessionTouchInterval = time.Minute
+	// SessionCleanupInterval - период удаления истекших сессий
+	SessionCleanupInterval = time.Hour
+)
+
+const (
+	// PasswordResetCodeTTL - срок действия кода сброса пароля, выданного учителем
+	PasswordResetCodeTTL = 48 * time.Hour
+	// PasswordMinLength - минимальная длина нового пароля
+	PasswordMinLength = 6
+	// Попытки ввода кода сброса с одного IP
+	PasswordResetIPFreeAttempts = 10
+)
+
+const (
+	// Вход по картинкам: секрет - последовательность из 3-4 картинок
+	PictureSecretMinLength = 3
+	PictureSecretMaxLength = 4
+	// Картинок мало, поэтому задержки строже, чем для пароля
+	PictureFreeAttempts  = 3
+	PictureBackoffBase   = 30 * time.Second
+	PictureBackoffMax    = time.Hour
+	PictureFailureWindow = 24 * time.Hour
+	ClassLoginCodeLength = 6
+)
+
+const (
+	// ClassJoinCodeLength - длина кода класса для регистрации учеников
+	ClassJoinCodeLength = 6
+	// StaffInviteTTL - срок действия ссылки-приглашения для сотрудника
+	StaffInviteTTL = 7 * 24 * time.Hour
+)
+
+const (
+	// GuardianCodeTTL - срок действия кода привязки родителя, выданного учителем
+	GuardianCodeTTL = 7 * 24 * time.Hour
+	// WeeklySummaryInterval - как часто проверять, не пора ли подвести итоги недели для родителей
+	WeeklySummaryInterval = time.Hour
+	// Попытки ввода кода привязки с одного IP
+	GuardianCodeIPFreeAttempts = 10
+)
+
+const (
+	// OIDCFlowTTL - сколько ждем возврата пользователя от провайдера единого входа
+	OIDCFlowTTL = 10 * time.Minute
+	// OIDCDiscoveryTTL - как долго используем метаданные провайдера без повторного discovery
+	OIDCDiscoveryTTL = time.Hour
+	// OIDCHTTPTimeout - таймаут запросов к провайдеру
+	OIDCHTTPTimeout = 10 * time.Second
+)
+
+const (
+	// DBQueryTimeout - предельное время обычного запроса к БД (DB_QUERY_TIMEOUT)
+	DBQueryTimeout = 5 * time.Second
+	// DBReportTimeout - предельное время отчетов статистики (DB_REPORT_TIMEOUT), меньше WriteTimeout сервера
+	DBReportTimeout = 20 * time.Second
+	// ShutdownTimeout - сколько ждем завершения запросов при остановке; затем их запросы к БД отменяются
+	ShutdownTimeout = 5 * time.Second
+)
+
+const (
+	// TrashRetention - сколько удаленные школы, классы, пользователи и типы уравнений лежат в корзине
+	TrashRetention = 30 * 24 * time.Hour
+	// TrashPurgeInterval - период окончательного удаления объектов с истекшим сроком хранения
+	TrashPurgeInterval = time.Hour
+)
+
 const (
 	SumSimbol  = "+"
 	SubSimbol  = "-"
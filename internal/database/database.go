@@ -9,31 +9,30 @@ import (
 	_ "github.com/lib/pq"
 )
 
-var DB *sql.DB
-
-func InitDB(connStr string) error {
-	var err error
-	DB, err = sql.Open("postgres", connStr)
+// InitDB открывает пул соединений с PostgreSQL и проверяет подключение
+func InitDB(connStr string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connStr)
 	if err != nil {
-		return fmt.Errorf("ошибка подключения к БД: %v", err)
+		return nil, fmt.Errorf("ошибка подключения к БД: %v", err)
 	}
 
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(25)
-	DB.SetConnMaxLifetime(5 * time.Minute)
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	db.SetConnMaxLifetime(5 * time.Minute)
 
-	err = DB.Ping()
+	err = db.Ping()
 	if err != nil {
-		return fmt.Errorf("ошибка ping БД: %v", err)
+		db.Close()
+		return nil, fmt.Errorf("ошибка ping БД: %v", err)
 	}
 
 	log.Println("База данных подключена успешно")
-	return nil
+	return db, nil
 }
 
-func CloseDB() {
-	if DB != nil {
-		DB.Close()
+func CloseDB(db *sql.DB) {
+	if db != nil {
+		db.Close()
 		log.Println("Соединение с БД закрыто")
 	}
 }
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d, versions must go without gaps", i, m.Version)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("migration %04d_%s: empty up or down", m.Version, m.Name)
+		}
+	}
+}
+
+// Уже примененная миграция пропускается, новая выполняется и записывается в schema_migrations
+func TestMigrateUpSkipsApplied(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	for i, m := range migrations {
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM schema_migrations`).
+			WithArgs(m.Version).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(i == 0))
+		if i == 0 {
+			mock.ExpectRollback()
+			continue
+		}
+		mock.ExpectExec(`.+`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO schema_migrations`).
+			WithArgs(m.Version, m.Name).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	applied, err := MigrateUp(db)
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if len(applied) != len(migrations)-1 {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(migrations)-1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+var (
+	sqlComment    = regexp.MustCompile(`--[^\n]*`)
+	createTableRe = regexp.MustCompile(`(?s)CREATE TABLE(?: IF NOT EXISTS)?\s+(\w+)\s*\((.*?)\n\);`)
+	addColumnRe   = regexp.MustCompile(`ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+	tableClauses  = map[string]bool{"PRIMARY": true, "UNIQUE": true, "FOREIGN": true, "CONSTRAINT": true, "CHECK": true}
+)
+
+// tableColumns возвращает столбцы из CREATE TABLE: таблица -> множество столбцов
+func tableColumns(schema string) map[string]map[string]bool {
+	schema = sqlComment.ReplaceAllString(schema, "")
+
+	tables := make(map[string]map[string]bool)
+	for _, m := range createTableRe.FindAllStringSubmatch(schema, -1) {
+		columns := make(map[string]bool)
+		depth, start := 0, 0
+		body := m[2] + ","
+		for i, ch := range body {
+			switch ch {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			case ',':
+				if depth > 0 {
+					continue
+				}
+				if fields := strings.Fields(body[start:i]); len(fields) > 0 && !tableClauses[strings.ToUpper(fields[0])] {
+					columns[fields[0]] = true
+				}
+				start = i + 1
+			}
+		}
+		tables[m[1]] = columns
+	}
+	return tables
+}
+
+// База, созданная вручную из schemas.sql, принимается миграцией 0001: каждый столбец,
+// которого там не было, должен добавляться через ADD COLUMN IF NOT EXISTS
+func TestSchemaMigrationAdoptsLegacyDatabase(t *testing.T) {
+	legacy, err := os.ReadFile("testdata/schemas_legacy.sql")
+	if err != nil {
+		t.Fatalf("read legacy schema: %v", err)
+	}
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	schema := migrations[0].Up
+
+	added := make(map[string]bool)
+	for _, m := range addColumnRe.FindAllStringSubmatch(schema, -1) {
+		added[m[1]+"."+m[2]] = true
+	}
+
+	current := tableColumns(schema)
+	for table, old := range tableColumns(string(legacy)) {
+		columns, ok := current[table]
+		if !ok {
+			t.Errorf("table %s from schemas.sql is missing in migration 0001", table)
+			continue
+		}
+		for column := range columns {
+			if !old[column] && !added[table+"."+column] {
+				t.Errorf("column %s.%s is not added to databases created from schemas.sql", table, column)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+-- Удаление всей схемы. Все данные будут потеряны.
+
+DROP TABLE IF EXISTS class_staff CASCADE;
+DROP TABLE IF EXISTS weekly_summaries CASCADE;
+DROP TABLE IF EXISTS guardian_codes CASCADE;
+DROP TABLE IF EXISTS guardians CASCADE;
+DROP TABLE IF EXISTS user_identities CASCADE;
+DROP TABLE IF EXISTS oidc_providers CASCADE;
+DROP TABLE IF EXISTS audit_log CASCADE;
+DROP TABLE IF EXISTS role_permissions CASCADE;
+DROP TABLE IF EXISTS permissions CASCADE;
+DROP TABLE IF EXISTS staff_invites CASCADE;
+DROP TABLE IF EXISTS password_reset_codes CASCADE;
+DROP TABLE IF EXISTS login_throttles CASCADE;
+DROP TABLE IF EXISTS offline_bundles CASCADE;
+DROP TABLE IF EXISTS user_sessions CASCADE;
+DROP TABLE IF EXISTS user_progress CASCADE;
+DROP TABLE IF EXISTS attempts CASCADE;
+DROP TABLE IF EXISTS student_classes CASCADE;
+DROP TABLE IF EXISTS classes CASCADE;
+DROP TABLE IF EXISTS users CASCADE;
+DROP TABLE IF EXISTS operand_ranges CASCADE;
+DROP TABLE IF EXISTS equation_types CASCADE;
+DROP TABLE IF EXISTS schools CASCADE;
+DROP TABLE IF EXISTS roles CASCADE;
+
+DROP FUNCTION IF EXISTS audit_log_append_only();
+DROP FUNCTION IF EXISTS create_user_progress_for_new_student();
+DROP FUNCTION IF EXISTS create_progress_when_student_added_to_class();
+DROP FUNCTION IF EXISTS create_user_progress_for_new_equation_type();
+DROP FUNCTION IF EXISTS sync_equation_type_availability();
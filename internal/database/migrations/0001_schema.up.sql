@@ -0,0 +1,466 @@
+-- Схема базы данных.
+-- Таблицы создаются с IF NOT EXISTS, чтобы миграцию можно было применить и к базе,
+-- созданной до появления миграций вручную из schemas.sql.
+
+-- 1. Таблица ролей
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    description VARCHAR(200) NOT NULL DEFAULT '',
+    is_system BOOLEAN NOT NULL DEFAULT FALSE, -- Встроенные роли нельзя изменить или удалить из админки
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 2. Таблица школ
+CREATE TABLE IF NOT EXISTS schools (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(256) NOT NULL,
+    address TEXT,
+    phone VARCHAR(50),
+    email VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 3. Таблица типов уравнений
+CREATE TABLE IF NOT EXISTS equation_types (
+    id SERIAL PRIMARY KEY,
+    class INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+
+    -- Поля для генерации
+    operation VARCHAR(10) NOT NULL, -- '+', '-', '*', '/', '+-' (значит, случайный выбор + или -)
+    num_operands INTEGER NOT NULL DEFAULT 2,
+
+    -- Специальные условия
+    no_remainder BOOLEAN DEFAULT FALSE,
+    result_max INTEGER DEFAULT NULL, -- Ограничение на результат (например, "до 90")
+
+    is_available BOOLEAN NOT NULL DEFAULT TRUE, -- Тип доступен ученикам
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 4. Таблица диапазонов операндов
+CREATE TABLE IF NOT EXISTS operand_ranges (
+    id SERIAL PRIMARY KEY,
+    equation_type_id INTEGER NOT NULL REFERENCES equation_types(id) ON DELETE CASCADE,
+    operand_order INTEGER NOT NULL CHECK (operand_order >= 1),
+    min_value INTEGER DEFAULT 0 NOT NULL,
+    max_value INTEGER DEFAULT 0 NOT NULL,
+    UNIQUE(equation_type_id, operand_order)
+);
+
+-- 5. Таблица пользователей
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(200) UNIQUE NOT NULL,
+    fullname VARCHAR(256) NOT NULL,
+    password_hash VARCHAR(100) NOT NULL,
+    role_id INTEGER NOT NULL REFERENCES roles(id) DEFAULT 1,
+    email VARCHAR(100),
+    school_id INT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    blocked BOOLEAN NOT NULL DEFAULT FALSE,
+    blocked_reason TEXT,                           -- Причина блокировки
+    blocked_at TIMESTAMP,                          -- Когда заблокирован
+    blocked_by INTEGER,                            -- Кто заблокировал
+    failed_login_count INTEGER NOT NULL DEFAULT 0, -- Неудачные входы подряд
+    locked_until TIMESTAMP,                        -- Временная блокировка входа
+    picture_password_hash VARCHAR(100),            -- Вход по картинкам для младших школьников
+    pending BOOLEAN NOT NULL DEFAULT FALSE,        -- Заявка ученика ждет подтверждения учителя
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 6. Таблица классов
+CREATE TABLE IF NOT EXISTS classes (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    grade INTEGER,
+    teacher_id INTEGER REFERENCES users(id),
+    school_id INTEGER REFERENCES schools(id) ON DELETE CASCADE,
+    login_code VARCHAR(12) UNIQUE, -- Код класса для входа по картинкам
+    join_code VARCHAR(12) UNIQUE,  -- Код для самостоятельной регистрации учеников
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 7. Связь учеников с классами
+CREATE TABLE IF NOT EXISTS student_classes (
+    student_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    class_id INTEGER REFERENCES classes(id) ON DELETE CASCADE,
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (student_id, class_id)
+);
+
+-- 8. Таблица попыток
+CREATE TABLE IF NOT EXISTS attempts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+
+    -- Тип уравнения
+    equation_type_id INTEGER REFERENCES equation_types(id) ON DELETE SET NULL,
+
+    -- Само уравнение и ответы
+    equation_text TEXT NOT NULL,
+    correct_answer VARCHAR(50) NOT NULL,
+    user_answer VARCHAR(50),
+    is_correct BOOLEAN NOT NULL DEFAULT FALSE,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 9. Таблица прогресса пользователя по типам уравнений
+CREATE TABLE IF NOT EXISTS user_progress (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    equation_type_id INTEGER REFERENCES equation_types(id) ON DELETE SET NULL,
+
+    -- Статистика по конкретному типу
+    attempts_count INTEGER DEFAULT 0,
+    correct_count INTEGER DEFAULT 0,
+
+    -- Доступность типа ученику
+    is_unlocked BOOLEAN NOT NULL DEFAULT FALSE,
+    first_unlocked_at TIMESTAMP,
+
+    -- Последняя активность
+    last_attempt_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE(user_id, equation_type_id)
+);
+
+-- 10. Таблица сессий для авторизации
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    session_token VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 от токена из cookie
+    user_agent VARCHAR(500) NOT NULL DEFAULT '',
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- 11. Офлайн-наборы примеров (верные ответы хранятся только здесь)
+CREATE TABLE IF NOT EXISTS offline_bundles (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    items JSONB NOT NULL,
+    issued_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    synced_at TIMESTAMP
+);
+
+-- 12. Задержки после неудачных входов (по логину и по IP)
+CREATE TABLE IF NOT EXISTS login_throttles (
+    throttle_key VARCHAR(300) PRIMARY KEY, -- 'user:<логин>' или 'ip:<адрес>'
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP,
+    blocked_until TIMESTAMP
+);
+
+-- 13. Одноразовые коды сброса пароля, выданные учителем (журнал выдачи)
+CREATE TABLE IF NOT EXISTS password_reset_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 от кода
+    issued_by INTEGER NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    used_ip VARCHAR(64),
+    revoked_at TIMESTAMP
+);
+
+-- 14. Приглашения сотрудников (учителей, директоров, администраторов)
+CREATE TABLE IF NOT EXISTS staff_invites (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 от токена из ссылки
+    role_id INTEGER NOT NULL REFERENCES roles(id),
+    school_id INTEGER REFERENCES schools(id) ON DELETE CASCADE,
+    note VARCHAR(200) NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    used_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP
+);
+
+-- 15. Права доступа
+CREATE TABLE IF NOT EXISTS permissions (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(64) UNIQUE NOT NULL, -- Например, class.stats.view
+    description VARCHAR(200) NOT NULL DEFAULT ''
+);
+
+-- 16. Права ролей
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+-- 17. Журнал аудита (только добавление записей)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id INTEGER,                     -- Без внешнего ключа: запись должна пережить удаление пользователя
+    actor_name VARCHAR(200) NOT NULL DEFAULT '',
+    action VARCHAR(64) NOT NULL,          -- Например, school.delete
+    target_type VARCHAR(32) NOT NULL,
+    target_id INTEGER,
+    before_state JSONB,
+    after_state JSONB,
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log допускает только добавление записей';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+-- 18. Провайдеры единого входа (OpenID Connect), настраиваются для каждой школы
+CREATE TABLE IF NOT EXISTS oidc_providers (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(50) UNIQUE NOT NULL,         -- Идентификатор в адресе входа
+    name VARCHAR(100) NOT NULL,               -- Название на кнопке входа
+    school_id INTEGER REFERENCES schools(id) ON DELETE CASCADE,
+    issuer VARCHAR(500) NOT NULL,
+    client_id VARCHAR(200) NOT NULL,
+    client_secret VARCHAR(500) NOT NULL DEFAULT '',
+    scopes VARCHAR(200) NOT NULL DEFAULT 'openid profile',
+    username_claim VARCHAR(100) NOT NULL DEFAULT 'preferred_username',
+    name_claim VARCHAR(100) NOT NULL DEFAULT 'name',
+    role_claim VARCHAR(100) NOT NULL DEFAULT 'roles',
+    role_mapping JSONB NOT NULL DEFAULT '{}',  -- Значение утверждения -> имя роли
+    default_role VARCHAR(50) NOT NULL DEFAULT '',
+    allow_provisioning BOOLEAN NOT NULL DEFAULT FALSE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 19. Привязка пользователей к учетным записям провайдеров
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider_id INTEGER NOT NULL REFERENCES oidc_providers(id) ON DELETE CASCADE,
+    subject VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    UNIQUE (provider_id, subject)
+);
+
+-- 20. Родители (законные представители) и их дети
+CREATE TABLE IF NOT EXISTS guardians (
+    parent_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weekly_summary BOOLEAN NOT NULL DEFAULT FALSE, -- Получать еженедельную сводку
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (parent_id, student_id)
+);
+
+-- 21. Коды привязки родителя к ученику, выданные учителем
+CREATE TABLE IF NOT EXISTS guardian_codes (
+    id SERIAL PRIMARY KEY,
+    code_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 от кода
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issued_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    used_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP
+);
+
+-- 22. Еженедельные сводки для родителей
+CREATE TABLE IF NOT EXISTS weekly_summaries (
+    parent_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    week_start DATE NOT NULL,             -- Понедельник недели
+    sessions INTEGER NOT NULL DEFAULT 0,
+    perfect_sessions INTEGER NOT NULL DEFAULT 0,
+    correct INTEGER NOT NULL DEFAULT 0,
+    total INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (parent_id, student_id, week_start)
+);
+
+-- 23. Сотрудники класса: ведущий учитель, ассистенты и наблюдатели.
+-- По этой таблице проверяется доступ к классу; classes.teacher_id - ведущий учитель для списков.
+CREATE TABLE IF NOT EXISTS class_staff (
+    class_id INTEGER NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('lead', 'assistant', 'viewer')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (class_id, user_id)
+);
+
+-- Столбцы, которых не было в schemas.sql: добавляются в уже существующие таблицы
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS description VARCHAR(200) NOT NULL DEFAULT '';
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS is_system BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE equation_types ADD COLUMN IF NOT EXISTS is_available BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE equation_types ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE users ALTER COLUMN blocked SET DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email VARCHAR(100);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_reason TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_by INTEGER;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS picture_password_hash VARCHAR(100);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS school_id INTEGER REFERENCES schools(id) ON DELETE CASCADE;
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS login_code VARCHAR(12) UNIQUE;
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS join_code VARCHAR(12) UNIQUE;
+-- Сессии из schemas.sql не хранили токен, войти по ним все равно нельзя
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS session_token VARCHAR(64);
+DELETE FROM user_sessions WHERE session_token IS NULL;
+ALTER TABLE user_sessions ALTER COLUMN session_token SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS user_sessions_session_token_key ON user_sessions(session_token);
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS user_agent VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS ip_address VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE attempts ADD COLUMN IF NOT EXISTS is_correct BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_progress ADD COLUMN IF NOT EXISTS is_unlocked BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_progress ADD COLUMN IF NOT EXISTS first_unlocked_at TIMESTAMP;
+ALTER TABLE user_progress ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE user_progress ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+-- Индексы
+CREATE INDEX IF NOT EXISTS idx_attempts_user_id ON attempts(user_id);
+CREATE INDEX IF NOT EXISTS idx_attempts_equation_type_id ON attempts(equation_type_id);
+CREATE INDEX IF NOT EXISTS idx_attempts_created_at ON attempts(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_attempts_is_correct ON attempts(is_correct);
+CREATE INDEX IF NOT EXISTS idx_user_progress_user_id ON user_progress(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_progress_type_id ON user_progress(equation_type_id);
+CREATE INDEX IF NOT EXISTS idx_users_role_id ON users(role_id);
+CREATE INDEX IF NOT EXISTS idx_classes_school_id ON classes(school_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_token ON user_sessions(session_token);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires_at ON user_sessions(expires_at);
+CREATE INDEX IF NOT EXISTS idx_offline_bundles_user_id ON offline_bundles(user_id);
+CREATE INDEX IF NOT EXISTS idx_password_reset_codes_user_id ON password_reset_codes(user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+CREATE INDEX IF NOT EXISTS idx_guardians_student_id ON guardians(student_id);
+CREATE INDEX IF NOT EXISTS idx_guardian_codes_student_id ON guardian_codes(student_id);
+CREATE INDEX IF NOT EXISTS idx_class_staff_user_id ON class_staff(user_id);
+
+-- Функция для обработки создания ученика
+CREATE OR REPLACE FUNCTION create_user_progress_for_new_student()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Для учеников НЕ создаем прогресс при регистрации
+    -- Прогресс будет создаваться, когда ученика добавят в класс
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Триггер на вставку пользователя (ученика)
+DROP TRIGGER IF EXISTS trigger_create_user_progress ON users;
+CREATE TRIGGER trigger_create_user_progress
+AFTER INSERT ON users
+FOR EACH ROW
+WHEN (NEW.role_id = 1)
+EXECUTE FUNCTION create_user_progress_for_new_student();
+
+-- Функция для обработки добавления ученика в класс
+CREATE OR REPLACE FUNCTION create_progress_when_student_added_to_class()
+RETURNS TRIGGER AS $$
+DECLARE
+    class_grade INTEGER;
+BEGIN
+    -- Получаем уровень (grade) класса
+    SELECT grade INTO class_grade FROM classes WHERE id = NEW.class_id;
+
+    -- Для каждого типа уравнения, который соответствует уровню класса
+    INSERT INTO user_progress (user_id, equation_type_id, is_unlocked, first_unlocked_at)
+    SELECT NEW.student_id, et.id, et.is_available, CURRENT_TIMESTAMP
+    FROM equation_types et
+    WHERE et.class = class_grade
+    ON CONFLICT (user_id, equation_type_id) DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Триггер на добавление ученика в класс
+DROP TRIGGER IF EXISTS trigger_create_progress_on_class_assignment ON student_classes;
+CREATE TRIGGER trigger_create_progress_on_class_assignment
+AFTER INSERT ON student_classes
+FOR EACH ROW
+EXECUTE FUNCTION create_progress_when_student_added_to_class();
+
+-- Функция для обработки создания типа уравнения
+CREATE OR REPLACE FUNCTION create_user_progress_for_new_equation_type()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Для каждого ученика, который находится в классе с таким уровнем
+    INSERT INTO user_progress (user_id, equation_type_id, is_unlocked, first_unlocked_at)
+    SELECT sc.student_id, NEW.id, NEW.is_available, CURRENT_TIMESTAMP
+    FROM student_classes sc
+    JOIN classes c ON c.id = sc.class_id
+    WHERE c.grade = NEW.class
+      AND EXISTS (SELECT 1 FROM users u WHERE u.id = sc.student_id AND u.role_id = 1)
+    ON CONFLICT (user_id, equation_type_id) DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Триггер на вставку типа уравнения
+DROP TRIGGER IF EXISTS trigger_create_user_progress_for_eq_type ON equation_types;
+CREATE TRIGGER trigger_create_user_progress_for_eq_type
+AFTER INSERT ON equation_types
+FOR EACH ROW
+EXECUTE FUNCTION create_user_progress_for_new_equation_type();
+
+CREATE OR REPLACE FUNCTION sync_equation_type_availability()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Если изменился статус доступности
+    IF OLD.is_available IS DISTINCT FROM NEW.is_available THEN
+        -- Обновляем статус разблокировки у всех пользователей
+        UPDATE user_progress
+        SET is_unlocked = NEW.is_available,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE equation_type_id = NEW.id;
+
+        -- Если тип стал доступным, устанавливаем дату первого разблокирования
+        IF NEW.is_available = TRUE AND OLD.is_available = FALSE THEN
+            UPDATE user_progress
+            SET first_unlocked_at = CURRENT_TIMESTAMP
+            WHERE equation_type_id = NEW.id
+              AND first_unlocked_at IS NULL;
+        END IF;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Триггер на обновление equation_types
+DROP TRIGGER IF EXISTS trigger_sync_equation_type_availability ON equation_types;
+CREATE TRIGGER trigger_sync_equation_type_availability
+AFTER UPDATE ON equation_types
+FOR EACH ROW
+WHEN (OLD.is_available IS DISTINCT FROM NEW.is_available)
+EXECUTE FUNCTION sync_equation_type_availability();
+
+-- Ведущие учителя уже существующих классов становятся сотрудниками своих классов
+INSERT INTO class_staff (class_id, user_id, role)
+SELECT id, teacher_id, 'lead' FROM classes WHERE teacher_id IS NOT NULL
+ON CONFLICT (class_id, user_id) DO NOTHING;
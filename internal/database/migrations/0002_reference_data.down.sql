@@ -0,0 +1,31 @@
+-- Удаление встроенных типов уравнений, прав и ролей.
+-- Пользователи встроенных ролей должны быть удалены раньше (миграция демо-данных).
+
+DELETE FROM equation_types et
+USING (VALUES
+    (3, 'Сложение/вычитание (2-знач. с 1-знач.)'),
+    (3, 'Сложение/вычитание (2-знач. с 2-знач.)'),
+    (3, 'Умножение (2-знач. на 1-знач.)'),
+    (3, 'Деление (без остатка)'),
+    (3, 'Выражение из 3 операндов'),
+    (3, 'Выражение из 4 операндов'),
+    (3, 'Сложение/вычитание (3-знач. с 3-знач.)'),
+    (3, 'Сложение/вычитание (3-знач. с 2-знач.)'),
+    (3, 'Умножение (3-знач. на 1-знач.)'),
+    (3, 'Деление (3-знач. на 1-знач.)'),
+    (4, 'Сложение/вычитание (3-знач. с 3-знач.)'),
+    (4, 'Умножение (3-знач. на 1-знач.)'),
+    (4, 'Выражение из 3 чисел')
+) AS v(class, name)
+WHERE et.class = v.class AND et.name = v.name;
+
+DELETE FROM role_permissions
+WHERE role_id IN (SELECT id FROM roles WHERE is_system);
+
+DELETE FROM permissions WHERE code IN (
+    'quiz.solve', 'class.stats.view', 'class.students.manage', 'school.stats.view',
+    'district.stats.view', 'admin.panel', 'users.manage', 'schools.manage',
+    'equation_types.manage', 'roles.manage', 'audit.view', 'children.view'
+);
+
+DELETE FROM roles WHERE is_system;
@@ -0,0 +1,118 @@
+-- Встроенные роли, права и типы уравнений
+
+-- Заполнение ролей
+INSERT INTO roles (name, description, is_system) VALUES
+('student', 'Ученик', TRUE),
+('teacher', 'Учитель', TRUE),
+('admin', 'Администратор', TRUE),
+('director', 'Директор', TRUE),
+('district', 'Специалист управления образования', TRUE),
+('parent', 'Родитель', TRUE)
+ON CONFLICT (name) DO NOTHING;
+
+-- Заполнение прав
+INSERT INTO permissions (code, description) VALUES
+('quiz.solve', 'Решать примеры и смотреть свою статистику'),
+('class.stats.view', 'Смотреть статистику своего класса'),
+('class.students.manage', 'Управлять учениками своего класса: заявки, коды, блокировка'),
+('school.stats.view', 'Смотреть статистику всех классов школы'),
+('district.stats.view', 'Смотреть статистику всех школ района'),
+('admin.panel', 'Открывать админ-панель'),
+('users.manage', 'Управлять пользователями и приглашениями'),
+('schools.manage', 'Управлять школами и классами'),
+('equation_types.manage', 'Управлять типами уравнений'),
+('roles.manage', 'Управлять ролями и правами'),
+('audit.view', 'Просматривать и выгружать журнал аудита'),
+('children.view', 'Смотреть успеваемость своих детей')
+ON CONFLICT (code) DO NOTHING;
+
+-- Права встроенных ролей
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM (VALUES
+    ('student', 'quiz.solve'),
+    ('teacher', 'class.stats.view'),
+    ('teacher', 'class.students.manage'),
+    ('director', 'school.stats.view'),
+    ('district', 'school.stats.view'),
+    ('district', 'district.stats.view'),
+    ('parent', 'children.view'),
+    ('admin', 'admin.panel'),
+    ('admin', 'users.manage'),
+    ('admin', 'schools.manage'),
+    ('admin', 'equation_types.manage'),
+    ('admin', 'roles.manage'),
+    ('admin', 'audit.view'),
+    ('admin', 'school.stats.view'),
+    ('admin', 'district.stats.view')
+) AS m(role_name, permission_code)
+JOIN roles r ON r.name = m.role_name
+JOIN permissions p ON p.code = m.permission_code
+ON CONFLICT (role_id, permission_id) DO NOTHING;
+
+-- Типы уравнений. Добавляются только в пустую таблицу, чтобы не дублировать
+-- типы, уже созданные или измененные администратором.
+INSERT INTO equation_types
+(class, name, description, operation, num_operands, result_max, no_remainder, is_available)
+SELECT v.class, v.name, v.description, v.operation, v.num_operands, v.result_max, v.no_remainder, v.is_available
+FROM (VALUES
+    -- 3 класс (основные)
+    (3, 'Сложение/вычитание (2-знач. с 1-знач.)', 'До 90', '+-', 2, 90, FALSE, TRUE),
+    (3, 'Сложение/вычитание (2-знач. с 2-знач.)', 'До 50', '+-', 2, NULL, FALSE, TRUE),
+    (3, 'Умножение (2-знач. на 1-знач.)', 'До 100', '*', 2, 100, FALSE, TRUE),
+    (3, 'Деление (без остатка)', 'До 100', '/', 2, NULL, TRUE, TRUE),
+
+    -- 3 класс (будущие расширения - пока is_available = FALSE)
+    (3, 'Выражение из 3 операндов', 'До 33', '+-*/', 3, 100, FALSE, FALSE),
+    (3, 'Выражение из 4 операндов', 'До 20', '+-*/', 4, 100, FALSE, FALSE),
+    (3, 'Сложение/вычитание (3-знач. с 3-знач.)', 'До 1000', '+-', 2, 1000, FALSE, FALSE),
+    (3, 'Сложение/вычитание (3-знач. с 2-знач.)', 'До 1000', '+-', 2, 1000, FALSE, FALSE),
+    (3, 'Умножение (3-знач. на 1-знач.)', 'До 1000', '*', 2, 1000, FALSE, FALSE),
+    (3, 'Деление (3-знач. на 1-знач.)', 'До 1000', '/', 2, 1000, FALSE, FALSE),
+
+    -- 4 класс
+    (4, 'Сложение/вычитание (3-знач. с 3-знач.)', 'До 500', '+-', 2, 500, FALSE, TRUE),
+    (4, 'Умножение (3-знач. на 1-знач.)', 'До 500', '*', 2, 500, FALSE, TRUE),
+
+    -- 4 класс (будущие расширения)
+    (4, 'Выражение из 3 чисел', 'До 333', '+-*/', 3, 1000, FALSE, FALSE)
+) AS v(class, name, description, operation, num_operands, result_max, no_remainder, is_available)
+WHERE NOT EXISTS (SELECT 1 FROM equation_types);
+
+-- Диапазоны операндов для каждого типа уравнения (тип определяется по классу и названию)
+INSERT INTO operand_ranges (equation_type_id, operand_order, min_value, max_value)
+SELECT et.id, v.operand_order, v.min_value, v.max_value
+FROM (VALUES
+    (3, 'Сложение/вычитание (2-знач. с 1-знач.)', 1, 10, 90),
+    (3, 'Сложение/вычитание (2-знач. с 1-знач.)', 2, 1, 9),
+    (3, 'Сложение/вычитание (2-знач. с 2-знач.)', 1, 10, 50),
+    (3, 'Сложение/вычитание (2-знач. с 2-знач.)', 2, 10, 50),
+    (3, 'Умножение (2-знач. на 1-знач.)', 1, 10, 99),
+    (3, 'Умножение (2-знач. на 1-знач.)', 2, 2, 9),
+    (3, 'Деление (без остатка)', 1, 10, 100),
+    (3, 'Деление (без остатка)', 2, 2, 10),
+    (3, 'Выражение из 3 операндов', 1, 1, 33),
+    (3, 'Выражение из 3 операндов', 2, 1, 33),
+    (3, 'Выражение из 3 операндов', 3, 1, 33),
+    (3, 'Выражение из 4 операндов', 1, 1, 20),
+    (3, 'Выражение из 4 операндов', 2, 1, 20),
+    (3, 'Выражение из 4 операндов', 3, 1, 20),
+    (3, 'Выражение из 4 операндов', 4, 1, 20),
+    (3, 'Сложение/вычитание (3-знач. с 3-знач.)', 1, 100, 1000),
+    (3, 'Сложение/вычитание (3-знач. с 3-знач.)', 2, 100, 1000),
+    (3, 'Сложение/вычитание (3-знач. с 2-знач.)', 1, 100, 1000),
+    (3, 'Сложение/вычитание (3-знач. с 2-знач.)', 2, 10, 100),
+    (3, 'Умножение (3-знач. на 1-знач.)', 1, 100, 999),
+    (3, 'Умножение (3-знач. на 1-знач.)', 2, 2, 9),
+    (3, 'Деление (3-знач. на 1-знач.)', 1, 100, 999),
+    (3, 'Деление (3-знач. на 1-знач.)', 2, 2, 9),
+    (4, 'Сложение/вычитание (3-знач. с 3-знач.)', 1, 100, 500),
+    (4, 'Сложение/вычитание (3-знач. с 3-знач.)', 2, 100, 500),
+    (4, 'Умножение (3-знач. на 1-знач.)', 1, 100, 500),
+    (4, 'Умножение (3-знач. на 1-знач.)', 2, 2, 9),
+    (4, 'Выражение из 3 чисел', 1, 100, 333),
+    (4, 'Выражение из 3 чисел', 2, 100, 333),
+    (4, 'Выражение из 3 чисел', 3, 100, 333)
+) AS v(class, name, operand_order, min_value, max_value)
+JOIN equation_types et ON et.class = v.class AND et.name = v.name
+ON CONFLICT (equation_type_id, operand_order) DO NOTHING;
@@ -0,0 +1,47 @@
+-- Отмена мягкого удаления. Строки из корзины снова становятся видимыми:
+-- откат не удаляет данные окончательно.
+
+CREATE OR REPLACE FUNCTION create_progress_when_student_added_to_class()
+RETURNS TRIGGER AS $$
+DECLARE
+    class_grade INTEGER;
+BEGIN
+    -- Получаем уровень (grade) класса
+    SELECT grade INTO class_grade FROM classes WHERE id = NEW.class_id;
+
+    -- Для каждого типа уравнения, который соответствует уровню класса
+    INSERT INTO user_progress (user_id, equation_type_id, is_unlocked, first_unlocked_at)
+    SELECT NEW.student_id, et.id, et.is_available, CURRENT_TIMESTAMP
+    FROM equation_types et
+    WHERE et.class = class_grade
+    ON CONFLICT (user_id, equation_type_id) DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION create_user_progress_for_new_equation_type()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Для каждого ученика, который находится в классе с таким уровнем
+    INSERT INTO user_progress (user_id, equation_type_id, is_unlocked, first_unlocked_at)
+    SELECT sc.student_id, NEW.id, NEW.is_available, CURRENT_TIMESTAMP
+    FROM student_classes sc
+    JOIN classes c ON c.id = sc.class_id
+    WHERE c.grade = NEW.class
+      AND EXISTS (SELECT 1 FROM users u WHERE u.id = sc.student_id AND u.role_id = 1)
+    ON CONFLICT (user_id, equation_type_id) DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS idx_equation_types_deleted_at;
+DROP INDEX IF EXISTS idx_users_deleted_at;
+DROP INDEX IF EXISTS idx_classes_deleted_at;
+DROP INDEX IF EXISTS idx_schools_deleted_at;
+
+ALTER TABLE equation_types DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE classes DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE schools DROP COLUMN IF EXISTS deleted_at;
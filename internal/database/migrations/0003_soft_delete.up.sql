@@ -0,0 +1,51 @@
+-- Мягкое удаление школ, классов, пользователей и типов уравнений.
+-- Удаленная строка получает deleted_at и попадает в корзину админки;
+-- окончательно ее удаляет периодическая очистка корзины.
+
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+ALTER TABLE equation_types ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+
+-- Индексы для корзины и очистки: удаленных строк немного
+CREATE INDEX IF NOT EXISTS idx_schools_deleted_at ON schools(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_classes_deleted_at ON classes(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_equation_types_deleted_at ON equation_types(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Прогресс создается только по типам, которых нет в корзине
+CREATE OR REPLACE FUNCTION create_progress_when_student_added_to_class()
+RETURNS TRIGGER AS $$
+DECLARE
+    class_grade INTEGER;
+BEGIN
+    -- Получаем уровень (grade) класса
+    SELECT grade INTO class_grade FROM classes WHERE id = NEW.class_id;
+
+    -- Для каждого типа уравнения, который соответствует уровню класса
+    INSERT INTO user_progress (user_id, equation_type_id, is_unlocked, first_unlocked_at)
+    SELECT NEW.student_id, et.id, et.is_available, CURRENT_TIMESTAMP
+    FROM equation_types et
+    WHERE et.class = class_grade AND et.deleted_at IS NULL
+    ON CONFLICT (user_id, equation_type_id) DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- ...и только для учеников и классов, которых нет в корзине
+CREATE OR REPLACE FUNCTION create_user_progress_for_new_equation_type()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Для каждого ученика, который находится в классе с таким уровнем
+    INSERT INTO user_progress (user_id, equation_type_id, is_unlocked, first_unlocked_at)
+    SELECT sc.student_id, NEW.id, NEW.is_available, CURRENT_TIMESTAMP
+    FROM student_classes sc
+    JOIN classes c ON c.id = sc.class_id
+    WHERE c.grade = NEW.class AND c.deleted_at IS NULL
+      AND EXISTS (SELECT 1 FROM users u WHERE u.id = sc.student_id AND u.role_id = 1 AND u.deleted_at IS NULL)
+    ON CONFLICT (user_id, equation_type_id) DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
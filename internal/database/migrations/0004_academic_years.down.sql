@@ -0,0 +1,6 @@
+-- Отмена учебных лет. Архив закрытых лет удаляется; параллели классов остаются как есть.
+
+DROP TABLE IF EXISTS academic_year_students;
+DROP TABLE IF EXISTS academic_year_classes;
+DROP FUNCTION IF EXISTS academic_year_snapshot_read_only();
+DROP TABLE IF EXISTS academic_years;
@@ -0,0 +1,88 @@
+-- Учебные годы и архив статистики закрытых лет.
+-- При переходе на новый год классы переводятся в следующую параллель,
+-- а итоги прошедшего года сохраняются в снимках, которые нельзя изменить.
+
+CREATE TABLE IF NOT EXISTS academic_years (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(20) UNIQUE NOT NULL,         -- Например, 2025/2026
+    starts_on DATE NOT NULL,
+    is_current BOOLEAN NOT NULL DEFAULT FALSE,
+    closed_at TIMESTAMP,
+    closed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Текущий учебный год всегда один
+CREATE UNIQUE INDEX IF NOT EXISTS idx_academic_years_current ON academic_years(is_current) WHERE is_current;
+
+-- Снимок класса на конец года. Без внешних ключей на классы и школы:
+-- архив должен пережить окончательное удаление класса из корзины
+CREATE TABLE IF NOT EXISTS academic_year_classes (
+    academic_year_id INTEGER NOT NULL REFERENCES academic_years(id) ON DELETE CASCADE,
+    class_id INTEGER NOT NULL,
+    school_id INTEGER,
+    school_name VARCHAR(256) NOT NULL DEFAULT '',
+    class_name VARCHAR(100) NOT NULL,
+    grade INTEGER NOT NULL,
+    teacher_name VARCHAR(256) NOT NULL DEFAULT '',
+    outcome VARCHAR(16) NOT NULL,             -- promote, keep, graduate
+    students_count INTEGER NOT NULL DEFAULT 0,
+    active_students INTEGER NOT NULL DEFAULT 0,
+    attempts_count INTEGER NOT NULL DEFAULT 0,
+    correct_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (academic_year_id, class_id)
+);
+
+-- Снимок ученика в классе на конец года
+CREATE TABLE IF NOT EXISTS academic_year_students (
+    academic_year_id INTEGER NOT NULL REFERENCES academic_years(id) ON DELETE CASCADE,
+    class_id INTEGER NOT NULL,
+    student_id INTEGER NOT NULL,
+    username VARCHAR(200) NOT NULL DEFAULT '',
+    full_name VARCHAR(256) NOT NULL DEFAULT '',
+    attempts_count INTEGER NOT NULL DEFAULT 0,
+    correct_count INTEGER NOT NULL DEFAULT 0,
+    last_attempt_at TIMESTAMP,
+    outcome VARCHAR(16) NOT NULL,             -- promoted, kept, graduated, unenrolled
+    PRIMARY KEY (academic_year_id, class_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_academic_year_students_student_id ON academic_year_students(student_id);
+
+-- Снимки только добавляются: изменение, удаление и очистка таблиц запрещены
+CREATE OR REPLACE FUNCTION academic_year_snapshot_read_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'снимки учебного года нельзя изменить';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS academic_year_classes_read_only ON academic_year_classes;
+CREATE TRIGGER academic_year_classes_read_only
+    BEFORE UPDATE OR DELETE ON academic_year_classes
+    FOR EACH ROW EXECUTE FUNCTION academic_year_snapshot_read_only();
+
+DROP TRIGGER IF EXISTS academic_year_classes_no_truncate ON academic_year_classes;
+CREATE TRIGGER academic_year_classes_no_truncate
+    BEFORE TRUNCATE ON academic_year_classes
+    FOR EACH STATEMENT EXECUTE FUNCTION academic_year_snapshot_read_only();
+
+DROP TRIGGER IF EXISTS academic_year_students_read_only ON academic_year_students;
+CREATE TRIGGER academic_year_students_read_only
+    BEFORE UPDATE OR DELETE ON academic_year_students
+    FOR EACH ROW EXECUTE FUNCTION academic_year_snapshot_read_only();
+
+DROP TRIGGER IF EXISTS academic_year_students_no_truncate ON academic_year_students;
+CREATE TRIGGER academic_year_students_no_truncate
+    BEFORE TRUNCATE ON academic_year_students
+    FOR EACH STATEMENT EXECUTE FUNCTION academic_year_snapshot_read_only();
+
+-- Текущий год по календарю: учебный год начинается 1 сентября
+INSERT INTO academic_years (name, starts_on, is_current)
+SELECT y || '/' || (y + 1), make_date(y, 9, 1), TRUE
+FROM (
+    SELECT CASE WHEN EXTRACT(MONTH FROM CURRENT_DATE) >= 9
+                THEN EXTRACT(YEAR FROM CURRENT_DATE)::int
+                ELSE EXTRACT(YEAR FROM CURRENT_DATE)::int - 1
+           END AS y
+) current_year
+WHERE NOT EXISTS (SELECT 1 FROM academic_years);
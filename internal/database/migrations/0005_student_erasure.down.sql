@@ -0,0 +1,9 @@
+-- Обезличенные пользователи остаются обезличенными: вернуть удаленные данные нельзя.
+
+DROP TRIGGER IF EXISTS academic_year_students_read_only ON academic_year_students;
+CREATE TRIGGER academic_year_students_read_only
+    BEFORE UPDATE OR DELETE ON academic_year_students
+    FOR EACH ROW EXECUTE FUNCTION academic_year_snapshot_read_only();
+DROP FUNCTION IF EXISTS academic_year_students_read_only();
+
+ALTER TABLE users DROP COLUMN IF EXISTS erased_at;
@@ -0,0 +1,22 @@
+-- Удаление персональных данных ученика по запросу родителей.
+-- Строка пользователя остается (на нее ссылаются попытки и статистика класса),
+-- но обезличивается; erased_at отмечает, что данные удалены и выгружать больше нечего.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS erased_at TIMESTAMP NULL;
+
+-- Единственное исключение из неизменности снимков учебного года: строки ученика удаляются
+-- (и пересоздаются обезличенными) только в транзакции стирания, которая выставляет
+-- edugame.erase_student в ID этого ученика через set_config(..., true)
+CREATE OR REPLACE FUNCTION academic_year_students_read_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND current_setting('edugame.erase_student', true) = OLD.student_id::text THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'снимки учебного года нельзя изменить';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS academic_year_students_read_only ON academic_year_students;
+CREATE TRIGGER academic_year_students_read_only
+    BEFORE UPDATE OR DELETE ON academic_year_students
+    FOR EACH ROW EXECUTE FUNCTION academic_year_students_read_only();
@@ -0,0 +1,6 @@
+-- Отмена предагрегированной статистики: отчеты снова считаются по попыткам.
+
+DROP TRIGGER IF EXISTS attempts_rollup_stats ON attempts;
+DROP FUNCTION IF EXISTS attempts_rollup_stats();
+DROP TABLE IF EXISTS student_hourly_stats;
+DROP TABLE IF EXISTS student_daily_stats;
@@ -0,0 +1,86 @@
+-- Предагрегированная статистика попыток. Отчеты учителя и директора читают эти таблицы
+-- вместо пересчета всех попыток при каждом открытии страницы.
+-- Таблицы ведет триггер на attempts, поэтому они всегда совпадают с сырыми данными.
+
+-- Итоги ученика за день по типу уравнения. Без внешнего ключа на equation_types:
+-- 0 - попытки, тип которых окончательно удален
+CREATE TABLE IF NOT EXISTS student_daily_stats (
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    equation_type_id INTEGER NOT NULL DEFAULT 0,
+    attempts_count INTEGER NOT NULL DEFAULT 0,
+    correct_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (student_id, day, equation_type_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_student_daily_stats_day ON student_daily_stats(day);
+
+-- Итоги ученика за час: из них собирается недельная сетка сессий по 10 примеров
+CREATE TABLE IF NOT EXISTS student_hourly_stats (
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    hour SMALLINT NOT NULL,
+    attempts_count INTEGER NOT NULL DEFAULT 0,
+    correct_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (student_id, day, hour)
+);
+
+-- Пересчет с нуля: новые попытки не должны проскочить между заполнением и созданием триггера
+LOCK TABLE attempts IN SHARE MODE;
+
+INSERT INTO student_daily_stats (student_id, day, equation_type_id, attempts_count, correct_count)
+SELECT user_id, created_at::date, COALESCE(equation_type_id, 0), COUNT(*), COUNT(*) FILTER (WHERE is_correct)
+FROM attempts
+WHERE user_id IS NOT NULL AND created_at IS NOT NULL
+GROUP BY user_id, created_at::date, COALESCE(equation_type_id, 0)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO student_hourly_stats (student_id, day, hour, attempts_count, correct_count)
+SELECT user_id, created_at::date, EXTRACT(HOUR FROM created_at), COUNT(*), COUNT(*) FILTER (WHERE is_correct)
+FROM attempts
+WHERE user_id IS NOT NULL AND created_at IS NOT NULL
+GROUP BY user_id, created_at::date, EXTRACT(HOUR FROM created_at)
+ON CONFLICT DO NOTHING;
+
+-- Старая версия строки вычитается, новая прибавляется. Вычитание - обычный UPDATE:
+-- при окончательном удалении ученика его итоги могут уйти раньше попыток
+CREATE OR REPLACE FUNCTION attempts_rollup_stats() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.user_id IS NOT NULL AND OLD.created_at IS NOT NULL THEN
+        UPDATE student_daily_stats
+        SET attempts_count = attempts_count - 1,
+            correct_count = correct_count - CASE WHEN OLD.is_correct THEN 1 ELSE 0 END
+        WHERE student_id = OLD.user_id AND day = OLD.created_at::date
+          AND equation_type_id = COALESCE(OLD.equation_type_id, 0);
+
+        UPDATE student_hourly_stats
+        SET attempts_count = attempts_count - 1,
+            correct_count = correct_count - CASE WHEN OLD.is_correct THEN 1 ELSE 0 END
+        WHERE student_id = OLD.user_id AND day = OLD.created_at::date
+          AND hour = EXTRACT(HOUR FROM OLD.created_at);
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.user_id IS NOT NULL AND NEW.created_at IS NOT NULL THEN
+        INSERT INTO student_daily_stats (student_id, day, equation_type_id, attempts_count, correct_count)
+        VALUES (NEW.user_id, NEW.created_at::date, COALESCE(NEW.equation_type_id, 0), 1,
+                CASE WHEN NEW.is_correct THEN 1 ELSE 0 END)
+        ON CONFLICT (student_id, day, equation_type_id) DO UPDATE
+        SET attempts_count = student_daily_stats.attempts_count + 1,
+            correct_count = student_daily_stats.correct_count + EXCLUDED.correct_count;
+
+        INSERT INTO student_hourly_stats (student_id, day, hour, attempts_count, correct_count)
+        VALUES (NEW.user_id, NEW.created_at::date, EXTRACT(HOUR FROM NEW.created_at), 1,
+                CASE WHEN NEW.is_correct THEN 1 ELSE 0 END)
+        ON CONFLICT (student_id, day, hour) DO UPDATE
+        SET attempts_count = student_hourly_stats.attempts_count + 1,
+            correct_count = student_hourly_stats.correct_count + EXCLUDED.correct_count;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS attempts_rollup_stats ON attempts;
+CREATE TRIGGER attempts_rollup_stats
+    AFTER INSERT OR DELETE OR UPDATE OF user_id, equation_type_id, is_correct, created_at ON attempts
+    FOR EACH ROW EXECUTE FUNCTION attempts_rollup_stats();
@@ -0,0 +1,5 @@
+-- Отмена серверного состояния наборов: выданные наборы теряются, ученикам нужно открыть задание заново.
+
+ALTER TABLE attempts DROP COLUMN IF EXISTS credit;
+DROP TABLE IF EXISTS quiz_items;
+DROP TABLE IF EXISTS quizzes;
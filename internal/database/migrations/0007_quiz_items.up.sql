@@ -0,0 +1,26 @@
+-- Состояние выданных наборов примеров хранится на сервере. Раньше верные ответы,
+-- число попыток и блокировка примеров лежали в подписанной, но не зашифрованной cookie:
+-- ответы можно было прочитать, а старая копия cookie сбрасывала попытки.
+
+CREATE TABLE IF NOT EXISTS quizzes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quizzes_user_id ON quizzes(user_id);
+
+CREATE TABLE IF NOT EXISTS quiz_items (
+    quiz_id INTEGER NOT NULL REFERENCES quizzes(id) ON DELETE CASCADE,
+    item_id INTEGER NOT NULL,                 -- Номер примера в наборе
+    equation_type_id INTEGER REFERENCES equation_types(id) ON DELETE SET NULL,
+    equation_text TEXT NOT NULL,
+    correct_answer VARCHAR(50) NOT NULL,
+    tries INTEGER NOT NULL DEFAULT 0,
+    locked BOOLEAN NOT NULL DEFAULT FALSE,
+    is_correct BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (quiz_id, item_id)
+);
+
+-- Доля балла за верный ответ при поштучной проверке; NULL - ответ проверен без учета попыток
+ALTER TABLE attempts ADD COLUMN IF NOT EXISTS credit NUMERIC(4, 3);
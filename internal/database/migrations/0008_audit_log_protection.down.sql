@@ -0,0 +1,5 @@
+-- Отмена дополнительной защиты журнала аудита
+
+GRANT UPDATE, DELETE, TRUNCATE ON audit_log TO CURRENT_USER;
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
@@ -0,0 +1,10 @@
+-- Журнал аудита: построчный триггер не срабатывает на TRUNCATE, поэтому
+-- очистку таблицы запрещает отдельный триггер на уровне оператора.
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- Приложение и миграции работают под одной ролью: у нее остаются только чтение и добавление.
+-- Владелец таблицы может вернуть права явно через GRANT, случайный запрос из приложения - нет.
+REVOKE UPDATE, DELETE, TRUNCATE ON audit_log FROM PUBLIC, CURRENT_USER;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_attempts_user_created_at;
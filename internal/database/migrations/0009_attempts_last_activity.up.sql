@@ -0,0 +1,3 @@
+-- Время последней попытки ученика для списков класса: итоги берутся из student_daily_stats,
+-- а точное время - одним чтением этого индекса вместо просмотра всех попыток
+CREATE INDEX IF NOT EXISTS idx_attempts_user_created_at ON attempts(user_id, created_at DESC);
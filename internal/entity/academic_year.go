@@ -0,0 +1,142 @@
+package entity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxGrade - последняя параллель школы: такой класс можно только выпустить
+const MaxGrade = 11
+
+// Решения по классу при переходе на новый учебный год
+const (
+	RolloverPromote  = "promote"  // класс переходит в следующую параллель
+	RolloverKeep     = "keep"     // класс остается в своей параллели
+	RolloverGraduate = "graduate" // ученики выпускаются, класс уходит в корзину
+)
+
+// ValidRolloverAction проверяет, что решение по классу известно
+func ValidRolloverAction(action string) bool {
+	switch action {
+	case RolloverPromote, RolloverKeep, RolloverGraduate:
+		return true
+	}
+	return false
+}
+
+// Итог года для ученика в архиве
+const (
+	OutcomePromoted   = "promoted"
+	OutcomeKept       = "kept"
+	OutcomeGraduated  = "graduated"
+	OutcomeUnenrolled = "unenrolled"
+)
+
+// OutcomeTitle - итог года для интерфейса (решение по классу или итог ученика)
+func OutcomeTitle(outcome string) string {
+	switch outcome {
+	case RolloverPromote, OutcomePromoted:
+		return "Переведен"
+	case RolloverKeep, OutcomeKept:
+		return "Остался"
+	case RolloverGraduate, OutcomeGraduated:
+		return "Выпущен"
+	case OutcomeUnenrolled:
+		return "Отчислен"
+	default:
+		return outcome
+	}
+}
+
+// AcademicYear - учебный год. Текущий год один; закрытый год хранит снимки статистики
+type AcademicYear struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	StartsOn  time.Time  `json:"starts_on"`
+	IsCurrent bool       `json:"is_current"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+	ClosedBy  *int       `json:"closed_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// AcademicYearStart - 1 сентября учебного года, в который попадает t
+func AcademicYearStart(t time.Time) time.Time {
+	year := t.Year()
+	if t.Month() < time.September {
+		year--
+	}
+	return time.Date(year, time.September, 1, 0, 0, 0, 0, t.Location())
+}
+
+// AcademicYearName - название учебного года, начинающегося в start: "2025/2026"
+func AcademicYearName(start time.Time) string {
+	return fmt.Sprintf("%d/%d", start.Year(), start.Year()+1)
+}
+
+// PromotedClassName - название класса в новой параллели: номер в начале названия
+// заменяется ("3А" - "4А", "3-Б" - "4-Б"); название без номера не меняется
+func PromotedClassName(name string, grade, newGrade int) string {
+	prefix := strconv.Itoa(grade)
+	rest, ok := strings.CutPrefix(name, prefix)
+	if !ok || (rest != "" && rest[0] >= '0' && rest[0] <= '9') {
+		return name
+	}
+	return strconv.Itoa(newGrade) + rest
+}
+
+// YearClassSnapshot - итоги класса за закрытый учебный год
+type YearClassSnapshot struct {
+	AcademicYearID int    `json:"academic_year_id"`
+	ClassID        int    `json:"class_id"`
+	SchoolID       *int   `json:"school_id,omitempty"`
+	SchoolName     string `json:"school_name"`
+	ClassName      string `json:"class_name"`
+	Grade          int    `json:"grade"`
+	TeacherName    string `json:"teacher_name"`
+	Outcome        string `json:"outcome"`
+	StudentsCount  int    `json:"students_count"`
+	ActiveStudents int    `json:"active_students"`
+	AttemptsCount  int    `json:"attempts_count"`
+	CorrectCount   int    `json:"correct_count"`
+}
+
+// Accuracy - доля верных ответов класса за год, в процентах
+func (s *YearClassSnapshot) Accuracy() float64 {
+	if s.AttemptsCount == 0 {
+		return 0
+	}
+	return float64(s.CorrectCount) * 100 / float64(s.AttemptsCount)
+}
+
+// OutcomeTitle - решение по классу для интерфейса
+func (s *YearClassSnapshot) OutcomeTitle() string {
+	return OutcomeTitle(s.Outcome)
+}
+
+// YearStudentSnapshot - итоги ученика в классе за закрытый учебный год
+type YearStudentSnapshot struct {
+	AcademicYearID int        `json:"academic_year_id"`
+	ClassID        int        `json:"class_id"`
+	StudentID      int        `json:"student_id"`
+	Username       string     `json:"username"`
+	FullName       string     `json:"full_name"`
+	AttemptsCount  int        `json:"attempts_count"`
+	CorrectCount   int        `json:"correct_count"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	Outcome        string     `json:"outcome"`
+}
+
+// Accuracy - доля верных ответов ученика за год, в процентах
+func (s *YearStudentSnapshot) Accuracy() float64 {
+	if s.AttemptsCount == 0 {
+		return 0
+	}
+	return float64(s.CorrectCount) * 100 / float64(s.AttemptsCount)
+}
+
+// OutcomeTitle - итог года ученика для интерфейса
+func (s *YearStudentSnapshot) OutcomeTitle() string {
+	return OutcomeTitle(s.Outcome)
+}
@@ -11,6 +11,7 @@ type Attempt struct {
 	UserAnswer     string    `json:"user_answer"`
 	IsCorrect      bool      `json:"is_correct"`
 	CreatedAt      time.Time `json:"created_at"`
+	Credit         *float64  `json:"credit,omitempty"` // Доля балла при поштучной проверке, nil - без учета попыток
 }
 
 func NewAttempt(userId, equationTypeId int, equationText, correctAnswer, userAnswer string) Attempt {
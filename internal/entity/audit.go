@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// AuditEntry - запись журнала аудита: кто, что и над каким объектом сделал.
+// Before/After - JSON состояния объекта до и после изменения (пустые при создании/удалении).
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	ActorID    *int      `json:"actor_id,omitempty"`
+	ActorName  string    `json:"actor_name"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   *int      `json:"target_id,omitempty"`
+	Before     string    `json:"before,omitempty"`
+	After      string    `json:"after,omitempty"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,62 @@
+package entity
+
+import "time"
+
+// Роли сотрудника в классе
+const (
+	StaffRoleLead      = "lead"      // ведущий учитель: все действия, включая коды класса
+	StaffRoleAssistant = "assistant" // ассистент: статистика и работа с учениками
+	StaffRoleViewer    = "viewer"    // наблюдатель: только статистика
+)
+
+// StaffRoles - роли в порядке убывания прав
+var StaffRoles = []string{StaffRoleLead, StaffRoleAssistant, StaffRoleViewer}
+
+// ValidStaffRole проверяет, что роль сотрудника класса известна
+func ValidStaffRole(role string) bool {
+	for _, r := range StaffRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// StaffRoleTitle - название роли сотрудника для интерфейса
+func StaffRoleTitle(role string) string {
+	switch role {
+	case StaffRoleLead:
+		return "Ведущий учитель"
+	case StaffRoleAssistant:
+		return "Ассистент"
+	case StaffRoleViewer:
+		return "Наблюдатель"
+	default:
+		return role
+	}
+}
+
+// ClassStaff - сотрудник, допущенный к классу
+type ClassStaff struct {
+	ClassID   int       `json:"class_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	FullName  string    `json:"full_name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoleTitle - название роли для интерфейса
+func (s *ClassStaff) RoleTitle() string {
+	return StaffRoleTitle(s.Role)
+}
+
+// CanManageStudents - сотрудник может работать с учениками класса (ведущий учитель или ассистент)
+func (c *Class) CanManageStudents() bool {
+	return c.StaffRole == StaffRoleLead || c.StaffRole == StaffRoleAssistant
+}
+
+// IsLead - сотрудник ведет класс и может менять его коды
+func (c *Class) IsLead() bool {
+	return c.StaffRole == StaffRoleLead
+}
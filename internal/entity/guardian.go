@@ -0,0 +1,49 @@
+package entity
+
+import "time"
+
+// GuardianCode - одноразовый код, по которому родитель привязывает к себе ученика.
+// Выдается учителем, сам код не хранится, только его хеш.
+type GuardianCode struct {
+	ID        int        `json:"id"`
+	StudentID int        `json:"student_id"`
+	IssuedBy  int        `json:"issued_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    *int       `json:"used_by,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Child - ученик, привязанный к родителю
+type Child struct {
+	ID            int       `json:"id"`
+	FullName      string    `json:"full_name"`
+	ClassName     string    `json:"class_name"`
+	WeeklySummary bool      `json:"weekly_summary"`
+	LinkedAt      time.Time `json:"linked_at"`
+}
+
+// WeeklySummary - итоги недели ученика для родителя
+type WeeklySummary struct {
+	StudentID       int       `json:"student_id"`
+	StudentName     string    `json:"student_name"`
+	WeekStart       time.Time `json:"week_start"`
+	Sessions        int       `json:"sessions"`
+	PerfectSessions int       `json:"perfect_sessions"`
+	Correct         int       `json:"correct"`
+	Total           int       `json:"total"`
+}
+
+// Accuracy - доля верных ответов за неделю в процентах
+func (s *WeeklySummary) Accuracy() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Correct) / float64(s.Total) * 100
+}
+
+// WeekEnd - воскресенье недели сводки
+func (s *WeeklySummary) WeekEnd() time.Time {
+	return s.WeekStart.AddDate(0, 0, 6)
+}
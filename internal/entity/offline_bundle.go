@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// OfflineItem - пример из офлайн-набора. Верный ответ хранится только на сервере.
+type OfflineItem struct {
+	ID             int    `json:"id"`
+	Text           string `json:"text"`
+	EquationTypeID int    `json:"equation_type_id"`
+	CorrectAnswer  string `json:"correct_answer"`
+}
+
+type OfflineBundle struct {
+	ID        int           `json:"id"`
+	UserID    int           `json:"user_id"`
+	Items     []OfflineItem `json:"items"`
+	IssuedAt  time.Time     `json:"issued_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	SyncedAt  *time.Time    `json:"synced_at,omitempty"`
+}
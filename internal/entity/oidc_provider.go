@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// OIDCProvider - внешний провайдер единого входа (OpenID Connect), обычно региональный,
+// привязанный к школе. RoleMapping переводит значения утверждения RoleClaim в имена ролей.
+type OIDCProvider struct {
+	ID                int               `json:"id"`
+	Slug              string            `json:"slug"`
+	Name              string            `json:"name"`
+	SchoolID          *int              `json:"school_id,omitempty"`
+	Issuer            string            `json:"issuer"`
+	ClientID          string            `json:"client_id"`
+	ClientSecret      string            `json:"-"`
+	Scopes            string            `json:"scopes"`
+	UsernameClaim     string            `json:"username_claim"`
+	NameClaim         string            `json:"name_claim"`
+	RoleClaim         string            `json:"role_claim"`
+	RoleMapping       map[string]string `json:"role_mapping"`
+	DefaultRole       string            `json:"default_role,omitempty"`
+	AllowProvisioning bool              `json:"allow_provisioning"`
+	Enabled           bool              `json:"enabled"`
+	CreatedAt         time.Time         `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// PasswordResetCode - одноразовый код сброса пароля, выданный учителем ученику.
+// Сам код не хранится, только его хеш.
+type PasswordResetCode struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	StudentName  string     `json:"student_name,omitempty"`
+	IssuedBy     int        `json:"issued_by"`
+	IssuedByName string     `json:"issued_by_name,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+	UsedIP       string     `json:"used_ip,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Status - состояние кода для журнала
+func (c *PasswordResetCode) Status() string {
+	switch {
+	case c.UsedAt != nil:
+		return "использован"
+	case c.RevokedAt != nil:
+		return "заменен новым"
+	case time.Now().After(c.ExpiresAt):
+		return "истек"
+	default:
+		return "действует"
+	}
+}
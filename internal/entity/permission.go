@@ -0,0 +1,24 @@
+package entity
+
+// Коды прав доступа. Набор прав хранится в таблице permissions,
+// роли получают права через role_permissions.
+const (
+	PermQuizSolve           = "quiz.solve"
+	PermClassStatsView      = "class.stats.view"
+	PermClassStudentsManage = "class.students.manage"
+	PermSchoolStatsView     = "school.stats.view"
+	PermDistrictStatsView   = "district.stats.view"
+	PermAdminPanel          = "admin.panel"
+	PermUsersManage         = "users.manage"
+	PermSchoolsManage       = "schools.manage"
+	PermEquationTypesManage = "equation_types.manage"
+	PermRolesManage         = "roles.manage"
+	PermAuditView           = "audit.view"
+	PermChildrenView        = "children.view"
+)
+
+type Permission struct {
+	ID          int    `json:"id"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,14 @@
+package entity
+
+// QuizItem - пример из выданного набора и состояние ответа на него.
+// Хранится только на сервере: в cookie лежит лишь номер набора.
+type QuizItem struct {
+	QuizID         int    `json:"quiz_id"`
+	ItemID         int    `json:"item_id"`
+	EquationTypeID int    `json:"equation_type_id"`
+	Text           string `json:"text"`
+	CorrectAnswer  string `json:"correct_answer"`
+	Tries          int    `json:"tries"`
+	Locked         bool   `json:"locked"`
+	Correct        bool   `json:"correct"`
+}
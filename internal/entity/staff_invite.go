@@ -0,0 +1,33 @@
+package entity
+
+import "time"
+
+// StaffInvite - ссылка-приглашение, по которой сотрудник сам создает учетную запись.
+// Сам токен не хранится, только его хеш.
+type StaffInvite struct {
+	ID        int        `json:"id"`
+	RoleID    int        `json:"role_id"`
+	RoleName  string     `json:"role_name"`
+	SchoolID  *int       `json:"school_id,omitempty"`
+	Note      string     `json:"note"`
+	CreatedBy *int       `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    *int       `json:"used_by,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Status - состояние приглашения для списка в админке
+func (i *StaffInvite) Status() string {
+	switch {
+	case i.UsedAt != nil:
+		return "использовано"
+	case i.RevokedAt != nil:
+		return "отозвано"
+	case time.Now().After(i.ExpiresAt):
+		return "истекло"
+	default:
+		return "действует"
+	}
+}
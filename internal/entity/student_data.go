@@ -0,0 +1,76 @@
+package entity
+
+import (
+	"strconv"
+	"time"
+)
+
+// ErasedFullName - имя ученика после удаления персональных данных
+const ErasedFullName = "Ученик (данные удалены)"
+
+// ErasedUsername - логин ученика после удаления персональных данных: уникальный и ни о ком не говорящий
+func ErasedUsername(id int) string {
+	return "erased-" + strconv.Itoa(id)
+}
+
+// StudentDataExport - все, что хранится об ученике, для ответа на запрос родителей.
+// Секреты (хеши паролей, токены сеансов) не выгружаются: выгружается только факт их наличия.
+type StudentDataExport struct {
+	ExportedAt time.Time               `json:"exported_at"`
+	User       StudentRecord           `json:"user"`
+	Classes    []StudentClassRecord    `json:"class_memberships"`
+	Attempts   []Attempt               `json:"attempts"`
+	Progress   []StudentProgressRecord `json:"user_progress"`
+	Sessions   []UserSession           `json:"sessions"`
+	Audit      []StudentAuditRecord    `json:"audit_log"`
+}
+
+// StudentRecord - строка users без секретов
+type StudentRecord struct {
+	ID                 int        `json:"id"`
+	Username           string     `json:"username"`
+	FullName           string     `json:"full_name"`
+	Email              string     `json:"email"`
+	Role               string     `json:"role"`
+	SchoolID           *int       `json:"school_id,omitempty"`
+	SchoolName         string     `json:"school_name"`
+	Blocked            bool       `json:"blocked"`
+	BlockedReason      string     `json:"blocked_reason"`
+	BlockedAt          *time.Time `json:"blocked_at,omitempty"`
+	Pending            bool       `json:"pending"`
+	HasPicturePassword bool       `json:"has_picture_password"`
+	CreatedAt          time.Time  `json:"created_at"`
+	ErasedAt           *time.Time `json:"erased_at,omitempty"`
+}
+
+// StudentClassRecord - членство ученика в классе
+type StudentClassRecord struct {
+	ClassID    int       `json:"class_id"`
+	ClassName  string    `json:"class_name"`
+	Grade      int       `json:"grade"`
+	SchoolName string    `json:"school_name"`
+	JoinedAt   time.Time `json:"joined_at"`
+}
+
+// StudentAuditRecord - запись журнала аудита об ученике. Кто и откуда выполнил действие,
+// не выгружается: это данные сотрудника.
+type StudentAuditRecord struct {
+	ID        int64     `json:"id"`
+	Action    string    `json:"action"`
+	Before    string    `json:"before_state,omitempty"`
+	After     string    `json:"after_state,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StudentProgressRecord - строка user_progress с названием типа уравнения
+type StudentProgressRecord struct {
+	EquationTypeID   int        `json:"equation_type_id"`
+	EquationTypeName string     `json:"equation_type_name"`
+	AttemptsCount    int        `json:"attempts_count"`
+	CorrectCount     int        `json:"correct_count"`
+	IsUnlocked       bool       `json:"is_unlocked"`
+	FirstUnlockedAt  *time.Time `json:"first_unlocked_at,omitempty"`
+	LastAttemptAt    *time.Time `json:"last_attempt_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,52 @@
+package entity
+
+import "time"
+
+// Виды объектов в корзине
+const (
+	TrashSchool       = "school"
+	TrashClass        = "class"
+	TrashUser         = "user"
+	TrashEquationType = "equation_type"
+)
+
+// ValidTrashKind проверяет, что вид объекта корзины известен
+func ValidTrashKind(kind string) bool {
+	switch kind {
+	case TrashSchool, TrashClass, TrashUser, TrashEquationType:
+		return true
+	}
+	return false
+}
+
+// TrashItem - удаленный объект, который еще можно восстановить.
+// Классы и сотрудники, удаленные вместе со школой, отдельно не показываются: они в Cascaded.
+type TrashItem struct {
+	Kind      string    `json:"kind"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Details   string    `json:"details"` // школа класса, логин пользователя, класс типа уравнения
+	Cascaded  int       `json:"cascaded"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// KindTitle - вид объекта для интерфейса
+func (t *TrashItem) KindTitle() string {
+	switch t.Kind {
+	case TrashSchool:
+		return "Школа"
+	case TrashClass:
+		return "Класс"
+	case TrashUser:
+		return "Пользователь"
+	case TrashEquationType:
+		return "Тип уравнения"
+	default:
+		return t.Kind
+	}
+}
+
+// PurgeAt - когда объект будет удален окончательно при сроке хранения retention
+func (t *TrashItem) PurgeAt(retention time.Duration) time.Time {
+	return t.DeletedAt.Add(retention)
+}
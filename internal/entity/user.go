@@ -6,6 +6,8 @@ type Role struct {
 	ID          int       `json:"id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
+	IsSystem    bool      `json:"is_system"`
+	Permissions []string  `json:"permissions,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -27,7 +29,12 @@ type User struct {
 	Role         *Role     `json:"role,omitempty"`
 	FullName     string    `json:"full_name"`
 	ClassID      *int      `json:"class_id,omitempty"`
+	SchoolID     *int      `json:"school_id,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
+	// Блокировка администратором или учителем (в отличие от временной блокировки после неудачных входов)
+	Blocked       bool       `json:"blocked"`
+	BlockedReason string     `json:"blocked_reason,omitempty"`
+	BlockedAt     *time.Time `json:"blocked_at,omitempty"`
 }
 
 type Class struct {
@@ -37,12 +44,18 @@ type Class struct {
 	TeacherID int       `json:"teacher_id"`
 	SchoolID  *int      `json:"school_id,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
+	// StaffRole - роль вошедшего сотрудника в классе, заполняется только в области учителя
+	StaffRole string `json:"staff_role,omitempty"`
 }
 
 type UserSession struct {
 	ID           int       `json:"id"`
 	UserID       int       `json:"user_id"`
-	SessionToken string    `json:"session_token"`
+	SessionToken string    `json:"-"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	CreatedAt    time.Time `json:"created_at"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+	UserAgent    string    `json:"user_agent"`
+	IPAddress    string    `json:"ip_address"`
+	Current      bool      `json:"current"`
 }
@@ -49,6 +49,13 @@ func NewGenerator() *Generator {
 	}
 }
 
+// NewSeededGenerator - генератор с заданным зерном: одинаковое зерно дает одинаковые примеры
+func NewSeededGenerator(seed int64) *Generator {
+	return &Generator{
+		randSource: rand.New(rand.NewSource(seed)),
+	}
+}
+
 func (g *Generator) GenerateEquation(t EquationType) (Equation, error) {
 	vars := make([]string, t.NumOperands)
 	ops := make([]string, t.NumOperands-1)
@@ -1,31 +1,66 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
+	"edugame/internal"
 	"edugame/internal/entity"
 	"edugame/internal/generator"
+	middleware "edugame/internal/midlleware"
 	"edugame/internal/repository"
+	"encoding/csv"
+	"errors"
+	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/lib/pq"
 )
 
 type AdminHandler struct {
-	schoolRepo *repository.SchoolRepository
-	classRepo  *repository.ClassRepository
-	userRepo   *repository.UserRepository
-	roleRepo   *repository.RoleRepository
-	typeRepo   *repository.TypeRepository
-	tmpl       *template.Template
+	schoolRepo  repository.Schools
+	classRepo   repository.Classes
+	staffRepo   repository.ClassStaff
+	userRepo    repository.Users
+	roleRepo    repository.Roles
+	typeRepo    repository.Types
+	sessionRepo repository.Sessions
+	inviteRepo  repository.Invites
+	permRepo    repository.Permissions
+	auditRepo   repository.AuditLog
+	oidcRepo    repository.OIDCProviders
+	trashRepo   repository.Trash
+	yearRepo    repository.AcademicYears
+	dataRepo    repository.StudentData
+	audit       *Auditor
+	tmpl        *template.Template
+	store       *sessions.CookieStore
 }
 
 func NewAdminHandler(
-	schoolRepo *repository.SchoolRepository,
-	classRepo *repository.ClassRepository,
-	userRepo *repository.UserRepository,
-	roleRepo *repository.RoleRepository,
-	typeRepo *repository.TypeRepository,
+	schoolRepo repository.Schools,
+	classRepo repository.Classes,
+	staffRepo repository.ClassStaff,
+	userRepo repository.Users,
+	roleRepo repository.Roles,
+	typeRepo repository.Types,
+	sessionRepo repository.Sessions,
+	inviteRepo repository.Invites,
+	permRepo repository.Permissions,
+	auditRepo repository.AuditLog,
+	oidcRepo repository.OIDCProviders,
+	trashRepo repository.Trash,
+	yearRepo repository.AcademicYears,
+	dataRepo repository.StudentData,
+	store *sessions.CookieStore,
 ) *AdminHandler {
 	tmpl := template.Must(template.ParseFiles(
 		"internal/templates/admin/dashboard.html",
@@ -37,27 +72,49 @@ func NewAdminHandler(
 		"internal/templates/admin/user_form.html",
 		"internal/templates/admin/equation_types.html",
 		"internal/templates/admin/equation_type_form.html",
+		"internal/templates/admin/invites.html",
+		"internal/templates/admin/roles.html",
+		"internal/templates/admin/role_form.html",
+		"internal/templates/admin/audit.html",
+		"internal/templates/admin/oidc_providers.html",
+		"internal/templates/admin/oidc_provider_form.html",
+		"internal/templates/admin/trash.html",
+		"internal/templates/admin/years.html",
+		"internal/templates/admin/year_rollover.html",
+		"internal/templates/admin/year_view.html",
 	))
 
 	return &AdminHandler{
-		schoolRepo: schoolRepo,
-		classRepo:  classRepo,
-		userRepo:   userRepo,
-		roleRepo:   roleRepo,
-		typeRepo:   typeRepo,
-		tmpl:       tmpl,
+		schoolRepo:  schoolRepo,
+		classRepo:   classRepo,
+		staffRepo:   staffRepo,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		typeRepo:    typeRepo,
+		sessionRepo: sessionRepo,
+		inviteRepo:  inviteRepo,
+		permRepo:    permRepo,
+		auditRepo:   auditRepo,
+		oidcRepo:    oidcRepo,
+		trashRepo:   trashRepo,
+		yearRepo:    yearRepo,
+		dataRepo:    dataRepo,
+		audit:       NewAuditor(auditRepo, store),
+		tmpl:        tmpl,
+		store:       store,
 	}
 }
 
 // Dashboard - главная страница админки
 func (h *AdminHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
-	schools, _ := h.schoolRepo.GetAll()
-	classes, _ := h.classRepo.GetAll()
-	users, _ := h.userRepo.GetAllUsers()
-	types, _ := h.typeRepo.GetAll()
+	schools, _ := h.schoolRepo.GetAll(r.Context())
+	classes, _ := h.classRepo.GetAll(r.Context())
+	users, _ := h.userRepo.GetAllUsers(r.Context())
+	types, _ := h.typeRepo.GetAll(r.Context())
 
 	data := map[string]interface{}{
 		"Title":        "Админ-панель",
+		"CSRFToken":    middleware.CSRFToken(r),
 		"SchoolsCount": len(schools),
 		"ClassesCount": len(classes),
 		"UsersCount":   len(users),
@@ -74,15 +131,16 @@ func (h *AdminHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 
 // Schools - список всех школ
 func (h *AdminHandler) Schools(w http.ResponseWriter, r *http.Request) {
-	schools, err := h.schoolRepo.GetAll()
+	schools, err := h.schoolRepo.GetAll(r.Context())
 	if err != nil {
-		http.Error(w, "Ошибка получения школ", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения школ", err)
 		return
 	}
 
 	data := map[string]interface{}{
-		"Title":   "Управление школами",
-		"Schools": schools,
+		"Title":     "Управление школами",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Schools":   schools,
 	}
 
 	h.tmpl.ExecuteTemplate(w, "schools.html", data)
@@ -93,14 +151,15 @@ func (h *AdminHandler) SchoolForm(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 
 	data := map[string]interface{}{
-		"Title":  "Новая школа",
-		"School": nil,
+		"Title":     "Новая школа",
+		"CSRFToken": middleware.CSRFToken(r),
+		"School":    nil,
 	}
 
 	if idStr != "" {
 		id, err := strconv.Atoi(idStr)
 		if err == nil {
-			school, err := h.schoolRepo.GetByID(id)
+			school, err := h.schoolRepo.GetByID(r.Context(), id)
 			if err == nil {
 				data["School"] = school
 				data["Title"] = "Редактирование школы"
@@ -123,12 +182,14 @@ func (h *AdminHandler) SchoolCreate(w http.ResponseWriter, r *http.Request) {
 	phone := r.FormValue("phone")
 	email := r.FormValue("email")
 
-	_, err := h.schoolRepo.Create(name, address, phone, email)
+	school, err := h.schoolRepo.Create(r.Context(), name, address, phone, email)
 	if err != nil {
-		http.Error(w, "Ошибка создания школы", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка создания школы", err)
 		return
 	}
 
+	h.audit.Record(r, "school.create", "school", school.ID, nil, school)
+
 	http.Redirect(w, r, "/admin/schools", http.StatusSeeOther)
 }
 
@@ -151,12 +212,16 @@ func (h *AdminHandler) SchoolUpdate(w http.ResponseWriter, r *http.Request) {
 	phone := r.FormValue("phone")
 	email := r.FormValue("email")
 
-	_, err = h.schoolRepo.Update(id, name, address, phone, email)
+	before, _ := h.schoolRepo.GetByID(r.Context(), id)
+
+	school, err := h.schoolRepo.Update(r.Context(), id, name, address, phone, email)
 	if err != nil {
-		http.Error(w, "Ошибка обновления школы", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка обновления школы", err)
 		return
 	}
 
+	h.audit.Record(r, "school.update", "school", id, before, school)
+
 	http.Redirect(w, r, "/admin/schools", http.StatusSeeOther)
 }
 
@@ -174,12 +239,16 @@ func (h *AdminHandler) SchoolDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.schoolRepo.Delete(id)
+	before, _ := h.schoolRepo.GetByID(r.Context(), id)
+
+	err = h.schoolRepo.Delete(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Ошибка удаления школы", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка удаления школы", err)
 		return
 	}
 
+	h.audit.Record(r, "school.delete", "school", id, before, nil)
+
 	http.Redirect(w, r, "/admin/schools", http.StatusSeeOther)
 }
 
@@ -187,20 +256,21 @@ func (h *AdminHandler) SchoolDelete(w http.ResponseWriter, r *http.Request) {
 
 // Classes - список всех классов
 func (h *AdminHandler) Classes(w http.ResponseWriter, r *http.Request) {
-	classes, err := h.classRepo.GetAll()
+	classes, err := h.classRepo.GetAll(r.Context())
 	if err != nil {
-		http.Error(w, "Ошибка получения классов", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения классов", err)
 		return
 	}
 
-	schools, _ := h.schoolRepo.GetAll()
-	teachers, _ := h.userRepo.GetUserByRoleType("teacher")
+	schools, _ := h.schoolRepo.GetAll(r.Context())
+	teachers, _ := h.userRepo.GetUserByRoleType(r.Context(), "teacher")
 
 	data := map[string]interface{}{
-		"Title":    "Управление классами",
-		"Classes":  classes,
-		"Schools":  schools,
-		"Teachers": teachers,
+		"Title":     "Управление классами",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Classes":   classes,
+		"Schools":   schools,
+		"Teachers":  teachers,
 	}
 
 	h.tmpl.ExecuteTemplate(w, "classes.html", data)
@@ -210,23 +280,36 @@ func (h *AdminHandler) Classes(w http.ResponseWriter, r *http.Request) {
 func (h *AdminHandler) ClassForm(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 
-	schools, _ := h.schoolRepo.GetAll()
-	teachers, _ := h.userRepo.GetUserByRoleType("teacher")
+	schools, _ := h.schoolRepo.GetAll(r.Context())
+	teachers, _ := h.userRepo.GetUserByRoleType(r.Context(), "teacher")
 
 	data := map[string]interface{}{
-		"Title":    "Новый класс",
-		"Class":    nil,
-		"Schools":  schools,
-		"Teachers": teachers,
+		"Title":     "Новый класс",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Class":     nil,
+		"Schools":   schools,
+		"Teachers":  teachers,
 	}
 
 	if idStr != "" {
 		id, err := strconv.Atoi(idStr)
 		if err == nil {
-			class, err := h.classRepo.GetByID(id)
+			class, err := h.classRepo.GetByID(r.Context(), id)
 			if err == nil {
 				data["Class"] = class
 				data["Title"] = "Редактирование класса"
+
+				staff, err := h.staffRepo.GetByClass(r.Context(), id)
+				if err != nil {
+					slog.Error("failed to get class staff", "error", err, "class_id", id)
+				}
+				data["Staff"] = staff
+
+				candidates, err := h.userRepo.GetUsersWithPermission(r.Context(), entity.PermClassStatsView)
+				if err != nil {
+					slog.Error("failed to get staff candidates", "error", err, "class_id", id)
+				}
+				data["StaffCandidates"] = candidates
 			}
 		}
 	}
@@ -251,12 +334,14 @@ func (h *AdminHandler) ClassCreate(w http.ResponseWriter, r *http.Request) {
 		schoolID = &id
 	}
 
-	_, err := h.classRepo.Create(name, grade, teacherID, schoolID)
+	class, err := h.classRepo.Create(r.Context(), name, grade, teacherID, schoolID)
 	if err != nil {
-		http.Error(w, "Ошибка создания класса", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка создания класса", err)
 		return
 	}
 
+	h.audit.Record(r, "class.create", "class", class.ID, nil, class)
+
 	http.Redirect(w, r, "/admin/classes", http.StatusSeeOther)
 }
 
@@ -284,12 +369,16 @@ func (h *AdminHandler) ClassUpdate(w http.ResponseWriter, r *http.Request) {
 		schoolID = &id
 	}
 
-	_, err = h.classRepo.Update(id, name, grade, teacherID, schoolID)
+	before, _ := h.classRepo.GetByID(r.Context(), id)
+
+	class, err := h.classRepo.Update(r.Context(), id, name, grade, teacherID, schoolID)
 	if err != nil {
-		http.Error(w, "Ошибка обновления класса", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка обновления класса", err)
 		return
 	}
 
+	h.audit.Record(r, "class.update", "class", id, before, class)
+
 	http.Redirect(w, r, "/admin/classes", http.StatusSeeOther)
 }
 
@@ -307,15 +396,133 @@ func (h *AdminHandler) ClassDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.classRepo.Delete(id)
+	before, _ := h.classRepo.GetByID(r.Context(), id)
+
+	err = h.classRepo.Delete(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Ошибка удаления класса", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка удаления класса", err)
 		return
 	}
 
+	h.audit.Record(r, "class.delete", "class", id, before, nil)
+
 	http.Redirect(w, r, "/admin/classes", http.StatusSeeOther)
 }
 
+// ClassStaffSet добавляет учителя в состав класса или меняет его роль
+func (h *AdminHandler) ClassStaffSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/classes", http.StatusSeeOther)
+		return
+	}
+
+	class, userID, ok := h.staffTarget(w, r)
+	if !ok {
+		return
+	}
+
+	role := r.FormValue("role")
+	if !entity.ValidStaffRole(role) {
+		http.Error(w, "Некорректная роль в классе", http.StatusBadRequest)
+		return
+	}
+
+	// Вести класс может любая роль с правом на статистику класса, в том числе настроенная администратором
+	permissions, err := h.permRepo.GetUserPermissions(r.Context(), userID)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения прав пользователя", err)
+		slog.Error("failed to get user permissions", "error", err, "user_id", userID)
+		return
+	}
+	if !slices.Contains(permissions, entity.PermClassStatsView) {
+		http.Error(w, "Учитель не найден", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.staffRepo.Get(r.Context(), class.ID, userID)
+	if err != nil && err != sql.ErrNoRows {
+		middleware.ServerError(w, "Ошибка получения состава класса", err)
+		slog.Error("failed to get class staff member", "error", err, "class_id", class.ID, "user_id", userID)
+		return
+	}
+
+	if err := h.staffRepo.Set(r.Context(), class.ID, userID, role); err != nil {
+		middleware.ServerError(w, "Ошибка сохранения состава класса", err)
+		slog.Error("failed to set class staff", "error", err, "class_id", class.ID, "user_id", userID)
+		return
+	}
+
+	h.audit.Record(r, "class.staff_set", "class", class.ID, before, map[string]interface{}{
+		"user_id": userID,
+		"role":    role,
+	})
+
+	http.Redirect(w, r, "/admin/classes/edit?id="+strconv.Itoa(class.ID), http.StatusSeeOther)
+}
+
+// ClassStaffRemove исключает учителя из состава класса
+func (h *AdminHandler) ClassStaffRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/classes", http.StatusSeeOther)
+		return
+	}
+
+	class, userID, ok := h.staffTarget(w, r)
+	if !ok {
+		return
+	}
+
+	before, _ := h.staffRepo.Get(r.Context(), class.ID, userID)
+
+	removed, err := h.staffRepo.Remove(r.Context(), class.ID, userID)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка изменения состава класса", err)
+		slog.Error("failed to remove class staff", "error", err, "class_id", class.ID, "user_id", userID)
+		return
+	}
+	if !removed {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.audit.Record(r, "class.staff_remove", "class", class.ID, before, nil)
+
+	http.Redirect(w, r, "/admin/classes/edit?id="+strconv.Itoa(class.ID), http.StatusSeeOther)
+}
+
+// staffTarget разбирает class_id и user_id формы состава класса. Учитель класса
+// (classes.teacher_id) всегда ведущий и меняется только в основной форме класса.
+func (h *AdminHandler) staffTarget(w http.ResponseWriter, r *http.Request) (*entity.Class, int, bool) {
+	classID, err := strconv.Atoi(r.FormValue("class_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID класса", http.StatusBadRequest)
+		return nil, 0, false
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID учителя", http.StatusBadRequest)
+		return nil, 0, false
+	}
+
+	class, err := h.classRepo.GetByID(r.Context(), classID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return nil, 0, false
+	}
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения класса", err)
+		return nil, 0, false
+	}
+
+	if userID == class.TeacherID {
+		http.Error(w, "Учитель класса меняется в форме класса", http.StatusBadRequest)
+		return nil, 0, false
+	}
+
+	return class, userID, true
+}
+
 // ============= ПОЛЬЗОВАТЕЛИ =============
 
 // Users - список всех пользователей
@@ -326,22 +533,23 @@ func (h *AdminHandler) Users(w http.ResponseWriter, r *http.Request) {
 	var users []entity.User
 	var err error
 	if roleFilter != "" {
-		users, err = h.userRepo.GetUserByRoleType(roleFilter)
+		users, err = h.userRepo.GetUserByRoleType(r.Context(), roleFilter)
 	} else {
-		users, err = h.userRepo.GetAllUsers()
+		users, err = h.userRepo.GetAllUsers(r.Context())
 	}
 
 	if err != nil {
-		http.Error(w, "Ошибка получения пользователей", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения пользователей", err)
 		slog.Error("failed to get users", "error", err)
 		return
 	}
 
-	roles, _ := h.roleRepo.GetAll()
-	schools, _ := h.schoolRepo.GetAll()
+	roles, _ := h.roleRepo.GetAll(r.Context())
+	schools, _ := h.schoolRepo.GetAll(r.Context())
 
 	data := map[string]interface{}{
 		"Title":      "Управление пользователями",
+		"CSRFToken":  middleware.CSRFToken(r),
 		"Users":      users,
 		"Roles":      roles,
 		"Schools":    schools,
@@ -355,22 +563,23 @@ func (h *AdminHandler) Users(w http.ResponseWriter, r *http.Request) {
 func (h *AdminHandler) UserForm(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 
-	roles, _ := h.roleRepo.GetAll()
-	schools, _ := h.schoolRepo.GetAll()
-	classes, _ := h.classRepo.GetAll()
+	roles, _ := h.roleRepo.GetAll(r.Context())
+	schools, _ := h.schoolRepo.GetAll(r.Context())
+	classes, _ := h.classRepo.GetAll(r.Context())
 
 	data := map[string]interface{}{
-		"Title":   "Новый пользователь",
-		"User":    nil,
-		"Roles":   roles,
-		"Schools": schools,
-		"Classes": classes,
+		"Title":     "Новый пользователь",
+		"CSRFToken": middleware.CSRFToken(r),
+		"User":      nil,
+		"Roles":     roles,
+		"Schools":   schools,
+		"Classes":   classes,
 	}
 
 	if idStr != "" {
 		id, err := strconv.Atoi(idStr)
 		if err == nil {
-			user, err := h.userRepo.GetByID(id)
+			user, err := h.userRepo.GetByID(r.Context(), id)
 			if err == nil {
 				data["User"] = user
 				data["Title"] = "Редактирование пользователя"
@@ -399,15 +608,24 @@ func (h *AdminHandler) UserCreate(w http.ResponseWriter, r *http.Request) {
 		classID = &id
 	}
 
-	_, err := h.userRepo.Register(username, password, roleName, fullName, classID)
+	user, err := h.userRepo.Register(r.Context(), username, password, roleName, fullName, classID)
 	if err != nil {
-		http.Error(w, "Ошибка создания пользователя", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка создания пользователя", err)
 		return
 	}
 
+	h.audit.Record(r, "user.create", "user", user.ID, nil, userAuditState(user))
+
 	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
+// roleNeedsSchool - роль видит статистику одной школы (директор или настроенная администратором),
+// поэтому без школы ее пользователю нечего показать
+func roleNeedsSchool(role *entity.Role) bool {
+	return slices.Contains(role.Permissions, entity.PermSchoolStatsView) &&
+		!slices.Contains(role.Permissions, entity.PermDistrictStatsView)
+}
+
 // UserUpdate - обновление пользователя
 func (h *AdminHandler) UserUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -433,12 +651,21 @@ func (h *AdminHandler) UserUpdate(w http.ResponseWriter, r *http.Request) {
 		schoolID = &id
 	}
 
-	_, err = h.userRepo.UpdateUser(id, username, fullName, email, roleID, schoolID)
+	if role, err := h.roleRepo.GetByID(r.Context(), roleID); err == nil && roleNeedsSchool(role) && schoolID == nil {
+		http.Error(w, "Пользователя с этой ролью нужно привязать к школе", http.StatusBadRequest)
+		return
+	}
+
+	before, _ := h.userRepo.GetByID(r.Context(), id)
+
+	user, err := h.userRepo.UpdateUser(r.Context(), id, username, fullName, email, roleID, schoolID)
 	if err != nil {
-		http.Error(w, "Ошибка обновления пользователя", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка обновления пользователя", err)
 		return
 	}
 
+	h.audit.Record(r, "user.update", "user", id, userAuditState(before), userAuditState(user))
+
 	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
@@ -456,219 +683,1432 @@ func (h *AdminHandler) UserDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.userRepo.DeleteUser(id)
+	before, _ := h.userRepo.GetByID(r.Context(), id)
+
+	err = h.userRepo.DeleteUser(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Ошибка удаления пользователя", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка удаления пользователя", err)
 		return
 	}
 
+	h.audit.Record(r, "user.delete", "user", id, userAuditState(before), nil)
+
 	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
-// ============= ТИПЫ УРАВНЕНИЙ =============
+// UserLogout - принудительно завершает все сеансы пользователя
+func (h *AdminHandler) UserLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
 
-// EquationTypes - список всех типов уравнений
-func (h *AdminHandler) EquationTypes(w http.ResponseWriter, r *http.Request) {
-	types, err := h.typeRepo.GetAll()
+	idStr := r.FormValue("id")
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Ошибка получения типов уравнений", http.StatusInternalServerError)
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
 		return
 	}
 
-	data := map[string]interface{}{
-		"Title": "Типы уравнений",
-		"Types": types,
+	count, err := h.sessionRepo.DeleteUserSessions(r.Context(), id, "")
+	if err != nil {
+		slog.Error("failed to force logout", "error", err, "user_id", id)
+		middleware.ServerError(w, "Ошибка завершения сеансов", err)
+		return
 	}
 
-	h.tmpl.ExecuteTemplate(w, "equation_types.html", data)
+	slog.Info("admin forced logout", "user_id", id, "sessions", count)
+	h.audit.Record(r, "user.logout", "user", id, nil, map[string]int64{"sessions": count})
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
-// EquationTypeForm - форма создания/редактирования типа уравнения
-func (h *AdminHandler) EquationTypeForm(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
+// UserBlock блокирует пользователя с указанием причины. Сеансы завершаются сразу.
+func (h *AdminHandler) UserBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
 
-	data := map[string]interface{}{
-		"Title": "Новый тип уравнения",
-		"Type":  nil,
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
 	}
 
-	if idStr != "" {
-		id, err := strconv.Atoi(idStr)
-		if err == nil {
-			et, err := h.typeRepo.GetTypeById(id)
-			if err == nil {
-				data["Type"] = et
-				data["Title"] = "Редактирование типа уравнения"
-			}
-		}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" || len([]rune(reason)) > 500 {
+		http.Error(w, "Укажите причину блокировки (до 500 символов)", http.StatusBadRequest)
+		return
 	}
 
-	h.tmpl.ExecuteTemplate(w, "equation_type_form.html", data)
+	session, _ := h.store.Get(r, "app-session")
+	adminID, _ := session.Values["user_id"].(int)
+	if id == adminID {
+		http.Error(w, "Нельзя заблокировать самого себя", http.StatusBadRequest)
+		return
+	}
+
+	before, _ := h.userRepo.GetByID(r.Context(), id)
+
+	if err := h.userRepo.Block(r.Context(), id, reason, adminID); err != nil {
+		slog.Error("failed to block user", "error", err, "user_id", id)
+		middleware.ServerError(w, "Ошибка блокировки пользователя", err)
+		return
+	}
+
+	slog.Info("user blocked", "user_id", id, "admin_id", adminID)
+	after, _ := h.userRepo.GetByID(r.Context(), id)
+	h.audit.Record(r, "user.block", "user", id, userAuditState(before), userAuditState(after))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
-// EquationTypeCreate - создание типа уравнения
-func (h *AdminHandler) EquationTypeCreate(w http.ResponseWriter, r *http.Request) {
+// UserUnblock снимает блокировку пользователя
+func (h *AdminHandler) UserUnblock(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 		return
 	}
 
-	// Парсинг данных формы
-	class, _ := strconv.Atoi(r.FormValue("class"))
-	name := r.FormValue("name")
-	description := r.FormValue("description")
-	operation := r.FormValue("operation")
-	numOperands, _ := strconv.Atoi(r.FormValue("num_operands"))
-
-	op1Min, _ := strconv.Atoi(r.FormValue("operand1_min"))
-	op1Max, _ := strconv.Atoi(r.FormValue("operand1_max"))
-	op2Min, _ := strconv.Atoi(r.FormValue("operand2_min"))
-	op2Max, _ := strconv.Atoi(r.FormValue("operand2_max"))
-	op3Min, _ := strconv.Atoi(r.FormValue("operand3_min"))
-	op3Max, _ := strconv.Atoi(r.FormValue("operand3_max"))
-	op4Min, _ := strconv.Atoi(r.FormValue("operand4_min"))
-	op4Max, _ := strconv.Atoi(r.FormValue("operand4_max"))
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
 
-	noRemainder := r.FormValue("no_remainder") == "on"
+	before, _ := h.userRepo.GetByID(r.Context(), id)
 
-	resultMax, _ := strconv.Atoi(r.FormValue("result_max"))
-	if resultMax == 0 {
-		resultMax = -1
+	if err := h.userRepo.Unblock(r.Context(), id); err != nil {
+		slog.Error("failed to unblock user", "error", err, "user_id", id)
+		middleware.ServerError(w, "Ошибка разблокировки пользователя", err)
+		return
 	}
 
-	operands := []generator.OperandRange{
-		{Order: 1, MinValue: op1Min, MaxValue: op1Max},
-		{Order: 2, MinValue: op2Min, MaxValue: op2Max},
-		{Order: 3, MinValue: op3Min, MaxValue: op3Max},
-		{Order: 4, MinValue: op4Min, MaxValue: op4Max},
-	}
+	slog.Info("user unblocked", "user_id", id)
+	after, _ := h.userRepo.GetByID(r.Context(), id)
+	h.audit.Record(r, "user.unblock", "user", id, userAuditState(before), userAuditState(after))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
 
-	et := generator.EquationType{
-		Class:       class,
-		Name:        name,
-		Description: description,
-		Operation:   operation,
-		NumOperands: numOperands,
-		Operands:    operands,
-		NoRemainder: noRemainder,
-		ResultMax:   resultMax,
+// UserExport выгружает архив со всеми данными ученика для ответа на запрос родителей
+func (h *AdminHandler) UserExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
 	}
 
-	_, err := h.typeRepo.Create(et)
+	id, err := strconv.Atoi(r.FormValue("id"))
 	if err != nil {
-		http.Error(w, "Ошибка создания типа уравнения", http.StatusInternalServerError)
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
 		return
 	}
 
-	http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+	exportStudentData(w, r, h.dataRepo, h.audit, id)
 }
 
-// EquationTypeUpdate - обновление типа уравнения
-func (h *AdminHandler) EquationTypeUpdate(w http.ResponseWriter, r *http.Request) {
+// UserErase обезличивает ученика: персональные данные удаляются, статистика классов остается прежней
+func (h *AdminHandler) UserErase(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 		return
 	}
 
-	idStr := r.FormValue("id")
-	id, err := strconv.Atoi(idStr)
+	id, err := strconv.Atoi(r.FormValue("id"))
 	if err != nil {
 		http.Error(w, "Некорректный ID", http.StatusBadRequest)
 		return
 	}
 
-	// Парсинг данных формы
-	class, _ := strconv.Atoi(r.FormValue("class"))
-	name := r.FormValue("name")
-	description := r.FormValue("description")
-	operation := r.FormValue("operation")
-	numOperands, _ := strconv.Atoi(r.FormValue("num_operands"))
+	session, _ := h.store.Get(r, "app-session")
+	adminID, _ := session.Values["user_id"].(int)
 
-	op1Min, _ := strconv.Atoi(r.FormValue("operand1_min"))
-	op1Max, _ := strconv.Atoi(r.FormValue("operand1_max"))
-	op2Min, _ := strconv.Atoi(r.FormValue("operand2_min"))
-	op2Max, _ := strconv.Atoi(r.FormValue("operand2_max"))
-	op3Min, _ := strconv.Atoi(r.FormValue("operand3_min"))
-	op3Max, _ := strconv.Atoi(r.FormValue("operand3_max"))
-	op4Min, _ := strconv.Atoi(r.FormValue("operand4_min"))
-	op4Max, _ := strconv.Atoi(r.FormValue("operand4_max"))
+	if !eraseStudentData(w, r, h.dataRepo, h.audit, id, adminID) {
+		return
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
 
-	noRemainder := r.FormValue("no_remainder") == "on"
+// ============= РОЛИ =============
 
-	resultMax, _ := strconv.Atoi(r.FormValue("result_max"))
-	if resultMax == 0 {
-		resultMax = -1
+// Roles - список ролей
+func (h *AdminHandler) Roles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.roleRepo.GetAll(r.Context())
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения ролей", err)
+		return
 	}
 
-	operands := []generator.OperandRange{
-		{Order: 1, MinValue: op1Min, MaxValue: op1Max},
-		{Order: 2, MinValue: op2Min, MaxValue: op2Max},
-		{Order: 3, MinValue: op3Min, MaxValue: op3Max},
-		{Order: 4, MinValue: op4Min, MaxValue: op4Max},
-	}
-	et := generator.EquationType{
-		ID:          id,
-		Class:       class,
-		Name:        name,
-		Description: description,
-		Operation:   operation,
-		NumOperands: numOperands,
-		Operands:    operands,
-		NoRemainder: noRemainder,
-		ResultMax:   resultMax,
+	data := map[string]interface{}{
+		"Title":     "Роли и права",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Roles":     roles,
+		"Error":     r.URL.Query().Get("error"),
 	}
 
-	_, err = h.typeRepo.Update(et)
+	h.tmpl.ExecuteTemplate(w, "roles.html", data)
+}
+
+// RoleForm - форма создания/редактирования роли. Встроенные роли открываются только для просмотра.
+func (h *AdminHandler) RoleForm(w http.ResponseWriter, r *http.Request) {
+	permissions, err := h.permRepo.GetAll(r.Context())
 	if err != nil {
-		http.Error(w, "Ошибка обновления типа уравнения", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения прав", err)
 		return
 	}
 
-	http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+	data := map[string]interface{}{
+		"Title":       "Новая роль",
+		"CSRFToken":   middleware.CSRFToken(r),
+		"Role":        nil,
+		"Permissions": permissions,
+		"Granted":     map[string]bool{},
+	}
+
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err == nil {
+			role, err := h.roleRepo.GetByID(r.Context(), id)
+			if err == nil {
+				granted := make(map[string]bool, len(role.Permissions))
+				for _, code := range role.Permissions {
+					granted[code] = true
+				}
+				data["Role"] = role
+				data["Granted"] = granted
+				data["Title"] = "Роль: " + role.Description
+			}
+		}
+	}
+
+	h.tmpl.ExecuteTemplate(w, "role_form.html", data)
 }
 
-// EquationTypeDelete - удаление типа уравнения
-func (h *AdminHandler) EquationTypeDelete(w http.ResponseWriter, r *http.Request) {
+// RoleCreate - создание пользовательской роли
+func (h *AdminHandler) RoleCreate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
 		return
 	}
 
-	idStr := r.FormValue("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Некорректная форма", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(r.FormValue("name")))
+	if !validRoleName(name) {
+		http.Error(w, "Имя роли: от 2 до 50 латинских букв, цифр и знаков _", http.StatusBadRequest)
 		return
 	}
 
-	err = h.typeRepo.Delete(id)
+	description := strings.TrimSpace(r.FormValue("description"))
+	if description == "" {
+		description = name
+	}
+
+	role, err := h.roleRepo.Create(r.Context(), name, description, r.Form["permissions"])
 	if err != nil {
-		http.Error(w, "Ошибка удаления типа уравнения", http.StatusInternalServerError)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			http.Error(w, "Роль с таким именем уже есть", http.StatusConflict)
+			return
+		}
+		slog.Error("failed to create role", "error", err)
+		middleware.ServerError(w, "Ошибка создания роли", err)
 		return
 	}
 
-	http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+	slog.Info("role created", "role", role.Name, "permissions", role.Permissions)
+	h.audit.Record(r, "role.create", "role", role.ID, nil, role)
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
 }
 
-// ToggleEquationTypeAvailability - переключение доступности типа уравнения
-func (h *AdminHandler) ToggleEquationTypeAvailability(w http.ResponseWriter, r *http.Request) {
+// RoleUpdate - изменение описания и прав пользовательской роли
+func (h *AdminHandler) RoleUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
 		return
 	}
 
-	idStr := r.FormValue("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Некорректная форма", http.StatusBadRequest)
 		return
 	}
 
-	err = h.typeRepo.ToggleAvailability(id)
+	id, err := strconv.Atoi(r.FormValue("id"))
 	if err != nil {
-		http.Error(w, "Ошибка переключения доступности", http.StatusInternalServerError)
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
 		return
 	}
 
+	before, _ := h.roleRepo.GetByID(r.Context(), id)
+
+	err = h.roleRepo.Update(r.Context(), id, strings.TrimSpace(r.FormValue("description")), r.Form["permissions"])
+	if errors.Is(err, repository.ErrSystemRole) {
+		http.Error(w, "Встроенную роль изменить нельзя", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to update role", "error", err, "role_id", id)
+		middleware.ServerError(w, "Ошибка обновления роли", err)
+		return
+	}
+
+	slog.Info("role updated", "role_id", id, "permissions", r.Form["permissions"])
+	after, _ := h.roleRepo.GetByID(r.Context(), id)
+	h.audit.Record(r, "role.update", "role", id, before, after)
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
+
+// RoleDelete - удаление пользовательской роли, которая никому не назначена
+func (h *AdminHandler) RoleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
+
+	before, _ := h.roleRepo.GetByID(r.Context(), id)
+
+	err = h.roleRepo.Delete(r.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrSystemRole):
+		http.Redirect(w, r, "/admin/roles?error=system", http.StatusSeeOther)
+		return
+	case errors.Is(err, repository.ErrRoleInUse):
+		http.Redirect(w, r, "/admin/roles?error=in_use", http.StatusSeeOther)
+		return
+	case err != nil:
+		slog.Error("failed to delete role", "error", err, "role_id", id)
+		middleware.ServerError(w, "Ошибка удаления роли", err)
+		return
+	}
+
+	h.audit.Record(r, "role.delete", "role", id, before, nil)
+
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
+
+// validRoleName - имя роли хранится в сессии и логах, поэтому только латиница, цифры и _
+func validRoleName(name string) bool {
+	if len(name) < 2 || len(name) > 50 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ============= ПРИГЛАШЕНИЯ =============
+
+// Invites - приглашения сотрудников
+func (h *AdminHandler) Invites(w http.ResponseWriter, r *http.Request) {
+	h.renderInvites(w, r, "")
+}
+
+// InviteCreate - создание ссылки-приглашения. Ссылка показывается один раз.
+func (h *AdminHandler) InviteCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+		return
+	}
+
+	roleID, err := strconv.Atoi(r.FormValue("role_id"))
+	if err != nil {
+		http.Error(w, "Некорректная роль", http.StatusBadRequest)
+		return
+	}
+
+	role, err := h.roleRepo.GetByID(r.Context(), roleID)
+	if err != nil || role.Name == "student" {
+		http.Error(w, "Некорректная роль", http.StatusBadRequest)
+		return
+	}
+
+	var schoolID *int
+	if schoolIDStr := r.FormValue("school_id"); schoolIDStr != "" {
+		id, _ := strconv.Atoi(schoolIDStr)
+		schoolID = &id
+	}
+
+	if roleNeedsSchool(role) && schoolID == nil {
+		http.Error(w, "Пользователя с этой ролью нужно привязать к школе", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := h.store.Get(r, "app-session")
+	adminID, _ := session.Values["user_id"].(int)
+
+	token, err := h.inviteRepo.Create(r.Context(), roleID, schoolID, strings.TrimSpace(r.FormValue("note")), adminID, internal.StaffInviteTTL)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка создания приглашения", err)
+		slog.Error("failed to create invite", "error", err)
+		return
+	}
+
+	slog.Info("staff invite created", "admin_id", adminID, "role", role.Name)
+	// Сам токен в журнал не попадает: по нему можно зарегистрироваться
+	h.audit.Record(r, "invite.create", "invite", 0, nil, map[string]interface{}{
+		"role":      role.Name,
+		"school_id": schoolID,
+		"note":      strings.TrimSpace(r.FormValue("note")),
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.renderInvites(w, r, middleware.BaseURL(r)+"/invite?token="+url.QueryEscape(token))
+}
+
+// InviteRevoke - отзыв неиспользованного приглашения
+func (h *AdminHandler) InviteRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.inviteRepo.Revoke(r.Context(), id); err != nil {
+		middleware.ServerError(w, "Ошибка отзыва приглашения", err)
+		return
+	}
+
+	h.audit.Record(r, "invite.revoke", "invite", id, nil, nil)
+
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
+
+func (h *AdminHandler) renderInvites(w http.ResponseWriter, r *http.Request, newLink string) {
+	invites, err := h.inviteRepo.GetAll(r.Context(), 100)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения приглашений", err)
+		slog.Error("failed to get invites", "error", err)
+		return
+	}
+
+	roles, _ := h.roleRepo.GetAll(r.Context())
+	var staffRoles []entity.Role
+	for _, role := range roles {
+		if role.Name != "student" {
+			staffRoles = append(staffRoles, role)
+		}
+	}
+
+	schools, _ := h.schoolRepo.GetAll(r.Context())
+
+	data := map[string]interface{}{
+		"Title":     "Приглашения сотрудников",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Invites":   invites,
+		"Roles":     staffRoles,
+		"Schools":   schools,
+		"NewLink":   newLink,
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "invites.html", data); err != nil {
+		slog.Error("failed to render invites", "error", err)
+	}
+}
+
+// ============= ВХОД ЧЕРЕЗ SSO =============
+
+// OIDCProviders - провайдеры единого входа
+func (h *AdminHandler) OIDCProviders(w http.ResponseWriter, r *http.Request) {
+	providers, err := h.oidcRepo.GetAll(r.Context())
+	if err != nil {
+		slog.Error("failed to get oidc providers", "error", err)
+		middleware.ServerError(w, "Ошибка получения провайдеров", err)
+		return
+	}
+
+	schools, _ := h.schoolRepo.GetAll(r.Context())
+	schoolNames := make(map[int]string)
+	for _, p := range providers {
+		for _, school := range schools {
+			if p.SchoolID != nil && *p.SchoolID == school.ID {
+				schoolNames[p.ID] = school.Name
+			}
+		}
+	}
+
+	data := map[string]interface{}{
+		"Title":       "Вход через SSO",
+		"CSRFToken":   middleware.CSRFToken(r),
+		"Providers":   providers,
+		"SchoolNames": schoolNames,
+		"CallbackURL": middleware.BaseURL(r) + "/auth/oidc/callback",
+	}
+
+	h.tmpl.ExecuteTemplate(w, "oidc_providers.html", data)
+}
+
+// OIDCProviderForm - форма создания/редактирования провайдера
+func (h *AdminHandler) OIDCProviderForm(w http.ResponseWriter, r *http.Request) {
+	provider := &entity.OIDCProvider{
+		Scopes:        "openid profile",
+		UsernameClaim: "preferred_username",
+		NameClaim:     "name",
+		RoleClaim:     "roles",
+		Enabled:       true,
+	}
+	title := "Новый провайдер входа"
+
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err == nil {
+			if existing, err := h.oidcRepo.GetByID(r.Context(), id); err == nil {
+				provider = existing
+				title = "Провайдер: " + existing.Name
+			}
+		}
+	}
+
+	var mapping []string
+	for value, role := range provider.RoleMapping {
+		mapping = append(mapping, value+"="+role)
+	}
+	sort.Strings(mapping)
+
+	schoolID := 0
+	if provider.SchoolID != nil {
+		schoolID = *provider.SchoolID
+	}
+
+	schools, _ := h.schoolRepo.GetAll(r.Context())
+	roles, _ := h.roleRepo.GetAll(r.Context())
+	var ssoRoles []entity.Role
+	for _, role := range roles {
+		if role.Name != "admin" {
+			ssoRoles = append(ssoRoles, role)
+		}
+	}
+
+	data := map[string]interface{}{
+		"Title":       title,
+		"CSRFToken":   middleware.CSRFToken(r),
+		"Provider":    provider,
+		"RoleMapping": strings.Join(mapping, "\n"),
+		"SchoolID":    schoolID,
+		"Schools":     schools,
+		"Roles":       ssoRoles,
+		"CallbackURL": middleware.BaseURL(r) + "/auth/oidc/callback",
+	}
+
+	h.tmpl.ExecuteTemplate(w, "oidc_provider_form.html", data)
+}
+
+// OIDCProviderCreate - добавление провайдера
+func (h *AdminHandler) OIDCProviderCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/sso", http.StatusSeeOther)
+		return
+	}
+
+	provider, err := h.parseOIDCProviderForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.oidcRepo.Create(r.Context(), provider); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			http.Error(w, "Провайдер с таким кодом уже есть", http.StatusConflict)
+			return
+		}
+		slog.Error("failed to create oidc provider", "error", err)
+		middleware.ServerError(w, "Ошибка создания провайдера", err)
+		return
+	}
+
+	h.audit.Record(r, "oidc_provider.create", "oidc_provider", provider.ID, nil, provider)
+	http.Redirect(w, r, "/admin/sso", http.StatusSeeOther)
+}
+
+// OIDCProviderUpdate - изменение настроек провайдера
+func (h *AdminHandler) OIDCProviderUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/sso", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
+
+	provider, err := h.parseOIDCProviderForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	provider.ID = id
+
+	before, _ := h.oidcRepo.GetByID(r.Context(), id)
+
+	err = h.oidcRepo.Update(r.Context(), provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			http.Error(w, "Провайдер с таким кодом уже есть", http.StatusConflict)
+			return
+		}
+		slog.Error("failed to update oidc provider", "error", err, "provider_id", id)
+		middleware.ServerError(w, "Ошибка обновления провайдера", err)
+		return
+	}
+
+	after, _ := h.oidcRepo.GetByID(r.Context(), id)
+	h.audit.Record(r, "oidc_provider.update", "oidc_provider", id, before, after)
+	http.Redirect(w, r, "/admin/sso", http.StatusSeeOther)
+}
+
+// OIDCProviderDelete - удаление провайдера вместе с привязками пользователей
+func (h *AdminHandler) OIDCProviderDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/sso", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
+
+	before, _ := h.oidcRepo.GetByID(r.Context(), id)
+
+	if err := h.oidcRepo.Delete(r.Context(), id); err != nil {
+		slog.Error("failed to delete oidc provider", "error", err, "provider_id", id)
+		middleware.ServerError(w, "Ошибка удаления провайдера", err)
+		return
+	}
+
+	h.audit.Record(r, "oidc_provider.delete", "oidc_provider", id, before, nil)
+	http.Redirect(w, r, "/admin/sso", http.StatusSeeOther)
+}
+
+// parseOIDCProviderForm проверяет форму провайдера. Роли в сопоставлении должны существовать,
+// роль администратора через SSO не выдается.
+func (h *AdminHandler) parseOIDCProviderForm(r *http.Request) (*entity.OIDCProvider, error) {
+	provider := &entity.OIDCProvider{
+		Slug:              strings.ToLower(strings.TrimSpace(r.FormValue("slug"))),
+		Name:              strings.TrimSpace(r.FormValue("name")),
+		Issuer:            strings.TrimSuffix(strings.TrimSpace(r.FormValue("issuer")), "/"),
+		ClientID:          strings.TrimSpace(r.FormValue("client_id")),
+		ClientSecret:      r.FormValue("client_secret"),
+		Scopes:            strings.Join(strings.Fields(r.FormValue("scopes")), " "),
+		UsernameClaim:     strings.TrimSpace(r.FormValue("username_claim")),
+		NameClaim:         strings.TrimSpace(r.FormValue("name_claim")),
+		RoleClaim:         strings.TrimSpace(r.FormValue("role_claim")),
+		DefaultRole:       strings.TrimSpace(r.FormValue("default_role")),
+		AllowProvisioning: r.FormValue("allow_provisioning") == "on",
+		Enabled:           r.FormValue("enabled") == "on",
+		RoleMapping:       map[string]string{},
+	}
+
+	if !validProviderSlug(provider.Slug) {
+		return nil, errors.New("код провайдера: от 2 до 50 латинских букв, цифр, знаков - и _")
+	}
+	if provider.Name == "" || provider.ClientID == "" {
+		return nil, errors.New("укажите название и client ID")
+	}
+
+	issuer, err := url.Parse(provider.Issuer)
+	if err != nil || issuer.Host == "" || (issuer.Scheme != "https" && issuer.Hostname() != "localhost" && issuer.Hostname() != "127.0.0.1") {
+		return nil, errors.New("issuer должен быть адресом https:// (http допускается только для localhost)")
+	}
+
+	if provider.Scopes == "" {
+		provider.Scopes = "openid profile"
+	}
+	if provider.UsernameClaim == "" {
+		provider.UsernameClaim = "preferred_username"
+	}
+	if provider.NameClaim == "" {
+		provider.NameClaim = "name"
+	}
+	if provider.RoleClaim == "" {
+		provider.RoleClaim = "roles"
+	}
+
+	if schoolIDStr := r.FormValue("school_id"); schoolIDStr != "" {
+		id, err := strconv.Atoi(schoolIDStr)
+		if err != nil {
+			return nil, errors.New("некорректная школа")
+		}
+		provider.SchoolID = &id
+	}
+
+	roles, err := h.roleRepo.GetAll(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		known[role.Name] = role.Name != "admin"
+	}
+
+	for _, line := range strings.Split(r.FormValue("role_mapping"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		value, role, ok := strings.Cut(line, "=")
+		value, role = strings.TrimSpace(value), strings.TrimSpace(role)
+		if !ok || value == "" || !known[role] {
+			return nil, fmt.Errorf("некорректное сопоставление ролей: %q", line)
+		}
+		provider.RoleMapping[value] = role
+	}
+
+	if provider.DefaultRole != "" && !known[provider.DefaultRole] {
+		return nil, errors.New("некорректная роль по умолчанию")
+	}
+
+	return provider, nil
+}
+
+// validProviderSlug - код провайдера попадает в адрес входа
+func validProviderSlug(slug string) bool {
+	if len(slug) < 2 || len(slug) > 50 {
+		return false
+	}
+	for _, c := range slug {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// ============= ЖУРНАЛ АУДИТА =============
+
+const auditPageSize = 50
+
+// Audit - журнал действий с фильтрами и постраничным выводом
+func (h *AdminHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	total, err := h.auditRepo.Count(r.Context(), filter)
+	if err != nil {
+		slog.Error("failed to count audit entries", "error", err)
+		middleware.ServerError(w, "Ошибка получения журнала", err)
+		return
+	}
+
+	entries, err := h.auditRepo.Find(r.Context(), filter, auditPageSize, (page-1)*auditPageSize)
+	if err != nil {
+		slog.Error("failed to get audit entries", "error", err)
+		middleware.ServerError(w, "Ошибка получения журнала", err)
+		return
+	}
+
+	// Ссылки на соседние страницы и выгрузку сохраняют фильтры
+	pageURL := func(n int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(n))
+		return "/admin/audit?" + query.Encode()
+	}
+	exportQuery := r.URL.Query()
+	exportQuery.Del("page")
+
+	data := map[string]interface{}{
+		"Title":     "Журнал аудита",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Entries":   entries,
+		"Filter":    r.URL.Query(),
+		"Total":     total,
+		"Page":      page,
+		"ExportURL": "/admin/audit/export?" + exportQuery.Encode(),
+	}
+	if page > 1 {
+		data["PrevURL"] = pageURL(page - 1)
+	}
+	if page*auditPageSize < total {
+		data["NextURL"] = pageURL(page + 1)
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "audit.html", data); err != nil {
+		slog.Error("failed to render audit log", "error", err)
+	}
+}
+
+// AuditExport - выгрузка журнала в CSV с теми же фильтрами, что и на странице
+func (h *AdminHandler) AuditExport(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Журнал только растет, поэтому записи пишутся в ответ по мере чтения, а не собираются в памяти.
+	// Заголовки отправляются с первой записью: если запрос упадет сразу, клиент получит код ошибки.
+	var cw *csv.Writer
+	err = h.auditRepo.Each(r.Context(), filter, func(e entity.AuditEntry) error {
+		if cw == nil {
+			cw = startAuditCSV(w)
+		}
+		return cw.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.CreatedAt.Format(time.RFC3339),
+			optionalID(e.ActorID),
+			csvCell(e.ActorName),
+			csvCell(e.Action),
+			csvCell(e.TargetType),
+			optionalID(e.TargetID),
+			csvCell(e.Before),
+			csvCell(e.After),
+			csvCell(e.IPAddress),
+		})
+	})
+	if err != nil && cw == nil {
+		slog.Error("failed to export audit entries", "error", err)
+		middleware.ServerError(w, "Ошибка выгрузки журнала", err)
+		return
+	}
+	if err != nil {
+		// Часть файла уже отправлена, код ответа не изменить - обрываем выгрузку
+		slog.Error("audit export interrupted", "error", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if cw == nil {
+		cw = startAuditCSV(w)
+	}
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		slog.Error("failed to write audit csv", "error", err)
+	}
+}
+
+// startAuditCSV отправляет заголовки выгрузки журнала и строку с названиями колонок
+func startAuditCSV(w http.ResponseWriter) *csv.Writer {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-`+time.Now().Format("20060102-150405")+`.csv"`)
+
+	// BOM, чтобы Excel распознал UTF-8
+	w.Write([]byte("\xEF\xBB\xBF"))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created_at", "actor_id", "actor_name", "action", "target_type", "target_id", "before", "after", "ip_address"})
+	return cw
+}
+
+// csvCell защищает ячейку от выполнения как формулы в Excel: ФИО сотрудник задает сам,
+// и значение вида "=HYPERLINK(...)" сработало бы у администратора, открывшего выгрузку
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// parseAuditFilter читает фильтры журнала из запроса. Даты в формате ГГГГ-ММ-ДД, "по" включительно.
+func parseAuditFilter(query url.Values) (repository.AuditFilter, error) {
+	filter := repository.AuditFilter{
+		Actor:      strings.TrimSpace(query.Get("actor")),
+		Action:     strings.TrimSpace(query.Get("action")),
+		TargetType: strings.TrimSpace(query.Get("target_type")),
+	}
+
+	if v := query.Get("target_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, errors.New("некорректный ID объекта")
+		}
+		filter.TargetID = &id
+	}
+
+	if v := query.Get("from"); v != "" {
+		from, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return filter, errors.New("некорректная дата начала")
+		}
+		filter.From = &from
+	}
+
+	if v := query.Get("to"); v != "" {
+		to, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return filter, errors.New("некорректная дата окончания")
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	return filter, nil
+}
+
+func optionalID(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
+
+// ============= КОРЗИНА =============
+
+// trashPermissions - право, с которым можно видеть и восстанавливать объект корзины:
+// то же, что нужно для его удаления
+var trashPermissions = map[string]string{
+	entity.TrashSchool:       entity.PermSchoolsManage,
+	entity.TrashClass:        entity.PermSchoolsManage,
+	entity.TrashUser:         entity.PermUsersManage,
+	entity.TrashEquationType: entity.PermEquationTypesManage,
+}
+
+// Trash - удаленные объекты, которые можно восстановить до окончательного удаления
+func (h *AdminHandler) Trash(w http.ResponseWriter, r *http.Request) {
+	all, err := h.trashRepo.GetItems(r.Context())
+	if err != nil {
+		slog.Error("failed to get trash", "error", err)
+		middleware.ServerError(w, "Ошибка получения корзины", err)
+		return
+	}
+
+	var items []entity.TrashItem
+	for _, item := range all {
+		if middleware.HasPermission(r, trashPermissions[item.Kind]) {
+			items = append(items, item)
+		}
+	}
+
+	data := map[string]interface{}{
+		"Title":         "Корзина",
+		"CSRFToken":     middleware.CSRFToken(r),
+		"Items":         items,
+		"RetentionDays": int(internal.TrashRetention.Hours() / 24),
+		"Retention":     internal.TrashRetention,
+		"Error":         r.URL.Query().Get("error"),
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "trash.html", data); err != nil {
+		slog.Error("failed to render trash", "error", err)
+	}
+}
+
+// TrashRestore - возвращает объект из корзины
+func (h *AdminHandler) TrashRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/trash", http.StatusSeeOther)
+		return
+	}
+
+	kind := r.FormValue("kind")
+	if !entity.ValidTrashKind(kind) {
+		http.Error(w, "Некорректный вид объекта", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
+	if !middleware.HasPermission(r, trashPermissions[kind]) {
+		http.Error(w, "Недостаточно прав", http.StatusForbidden)
+		return
+	}
+
+	err = h.trashRepo.Restore(r.Context(), kind, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Объект не найден в корзине", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, repository.ErrParentDeleted) {
+		http.Redirect(w, r, "/admin/trash?error=parent_deleted", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		middleware.ServerError(w, "Ошибка восстановления", err)
+		return
+	}
+
+	h.audit.Record(r, kind+".restore", kind, id, nil, h.trashState(r.Context(), kind, id))
+
+	http.Redirect(w, r, "/admin/trash", http.StatusSeeOther)
+}
+
+// trashState - восстановленный объект для записи в журнал
+func (h *AdminHandler) trashState(ctx context.Context, kind string, id int) interface{} {
+	switch kind {
+	case entity.TrashSchool:
+		school, _ := h.schoolRepo.GetByID(ctx, id)
+		return school
+	case entity.TrashClass:
+		class, _ := h.classRepo.GetByID(ctx, id)
+		return class
+	case entity.TrashUser:
+		user, _ := h.userRepo.GetByID(ctx, id)
+		return userAuditState(user)
+	case entity.TrashEquationType:
+		return h.equationTypeState(ctx, id)
+	}
+	return nil
+}
+
+// ============= УЧЕБНЫЕ ГОДЫ =============
+
+// Решения по отдельному ученику в мастере перехода
+const (
+	studentStay     = "stay"
+	studentGraduate = "graduate"
+	studentUnenroll = "unenroll"
+)
+
+// Years - учебные годы: текущий и архив закрытых
+func (h *AdminHandler) Years(w http.ResponseWriter, r *http.Request) {
+	years, err := h.yearRepo.GetAll(r.Context())
+	if err != nil {
+		slog.Error("failed to get academic years", "error", err)
+		middleware.ServerError(w, "Ошибка получения учебных лет", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":     "Учебные годы",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Years":     years,
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "years.html", data); err != nil {
+		slog.Error("failed to render academic years", "error", err)
+	}
+}
+
+// YearRolloverForm - мастер перехода на новый учебный год
+func (h *AdminHandler) YearRolloverForm(w http.ResponseWriter, r *http.Request) {
+	current, err := h.yearRepo.GetCurrent(r.Context())
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения текущего учебного года", err)
+		return
+	}
+	classes, err := h.yearRepo.GetRolloverClasses(r.Context())
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения классов", err)
+		return
+	}
+
+	nextStart := current.StartsOn.AddDate(1, 0, 0)
+	data := map[string]interface{}{
+		"Title":     "Переход на новый учебный год",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Current":   current,
+		"NextName":  entity.AcademicYearName(nextStart),
+		"NextStart": nextStart.Format("2006-01-02"),
+		"Classes":   classes,
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "year_rollover.html", data); err != nil {
+		slog.Error("failed to render rollover form", "error", err)
+	}
+}
+
+// YearRollover - закрывает текущий учебный год и открывает новый по решениям из мастера
+func (h *AdminHandler) YearRollover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/years/rollover", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Некорректная форма", http.StatusBadRequest)
+		return
+	}
+
+	current, err := h.yearRepo.GetCurrent(r.Context())
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения текущего учебного года", err)
+		return
+	}
+
+	plan, err := parseRolloverForm(r.PostForm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !plan.NewYearStart.After(current.StartsOn) {
+		http.Error(w, "Новый учебный год должен начинаться позже текущего", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := h.store.Get(r, "app-session")
+	plan.ClosedBy, _ = session.Values["user_id"].(int)
+
+	result, err := h.yearRepo.Rollover(r.Context(), plan)
+	if errors.Is(err, repository.ErrMaxGrade) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		http.Error(w, "Учебный год с таким названием уже есть", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		middleware.ServerError(w, "Ошибка перехода на новый учебный год", err)
+		return
+	}
+
+	h.audit.Record(r, "academic_year.rollover", "academic_year", result.Year.ID, current, result)
+
+	http.Redirect(w, r, "/admin/years/view?id="+strconv.Itoa(current.ID), http.StatusSeeOther)
+}
+
+// parseRolloverForm собирает решения мастера: class_<id> - решение по классу,
+// student_<id> - решение по ученику, если он не переходит вместе с классом
+func parseRolloverForm(form url.Values) (repository.RolloverPlan, error) {
+	plan := repository.RolloverPlan{
+		NewYearName:  strings.TrimSpace(form.Get("name")),
+		ClassActions: make(map[int]string),
+	}
+	if plan.NewYearName == "" || len([]rune(plan.NewYearName)) > 20 {
+		return plan, errors.New("Укажите название учебного года (до 20 символов)")
+	}
+	start, err := time.Parse("2006-01-02", form.Get("starts_on"))
+	if err != nil {
+		return plan, errors.New("Некорректная дата начала учебного года")
+	}
+	plan.NewYearStart = start
+
+	for key, values := range form {
+		if idStr, ok := strings.CutPrefix(key, "class_"); ok {
+			id, err := strconv.Atoi(idStr)
+			if err != nil || !entity.ValidRolloverAction(values[0]) {
+				return plan, errors.New("Некорректное решение по классу")
+			}
+			plan.ClassActions[id] = values[0]
+		}
+		if idStr, ok := strings.CutPrefix(key, "student_"); ok {
+			id, err := strconv.Atoi(idStr)
+			if err != nil {
+				return plan, errors.New("Некорректный ID ученика")
+			}
+			switch values[0] {
+			case studentStay:
+			case studentGraduate:
+				plan.Graduate = append(plan.Graduate, id)
+			case studentUnenroll:
+				plan.Unenroll = append(plan.Unenroll, id)
+			default:
+				return plan, errors.New("Некорректное решение по ученику")
+			}
+		}
+	}
+	sort.Ints(plan.Graduate)
+	sort.Ints(plan.Unenroll)
+
+	return plan, nil
+}
+
+// YearView - архив закрытого учебного года; с параметром class - ученики класса
+func (h *AdminHandler) YearView(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
+
+	year, err := h.yearRepo.GetByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения учебного года", err)
+		return
+	}
+
+	classes, err := h.yearRepo.GetClassSnapshots(r.Context(), id)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения архива", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":     "Учебный год " + year.Name,
+		"CSRFToken": middleware.CSRFToken(r),
+		"Year":      year,
+		"Classes":   classes,
+	}
+
+	if classStr := r.URL.Query().Get("class"); classStr != "" {
+		classID, err := strconv.Atoi(classStr)
+		if err != nil {
+			http.Error(w, "Некорректный ID класса", http.StatusBadRequest)
+			return
+		}
+		for i := range classes {
+			if classes[i].ClassID == classID {
+				data["Class"] = &classes[i]
+			}
+		}
+		students, err := h.yearRepo.GetStudentSnapshots(r.Context(), id, classID)
+		if err != nil {
+			middleware.ServerError(w, "Ошибка получения архива", err)
+			return
+		}
+		data["Students"] = students
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "year_view.html", data); err != nil {
+		slog.Error("failed to render academic year", "error", err)
+	}
+}
+
+// ============= ТИПЫ УРАВНЕНИЙ =============
+
+// EquationTypes - список всех типов уравнений
+func (h *AdminHandler) EquationTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := h.typeRepo.GetAll(r.Context())
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения типов уравнений", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":     "Типы уравнений",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Types":     types,
+	}
+
+	h.tmpl.ExecuteTemplate(w, "equation_types.html", data)
+}
+
+// EquationTypeForm - форма создания/редактирования типа уравнения
+func (h *AdminHandler) EquationTypeForm(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+
+	data := map[string]interface{}{
+		"Title":     "Новый тип уравнения",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Type":      nil,
+	}
+
+	if idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err == nil {
+			et, err := h.typeRepo.GetTypeById(r.Context(), id)
+			if err == nil {
+				data["Type"] = et
+				data["Title"] = "Редактирование типа уравнения"
+			}
+		}
+	}
+
+	h.tmpl.ExecuteTemplate(w, "equation_type_form.html", data)
+}
+
+// EquationTypeCreate - создание типа уравнения
+func (h *AdminHandler) EquationTypeCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+		return
+	}
+
+	// Парсинг данных формы
+	class, _ := strconv.Atoi(r.FormValue("class"))
+	name := r.FormValue("name")
+	description := r.FormValue("description")
+	operation := r.FormValue("operation")
+	numOperands, _ := strconv.Atoi(r.FormValue("num_operands"))
+
+	op1Min, _ := strconv.Atoi(r.FormValue("operand1_min"))
+	op1Max, _ := strconv.Atoi(r.FormValue("operand1_max"))
+	op2Min, _ := strconv.Atoi(r.FormValue("operand2_min"))
+	op2Max, _ := strconv.Atoi(r.FormValue("operand2_max"))
+	op3Min, _ := strconv.Atoi(r.FormValue("operand3_min"))
+	op3Max, _ := strconv.Atoi(r.FormValue("operand3_max"))
+	op4Min, _ := strconv.Atoi(r.FormValue("operand4_min"))
+	op4Max, _ := strconv.Atoi(r.FormValue("operand4_max"))
+
+	noRemainder := r.FormValue("no_remainder") == "on"
+
+	resultMax, _ := strconv.Atoi(r.FormValue("result_max"))
+	if resultMax == 0 {
+		resultMax = -1
+	}
+
+	operands := []generator.OperandRange{
+		{Order: 1, MinValue: op1Min, MaxValue: op1Max},
+		{Order: 2, MinValue: op2Min, MaxValue: op2Max},
+		{Order: 3, MinValue: op3Min, MaxValue: op3Max},
+		{Order: 4, MinValue: op4Min, MaxValue: op4Max},
+	}
+
+	et := generator.EquationType{
+		Class:       class,
+		Name:        name,
+		Description: description,
+		Operation:   operation,
+		NumOperands: numOperands,
+		Operands:    operands,
+		NoRemainder: noRemainder,
+		ResultMax:   resultMax,
+	}
+
+	created, err := h.typeRepo.Create(r.Context(), et)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка создания типа уравнения", err)
+		return
+	}
+
+	h.audit.Record(r, "equation_type.create", "equation_type", created.ID, nil, created)
+
+	http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+}
+
+// EquationTypeUpdate - обновление типа уравнения
+func (h *AdminHandler) EquationTypeUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+		return
+	}
+
+	idStr := r.FormValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
+
+	// Парсинг данных формы
+	class, _ := strconv.Atoi(r.FormValue("class"))
+	name := r.FormValue("name")
+	description := r.FormValue("description")
+	operation := r.FormValue("operation")
+	numOperands, _ := strconv.Atoi(r.FormValue("num_operands"))
+
+	op1Min, _ := strconv.Atoi(r.FormValue("operand1_min"))
+	op1Max, _ := strconv.Atoi(r.FormValue("operand1_max"))
+	op2Min, _ := strconv.Atoi(r.FormValue("operand2_min"))
+	op2Max, _ := strconv.Atoi(r.FormValue("operand2_max"))
+	op3Min, _ := strconv.Atoi(r.FormValue("operand3_min"))
+	op3Max, _ := strconv.Atoi(r.FormValue("operand3_max"))
+	op4Min, _ := strconv.Atoi(r.FormValue("operand4_min"))
+	op4Max, _ := strconv.Atoi(r.FormValue("operand4_max"))
+
+	noRemainder := r.FormValue("no_remainder") == "on"
+
+	resultMax, _ := strconv.Atoi(r.FormValue("result_max"))
+	if resultMax == 0 {
+		resultMax = -1
+	}
+
+	operands := []generator.OperandRange{
+		{Order: 1, MinValue: op1Min, MaxValue: op1Max},
+		{Order: 2, MinValue: op2Min, MaxValue: op2Max},
+		{Order: 3, MinValue: op3Min, MaxValue: op3Max},
+		{Order: 4, MinValue: op4Min, MaxValue: op4Max},
+	}
+	et := generator.EquationType{
+		ID:          id,
+		Class:       class,
+		Name:        name,
+		Description: description,
+		Operation:   operation,
+		NumOperands: numOperands,
+		Operands:    operands,
+		NoRemainder: noRemainder,
+		ResultMax:   resultMax,
+	}
+
+	before := h.equationTypeState(r.Context(), id)
+
+	_, err = h.typeRepo.Update(r.Context(), et)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка обновления типа уравнения", err)
+		return
+	}
+
+	h.audit.Record(r, "equation_type.update", "equation_type", id, before, h.equationTypeState(r.Context(), id))
+
+	http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+}
+
+// EquationTypeDelete - удаление типа уравнения
+func (h *AdminHandler) EquationTypeDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+		return
+	}
+
+	idStr := r.FormValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
+
+	before := h.equationTypeState(r.Context(), id)
+
+	err = h.typeRepo.Delete(r.Context(), id)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка удаления типа уравнения", err)
+		return
+	}
+
+	h.audit.Record(r, "equation_type.delete", "equation_type", id, before, nil)
+
+	http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+}
+
+// ToggleEquationTypeAvailability - переключение доступности типа уравнения
+func (h *AdminHandler) ToggleEquationTypeAvailability(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
+		return
+	}
+
+	idStr := r.FormValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Некорректный ID", http.StatusBadRequest)
+		return
+	}
+
+	before := h.equationTypeState(r.Context(), id)
+
+	err = h.typeRepo.ToggleAvailability(r.Context(), id)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка переключения доступности", err)
+		return
+	}
+
+	h.audit.Record(r, "equation_type.toggle", "equation_type", id, before, h.equationTypeState(r.Context(), id))
+
 	http.Redirect(w, r, "/admin/equation-types", http.StatusSeeOther)
 }
+
+// equationTypeState - снимок типа уравнения для журнала аудита, nil если тип не найден
+func (h *AdminHandler) equationTypeState(ctx context.Context, id int) interface{} {
+	et, err := h.typeRepo.GetTypeById(ctx, id)
+	if err != nil {
+		return nil
+	}
+	return et
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"edugame/internal/entity"
+	"edugame/internal/repository"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// Auditor записывает изменяющие действия администраторов и учителей в журнал аудита.
+// Ошибка записи журнала не прерывает уже выполненное действие, а только логируется.
+type Auditor struct {
+	repo  repository.AuditLog
+	store *sessions.CookieStore
+}
+
+func NewAuditor(repo repository.AuditLog, store *sessions.CookieStore) *Auditor {
+	return &Auditor{repo: repo, store: store}
+}
+
+// Record фиксирует действие текущего пользователя над объектом targetType/targetID.
+// before и after сериализуются в JSON, nil означает отсутствие состояния.
+func (a *Auditor) Record(r *http.Request, action, targetType string, targetID int, before, after interface{}) {
+	if a == nil {
+		return
+	}
+
+	entry := &entity.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		IPAddress:  clientIP(r),
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+	}
+	if targetID != 0 {
+		entry.TargetID = &targetID
+	}
+
+	if session, err := a.store.Get(r, "app-session"); err == nil {
+		if userID, ok := session.Values["user_id"].(int); ok {
+			entry.ActorID = &userID
+		}
+		entry.ActorName, _ = session.Values["username"].(string)
+	}
+
+	if err := a.repo.Record(r.Context(), entry); err != nil {
+		slog.Error("failed to write audit log", "action", action, "target_type", targetType, "target_id", targetID, "error", err)
+	}
+}
+
+// userAuditState - состояние пользователя для журнала: только идентификаторы и статус.
+// Логин, ФИО и почта в журнал не пишутся: записи нельзя изменить, а данные ученика
+// по запросу родителей должны исчезнуть полностью.
+func userAuditState(u *entity.User) interface{} {
+	if u == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"id":        u.ID,
+		"role_id":   u.RoleID,
+		"school_id": u.SchoolID,
+		"class_id":  u.ClassID,
+		"blocked":   u.Blocked,
+	}
+}
+
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to marshal audit state", "error", err)
+		return ""
+	}
+	if string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
@@ -1,41 +1,55 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
 	"edugame/internal"
-	"edugame/internal/database"
 	"edugame/internal/entity"
 	"edugame/internal/generator"
+	middleware "edugame/internal/midlleware"
 	"edugame/internal/repository"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"log/slog"
 	"net/http"
 	"sort"
+	"strings"
 
 	"github.com/gorilla/sessions"
 )
 
 type EquationHandler struct {
 	tmpl             *template.Template
-	userRepo         *repository.UserRepository
-	typeRepo         *repository.TypeRepository
-	userProgressRepo *repository.UserProgressRepository
+	userRepo         repository.Users
+	typeRepo         repository.Types
+	userProgressRepo repository.Progress
+	attemptRepo      repository.Attempts
+	quizRepo         repository.Quizzes
 	gen              *generator.Generator
 	store            *sessions.CookieStore
+	maxTries         int
 }
 
-func NewEquationHandler(userRepo *repository.UserRepository, typeRepo *repository.TypeRepository, userProgressRepo *repository.UserProgressRepository, store *sessions.CookieStore) *EquationHandler {
+func NewEquationHandler(userRepo repository.Users, typeRepo repository.Types, userProgressRepo repository.Progress, attemptRepo repository.Attempts, quizRepo repository.Quizzes, store *sessions.CookieStore, maxTries int) *EquationHandler {
 	tmpl := template.Must(template.ParseFiles("internal/templates/equation.html"))
 
+	if maxTries < 1 {
+		maxTries = internal.MaxItemTries
+	}
+
 	return &EquationHandler{
 		tmpl:             tmpl,
 		userRepo:         userRepo,
 		typeRepo:         typeRepo,
 		userProgressRepo: userProgressRepo,
+		attemptRepo:      attemptRepo,
+		quizRepo:         quizRepo,
 		gen:              generator.NewGenerator(),
 		store:            store,
+		maxTries:         maxTries,
 	}
 }
 
@@ -52,8 +66,9 @@ func NewEquationWithID(eq generator.Equation, id int) *EquationWithID {
 }
 
 type EquationData struct {
-	Eqs   []EquationWithID
-	Class int
+	Eqs       []EquationWithID
+	Class     int
+	CSRFToken string
 }
 
 func NewEquationData(list []EquationWithID, class int) *EquationData {
@@ -77,33 +92,33 @@ func (h *EquationHandler) EquationHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	user, err := h.userRepo.GetByID(userId)
+	user, err := h.userRepo.GetByID(r.Context(), userId)
 	if err != nil {
 		log.Println("Ошибка получения пользователя:", err)
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	if user.Role.Name != "student" {
+	if !middleware.HasPermission(r, entity.PermQuizSolve) {
 		http.Error(w, "Доступ запрещен. Только для учеников", http.StatusForbidden)
 		return
 	}
 
-	class, err := h.userRepo.GetStudentClass(userId)
+	class, err := h.userRepo.GetStudentClass(r.Context(), userId)
 	if err != nil {
 		log.Println("Ошибка получения класс: ", err)
 		return
 	}
-	listTypes, err := h.typeRepo.GetListTypes(class)
+	listTypes, err := h.typeRepo.GetListTypes(r.Context(), class)
 	if err != nil {
 		log.Println("Ошибка получения типов уравнений:", err)
-		http.Error(w, "Ошибка загрузки уравнений", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка загрузки уравнений", err)
 		return
 	}
 
 	slog.Info("here", "listtypes", listTypes)
 
-	typeStats, err := h.userProgressRepo.GetUserTypeStatistics(userId)
+	typeStats, err := h.userProgressRepo.GetUserTypeStatistics(r.Context(), userId)
 	if err != nil {
 		log.Println("Ошибка получения статистики:", err)
 	}
@@ -111,10 +126,10 @@ func (h *EquationHandler) EquationHandler(w http.ResponseWriter, r *http.Request
 	log.Printf("Пользователь: %s (ID: %d, Класс: %d)\n", user.Username, userId, class)
 	log.Printf("Типы уравнений для %d класса: %d\n", class, len(listTypes))
 
-	listEquations, err := h.generateAdaptiveEquations(listTypes, typeStats, userId)
+	listEquations, err := generateAdaptiveEquations(listTypes, typeStats, internal.CountEqs)
 	if err != nil {
 		log.Println("Ошибка генерации уравнений:", err)
-		http.Error(w, "Ошибка генерации уравнений", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка генерации уравнений", err)
 		return
 	}
 
@@ -123,31 +138,45 @@ func (h *EquationHandler) EquationHandler(w http.ResponseWriter, r *http.Request
 		log.Printf("  %d: %s (ответ: %s)\n", i+1, eq.Eq.Text, eq.Eq.CorrectAnswer)
 	}
 
-	session, _ = h.store.Get(r, "equations-session")
-	correctAnswers := make(map[int]string)
-	for i, eq := range listEquations {
-		correctAnswers[i] = eq.Eq.CorrectAnswer
+	// Верные ответы и попытки хранятся на сервере, в cookie - только номер набора
+	quizItems := make([]entity.QuizItem, 0, len(listEquations))
+	for _, eq := range listEquations {
+		quizItems = append(quizItems, entity.QuizItem{
+			ItemID:         eq.Id,
+			EquationTypeID: eq.Eq.EquationTypeId,
+			Text:           eq.Eq.Text,
+			CorrectAnswer:  eq.Eq.CorrectAnswer,
+		})
 	}
-	session.Values["correct_answers"] = correctAnswers
+	quizID, err := h.quizRepo.CreateQuiz(r.Context(), userId, quizItems)
+	if err != nil {
+		slog.Error("failed to save quiz", "error", err, "user_id", userId)
+		middleware.ServerError(w, "Ошибка сохранения набора примеров", err)
+		return
+	}
+
+	session, _ = h.store.Get(r, "equations-session")
+	delete(session.Values, "correct_answers")
+	delete(session.Values, "quiz_items")
+	session.Values["quiz_id"] = quizID
 	if err := session.Save(r, w); err != nil {
-		log.Println("Ошибка сохранения верных ответов в сессию")
+		log.Println("Ошибка сохранения набора в сессию")
 		log.Println("Error: ", err)
 		return
 	}
 
 	equationData := NewEquationData(listEquations, listEquations[0].Eq.Class)
+	equationData.CSRFToken = middleware.CSRFToken(r)
 
 	h.tmpl.Execute(w, equationData)
 }
 
 // generateAdaptiveEquations - адаптивная генерация уравнений
-func (e *EquationHandler) generateAdaptiveEquations(
+func generateAdaptiveEquations(
 	types []generator.EquationType,
 	typeStats map[int]repository.TypeStat,
-	userId int,
+	totalEquations int,
 ) ([]EquationWithID, error) {
-	const totalEquations = internal.CountEqs
-
 	var weakTypes []generator.EquationType
 	var mediumTypes []generator.EquationType
 	var strongTypes []generator.EquationType
@@ -317,25 +346,27 @@ func generateListOfEquations(types []generator.EquationType) ([]EquationWithID,
 }
 
 func (h *EquationHandler) CheckAnswersHandler(w http.ResponseWriter, r *http.Request) {
-	session, _ := h.store.Get(r, "equations-session")
-	correctAnswers, ok := session.Values["correct_answers"].(map[int]string)
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	if !ok {
-		http.Error(w, "Сессия не найдена", http.StatusBadRequest)
+	userId, err := h.getUserIdFromSession(r)
+	if err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusUnauthorized)
 		return
 	}
 
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	quizID, ok := h.quizID(r)
+	if !ok {
+		http.Error(w, "Сессия не найдена", http.StatusBadRequest)
 		return
 	}
 
 	var request struct {
 		Answers []struct {
-			EquationID     int    `json:"equation_id"`
-			UserAnswer     string `json:"user_answer"`
-			EquationText   string `json:"equation_text"`
-			EquationTypeId int    `json:"equation_type_id"`
+			EquationID int    `json:"equation_id"`
+			UserAnswer string `json:"user_answer"`
 		} `json:"answers"`
 	}
 
@@ -344,20 +375,31 @@ func (h *EquationHandler) CheckAnswersHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	quizItems, err := h.quizRepo.GetItems(r.Context(), quizID, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Сессия не найдена", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to load quiz", "error", err, "quiz_id", quizID)
+		middleware.ServerError(w, "Ошибка проверки ответов", err)
+		return
+	}
+
 	results := make([]map[string]interface{}, len(request.Answers))
 	correctCount := 0
 	attempts := make([]entity.Attempt, 0)
-	userId, err := h.getUserIdFromSession(r)
-
-	if err != nil {
-		log.Printf("ошибка получения id")
-	}
 
 	for i, answer := range request.Answers {
-		correctAnswer, exists := correctAnswers[answer.EquationID]
-		isCorrect := exists && answer.UserAnswer == correctAnswer
+		item, exists := quizItems[answer.EquationID]
+		isCorrect := exists && answer.UserAnswer == item.CorrectAnswer
+
+		// Примеры, уже принятые поштучной проверкой, повторно не засчитываются
+		if exists && item.Locked {
+			isCorrect = item.Correct
+		}
 
-		feedback := "❌ Неправильно. Правильный ответ:" + correctAnswer
+		feedback := "❌ Неправильно. Правильный ответ:" + item.CorrectAnswer
 
 		if isCorrect {
 			correctCount++
@@ -367,19 +409,31 @@ func (h *EquationHandler) CheckAnswersHandler(w http.ResponseWriter, r *http.Req
 		results[i] = map[string]interface{}{
 			"equation_id":    answer.EquationID,
 			"is_correct":     isCorrect,
-			"correct_answer": correctAnswer,
+			"correct_answer": item.CorrectAnswer,
 			"feedback":       feedback,
 		}
 
-		log.Println(answer.EquationTypeId, answer.EquationText)
-		attempts = append(attempts, entity.NewAttempt(userId, answer.EquationTypeId, answer.EquationText, correctAnswer, answer.UserAnswer))
+		if !exists || item.Locked {
+			continue
+		}
+
+		locked, err := h.quizRepo.LockItem(r.Context(), quizID, userId, answer.EquationID, isCorrect)
+		if err != nil {
+			slog.Error("failed to lock quiz item", "error", err, "quiz_id", quizID, "item_id", answer.EquationID)
+			continue
+		}
+		if !locked {
+			continue
+		}
+
+		attempts = append(attempts, entity.NewAttempt(userId, item.EquationTypeID, item.Text, item.CorrectAnswer, answer.UserAnswer))
 	}
 
+	// Попытки сохраняются после ответа клиенту, поэтому отмена запроса на них не влияет
+	ctx := context.WithoutCancel(r.Context())
 	go func() {
-		attemptRepo := repository.NewAttemptRepository(database.DB)
-
 		for _, a := range attempts {
-			err := attemptRepo.SaveAttempt(a)
+			err := h.attemptRepo.SaveAttempt(ctx, a)
 			if err != nil {
 				log.Println("Error:", err)
 				break
@@ -398,6 +452,123 @@ func (h *EquationHandler) CheckAnswersHandler(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(response)
 }
 
+// CheckItemHandler - мгновенная проверка одного примера из выданного набора.
+// Ответ сверяется с состоянием набора на сервере, число попыток хранится в самом примере.
+// После верного ответа или исчерпания попыток пример блокируется, и только тогда
+// сохраняется одна итоговая попытка с баллом: промежуточные ошибки не портят
+// точность, прогресс и счет занятий.
+func (h *EquationHandler) CheckItemHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	quizID, ok := h.quizID(r)
+	if !ok {
+		http.Error(w, "Сессия не найдена", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		EquationID int    `json:"equation_id"`
+		UserAnswer string `json:"user_answer"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	userAnswer := strings.TrimSpace(request.UserAnswer)
+	if userAnswer == "" {
+		http.Error(w, "Пустой ответ", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := h.getUserIdFromSession(r)
+	if err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusUnauthorized)
+		return
+	}
+
+	item, err := h.quizRepo.AnswerItem(r.Context(), quizID, userId, request.EquationID, userAnswer, h.maxTries)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Пример не найден", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, repository.ErrQuizItemLocked) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"equation_id":    request.EquationID,
+			"is_correct":     item.Correct,
+			"locked":         true,
+			"tries":          item.Tries,
+			"tries_left":     0,
+			"correct_answer": item.CorrectAnswer,
+			"feedback":       "Ответ на этот пример уже принят",
+		})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to check quiz item", "error", err, "quiz_id", quizID, "item_id", request.EquationID)
+		middleware.ServerError(w, "Ошибка проверки ответа", err)
+		return
+	}
+
+	credit := 0.0
+	if item.Correct {
+		credit = itemCredit(item.Tries, h.maxTries)
+	}
+
+	if item.Locked {
+		attempt := entity.NewAttempt(userId, item.EquationTypeID, item.Text, item.CorrectAnswer, userAnswer)
+		attempt.Credit = &credit
+		if err := h.attemptRepo.SaveAttempt(r.Context(), attempt); err != nil {
+			slog.Error("failed to save attempt", "error", err, "user_id", userId)
+		}
+	}
+
+	feedback := "❌ Неправильно. Попробуй ещё раз"
+	if item.Correct {
+		feedback = "✅ Правильно!"
+	} else if item.Locked {
+		feedback = "❌ Неправильно. Правильный ответ: " + item.CorrectAnswer
+	}
+
+	response := map[string]interface{}{
+		"equation_id": request.EquationID,
+		"is_correct":  item.Correct,
+		"locked":      item.Locked,
+		"tries":       item.Tries,
+		"tries_left":  h.maxTries - item.Tries,
+		"credit":      credit,
+		"feedback":    feedback,
+	}
+
+	if item.Locked {
+		response["correct_answer"] = item.CorrectAnswer
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// quizID - номер выданного набора из cookie
+func (h *EquationHandler) quizID(r *http.Request) (int, bool) {
+	session, _ := h.store.Get(r, "equations-session")
+	quizID, ok := session.Values["quiz_id"].(int)
+	return quizID, ok && quizID != 0
+}
+
+// itemCredit - доля балла за верный ответ: с каждой следующей попыткой балл уменьшается
+func itemCredit(tries, maxTries int) float64 {
+	if tries < 1 || tries > maxTries {
+		return 0
+	}
+	return float64(maxTries-tries+1) / float64(maxTries)
+}
+
 func (h *EquationHandler) getUserIdFromSession(r *http.Request) (int, error) {
 	session, err := h.store.Get(r, "app-session")
 	if err != nil {
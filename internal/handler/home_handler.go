@@ -1,6 +1,7 @@
 package handler
 
 import (
+	middleware "edugame/internal/midlleware"
 	"html/template"
 	"net/http"
 )
@@ -15,5 +16,7 @@ func NewHomeHandler() *IndexHandler {
 }
 
 func (i *IndexHandler) HomePage(w http.ResponseWriter, r *http.Request) {
-	i.tmpl.Execute(w, nil)
+	i.tmpl.Execute(w, map[string]interface{}{
+		"CSRFToken": middleware.CSRFToken(r),
+	})
 }
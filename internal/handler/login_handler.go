@@ -1,10 +1,17 @@
 package handler
 
 import (
+	"context"
+	"edugame/internal"
+	"edugame/internal/entity"
+	middleware "edugame/internal/midlleware"
 	"edugame/internal/repository"
+	"errors"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -12,49 +19,68 @@ import (
 )
 
 type LoginHandler struct {
-	userRepo *repository.UserRepository
-	tmpl     *template.Template
-	store    *sessions.CookieStore
+	userRepo     repository.Users
+	sessionRepo  repository.Sessions
+	throttleRepo repository.LoginThrottles
+	oidcRepo     repository.OIDCProviders
+	tmpl         *template.Template
+	store        *sessions.CookieStore
 }
 
-func NewLoginHandler(userRepo *repository.UserRepository, store *sessions.CookieStore) *LoginHandler {
+func NewLoginHandler(
+	userRepo repository.Users,
+	sessionRepo repository.Sessions,
+	throttleRepo repository.LoginThrottles,
+	oidcRepo repository.OIDCProviders,
+	store *sessions.CookieStore,
+) *LoginHandler {
 	tmpl := template.Must(template.ParseFiles(
 		"internal/templates/login.html",
 	))
 	return &LoginHandler{
-		userRepo: userRepo,
-		tmpl:     tmpl,
-		store:    store,
+		userRepo:     userRepo,
+		sessionRepo:  sessionRepo,
+		throttleRepo: throttleRepo,
+		oidcRepo:     oidcRepo,
+		tmpl:         tmpl,
+		store:        store,
 	}
 }
 
+var (
+	userLoginPolicy = repository.ThrottlePolicy{
+		FreeAttempts: internal.LoginUserFreeAttempts,
+		BaseDelay:    internal.LoginBackoffBase,
+		MaxDelay:     internal.LoginBackoffMax,
+		Window:       internal.LoginFailureWindow,
+	}
+	ipLoginPolicy = repository.ThrottlePolicy{
+		FreeAttempts: internal.LoginIPFreeAttempts,
+		BaseDelay:    internal.LoginBackoffBase,
+		MaxDelay:     internal.LoginBackoffMax,
+		Window:       internal.LoginFailureWindow,
+	}
+)
+
 func (h *LoginHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.store.Get(r, "app-session")
 	if userID, ok := session.Values["user_id"].(int); ok && userID > 0 {
-		role, ok := session.Values["role"].(string)
-		if !ok {
-			role = "student"
-		}
-
-		switch role {
-		case "teacher":
-			http.Redirect(w, r, "/teacher/class", http.StatusSeeOther)
-		case "student":
-			http.Redirect(w, r, "/home", http.StatusSeeOther)
-		case "director":
-			http.Redirect(w, r, "/director", http.StatusSeeOther)
-		case "admin":
-			http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
-		default:
-			http.Redirect(w, r, "/index", http.StatusSeeOther)
-		}
+		http.Redirect(w, r, middleware.HomeURL(r), http.StatusSeeOther)
 		return
 	}
 
+	// Вход через провайдеров SSO - дополнительный, при ошибке остается обычная форма
+	providers, err := h.oidcRepo.GetEnabled(r.Context())
+	if err != nil {
+		fmt.Printf("Ошибка получения провайдеров входа: %v\n", err)
+	}
+
 	data := map[string]interface{}{
-		"Title":   "Вход в систему",
-		"Error":   r.URL.Query().Get("error"),
-		"Message": r.URL.Query().Get("message"),
+		"Title":     "Вход в систему",
+		"Providers": providers,
+		"CSRFToken": middleware.CSRFToken(r),
+		"Error":     r.URL.Query().Get("error"),
+		"Message":   r.URL.Query().Get("message"),
 		"Form": map[string]string{
 			"username": r.URL.Query().Get("username"),
 		},
@@ -78,34 +104,110 @@ func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
 	password := r.FormValue("password")
 
 	if username == "" || password == "" {
-		http.Redirect(w, r, "/login?error=empty_fields&username="+username, http.StatusSeeOther)
+		http.Redirect(w, r, "/login?error=empty_fields&username="+url.QueryEscape(username), http.StatusSeeOther)
 		return
 	}
 
-	user, err := h.userRepo.Login(username, password)
+	userKey := repository.LoginThrottleUserKey(username)
+	ipKey := repository.LoginThrottleIPKey(clientIP(r))
+
+	// Попытка засчитывается до проверки пароля, иначе пачка параллельных
+	// подборов проходит проверку задержки раньше, чем первая ошибка будет учтена
+	wait, err := h.reserveAttempt(r.Context(), userKey, ipKey)
 	if err != nil {
-		fmt.Printf("Ошибка входа для пользователя %s: %v\n", username, err)
-		http.Redirect(w, r, "/login?error=invalid_credentials&username="+username, http.StatusSeeOther)
+		// Без счетчиков вход не пускаем: иначе нагрузка на БД отключает защиту от подбора
+		fmt.Printf("Ошибка проверки ограничений входа для %s: %v\n", username, err)
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Сервер перегружен, попробуйте позже", http.StatusServiceUnavailable)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds())+1))
+		http.Redirect(w, r, "/login?error=too_many_attempts&username="+url.QueryEscape(username), http.StatusSeeOther)
 		return
 	}
 
-	sessionToken, err := h.userRepo.CreateSession(user.ID)
+	user, err := h.userRepo.Login(r.Context(), username, password)
+	if errors.Is(err, repository.ErrAccountLocked) || errors.Is(err, repository.ErrAccountPending) ||
+		errors.Is(err, repository.ErrAccountBlocked) || repository.IsTimeout(err) {
+		// Неверным паролем это не было - засчитанная заранее попытка возвращается
+		h.releaseAttempt(r.Context(), userKey, ipKey)
+	}
+	if errors.Is(err, repository.ErrAccountLocked) {
+		http.Redirect(w, r, "/login?error=account_locked&username="+url.QueryEscape(username), http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, repository.ErrAccountPending) {
+		http.Redirect(w, r, "/login?error=account_pending&username="+url.QueryEscape(username), http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, repository.ErrAccountBlocked) {
+		fmt.Printf("Попытка входа заблокированного пользователя %s\n", username)
+		http.Redirect(w, r, "/login?error=account_blocked&username="+url.QueryEscape(username), http.StatusSeeOther)
+		return
+	}
+	if repository.IsTimeout(err) {
+		// Медленная БД - не повод считать попытку неудачной и блокировать учетную запись
+		middleware.ServerError(w, "", err)
+		return
+	}
 	if err != nil {
+		fmt.Printf("Ошибка входа для пользователя %s: %v\n", username, err)
+		h.registerFailure(r.Context(), username)
+		http.Redirect(w, r, "/login?error=invalid_credentials&username="+url.QueryEscape(username), http.StatusSeeOther)
+		return
+	}
+
+	if err := h.throttleRepo.Reset(r.Context(), userKey); err != nil {
+		fmt.Printf("Ошибка сброса ограничений входа для %s: %v\n", username, err)
+	}
+	if err := h.throttleRepo.Release(r.Context(), ipKey, ipLoginPolicy); err != nil {
+		fmt.Printf("Ошибка учета входа с %s: %v\n", ipKey, err)
+	}
+	if err := h.userRepo.ResetFailedLogins(r.Context(), user.ID); err != nil {
+		fmt.Printf("Ошибка сброса счетчика входов для %d: %v\n", user.ID, err)
+	}
+
+	if err := startUserSession(w, r, h.store, h.sessionRepo, user); err != nil {
 		fmt.Printf("Ошибка создания сессии для пользователя %d: %v\n", user.ID, err)
 		http.Redirect(w, r, "/login?error=session_error", http.StatusSeeOther)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-	})
+	fmt.Printf("Успешный вход: %s (ID: %d, Роль: %s)\n",
+		user.Username, user.ID, user.Role.Name)
+
+	// Права роли загружаются на следующем запросе, стартовую страницу по ним выберет LoginPage
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (h *LoginHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(middleware.SessionCookieName)
+	if err == nil {
+		if err := h.sessionRepo.Delete(r.Context(), cookie.Value); err != nil {
+			fmt.Printf("Ошибка удаления сессии: %v\n", err)
+		}
+	}
+
+	middleware.ClearSessionCookie(w)
 
 	session, _ := h.store.Get(r, "app-session")
+	session.Options.MaxAge = -1 // Удаляем сессию
+	session.Save(r, w)
+
+	http.Redirect(w, r, "/login?message=Вы+вышли+из+системы", http.StatusSeeOther)
+}
+
+// startUserSession создает серверную сессию и записывает данные входа в gorilla-сессию
+func startUserSession(w http.ResponseWriter, r *http.Request, store *sessions.CookieStore, sessionRepo repository.Sessions, user *entity.User) error {
+	sessionToken, err := sessionRepo.Create(r.Context(), user.ID, r.UserAgent(), clientIP(r), internal.SessionTTL)
+	if err != nil {
+		return err
+	}
+
+	middleware.SetSessionCookie(w, sessionToken)
+
+	session, _ := store.Get(r, "app-session")
 	session.Values["user_id"] = user.ID
 	session.Values["username"] = user.Username
 	session.Values["role"] = user.Role.Name
@@ -115,40 +217,54 @@ func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
 		fmt.Printf("Ошибка сохранения сессии Gorilla: %v\n", err)
 	}
 
-	fmt.Printf("Успешный вход: %s (ID: %d, Роль: %s)\n",
-		user.Username, user.ID, user.Role)
-
-	switch user.Role.Name {
-	case "student":
-		http.Redirect(w, r, "/home", http.StatusSeeOther)
-	case "teacher":
-		http.Redirect(w, r, "/teacher/class", http.StatusSeeOther)
-	case "director":
-		http.Redirect(w, r, "/director", http.StatusSeeOther)
-	case "admin":
-		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
-	default:
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-	}
+	return nil
 }
 
-func (h *LoginHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_token")
-	if err == nil {
-		h.userRepo.Logout(cookie.Value)
+// reserveAttempt засчитывает попытку входа по логину и по IP до проверки пароля.
+// Если один из ключей под задержкой, возвращает время ожидания и ничего не засчитывает.
+func (h *LoginHandler) reserveAttempt(ctx context.Context, userKey, ipKey string) (time.Duration, error) {
+	wait, err := h.throttleRepo.Reserve(ctx, userKey, userLoginPolicy)
+	if err != nil || wait > 0 {
+		return wait, err
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-	})
+	wait, err = h.throttleRepo.Reserve(ctx, ipKey, ipLoginPolicy)
+	if err != nil || wait > 0 {
+		if err := h.throttleRepo.Release(ctx, userKey, userLoginPolicy); err != nil {
+			fmt.Printf("Ошибка учета входа для %s: %v\n", userKey, err)
+		}
+	}
+	return wait, err
+}
 
-	session, _ := h.store.Get(r, "app-session")
-	session.Options.MaxAge = -1 // Удаляем сессию
-	session.Save(r, w)
+// releaseAttempt возвращает попытку, засчитанную reserveAttempt
+func (h *LoginHandler) releaseAttempt(ctx context.Context, userKey, ipKey string) {
+	if err := h.throttleRepo.Release(ctx, userKey, userLoginPolicy); err != nil {
+		fmt.Printf("Ошибка учета входа для %s: %v\n", userKey, err)
+	}
+	if err := h.throttleRepo.Release(ctx, ipKey, ipLoginPolicy); err != nil {
+		fmt.Printf("Ошибка учета входа с %s: %v\n", ipKey, err)
+	}
+}
 
-	http.Redirect(w, r, "/login?message=Вы+вышли+из+системы", http.StatusSeeOther)
+// registerFailure учитывает неудачный вход в самой учетной записи.
+// Счетчики по логину и по IP уже увеличены в reserveAttempt.
+func (h *LoginHandler) registerFailure(ctx context.Context, username string) {
+	locked, err := h.userRepo.RegisterFailedLogin(ctx, username, internal.AccountLockThreshold, internal.AccountLockDuration)
+	if err != nil {
+		fmt.Printf("Ошибка учета неудачного входа для %s: %v\n", username, err)
+	}
+	if locked {
+		fmt.Printf("Учетная запись %s временно заблокирована\n", username)
+	}
+}
+
+// clientIP определяет адрес клиента. X-Forwarded-For от доверенных прокси
+// уже разобран middleware.RealIP, поэтому здесь учитывается только RemoteAddr.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -0,0 +1,1013 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"edugame/internal"
+	"edugame/internal/entity"
+	"edugame/internal/generator"
+	middleware "edugame/internal/midlleware"
+	"edugame/internal/oidc"
+	"edugame/internal/repository"
+	"edugame/internal/repository/memory"
+	"edugame/internal/session"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// flowEnv - обработчики поверх хранилища в памяти: сценарии проходят целиком, без ожиданий SQL
+type flowEnv struct {
+	mem     *memory.Store
+	store   *sessions.CookieStore
+	teacher *entity.User
+	student *entity.User
+	class   *entity.Class
+}
+
+func newFlowEnv(t *testing.T) *flowEnv {
+	t.Helper()
+
+	// Промежуточные обработчики берут хранилище сессий из пакета session
+	session.InitStore("test-secret-key-32-bytes-long!!!")
+	gob.Register(map[int]string{})
+
+	mem := memory.New()
+	school, err := mem.Schools().Create(t.Context(), "Школа №1", "", "", "")
+	if err != nil {
+		t.Fatalf("create school: %v", err)
+	}
+	teacher, err := mem.Users().Register(t.Context(), "ivanova", "secret123", "teacher", "Иванова Мария", nil)
+	if err != nil {
+		t.Fatalf("register teacher: %v", err)
+	}
+	class, err := mem.Classes().Create(t.Context(), "2А", 2, teacher.ID, &school.ID)
+	if err != nil {
+		t.Fatalf("create class: %v", err)
+	}
+	student, err := mem.Users().Register(t.Context(), "petya", "secret123", "student", "Петров Петя", &class.ID)
+	if err != nil {
+		t.Fatalf("register student: %v", err)
+	}
+	mem.AddType(generator.EquationType{
+		Class:       2,
+		Name:        "Сложение",
+		Operation:   "+",
+		NumOperands: 2,
+		Operands:    []generator.OperandRange{{Order: 1, MinValue: 1, MaxValue: 9}, {Order: 2, MinValue: 1, MaxValue: 9}},
+		ResultMax:   20,
+		IsAvailable: true,
+	})
+
+	return &flowEnv{mem: mem, store: session.GetStore(), teacher: teacher, student: student, class: class}
+}
+
+// serve выполняет запрос с cookie из предыдущих ответов и возвращает ответ
+func serve(h http.Handler, r *http.Request, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// mergeCookies заменяет cookie с теми же именами, как это делает браузер
+func mergeCookies(cookies, fresh []*http.Cookie) []*http.Cookie {
+	merged := make([]*http.Cookie, 0, len(cookies)+len(fresh))
+	for _, c := range cookies {
+		replaced := false
+		for _, f := range fresh {
+			replaced = replaced || f.Name == c.Name
+		}
+		if !replaced {
+			merged = append(merged, c)
+		}
+	}
+	return append(merged, fresh...)
+}
+
+func postForm(target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func (env *flowEnv) login(t *testing.T, username string) []*http.Cookie {
+	t.Helper()
+
+	mem := env.mem
+	h := NewLoginHandler(mem.Users(), mem.Sessions(), mem.LoginThrottles(), mem.OIDCProviders(), env.store)
+	rec := serve(http.HandlerFunc(h.Login), postForm("/login", url.Values{
+		"username": {username}, "password": {"secret123"},
+	}), nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Fatalf("login %s: status %d, location %q", username, rec.Code, rec.Header().Get("Location"))
+	}
+	return rec.Result().Cookies()
+}
+
+func TestLoginFlowWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	h := NewLoginHandler(mem.Users(), mem.Sessions(), mem.LoginThrottles(), mem.OIDCProviders(), env.store)
+
+	t.Run("success", func(t *testing.T) {
+		env.login(t, "petya")
+
+		sessions, err := mem.Sessions().GetUserSessions(t.Context(), env.student.ID, "")
+		if err != nil || len(sessions) != 1 {
+			t.Fatalf("sessions after login: %d, err %v", len(sessions), err)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		rec := serve(http.HandlerFunc(h.Login), postForm("/login", url.Values{
+			"username": {"petya"}, "password": {"wrong"},
+		}), nil)
+		if loc := rec.Header().Get("Location"); !strings.Contains(loc, "error=invalid_credentials") {
+			t.Fatalf("location %q, want invalid_credentials", loc)
+		}
+	})
+
+	t.Run("pending student", func(t *testing.T) {
+		if _, err := mem.Users().RegisterStudentRequest(t.Context(), "vasya", "secret123", "Васильев Вася", env.class.ID); err != nil {
+			t.Fatalf("register request: %v", err)
+		}
+		rec := serve(http.HandlerFunc(h.Login), postForm("/login", url.Values{
+			"username": {"vasya"}, "password": {"secret123"},
+		}), nil)
+		if loc := rec.Header().Get("Location"); !strings.Contains(loc, "error=account_pending") {
+			t.Fatalf("location %q, want account_pending", loc)
+		}
+	})
+}
+
+// adminHandler - обработчики администратора поверх хранилища в памяти
+func (env *flowEnv) adminHandler() *AdminHandler {
+	mem := env.mem
+	return NewAdminHandler(mem.Schools(), mem.Classes(), mem.ClassStaff(), mem.Users(), mem.Roles(), mem.Types(),
+		mem.Sessions(), mem.Invites(), mem.Permissions(), mem.AuditLog(), mem.OIDCProviders(), mem.Trash(),
+		mem.AcademicYears(), mem.StudentData(), env.store)
+}
+
+// В состав класса можно добавить любую роль с правом на статистику класса, а не только учителя
+func TestClassStaffAcceptsCustomRoles(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	h := env.adminHandler()
+
+	if _, err := mem.Roles().Create(t.Context(), "methodologist", "Методист", []string{entity.PermClassStatsView}); err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	methodologist, err := mem.Users().Register(t.Context(), "metod", "secret123", "methodologist", "Смирнова Ольга", nil)
+	if err != nil {
+		t.Fatalf("register methodologist: %v", err)
+	}
+
+	setStaff := func(userID int) *httptest.ResponseRecorder {
+		return serve(http.HandlerFunc(h.ClassStaffSet), postForm("/admin/classes/staff", url.Values{
+			"class_id": {strconv.Itoa(env.class.ID)},
+			"user_id":  {strconv.Itoa(userID)},
+			"role":     {entity.StaffRoleViewer},
+		}), nil)
+	}
+
+	if rec := setStaff(methodologist.ID); rec.Code != http.StatusSeeOther {
+		t.Fatalf("methodologist: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if rec := setStaff(env.student.ID); rec.Code != http.StatusBadRequest {
+		t.Fatalf("student: status %d, want 400", rec.Code)
+	}
+
+	candidates, err := mem.Users().GetUsersWithPermission(t.Context(), entity.PermClassStatsView)
+	if err != nil || len(candidates) != 2 {
+		t.Fatalf("staff candidates = %v, %v, want teacher and methodologist", candidates, err)
+	}
+}
+
+// Роль со статистикой одной школы требует школу, даже если это не встроенный директор
+func TestSchoolRoleRequiresSchool(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	h := env.adminHandler()
+
+	inspector, err := mem.Roles().Create(t.Context(), "inspector", "Завуч", []string{entity.PermSchoolStatsView})
+	if err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	schoolID := strconv.Itoa(*env.class.SchoolID)
+	roleID := strconv.Itoa(inspector.ID)
+
+	invite := func(schoolID string) int {
+		return serve(http.HandlerFunc(h.InviteCreate), postForm("/admin/invites", url.Values{
+			"role_id": {roleID}, "school_id": {schoolID},
+		}), nil).Code
+	}
+	if code := invite(""); code != http.StatusBadRequest {
+		t.Errorf("invite without school: status %d, want 400", code)
+	}
+	if code := invite(schoolID); code != http.StatusOK {
+		t.Errorf("invite with school: status %d, want 200", code)
+	}
+
+	update := func(schoolID string) int {
+		return serve(http.HandlerFunc(h.UserUpdate), postForm("/admin/users/update", url.Values{
+			"id": {strconv.Itoa(env.teacher.ID)}, "username": {"ivanova"}, "fullname": {"Иванова Мария"},
+			"role_id": {roleID}, "school_id": {schoolID},
+		}), nil).Code
+	}
+	if code := update(""); code != http.StatusBadRequest {
+		t.Errorf("update without school: status %d, want 400", code)
+	}
+	if code := update(schoolID); code != http.StatusSeeOther {
+		t.Errorf("update with school: status %d, want 303", code)
+	}
+}
+
+// Выгрузка журнала: значения, похожие на формулы, Excel не выполнит
+func TestAuditExportNeutralisesFormulas(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	h := env.adminHandler()
+
+	targetID := env.student.ID
+	for _, name := range []string{"=HYPERLINK(\"http://evil\")", "Иванова Мария"} {
+		if err := mem.AuditLog().Record(t.Context(), &entity.AuditEntry{
+			ActorName: name, Action: "user.update", TargetType: "user", TargetID: &targetID, IPAddress: "192.0.2.1",
+		}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	rec := serve(http.HandlerFunc(h.AuditExport), httptest.NewRequest(http.MethodGet, "/admin/audit/export", nil), nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "\xEF\xBB\xBF") {
+		t.Fatalf("export: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(rec.Body.String(), "\xEF\xBB\xBF"))).ReadAll()
+	if err != nil || len(rows) != 3 {
+		t.Fatalf("csv rows = %v, %v", rows, err)
+	}
+	if rows[1][3] != "Иванова Мария" || rows[2][3] != "'=HYPERLINK(\"http://evil\")" {
+		t.Errorf("actor names = %q, %q", rows[1][3], rows[2][3])
+	}
+}
+
+// Серверная сессия отзывается: подписанная gorilla-cookie без живой строки в сессиях не пускает
+func TestSessionRevocationWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	sessions := NewSessionHandler(mem.Sessions(), env.store)
+
+	validate := middleware.ValidateSession(mem.Sessions())
+	page := validate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(target string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		return serve(page, httptest.NewRequest(http.MethodGet, target, nil), cookies)
+	}
+
+	laptop := env.login(t, "petya")
+	phone := env.login(t, "petya")
+	if rec := get("/equations", phone); rec.Code != http.StatusOK {
+		t.Fatalf("phone before revoke: status %d", rec.Code)
+	}
+
+	rec := serve(validate(http.HandlerFunc(sessions.RevokeOthers)), postForm("/sessions/revoke-others", nil), laptop)
+	if rec.Code != http.StatusSeeOther || !strings.Contains(rec.Header().Get("Location"), "message=") {
+		t.Fatalf("revoke others: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if rec := get("/equations", laptop); rec.Code != http.StatusOK {
+		t.Fatalf("current session revoked: status %d", rec.Code)
+	}
+	if rec := get("/equations", phone); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login?error=session_expired" {
+		t.Fatalf("revoked page: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := get("/api/offline/sync", phone); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked api: status %d, want 401", rec.Code)
+	}
+
+	// Чужой токен сессии с cookie ученика не подходит: строка принадлежит другому пользователю
+	var studentCookie []*http.Cookie
+	for _, c := range laptop {
+		if c.Name != middleware.SessionCookieName {
+			studentCookie = append(studentCookie, c)
+		}
+	}
+	for _, c := range env.login(t, "ivanova") {
+		if c.Name == middleware.SessionCookieName {
+			studentCookie = append(studentCookie, c)
+		}
+	}
+	if rec := get("/equations", studentCookie); rec.Code != http.StatusSeeOther {
+		t.Fatalf("foreign token: status %d, want redirect", rec.Code)
+	}
+}
+
+// Учитель выдает код сброса, ученик по нему задает новый пароль; код одноразовый, старые сеансы завершаются
+func TestPasswordResetWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	teacher := NewTeacherHandlers(mem.Teachers(), mem.Users(), mem.Schools(), mem.PasswordResets(),
+		mem.Guardians(), mem.StudentData(), mem.AuditLog(), env.store)
+	reset := NewPasswordResetHandler(mem.PasswordResets(), mem.LoginThrottles())
+
+	studentCookies := env.login(t, "petya")
+	rec := serve(http.HandlerFunc(teacher.IssueResetCode), postForm("/teacher/student/reset-code", url.Values{
+		"student_id": {strconv.Itoa(env.student.ID)},
+	}), env.login(t, "ivanova"))
+	match := regexp.MustCompile(`/reset\?code=([A-Za-z0-9]+)`).FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || match == nil || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("issue code: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	code := match[1]
+
+	redeem := func(code, password, confirm string) *httptest.ResponseRecorder {
+		return serve(http.HandlerFunc(reset.Reset), postForm("/auth/reset", url.Values{
+			"code": {code}, "password": {password}, "password_confirm": {confirm},
+		}), nil)
+	}
+
+	// Ошибки формы не расходуют код
+	if rec := redeem(code, "newpass1", "newpass2"); rec.Code != http.StatusOK || rec.Header().Get("Location") != "" {
+		t.Fatalf("mismatch: status %d", rec.Code)
+	}
+	if rec := redeem(code, "abc", "abc"); rec.Code != http.StatusOK || rec.Header().Get("Location") != "" {
+		t.Fatalf("short password: status %d", rec.Code)
+	}
+
+	rec = redeem(strings.ToLower(code), "newpass1", "newpass1")
+	if rec.Code != http.StatusSeeOther || !strings.HasPrefix(rec.Header().Get("Location"), "/login?message=") {
+		t.Fatalf("redeem: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := redeem(code, "another1", "another1"); rec.Code != http.StatusOK || rec.Header().Get("Location") != "" {
+		t.Fatalf("reused code: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if sessions, _ := mem.Sessions().GetUserSessions(t.Context(), env.student.ID, ""); len(sessions) != 0 {
+		t.Fatalf("sessions survived the reset: %d", len(sessions))
+	}
+	page := middleware.ValidateSession(mem.Sessions())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if rec := serve(page, httptest.NewRequest(http.MethodGet, "/equations", nil), studentCookies); rec.Code != http.StatusSeeOther {
+		t.Fatalf("old session after reset: status %d", rec.Code)
+	}
+	if _, err := mem.Users().Login(t.Context(), "petya", "secret123"); err == nil {
+		t.Fatal("old password still works")
+	}
+	if _, err := mem.Users().Login(t.Context(), "petya", "newpass1"); err != nil {
+		t.Fatalf("new password: %v", err)
+	}
+}
+
+// Вход по картинкам: учитель задает картинки, ученик входит по коду класса, подбор ограничен
+func TestPictureLoginWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	h := NewPictureLoginHandler(mem.Users(), mem.Teachers(), mem.Sessions(), mem.LoginThrottles(), mem.AuditLog(), env.store)
+
+	code, err := mem.Teachers().RotateClassLoginCode(t.Context(), env.class.ID)
+	if err != nil {
+		t.Fatalf("rotate code: %v", err)
+	}
+
+	rec := serve(http.HandlerFunc(h.PicturePasswordPage), postForm("/teacher/student/picture-password", url.Values{
+		"student_id": {strconv.Itoa(env.student.ID)}, "secret": {"cat,sun,star"},
+	}), env.login(t, "ivanova"))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("set pictures: status %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(http.HandlerFunc(h.LoginPage), httptest.NewRequest(http.MethodGet, "/picture-login?code="+code, nil), nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), env.student.FullName) {
+		t.Fatalf("roster: status %d", rec.Code)
+	}
+
+	login := func(code, secret string) *httptest.ResponseRecorder {
+		return serve(http.HandlerFunc(h.Login), postForm("/auth/picture-login", url.Values{
+			"code": {code}, "student_id": {strconv.Itoa(env.student.ID)}, "secret": {secret},
+		}), nil)
+	}
+	errorOf := func(rec *httptest.ResponseRecorder) string {
+		return mustQuery(t, rec.Header().Get("Location")).Get("error")
+	}
+
+	if rec := login("ZZZZZZ", "cat,sun,star"); errorOf(rec) != "invalid_code" {
+		t.Fatalf("unknown class code: location %q", rec.Header().Get("Location"))
+	}
+
+	rec = login(strings.ToLower(code), "cat,sun,star")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/home" {
+		t.Fatalf("login: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if sessions, _ := mem.Sessions().GetUserSessions(t.Context(), env.student.ID, ""); len(sessions) != 1 {
+		t.Fatalf("sessions after picture login: %d", len(sessions))
+	}
+
+	// После бесплатных ошибок включается задержка, и даже верные картинки не принимаются
+	for i := 0; i <= internal.PictureFreeAttempts; i++ {
+		if rec := login(code, "sun,cat,star"); errorOf(rec) != "wrong_pictures" {
+			t.Fatalf("wrong pictures #%d: location %q", i+1, rec.Header().Get("Location"))
+		}
+	}
+	if rec := login(code, "cat,sun,star"); errorOf(rec) != "too_many_attempts" || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("throttled: location %q", rec.Header().Get("Location"))
+	}
+}
+
+// failingThrottles - счетчики входов, до которых не достучаться
+type failingThrottles struct{ repository.LoginThrottles }
+
+func (failingThrottles) Reserve(ctx context.Context, key string, policy repository.ThrottlePolicy) (time.Duration, error) {
+	return 0, errors.New("connection refused")
+}
+
+// Задержка после неудачных входов: пачка параллельных подборов не обходит счетчик
+func TestLoginThrottleWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	h := NewLoginHandler(mem.Users(), mem.Sessions(), mem.LoginThrottles(), mem.OIDCProviders(), env.store)
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		return serve(http.HandlerFunc(h.Login), postForm("/login", url.Values{
+			"username": {username}, "password": {password},
+		}), nil)
+	}
+
+	t.Run("parallel guesses", func(t *testing.T) {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		outcomes := map[string]int{}
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				loc, _ := url.Parse(login("nobody", "guess").Header().Get("Location"))
+				mu.Lock()
+				defer mu.Unlock()
+				outcomes[loc.Query().Get("error")]++
+			}()
+		}
+		wg.Wait()
+
+		// Задержка включается после 4-й ошибки, остальные попытки до пароля не доходят
+		if outcomes["invalid_credentials"] != 4 || outcomes["too_many_attempts"] != 6 {
+			t.Fatalf("outcomes = %v", outcomes)
+		}
+	})
+
+	t.Run("correct password while delayed", func(t *testing.T) {
+		for range 4 {
+			login("petya", "wrong")
+		}
+		rec := login("petya", "secret123")
+		if loc := rec.Header().Get("Location"); !strings.Contains(loc, "error=too_many_attempts") || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("location %q, Retry-After %q", loc, rec.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("successful logins do not count against the ip", func(t *testing.T) {
+		for range 40 {
+			env.login(t, "ivanova")
+		}
+	})
+
+	t.Run("empty fields", func(t *testing.T) {
+		loc := login("a&error=x", "").Header().Get("Location")
+		if q := mustQuery(t, loc); q.Get("error") != "empty_fields" || q.Get("username") != "a&error=x" {
+			t.Fatalf("location %q", loc)
+		}
+	})
+
+	t.Run("throttle unavailable", func(t *testing.T) {
+		h := NewLoginHandler(mem.Users(), mem.Sessions(), failingThrottles{mem.LoginThrottles()}, mem.OIDCProviders(), env.store)
+		rec := serve(http.HandlerFunc(h.Login), postForm("/login", url.Values{
+			"username": {"ivanova"}, "password": {"secret123"},
+		}), nil)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status %d, want 503", rec.Code)
+		}
+	})
+}
+
+// mustQuery - параметры адреса перенаправления
+func mustQuery(t *testing.T, location string) url.Values {
+	t.Helper()
+
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("parse location %q: %v", location, err)
+	}
+	return u.Query()
+}
+
+// Ученик получает задание, отвечает на пример, попытка сохраняется и учитывается в прогрессе
+func TestQuizFlowWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	cookies := env.login(t, "petya")
+
+	h := NewEquationHandler(mem.Users(), mem.Types(), mem.Progress(), mem.Attempts(), mem.Quizzes(), env.store, 3)
+	quiz := middleware.LoadPermissions(mem.Permissions())(http.HandlerFunc(h.EquationHandler))
+
+	rec := serve(quiz, httptest.NewRequest(http.MethodGet, "/equations", nil), cookies)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("quiz page: status %d", rec.Code)
+	}
+	cookies = mergeCookies(cookies, rec.Result().Cookies())
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	sess, err := env.store.Get(r, "equations-session")
+	if err != nil {
+		t.Fatalf("equations session: %v", err)
+	}
+	if _, ok := sess.Values["correct_answers"]; ok {
+		t.Fatalf("correct answers leaked into cookie: %v", sess.Values)
+	}
+	quizID, _ := sess.Values["quiz_id"].(int)
+	item, ok := mem.GetQuizItems(quizID)[0]
+	if !ok {
+		t.Fatalf("quiz items not stored on server: %v", sess.Values)
+	}
+
+	answer := func(cookies []*http.Cookie, userAnswer string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"equation_id": 0, "user_answer": userAnswer})
+		r := httptest.NewRequest(http.MethodPost, "/check-item", strings.NewReader(string(body)))
+		return serve(http.HandlerFunc(h.CheckItemHandler), r, cookies)
+	}
+
+	issued := cookies
+	if rec := answer(cookies, item.CorrectAnswer+"0"); rec.Code != http.StatusOK {
+		t.Fatalf("wrong answer: status %d", rec.Code)
+	}
+
+	rec = answer(cookies, item.CorrectAnswer)
+	var resp struct {
+		IsCorrect bool `json:"is_correct"`
+		Locked    bool `json:"locked"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusOK || !resp.IsCorrect || !resp.Locked {
+		t.Fatalf("check item: status %d, response %+v", rec.Code, resp)
+	}
+	cookies = mergeCookies(cookies, rec.Result().Cookies())
+
+	if rec := answer(cookies, item.CorrectAnswer); rec.Code != http.StatusConflict {
+		t.Fatalf("repeated answer: status %d, want 409", rec.Code)
+	}
+
+	// Повтор старой cookie не сбрасывает попытки и блокировку
+	if rec := answer(issued, item.CorrectAnswer); rec.Code != http.StatusConflict {
+		t.Fatalf("replayed cookie: status %d, want 409", rec.Code)
+	}
+
+	// Неверная промежуточная попытка не сохраняется: на пример приходится одна итоговая запись
+	attempts := mem.GetAttempts(env.student.ID)
+	if len(attempts) != 1 || !attempts[0].IsCorrect || attempts[0].UserAnswer != item.CorrectAnswer {
+		t.Fatalf("attempts: %+v", attempts)
+	}
+	if c := attempts[0].Credit; c == nil || *c != itemCredit(2, 3) {
+		t.Fatalf("credit not saved: %v", c)
+	}
+
+	stats, err := mem.Progress().GetUserTypeStatistics(t.Context(), env.student.ID)
+	if err != nil {
+		t.Fatalf("type statistics: %v", err)
+	}
+	if stat := stats[item.EquationTypeID]; stat.Attempts != 1 || stat.Correct != 1 {
+		t.Fatalf("type stat: %+v", stat)
+	}
+}
+
+// Учитель подтверждает заявку в свой класс и не видит чужих учеников
+func TestTeacherFlowWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	cookies := env.login(t, "ivanova")
+
+	h := NewTeacherHandlers(mem.Teachers(), mem.Users(), mem.Schools(), mem.PasswordResets(),
+		mem.Guardians(), mem.StudentData(), mem.AuditLog(), env.store)
+
+	pending, err := mem.Users().RegisterStudentRequest(t.Context(), "vasya", "secret123", "Васильев Вася", env.class.ID)
+	if err != nil {
+		t.Fatalf("register request: %v", err)
+	}
+
+	rec := serve(http.HandlerFunc(h.ReviewStudent), postForm("/teacher/students/review", url.Values{
+		"student_id": {strconv.Itoa(pending.ID)}, "decision": {"approve"},
+	}), cookies)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("approve: status %d", rec.Code)
+	}
+	if left, _ := mem.Teachers().GetPendingStudents(t.Context(), env.class.ID); len(left) != 0 {
+		t.Fatalf("pending after approve: %+v", left)
+	}
+
+	other, err := mem.Users().Register(t.Context(), "sidorov", "secret123", "teacher", "Сидоров Петр", nil)
+	if err != nil {
+		t.Fatalf("register teacher: %v", err)
+	}
+	otherClass, err := mem.Classes().Create(t.Context(), "2Б", 2, other.ID, nil)
+	if err != nil {
+		t.Fatalf("create class: %v", err)
+	}
+	foreign, err := mem.Users().Register(t.Context(), "kolya", "secret123", "student", "Колин Коля", &otherClass.ID)
+	if err != nil {
+		t.Fatalf("register student: %v", err)
+	}
+
+	target := "/teacher/student?student_id=" + strconv.Itoa(foreign.ID)
+	rec = serve(http.HandlerFunc(h.StudentStatistics), httptest.NewRequest(http.MethodGet, target, nil), cookies)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("foreign student: status %d, want 404", rec.Code)
+	}
+
+	target = "/teacher/class?class_id=" + strconv.Itoa(otherClass.ID)
+	rec = serve(http.HandlerFunc(h.ClassStatistics), httptest.NewRequest(http.MethodGet, target, nil), cookies)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("foreign class: status %d, want 404", rec.Code)
+	}
+
+	if entries, _ := mem.AuditLog().Count(t.Context(), repository.AuditFilter{Action: "student.approve"}); entries != 1 {
+		t.Fatalf("audit entries: %d", entries)
+	}
+}
+
+// slowTeachers - отчеты по ученикам не укладываются в срок запроса
+type slowTeachers struct{ repository.Teachers }
+
+func (t slowTeachers) ForTeacher(teacherID int) repository.TeacherScope {
+	return slowScope{t.Teachers.ForTeacher(teacherID)}
+}
+
+type slowScope struct{ repository.TeacherScope }
+
+func (slowScope) GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// Отчет, прерванный по сроку запроса, отвечает 503, а не 500
+func TestStatisticsTimeoutWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	cookies := env.login(t, "ivanova")
+
+	h := NewTeacherHandlers(slowTeachers{mem.Teachers()}, mem.Users(), mem.Schools(), mem.PasswordResets(),
+		mem.Guardians(), mem.StudentData(), mem.AuditLog(), env.store)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	target := "/teacher/student?student_id=" + strconv.Itoa(env.student.ID)
+	r := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+	rec := serve(http.HandlerFunc(h.StudentStatistics), r, cookies)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After is not set")
+	}
+}
+
+// Удаленные объекты пропадают из выборок и входа, восстанавливаются из корзины и удаляются окончательно
+func TestTrashFlowWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	ctx := t.Context()
+	h := NewLoginHandler(mem.Users(), mem.Sessions(), mem.LoginThrottles(), mem.OIDCProviders(), env.store)
+
+	loginLocation := func() string {
+		rec := serve(http.HandlerFunc(h.Login), postForm("/login", url.Values{
+			"username": {"petya"}, "password": {"secret123"},
+		}), nil)
+		return rec.Header().Get("Location")
+	}
+
+	env.login(t, "petya")
+	if err := mem.Users().DeleteUser(ctx, env.student.ID); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if sessions, _ := mem.Sessions().GetUserSessions(ctx, env.student.ID, ""); len(sessions) != 0 {
+		t.Errorf("sessions after delete: %d, want 0", len(sessions))
+	}
+	if loc := loginLocation(); !strings.Contains(loc, "error=invalid_credentials") {
+		t.Errorf("login of deleted user: location %q", loc)
+	}
+	// Логин остается занятым, пока пользователь в корзине
+	if _, err := mem.Users().Register(ctx, "petya", "secret123", "student", "Другой Петя", nil); err == nil {
+		t.Error("username of trashed user was reused")
+	}
+
+	schools, _ := mem.Schools().GetAll(ctx)
+	if err := mem.Schools().Delete(ctx, schools[0].ID); err != nil {
+		t.Fatalf("delete school: %v", err)
+	}
+	if _, err := mem.Classes().GetByID(ctx, env.class.ID); err == nil {
+		t.Error("class of deleted school is still visible")
+	}
+
+	trash := mem.Trash()
+	items, err := trash.GetItems(ctx)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("trash items: %+v, err %v", items, err)
+	}
+	if items[0].Kind != entity.TrashSchool || items[0].Cascaded != 1 {
+		t.Errorf("first item %+v, want school with one cascaded class", items[0])
+	}
+
+	if err := trash.Restore(ctx, entity.TrashClass, env.class.ID); !errors.Is(err, repository.ErrParentDeleted) {
+		t.Errorf("restore class before school: %v, want ErrParentDeleted", err)
+	}
+	if err := trash.Restore(ctx, entity.TrashSchool, schools[0].ID); err != nil {
+		t.Fatalf("restore school: %v", err)
+	}
+	if _, err := mem.Classes().GetByID(ctx, env.class.ID); err != nil {
+		t.Errorf("class after school restore: %v", err)
+	}
+
+	if err := trash.Restore(ctx, entity.TrashUser, env.student.ID); err != nil {
+		t.Fatalf("restore user: %v", err)
+	}
+	if loc := loginLocation(); loc != "/login" {
+		t.Errorf("login after restore: location %q", loc)
+	}
+	// Ученик вернулся в свой класс
+	if grade, err := mem.Users().GetStudentClass(ctx, env.student.ID); err != nil || grade != env.class.Grade {
+		t.Errorf("student grade after restore: %d, err %v", grade, err)
+	}
+
+	if err := mem.Users().DeleteUser(ctx, env.student.ID); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	purged, err := trash.Purge(ctx, time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Fatalf("purge: %d, err %v", purged, err)
+	}
+	entries, err := mem.AuditLog().Find(ctx, repository.AuditFilter{Action: "user.purge"}, 10, 0)
+	if err != nil || len(entries) != 1 || entries[0].TargetID == nil || *entries[0].TargetID != env.student.ID {
+		t.Errorf("purge audit: %+v, err %v", entries, err)
+	}
+	if err := trash.Restore(ctx, entity.TrashUser, env.student.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("restore purged user: %v, want sql.ErrNoRows", err)
+	}
+	if attempts := mem.GetAttempts(env.student.ID); len(attempts) != 0 {
+		t.Errorf("attempts after purge: %d", len(attempts))
+	}
+}
+
+// Переход на новый год переводит класс, сохраняет итоги года и убирает отчисленных из класса
+func TestYearRolloverWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	ctx := t.Context()
+
+	third := mem.AddType(generator.EquationType{
+		Class:       3,
+		Name:        "Умножение",
+		Operation:   "*",
+		NumOperands: 2,
+		Operands:    []generator.OperandRange{{Order: 1, MinValue: 1, MaxValue: 9}, {Order: 2, MinValue: 1, MaxValue: 9}},
+		ResultMax:   81,
+		IsAvailable: true,
+	})
+	leaving, err := mem.Users().Register(ctx, "kolya", "secret123", "student", "Колин Коля", &env.class.ID)
+	if err != nil {
+		t.Fatalf("register student: %v", err)
+	}
+
+	years := mem.AcademicYears()
+	current, err := years.GetCurrent(ctx)
+	if err != nil {
+		t.Fatalf("current year: %v", err)
+	}
+	start := current.StartsOn.AddDate(1, 0, 0)
+	result, err := years.Rollover(ctx, repository.RolloverPlan{
+		NewYearName:  entity.AcademicYearName(start),
+		NewYearStart: start,
+		ClassActions: map[int]string{env.class.ID: entity.RolloverPromote},
+		Unenroll:     []int{leaving.ID},
+		ClosedBy:     env.teacher.ID,
+	})
+	if err != nil {
+		t.Fatalf("rollover: %v", err)
+	}
+	if result.Promoted != 1 || result.Unenrolled != 1 {
+		t.Errorf("result %+v, want one promoted class and one unenrolled student", result)
+	}
+
+	class, err := mem.Classes().GetByID(ctx, env.class.ID)
+	if err != nil || class.Name != "3А" || class.Grade != 3 {
+		t.Fatalf("promoted class: %+v, err %v", class, err)
+	}
+	if grade, err := mem.Users().GetStudentClass(ctx, leaving.ID); err == nil {
+		t.Errorf("unenrolled student still in grade %d", grade)
+	}
+
+	// Прогресс прошлой параллели сохраняется рядом с новой
+	progress, _ := mem.Progress().GetUserAllProgress(ctx, env.student.ID)
+	if len(progress) != 2 || progress[len(progress)-1].EquationTypeId != third.ID {
+		t.Errorf("progress after promotion: %+v", progress)
+	}
+
+	if now, err := years.GetCurrent(ctx); err != nil || now.ID != result.Year.ID {
+		t.Errorf("current year after rollover: %+v, err %v", now, err)
+	}
+	snapshots, _ := years.GetClassSnapshots(ctx, current.ID)
+	if len(snapshots) != 1 || snapshots[0].ClassName != "2А" || snapshots[0].StudentsCount != 2 {
+		t.Fatalf("class snapshots: %+v", snapshots)
+	}
+	students, _ := years.GetStudentSnapshots(ctx, current.ID, env.class.ID)
+	outcomes := make(map[int]string)
+	for _, st := range students {
+		outcomes[st.StudentID] = st.Outcome
+	}
+	if outcomes[env.student.ID] != entity.OutcomePromoted || outcomes[leaving.ID] != entity.OutcomeUnenrolled {
+		t.Errorf("student outcomes: %v", outcomes)
+	}
+
+	if _, err := years.Rollover(ctx, repository.RolloverPlan{NewYearName: result.Year.Name, NewYearStart: start}); err == nil {
+		t.Error("rollover to an existing year name succeeded")
+	}
+}
+
+// Выгрузка отдает архив с данными ученика, удаление обезличивает его, не меняя статистику класса
+func TestStudentDataExportAndEraseWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	ctx := t.Context()
+	h := NewTeacherHandlers(mem.Teachers(), mem.Users(), mem.Schools(), mem.PasswordResets(),
+		mem.Guardians(), mem.StudentData(), mem.AuditLog(), env.store)
+
+	for _, answer := range []string{"5", "7"} {
+		attempt := entity.NewAttempt(env.student.ID, 1, "2 + 3", "5", answer)
+		if err := mem.Attempts().SaveAttempt(ctx, attempt); err != nil {
+			t.Fatalf("save attempt: %v", err)
+		}
+	}
+	env.login(t, "petya")
+	cookies := env.login(t, "ivanova")
+	form := url.Values{"student_id": {strconv.Itoa(env.student.ID)}}
+	NewAuditor(mem.AuditLog(), env.store).Record(httptest.NewRequest(http.MethodPost, "/admin/users/update", nil),
+		"user.update", "user", env.student.ID, userAuditState(env.student), userAuditState(env.student))
+
+	rec := serve(http.HandlerFunc(h.ExportStudentData), postForm("/teacher/student/export", form), cookies)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("export: status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	for _, name := range []string{"student.json", "user.csv", "class_memberships.csv", "attempts.csv", "user_progress.csv", "sessions.csv", "audit_log.csv"} {
+		if files[name] == nil {
+			t.Errorf("archive has no %s", name)
+		}
+	}
+	f, err := files["student.json"].Open()
+	if err != nil {
+		t.Fatalf("open student.json: %v", err)
+	}
+	var export entity.StudentDataExport
+	err = json.NewDecoder(f).Decode(&export)
+	f.Close()
+	if err != nil {
+		t.Fatalf("decode student.json: %v", err)
+	}
+	if export.User.Username != "petya" || len(export.Attempts) != 2 || len(export.Classes) != 1 || len(export.Sessions) != 1 {
+		t.Errorf("export: user %q, %d attempts, %d classes, %d sessions",
+			export.User.Username, len(export.Attempts), len(export.Classes), len(export.Sessions))
+	}
+	if len(export.Audit) != 1 || export.Audit[0].Action != "user.update" {
+		t.Errorf("export audit: %+v", export.Audit)
+	}
+
+	before, _ := mem.Teachers().GetClassStatistics(ctx, env.class.ID)
+	rec = serve(http.HandlerFunc(h.EraseStudentData), postForm("/teacher/student/erase", form), cookies)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("erase: status %d", rec.Code)
+	}
+	after, _ := mem.Teachers().GetClassStatistics(ctx, env.class.ID)
+	for _, key := range []string{"student_count", "total_attempts", "correct_attempts"} {
+		if before[key] != after[key] {
+			t.Errorf("class %s: %v before erase, %v after", key, before[key], after[key])
+		}
+	}
+
+	student, err := mem.Users().GetByID(ctx, env.student.ID)
+	if err != nil || student.Username != entity.ErasedUsername(env.student.ID) || student.FullName != entity.ErasedFullName {
+		t.Fatalf("erased student: %+v, err %v", student, err)
+	}
+	if sessions, _ := mem.Sessions().GetUserSessions(ctx, env.student.ID, ""); len(sessions) != 0 {
+		t.Errorf("sessions after erase: %d", len(sessions))
+	}
+	if _, err := mem.Users().Login(ctx, "petya", "secret123"); err == nil {
+		t.Error("erased student can still log in")
+	}
+	// Логин освобождается: имя ученика больше нигде не хранится
+	if _, err := mem.Users().Register(ctx, "petya", "secret123", "student", "Новый Петя", nil); err != nil {
+		t.Errorf("username of erased student is still taken: %v", err)
+	}
+
+	rec = serve(http.HandlerFunc(h.EraseStudentData), postForm("/teacher/student/erase", form), cookies)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("repeated erase: status %d, want 400", rec.Code)
+	}
+
+	for _, action := range []string{"student.export", "student.erase"} {
+		if entries, _ := mem.AuditLog().Count(ctx, repository.AuditFilter{Action: action}); entries != 1 {
+			t.Errorf("audit %s entries: %d, want 1", action, entries)
+		}
+	}
+
+	// Журнал только дополняется, поэтому имени ученика в нем не было с самого начала
+	entries, _ := mem.AuditLog().Find(ctx, repository.AuditFilter{}, 0, 0)
+	for _, e := range entries {
+		for _, state := range []string{e.Before, e.After} {
+			if strings.Contains(state, "petya") || strings.Contains(state, "Петров") {
+				t.Errorf("audit %s keeps student data: %s", e.Action, state)
+			}
+		}
+	}
+}
+
+// SSO привязывает существующую учетную запись только у провайдера той же школы и только
+// по подтвержденной почте; смена роли провайдером попадает в журнал аудита
+func TestSSOLinkWithMemoryStore(t *testing.T) {
+	env := newFlowEnv(t)
+	mem := env.mem
+	ctx := t.Context()
+
+	schoolID := *env.class.SchoolID
+	if _, err := mem.Users().UpdateUser(ctx, env.teacher.ID, "ivanova", "Иванова Мария", "Ivanova@school.ru", env.teacher.RoleID, &schoolID); err != nil {
+		t.Fatalf("update teacher: %v", err)
+	}
+
+	global := &entity.OIDCProvider{Slug: "global", Name: "Global", DefaultRole: "teacher", UsernameClaim: "preferred_username"}
+	school := &entity.OIDCProvider{Slug: "school", Name: "School", SchoolID: &schoolID, DefaultRole: "teacher", UsernameClaim: "preferred_username"}
+	for _, p := range []*entity.OIDCProvider{global, school} {
+		if err := mem.OIDCProviders().Create(ctx, p); err != nil {
+			t.Fatalf("create provider: %v", err)
+		}
+	}
+
+	h := NewOIDCHandler(mem.OIDCProviders(), mem.Users(), mem.Sessions(), mem.AuditLog(), nil, env.store)
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback", nil)
+	claims := func(sub string, verified bool) oidc.Claims {
+		return oidc.Claims{"sub": sub, "preferred_username": "ivanova", "email": "ivanova@school.ru", "email_verified": verified}
+	}
+
+	if _, err := h.resolveUser(r, global, claims("g-1", true)); !errors.Is(err, errSSONoAccount) {
+		t.Fatalf("provider without school: err %v, want no account", err)
+	}
+	if _, err := h.resolveUser(r, school, claims("s-1", false)); !errors.Is(err, errSSONoAccount) {
+		t.Fatalf("unverified email: err %v, want no account", err)
+	}
+
+	userID, err := h.resolveUser(r, school, claims("s-1", true))
+	if err != nil || userID != env.teacher.ID {
+		t.Fatalf("link: user %d, err %v", userID, err)
+	}
+	links, err := mem.AuditLog().Find(ctx, repository.AuditFilter{Action: "user.sso_link"}, 10, 0)
+	if err != nil || len(links) != 1 || strings.Contains(links[0].After, "s-1") {
+		t.Fatalf("link audit must not keep the provider subject: %+v, err %v", links, err)
+	}
+
+	school.DefaultRole = "director"
+	if _, err := h.resolveUser(r, school, claims("s-1", true)); err != nil {
+		t.Fatalf("role change: %v", err)
+	}
+	entries, err := mem.AuditLog().Find(ctx, repository.AuditFilter{Action: "user.role_change"}, 10, 0)
+	if err != nil || len(entries) != 1 || entries[0].TargetID == nil || *entries[0].TargetID != env.teacher.ID {
+		t.Fatalf("role change audit: %+v, err %v", entries, err)
+	}
+
+	if _, err := h.resolveUser(r, school, claims("s-1", true)); err != nil {
+		t.Fatalf("repeat login: %v", err)
+	}
+	if n, _ := mem.AuditLog().Count(ctx, repository.AuditFilter{Action: "user.role_change"}); n != 1 {
+		t.Fatalf("unchanged role audited: %d entries", n)
+	}
+}
@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"edugame/internal"
+	"edugame/internal/entity"
+	middleware "edugame/internal/midlleware"
+	"edugame/internal/repository"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+type OfflineHandler struct {
+	tmpl             *template.Template
+	userRepo         repository.Users
+	typeRepo         repository.Types
+	userProgressRepo repository.Progress
+	offlineRepo      repository.OfflineBundles
+	store            *sessions.CookieStore
+	signingKey       []byte
+}
+
+func NewOfflineHandler(
+	userRepo repository.Users,
+	typeRepo repository.Types,
+	userProgressRepo repository.Progress,
+	offlineRepo repository.OfflineBundles,
+	store *sessions.CookieStore,
+	signingKey string,
+) *OfflineHandler {
+	tmpl := template.Must(template.ParseFiles("internal/templates/offline.html"))
+
+	return &OfflineHandler{
+		tmpl:             tmpl,
+		userRepo:         userRepo,
+		typeRepo:         typeRepo,
+		userProgressRepo: userProgressRepo,
+		offlineRepo:      offlineRepo,
+		store:            store,
+		signingKey:       []byte(signingKey),
+	}
+}
+
+// offlineItem - пример в том виде, в котором он уходит клиенту (без ответа)
+type offlineItem struct {
+	ID             int    `json:"id"`
+	Text           string `json:"text"`
+	EquationTypeID int    `json:"equation_type_id"`
+}
+
+// offlineBundlePayload - подписываемая часть офлайн-набора
+type offlineBundlePayload struct {
+	BundleID  int           `json:"bundle_id"`
+	UserID    int           `json:"user_id"`
+	IssuedAt  time.Time     `json:"issued_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	Items     []offlineItem `json:"items"`
+}
+
+// OfflinePage - страница решения примеров без интернета
+func (h *OfflineHandler) OfflinePage(w http.ResponseWriter, r *http.Request) {
+	if err := h.tmpl.Execute(w, map[string]interface{}{
+		"CSRFToken": middleware.CSRFToken(r),
+	}); err != nil {
+		slog.Error("failed to render offline page", "error", err)
+	}
+}
+
+// BundleHandler выдает ученику подписанный набор заранее сгенерированных примеров
+func (h *OfflineHandler) BundleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userId, err := h.getUserIdFromSession(r)
+	if err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusUnauthorized)
+		return
+	}
+
+	count := internal.OfflineBundleSize
+	if countStr := r.URL.Query().Get("count"); countStr != "" {
+		n, err := strconv.Atoi(countStr)
+		if err != nil || n < 1 || n > internal.OfflineBundleMaxSize {
+			http.Error(w, "Некорректное количество примеров", http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
+
+	class, err := h.userRepo.GetStudentClass(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "Ученик не привязан к классу", http.StatusBadRequest)
+		return
+	}
+
+	listTypes, err := h.typeRepo.GetListTypes(r.Context(), class)
+	if err != nil || len(listTypes) == 0 {
+		middleware.ServerError(w, "Ошибка загрузки уравнений", err)
+		return
+	}
+
+	typeStats, err := h.userProgressRepo.GetUserTypeStatistics(r.Context(), userId)
+	if err != nil {
+		log.Println("Ошибка получения статистики:", err)
+	}
+
+	equations, err := generateAdaptiveEquations(listTypes, typeStats, count)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка генерации уравнений", err)
+		return
+	}
+
+	items := make([]entity.OfflineItem, 0, len(equations))
+	for _, eq := range equations {
+		items = append(items, entity.OfflineItem{
+			ID:             eq.Id,
+			Text:           eq.Eq.Text,
+			EquationTypeID: eq.Eq.EquationTypeId,
+			CorrectAnswer:  eq.Eq.CorrectAnswer,
+		})
+	}
+
+	issuedAt := time.Now().UTC().Truncate(time.Second)
+	expiresAt := issuedAt.Add(internal.OfflineBundleTTL)
+
+	bundle, err := h.offlineRepo.CreateBundle(r.Context(), userId, items, issuedAt, expiresAt)
+	if err != nil {
+		slog.Error("failed to create offline bundle", "error", err, "user_id", userId)
+		middleware.ServerError(w, "Ошибка создания набора", err)
+		return
+	}
+
+	payload := newOfflineBundlePayload(bundle)
+
+	signature, err := h.sign(payload)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка подписи набора", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bundle":    payload,
+		"signature": signature,
+	})
+}
+
+// SyncHandler принимает ответы, накопленные без интернета, и сохраняет их
+// как попытки с исходным временем решения
+func (h *OfflineHandler) SyncHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userId, err := h.getUserIdFromSession(r)
+	if err != nil {
+		http.Error(w, "Пользователь не найден", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Bundle    offlineBundlePayload `json:"bundle"`
+		Signature string               `json:"signature"`
+		Answers   []struct {
+			ItemID     int       `json:"item_id"`
+			UserAnswer string    `json:"user_answer"`
+			AnsweredAt time.Time `json:"answered_at"`
+		} `json:"answers"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !h.verify(request.Bundle, request.Signature) {
+		http.Error(w, "Неверная подпись набора", http.StatusForbidden)
+		return
+	}
+
+	if request.Bundle.UserID != userId {
+		http.Error(w, "Набор выдан другому ученику", http.StatusForbidden)
+		return
+	}
+
+	bundle, err := h.offlineRepo.GetBundle(r.Context(), request.Bundle.BundleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Набор не найден", http.StatusNotFound)
+			return
+		}
+		middleware.ServerError(w, "Ошибка получения набора", err)
+		return
+	}
+
+	if bundle.UserID != userId {
+		http.Error(w, "Набор выдан другому ученику", http.StatusForbidden)
+		return
+	}
+
+	if bundle.SyncedAt != nil {
+		http.Error(w, "Набор уже синхронизирован", http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC()
+
+	items := make(map[int]entity.OfflineItem, len(bundle.Items))
+	for _, item := range bundle.Items {
+		items[item.ID] = item
+	}
+
+	// Ответ засчитывается, только если он дан между выдачей набора и текущим моментом
+	notBefore := bundle.IssuedAt.Add(-internal.OfflineClockSkew)
+	notAfter := now.Add(internal.OfflineClockSkew)
+	if bundle.ExpiresAt.Before(notAfter) {
+		notAfter = bundle.ExpiresAt
+	}
+
+	answered := make(map[int]bool)
+	results := make([]map[string]interface{}, 0, len(request.Answers))
+	attempts := make([]entity.Attempt, 0, len(request.Answers))
+	correctCount := 0
+
+	for _, answer := range request.Answers {
+		result := map[string]interface{}{
+			"item_id": answer.ItemID,
+		}
+
+		item, exists := items[answer.ItemID]
+		userAnswer := strings.TrimSpace(answer.UserAnswer)
+
+		switch {
+		case !exists:
+			result["status"] = "unknown_item"
+		case answered[answer.ItemID]:
+			result["status"] = "duplicate"
+		case userAnswer == "":
+			result["status"] = "skipped"
+		case answer.AnsweredAt.Before(notBefore) || answer.AnsweredAt.After(notAfter):
+			result["status"] = "invalid_time"
+		default:
+			answered[answer.ItemID] = true
+
+			attempt := entity.NewAttempt(userId, item.EquationTypeID, item.Text, item.CorrectAnswer, userAnswer)
+			attempt.CreatedAt = answer.AnsweredAt
+			attempts = append(attempts, attempt)
+
+			if attempt.IsCorrect {
+				correctCount++
+				result["status"] = "correct"
+			} else {
+				result["status"] = "incorrect"
+			}
+			result["correct_answer"] = item.CorrectAnswer
+		}
+
+		results = append(results, result)
+	}
+
+	// Набор помечается синхронизированным вместе с сохранением попыток,
+	// поэтому при ошибке его можно отправить повторно
+	synced, err := h.offlineRepo.SyncBundle(r.Context(), bundle.ID, now, attempts)
+	if err != nil {
+		slog.Error("failed to sync offline bundle", "error", err, "user_id", userId, "bundle_id", bundle.ID)
+		middleware.ServerError(w, "Ошибка синхронизации", err)
+		return
+	}
+	if !synced {
+		http.Error(w, "Набор уже синхронизирован", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bundle_id": bundle.ID,
+		"accepted":  len(attempts),
+		"correct":   correctCount,
+		"results":   results,
+	})
+}
+
+func newOfflineBundlePayload(bundle *entity.OfflineBundle) offlineBundlePayload {
+	items := make([]offlineItem, 0, len(bundle.Items))
+	for _, item := range bundle.Items {
+		items = append(items, offlineItem{
+			ID:             item.ID,
+			Text:           item.Text,
+			EquationTypeID: item.EquationTypeID,
+		})
+	}
+
+	return offlineBundlePayload{
+		BundleID:  bundle.ID,
+		UserID:    bundle.UserID,
+		IssuedAt:  bundle.IssuedAt,
+		ExpiresAt: bundle.ExpiresAt,
+		Items:     items,
+	}
+}
+
+// sign подписывает набор HMAC-SHA256
+func (h *OfflineHandler) sign(payload offlineBundlePayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, h.signingKey)
+	mac.Write(data)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (h *OfflineHandler) verify(payload offlineBundlePayload, signature string) bool {
+	expected, err := h.sign(payload)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func (h *OfflineHandler) getUserIdFromSession(r *http.Request) (int, error) {
+	session, err := h.store.Get(r, "app-session")
+	if err != nil {
+		return 0, err
+	}
+
+	userId, ok := session.Values["user_id"].(int)
+	if !ok || userId == 0 {
+		return 0, errors.New("user_id not found in session")
+	}
+
+	return userId, nil
+}
@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"edugame/internal"
+	"edugame/internal/entity"
+	middleware "edugame/internal/midlleware"
+	"edugame/internal/oidc"
+	"edugame/internal/repository"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/lib/pq"
+)
+
+var (
+	// errSSONoRole - утверждения провайдера не дают ни одной роли приложения
+	errSSONoRole = errors.New("sso: роль не сопоставлена")
+	// errSSONoAccount - учетной записи нет, а создавать ее для провайдера запрещено
+	errSSONoAccount = errors.New("sso: учетная запись не найдена")
+	// errSSOConflict - найденная учетная запись не подходит для привязки: другая роль,
+	// несколько пользователей с той же почтой или логин уже занят
+	errSSOConflict = errors.New("sso: логин занят другой учетной записью")
+)
+
+const oidcFlowSession = "oidc-flow"
+
+// OIDCHandler - вход через внешнего провайдера (OpenID Connect, authorization code + PKCE).
+// Вход по логину и паролю при этом остается доступен.
+type OIDCHandler struct {
+	oidcRepo    repository.OIDCProviders
+	userRepo    repository.Users
+	sessionRepo repository.Sessions
+	providers   *oidc.Cache
+	audit       *Auditor
+	store       *sessions.CookieStore
+}
+
+func NewOIDCHandler(
+	oidcRepo repository.OIDCProviders,
+	userRepo repository.Users,
+	sessionRepo repository.Sessions,
+	auditRepo repository.AuditLog,
+	providers *oidc.Cache,
+	store *sessions.CookieStore,
+) *OIDCHandler {
+	return &OIDCHandler{
+		oidcRepo:    oidcRepo,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		providers:   providers,
+		audit:       NewAuditor(auditRepo, store),
+		store:       store,
+	}
+}
+
+// Start отправляет пользователя на страницу входа провайдера (?provider=slug)
+func (h *OIDCHandler) Start(w http.ResponseWriter, r *http.Request) {
+	provider, err := h.oidcRepo.GetBySlug(r.Context(), r.URL.Query().Get("provider"))
+	if err != nil || !provider.Enabled {
+		http.Redirect(w, r, "/login?error=sso_unavailable", http.StatusSeeOther)
+		return
+	}
+
+	client, err := h.providers.Get(h.clientConfig(r, provider))
+	if err != nil {
+		slog.Error("oidc discovery failed", "provider", provider.Slug, "error", err)
+		http.Redirect(w, r, "/login?error=sso_unavailable", http.StatusSeeOther)
+		return
+	}
+
+	state, err1 := oidc.RandomString()
+	nonce, err2 := oidc.RandomString()
+	verifier, err3 := oidc.RandomString()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		http.Error(w, "Ошибка генерации параметров входа", http.StatusInternalServerError)
+		return
+	}
+
+	flow, _ := h.store.Get(r, oidcFlowSession)
+	flow.Options = flowOptions(r, int(internal.OIDCFlowTTL.Seconds()))
+	flow.Values["provider_id"] = provider.ID
+	flow.Values["state"] = state
+	flow.Values["nonce"] = nonce
+	flow.Values["verifier"] = verifier
+	if err := flow.Save(r, w); err != nil {
+		slog.Error("failed to save oidc flow", "error", err)
+		http.Error(w, "Ошибка сохранения сессии", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, client.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// Callback принимает код от провайдера, проверяет ID-токен и выполняет вход
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	flow, _ := h.store.Get(r, oidcFlowSession)
+	providerID, _ := flow.Values["provider_id"].(int)
+	state, _ := flow.Values["state"].(string)
+	nonce, _ := flow.Values["nonce"].(string)
+	verifier, _ := flow.Values["verifier"].(string)
+
+	// Параметры одноразовые: удаляем их до любых проверок
+	flow.Options = flowOptions(r, -1)
+	flow.Save(r, w)
+
+	query := r.URL.Query()
+	if state == "" || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		http.Redirect(w, r, "/login?error=sso_failed", http.StatusSeeOther)
+		return
+	}
+	if idpError := query.Get("error"); idpError != "" {
+		slog.Info("oidc login cancelled by provider", "provider_id", providerID, "error", idpError)
+		http.Redirect(w, r, "/login?error=sso_failed", http.StatusSeeOther)
+		return
+	}
+
+	provider, err := h.oidcRepo.GetByID(r.Context(), providerID)
+	if err != nil || !provider.Enabled {
+		http.Redirect(w, r, "/login?error=sso_unavailable", http.StatusSeeOther)
+		return
+	}
+
+	client, err := h.providers.Get(h.clientConfig(r, provider))
+	if err != nil {
+		slog.Error("oidc discovery failed", "provider", provider.Slug, "error", err)
+		http.Redirect(w, r, "/login?error=sso_unavailable", http.StatusSeeOther)
+		return
+	}
+
+	rawIDToken, err := client.Exchange(query.Get("code"), verifier)
+	if err != nil {
+		slog.Error("oidc code exchange failed", "provider", provider.Slug, "error", err)
+		http.Redirect(w, r, "/login?error=sso_failed", http.StatusSeeOther)
+		return
+	}
+
+	claims, err := client.Verify(rawIDToken, nonce)
+	if err != nil {
+		slog.Error("oidc id token rejected", "provider", provider.Slug, "error", err)
+		http.Redirect(w, r, "/login?error=sso_failed", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := h.resolveUser(r, provider, claims)
+	switch {
+	case errors.Is(err, errSSONoRole):
+		http.Redirect(w, r, "/login?error=sso_no_role", http.StatusSeeOther)
+		return
+	case errors.Is(err, errSSONoAccount):
+		http.Redirect(w, r, "/login?error=sso_no_account", http.StatusSeeOther)
+		return
+	case errors.Is(err, errSSOConflict):
+		http.Redirect(w, r, "/login?error=sso_conflict", http.StatusSeeOther)
+		return
+	case err != nil:
+		slog.Error("failed to resolve sso user", "provider", provider.Slug, "error", err)
+		http.Redirect(w, r, "/login?error=sso_failed", http.StatusSeeOther)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to load sso user", "user_id", userID, "error", err)
+		http.Redirect(w, r, "/login?error=sso_failed", http.StatusSeeOther)
+		return
+	}
+	if user.Blocked {
+		http.Redirect(w, r, "/login?error=account_blocked", http.StatusSeeOther)
+		return
+	}
+
+	if err := startUserSession(w, r, h.store, h.sessionRepo, user); err != nil {
+		slog.Error("failed to start sso session", "user_id", user.ID, "error", err)
+		http.Redirect(w, r, "/login?error=session_error", http.StatusSeeOther)
+		return
+	}
+
+	slog.Info("sso login", "provider", provider.Slug, "user_id", user.ID, "role", user.Role.Name)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// resolveUser находит пользователя по subject провайдера, при первом входе привязывает
+// существующего пользователя или создает нового. Привязка возможна только у провайдера школы:
+// пользователь той же школы с той же ролью и подтвержденной провайдером почтой.
+// Роль уже привязанного пользователя каждый раз приводится к роли из утверждений провайдера,
+// изменение записывается в журнал аудита.
+func (h *OIDCHandler) resolveUser(r *http.Request, provider *entity.OIDCProvider, claims oidc.Claims) (int, error) {
+	subject := claims.String("sub")
+	role := mapSSORole(provider, claims)
+
+	userID, err := h.oidcRepo.FindIdentity(r.Context(), provider.ID, subject)
+	if err == nil {
+		if role == "" {
+			return 0, errSSONoRole
+		}
+		previous, err := h.oidcRepo.SetUserRole(r.Context(), userID, role)
+		if err != nil {
+			return 0, err
+		}
+		if previous != "" {
+			h.audit.Record(r, "user.role_change", "user", userID,
+				map[string]string{"role": previous},
+				map[string]string{"role": role, "provider": provider.Slug})
+		}
+		if err := h.oidcRepo.TouchIdentity(r.Context(), provider.ID, subject); err != nil {
+			slog.Error("failed to touch identity", "user_id", userID, "error", err)
+		}
+		return userID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	if role == "" {
+		return 0, errSSONoRole
+	}
+
+	// Привязываем только «ту же» учетную запись: иначе провайдер мог бы выдать себя за
+	// пользователя другой школы. Логин провайдер задает сам, поэтому сверяется подтвержденная почта.
+	email := strings.TrimSpace(claims.String("email"))
+	if provider.SchoolID != nil && email != "" && claims.Bool("email_verified") {
+		candidateID, candidateRole, err := h.oidcRepo.FindLinkCandidate(r.Context(), *provider.SchoolID, email)
+		switch {
+		case err == nil:
+			if candidateRole != role {
+				return 0, errSSOConflict
+			}
+			if err := h.oidcRepo.LinkIdentity(r.Context(), provider.ID, subject, candidateID); err != nil {
+				return 0, err
+			}
+			// Идентификатор у провайдера в журнал не пишется: журнал не очищается при удалении данных ученика
+			h.audit.Record(r, "user.sso_link", "user", candidateID, nil, map[string]string{
+				"provider": provider.Slug,
+			})
+			return candidateID, nil
+		case errors.Is(err, repository.ErrAmbiguousLink):
+			return 0, errSSOConflict
+		case !errors.Is(err, sql.ErrNoRows):
+			return 0, err
+		}
+	}
+
+	username := strings.TrimSpace(claims.String(provider.UsernameClaim))
+	if username == "" {
+		return 0, errSSONoAccount
+	}
+
+	// Ученики попадают в класс только по коду класса, поэтому автоматически создаются лишь сотрудники
+	if !provider.AllowProvisioning || role == "student" {
+		return 0, errSSONoAccount
+	}
+
+	fullName := strings.TrimSpace(claims.String(provider.NameClaim))
+	if fullName == "" {
+		fullName = username
+	}
+
+	userID, err = h.oidcRepo.Provision(r.Context(), provider, subject, username, fullName, role)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		// Логин занят учетной записью, которую нельзя привязать автоматически
+		return 0, errSSOConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	h.audit.Record(r, "user.sso_provision", "user", userID, nil, map[string]interface{}{
+		"provider":  provider.Slug,
+		"role":      role,
+		"school_id": provider.SchoolID,
+	})
+	return userID, nil
+}
+
+// mapSSORole переводит значения утверждения о ролях в роль приложения: побеждает первое
+// значение, для которого есть сопоставление, иначе используется роль по умолчанию.
+// Роль администратора через провайдера не выдается никогда.
+func mapSSORole(provider *entity.OIDCProvider, claims oidc.Claims) string {
+	for _, value := range claims.Strings(provider.RoleClaim) {
+		if role, ok := provider.RoleMapping[value]; ok && role != "admin" {
+			return role
+		}
+	}
+	if provider.DefaultRole != "admin" {
+		return provider.DefaultRole
+	}
+	return ""
+}
+
+// flowOptions - cookie с параметрами входа видна только обработчикам SSO.
+// SameSite=Lax нужен, чтобы cookie пришла при возврате с сайта провайдера.
+func flowOptions(r *http.Request, maxAge int) *sessions.Options {
+	return &sessions.Options{
+		Path:     "/auth/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   middleware.IsHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (h *OIDCHandler) clientConfig(r *http.Request, provider *entity.OIDCProvider) oidc.Config {
+	return oidc.Config{
+		Issuer:       provider.Issuer,
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  middleware.BaseURL(r) + "/auth/oidc/callback",
+		Scopes:       provider.Scopes,
+	}
+}
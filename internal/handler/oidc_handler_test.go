@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"edugame/internal/entity"
+	"edugame/internal/oidc"
+	"testing"
+)
+
+func TestMapSSORole(t *testing.T) {
+	provider := &entity.OIDCProvider{
+		RoleClaim: "roles",
+		RoleMapping: map[string]string{
+			"teacher":    "teacher",
+			"headmaster": "director",
+			"superuser":  "admin",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		claim       interface{}
+		defaultRole string
+		want        string
+	}{
+		{name: "array claim", claim: []interface{}{"guest", "headmaster"}, want: "director"},
+		{name: "first mapped value wins", claim: []interface{}{"teacher", "headmaster"}, want: "teacher"},
+		{name: "string claim", claim: "teacher", want: "teacher"},
+		{name: "no mapping", claim: []interface{}{"guest"}, want: ""},
+		{name: "default role", claim: []interface{}{"guest"}, defaultRole: "teacher", want: "teacher"},
+		{name: "admin is never granted", claim: []interface{}{"superuser"}, want: ""},
+		{name: "admin default is ignored", claim: nil, defaultRole: "admin", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := *provider
+			p.DefaultRole = tt.defaultRole
+
+			if got := mapSSORole(&p, oidc.Claims{"roles": tt.claim}); got != tt.want {
+				t.Errorf("mapSSORole() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package handler
+
+import (
+	"context"
+	"edugame/internal"
+	middleware "edugame/internal/midlleware"
+	"edugame/internal/repository"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// weeklySummaryLimit - сколько последних сводок показывать на странице родителя
+const weeklySummaryLimit = 12
+
+var guardianIPPolicy = repository.ThrottlePolicy{
+	FreeAttempts: internal.GuardianCodeIPFreeAttempts,
+	BaseDelay:    internal.LoginBackoffBase,
+	MaxDelay:     internal.LoginBackoffMax,
+	Window:       internal.LoginFailureWindow,
+}
+
+// ParentHandler - кабинет родителя: регистрация и привязка детей по коду от учителя,
+// просмотр статистики детей (только чтение) и еженедельные сводки
+type ParentHandler struct {
+	guardRepo    repository.Guardians
+	teacherRepo  repository.Teachers
+	userRepo     repository.Users
+	sessionRepo  repository.Sessions
+	throttleRepo repository.LoginThrottles
+	audit        *Auditor
+	tmpl         *template.Template
+	store        *sessions.CookieStore
+}
+
+func NewParentHandler(
+	guardRepo repository.Guardians,
+	teacherRepo repository.Teachers,
+	userRepo repository.Users,
+	sessionRepo repository.Sessions,
+	throttleRepo repository.LoginThrottles,
+	auditRepo repository.AuditLog,
+	store *sessions.CookieStore,
+) *ParentHandler {
+	tmpl := template.Must(template.ParseFiles(
+		"internal/templates/guardian_join.html",
+		"internal/templates/parent_home.html",
+		"internal/templates/parent_child.html",
+	))
+
+	return &ParentHandler{
+		guardRepo:    guardRepo,
+		teacherRepo:  teacherRepo,
+		userRepo:     userRepo,
+		sessionRepo:  sessionRepo,
+		throttleRepo: throttleRepo,
+		audit:        NewAuditor(auditRepo, store),
+		tmpl:         tmpl,
+		store:        store,
+	}
+}
+
+// JoinPage - регистрация родителя по коду привязки
+func (h *ParentHandler) JoinPage(w http.ResponseWriter, r *http.Request) {
+	h.renderJoin(w, r, "", map[string]string{
+		"code": r.URL.Query().Get("code"),
+	})
+}
+
+// Join создает учетную запись родителя и привязывает к ней ученика
+func (h *ParentHandler) Join(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.JoinPage(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Ошибка обработки формы", http.StatusBadRequest)
+		return
+	}
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+	fullName := strings.TrimSpace(r.FormValue("full_name"))
+	code := repository.NormalizeResetCode(r.FormValue("code"))
+
+	form := map[string]string{
+		"username":  username,
+		"full_name": fullName,
+		"code":      code,
+	}
+
+	if code == "" {
+		h.renderJoin(w, r, "Введите код от учителя", form)
+		return
+	}
+	if msg := validateNewAccount(username, password, fullName); msg != "" {
+		h.renderJoin(w, r, msg, form)
+		return
+	}
+
+	ipKey, ok := h.checkCodeThrottle(r)
+	if !ok {
+		h.renderJoin(w, r, "Слишком много неверных кодов. Подождите немного и попробуйте снова", form)
+		return
+	}
+
+	parentID, studentID, err := h.guardRepo.RegisterParent(r.Context(), code, username, password, fullName)
+	if errors.Is(err, repository.ErrGuardianCodeInvalid) {
+		h.registerCodeFailure(r.Context(), ipKey)
+		h.renderJoin(w, r, "Код не найден, уже использован или истек. Попросите у учителя новый", form)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to register parent", "error", err)
+		h.renderJoin(w, r, "Ошибка регистрации: возможно, такой логин уже занят", form)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), parentID)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	slog.Info("parent registered", "user_id", parentID, "student_id", studentID)
+
+	if err := startUserSession(w, r, h.store, h.sessionRepo, user); err != nil {
+		http.Redirect(w, r, "/login?error=session_error", http.StatusSeeOther)
+		return
+	}
+
+	h.audit.Record(r, "guardian.link", "user", studentID, nil, map[string]interface{}{
+		"parent_id": parentID,
+	})
+
+	http.Redirect(w, r, "/parent", http.StatusSeeOther)
+}
+
+// Home - список детей и еженедельные сводки
+func (h *ParentHandler) Home(w http.ResponseWriter, r *http.Request) {
+	parentID, ok := h.parentID(w, r)
+	if !ok {
+		return
+	}
+
+	children, err := h.guardRepo.GetChildren(r.Context(), parentID)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения списка детей", err)
+		slog.Error("failed to get children", "error", err, "parent_id", parentID)
+		return
+	}
+
+	summaries, err := h.guardRepo.GetSummaries(r.Context(), parentID, weeklySummaryLimit)
+	if err != nil {
+		slog.Error("failed to get weekly summaries", "error", err, "parent_id", parentID)
+	}
+
+	data := map[string]interface{}{
+		"CSRFToken": middleware.CSRFToken(r),
+		"Children":  children,
+		"Summaries": summaries,
+		"Error":     r.URL.Query().Get("error"),
+		"Message":   r.URL.Query().Get("message"),
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "parent_home.html", data); err != nil {
+		slog.Error("failed to render parent home", "error", err)
+	}
+}
+
+// Link привязывает к родителю еще одного ребенка по коду
+func (h *ParentHandler) Link(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parentID, ok := h.parentID(w, r)
+	if !ok {
+		return
+	}
+
+	code := repository.NormalizeResetCode(r.FormValue("code"))
+	if code == "" {
+		http.Redirect(w, r, "/parent?error="+url.QueryEscape("Введите код от учителя"), http.StatusSeeOther)
+		return
+	}
+
+	ipKey, ok := h.checkCodeThrottle(r)
+	if !ok {
+		http.Redirect(w, r, "/parent?error="+url.QueryEscape("Слишком много неверных кодов. Подождите немного"), http.StatusSeeOther)
+		return
+	}
+
+	studentID, err := h.guardRepo.LinkByCode(r.Context(), parentID, code)
+	switch {
+	case errors.Is(err, repository.ErrGuardianCodeInvalid):
+		h.registerCodeFailure(r.Context(), ipKey)
+		http.Redirect(w, r, "/parent?error="+url.QueryEscape("Код не найден, уже использован или истек"), http.StatusSeeOther)
+		return
+	case errors.Is(err, repository.ErrAlreadyLinked):
+		http.Redirect(w, r, "/parent?error="+url.QueryEscape("Этот ребенок уже привязан к вашей учетной записи"), http.StatusSeeOther)
+		return
+	case err != nil:
+		middleware.ServerError(w, "Ошибка привязки", err)
+		slog.Error("failed to link child", "error", err, "parent_id", parentID)
+		return
+	}
+
+	slog.Info("child linked", "parent_id", parentID, "student_id", studentID)
+	h.audit.Record(r, "guardian.link", "user", studentID, nil, map[string]interface{}{
+		"parent_id": parentID,
+	})
+
+	http.Redirect(w, r, "/parent?message="+url.QueryEscape("Ребенок привязан"), http.StatusSeeOther)
+}
+
+// Child - статистика и недельная сетка сессий ребенка. Чужой ученик - 404.
+func (h *ParentHandler) Child(w http.ResponseWriter, r *http.Request) {
+	parentID, ok := h.parentID(w, r)
+	if !ok {
+		return
+	}
+
+	studentID, err := strconv.Atoi(r.URL.Query().Get("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	// Только прошедшие недели: 0 - текущая, -1 - предыдущая и т.д.
+	week, _ := strconv.Atoi(r.URL.Query().Get("week"))
+	if week > 0 {
+		week = 0
+	}
+
+	scope := h.teacherRepo.ForParent(parentID)
+
+	stats, err := scope.GetStudentStatistics(r.Context(), studentID)
+	if errors.Is(err, repository.ErrNotInScope) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения статистики", err)
+		slog.Error("failed to get child statistics", "error", err, "student_id", studentID)
+		return
+	}
+
+	weekly, err := scope.GetStudentWeeklyResults(r.Context(), studentID, week)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения статистики недели", err)
+		slog.Error("failed to get child weekly results", "error", err, "student_id", studentID)
+		return
+	}
+
+	stats["CSRFToken"] = middleware.CSRFToken(r)
+	stats["DailyResults"] = weekly
+	stats["Week"] = week
+	stats["PrevWeek"] = week - 1
+	stats["NextWeek"] = week + 1
+
+	if err := h.tmpl.ExecuteTemplate(w, "parent_child.html", stats); err != nil {
+		slog.Error("failed to render child page", "error", err)
+	}
+}
+
+// SetSummary включает или выключает еженедельную сводку по ребенку
+func (h *ParentHandler) SetSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parentID, ok := h.parentID(w, r)
+	if !ok {
+		return
+	}
+
+	studentID, err := strconv.Atoi(r.FormValue("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	enabled := r.FormValue("enabled") == "1"
+
+	updated, err := h.guardRepo.SetWeeklySummary(r.Context(), parentID, studentID, enabled)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка сохранения настройки", err)
+		slog.Error("failed to set weekly summary", "error", err, "parent_id", parentID)
+		return
+	}
+	if !updated {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/parent", http.StatusSeeOther)
+}
+
+func (h *ParentHandler) parentID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	session, _ := h.store.Get(r, "app-session")
+	parentID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, false
+	}
+	return parentID, true
+}
+
+// checkCodeThrottle возвращает ключ ограничения по IP и false, если ввод кодов временно запрещен
+func (h *ParentHandler) checkCodeThrottle(r *http.Request) (string, bool) {
+	ipKey := "guardian-" + repository.LoginThrottleIPKey(clientIP(r))
+
+	wait, err := h.throttleRepo.RetryAfter(r.Context(), ipKey)
+	if err != nil {
+		slog.Error("failed to check guardian throttle", "error", err)
+	}
+
+	return ipKey, wait <= 0
+}
+
+func (h *ParentHandler) registerCodeFailure(ctx context.Context, ipKey string) {
+	if err := h.throttleRepo.RegisterFailure(ctx, ipKey, guardianIPPolicy); err != nil {
+		slog.Error("failed to register guardian code failure", "error", err)
+	}
+}
+
+func (h *ParentHandler) renderJoin(w http.ResponseWriter, r *http.Request, errMsg string, form map[string]string) {
+	data := map[string]interface{}{
+		"Title":     "Регистрация родителя",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Error":     errMsg,
+		"Form":      form,
+		"MinLength": internal.PasswordMinLength,
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "guardian_join.html", data); err != nil {
+		slog.Error("failed to render guardian join page", "error", err)
+	}
+}
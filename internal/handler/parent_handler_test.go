@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const testParentID = 30
+
+// Родитель не видит статистику ученика, который к нему не привязан
+func TestParentCannotViewForeignChild(t *testing.T) {
+	env := newTeacherTestEnv(t)
+	env.mock.ExpectQuery(`FROM guardians g\s+JOIN users u`).
+		WithArgs(testParentID, testForeignStudent).
+		WillReturnError(sql.ErrNoRows)
+
+	rec := httptest.NewRecorder()
+	env.parent.Child(rec, env.requestAs(t, testParentID, "parent", http.MethodGet, "/parent/child?student_id=42", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if err := env.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParentCannotSubscribeToForeignChild(t *testing.T) {
+	env := newTeacherTestEnv(t)
+	env.mock.ExpectExec(`UPDATE guardians SET weekly_summary`).
+		WithArgs(testParentID, testForeignStudent, true).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	form := url.Values{"student_id": {"42"}, "enabled": {"1"}}
+	rec := httptest.NewRecorder()
+	env.parent.SetSummary(rec, env.requestAs(t, testParentID, "parent", http.MethodPost, "/parent/summary", form))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if err := env.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"edugame/internal"
+	middleware "edugame/internal/midlleware"
+	"edugame/internal/repository"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+)
+
+// PasswordResetHandler - страница, где ученик по коду от учителя задает новый пароль
+type PasswordResetHandler struct {
+	resetRepo    repository.PasswordResets
+	throttleRepo repository.LoginThrottles
+	tmpl         *template.Template
+}
+
+func NewPasswordResetHandler(resetRepo repository.PasswordResets, throttleRepo repository.LoginThrottles) *PasswordResetHandler {
+	tmpl := template.Must(template.ParseFiles("internal/templates/reset_password.html"))
+
+	return &PasswordResetHandler{
+		resetRepo:    resetRepo,
+		throttleRepo: throttleRepo,
+		tmpl:         tmpl,
+	}
+}
+
+var resetIPPolicy = repository.ThrottlePolicy{
+	FreeAttempts: internal.PasswordResetIPFreeAttempts,
+	BaseDelay:    internal.LoginBackoffBase,
+	MaxDelay:     internal.LoginBackoffMax,
+	Window:       internal.LoginFailureWindow,
+}
+
+// ResetPage - форма ввода кода и нового пароля
+func (h *PasswordResetHandler) ResetPage(w http.ResponseWriter, r *http.Request) {
+	h.render(w, r, r.URL.Query().Get("error"), r.URL.Query().Get("code"))
+}
+
+// Reset погашает код и меняет пароль
+func (h *PasswordResetHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.ResetPage(w, r)
+		return
+	}
+
+	code := repository.NormalizeResetCode(r.FormValue("code"))
+	password := r.FormValue("password")
+	confirm := r.FormValue("password_confirm")
+
+	switch {
+	case code == "" || password == "":
+		h.render(w, r, "empty_fields", code)
+		return
+	case utf8.RuneCountInString(password) < internal.PasswordMinLength:
+		h.render(w, r, "password_too_short", code)
+		return
+	case password != confirm:
+		h.render(w, r, "password_mismatch", code)
+		return
+	}
+
+	ipKey := "reset-" + repository.LoginThrottleIPKey(clientIP(r))
+
+	wait, err := h.throttleRepo.RetryAfter(r.Context(), ipKey)
+	if err != nil {
+		slog.Error("failed to check reset throttle", "error", err)
+	}
+	if wait > 0 {
+		h.render(w, r, "too_many_attempts", "")
+		return
+	}
+
+	userID, err := h.resetRepo.Redeem(r.Context(), code, password, clientIP(r))
+	if errors.Is(err, repository.ErrResetCodeInvalid) {
+		if err := h.throttleRepo.RegisterFailure(r.Context(), ipKey, resetIPPolicy); err != nil {
+			slog.Error("failed to register reset failure", "error", err)
+		}
+		h.render(w, r, "invalid_code", "")
+		return
+	}
+	if err != nil {
+		slog.Error("failed to redeem reset code", "error", err)
+		middleware.ServerError(w, "Ошибка смены пароля", err)
+		return
+	}
+
+	slog.Info("password reset by code", "user_id", userID)
+	http.Redirect(w, r, "/login?message="+url.QueryEscape("Пароль изменен, войдите с новым паролем"), http.StatusSeeOther)
+}
+
+func (h *PasswordResetHandler) render(w http.ResponseWriter, r *http.Request, errorCode, code string) {
+	data := map[string]interface{}{
+		"Title":     "Новый пароль",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Error":     errorCode,
+		"Code":      code,
+		"MinLength": internal.PasswordMinLength,
+	}
+
+	if err := h.tmpl.Execute(w, data); err != nil {
+		slog.Error("failed to render reset page", "error", err)
+	}
+}
@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"context"
+	"edugame/internal"
+	middleware "edugame/internal/midlleware"
+	"edugame/internal/repository"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// LoginPicture - картинка для входа. В секрет попадает только Key.
+type LoginPicture struct {
+	Key   string
+	Emoji string
+	Name  string
+}
+
+var loginPictures = []LoginPicture{
+	{Key: "cat", Emoji: "🐱", Name: "кошка"},
+	{Key: "dog", Emoji: "🐶", Name: "собака"},
+	{Key: "sun", Emoji: "☀️", Name: "солнце"},
+	{Key: "apple", Emoji: "🍎", Name: "яблоко"},
+	{Key: "car", Emoji: "🚗", Name: "машина"},
+	{Key: "star", Emoji: "⭐", Name: "звезда"},
+	{Key: "fish", Emoji: "🐟", Name: "рыбка"},
+	{Key: "ball", Emoji: "⚽", Name: "мяч"},
+	{Key: "tree", Emoji: "🌳", Name: "дерево"},
+	{Key: "house", Emoji: "🏠", Name: "дом"},
+	{Key: "flower", Emoji: "🌸", Name: "цветок"},
+	{Key: "rocket", Emoji: "🚀", Name: "ракета"},
+}
+
+var pictureLoginPolicy = repository.ThrottlePolicy{
+	FreeAttempts: internal.PictureFreeAttempts,
+	BaseDelay:    internal.PictureBackoffBase,
+	MaxDelay:     internal.PictureBackoffMax,
+	Window:       internal.PictureFailureWindow,
+}
+
+// parsePictureSecret проверяет выбранную последовательность картинок ("cat,sun,star")
+// и возвращает ее в каноническом виде для хеширования
+func parsePictureSecret(raw string) (string, bool) {
+	keys := strings.Split(raw, ",")
+	if len(keys) < internal.PictureSecretMinLength || len(keys) > internal.PictureSecretMaxLength {
+		return "", false
+	}
+
+	for _, key := range keys {
+		known := false
+		for _, picture := range loginPictures {
+			if picture.Key == key {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return "", false
+		}
+	}
+
+	return strings.Join(keys, "-"), true
+}
+
+// PictureLoginHandler - вход для младших школьников: код класса, имя из списка и картинки
+type PictureLoginHandler struct {
+	userRepo     repository.Users
+	teacherRepo  repository.Teachers
+	sessionRepo  repository.Sessions
+	throttleRepo repository.LoginThrottles
+	audit        *Auditor
+	tmpl         *template.Template
+	store        *sessions.CookieStore
+}
+
+func NewPictureLoginHandler(
+	userRepo repository.Users,
+	teacherRepo repository.Teachers,
+	sessionRepo repository.Sessions,
+	throttleRepo repository.LoginThrottles,
+	auditRepo repository.AuditLog,
+	store *sessions.CookieStore,
+) *PictureLoginHandler {
+	tmpl := template.Must(template.ParseFiles(
+		"internal/templates/picture_login.html",
+		"internal/templates/picture_password.html",
+	))
+
+	return &PictureLoginHandler{
+		userRepo:     userRepo,
+		teacherRepo:  teacherRepo,
+		sessionRepo:  sessionRepo,
+		throttleRepo: throttleRepo,
+		audit:        NewAuditor(auditRepo, store),
+		tmpl:         tmpl,
+		store:        store,
+	}
+}
+
+// LoginPage ведет ученика по шагам: код класса -> свое имя -> картинки
+func (h *PictureLoginHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	code := repository.NormalizeResetCode(query.Get("code"))
+
+	data := map[string]interface{}{
+		"Title":     "Вход по картинкам",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Error":     query.Get("error"),
+		"Step":      "code",
+		"Code":      code,
+		"Pictures":  loginPictures,
+		"MinLength": internal.PictureSecretMinLength,
+		"MaxLength": internal.PictureSecretMaxLength,
+	}
+
+	if code != "" {
+		class, err := h.teacherRepo.GetClassByLoginCode(r.Context(), code)
+		if err != nil {
+			data["Error"] = "invalid_code"
+			h.render(w, "picture_login.html", data)
+			return
+		}
+
+		students, err := h.teacherRepo.GetClassStudents(r.Context(), class.ID)
+		if err != nil {
+			slog.Error("failed to get class students", "error", err, "class_id", class.ID)
+			middleware.ServerError(w, "Ошибка получения учеников", err)
+			return
+		}
+
+		var roster []map[string]interface{}
+		for _, student := range students {
+			if student.HasPicturePassword && !student.IsBlocked {
+				roster = append(roster, map[string]interface{}{
+					"ID":       student.ID,
+					"FullName": student.FullName,
+				})
+			}
+		}
+
+		data["Step"] = "roster"
+		data["ClassName"] = class.Name
+		data["Students"] = roster
+
+		if studentID, err := strconv.Atoi(query.Get("student_id")); err == nil {
+			for _, student := range roster {
+				if student["ID"] == studentID {
+					data["Step"] = "pictures"
+					data["Student"] = student
+					break
+				}
+			}
+		}
+	}
+
+	h.render(w, "picture_login.html", data)
+}
+
+// Login проверяет последовательность картинок и открывает сессию
+func (h *PictureLoginHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.LoginPage(w, r)
+		return
+	}
+
+	code := repository.NormalizeResetCode(r.FormValue("code"))
+	studentID, _ := strconv.Atoi(r.FormValue("student_id"))
+	back := "/picture-login?code=" + url.QueryEscape(code) + "&student_id=" + strconv.Itoa(studentID)
+
+	ipKey := "picture-" + repository.LoginThrottleIPKey(clientIP(r))
+	studentKey := repository.LoginThrottlePictureKey(studentID)
+
+	wait, err := h.throttleRepo.RetryAfter(r.Context(), studentKey, ipKey)
+	if err != nil {
+		slog.Error("failed to check picture login throttle", "error", err)
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds())+1))
+		http.Redirect(w, r, back+"&error=too_many_attempts", http.StatusSeeOther)
+		return
+	}
+
+	class, err := h.teacherRepo.GetClassByLoginCode(r.Context(), code)
+	if err != nil {
+		h.registerFailure(r.Context(), ipKey, "")
+		http.Redirect(w, r, "/picture-login?error=invalid_code", http.StatusSeeOther)
+		return
+	}
+
+	secret, ok := parsePictureSecret(r.FormValue("secret"))
+	if !ok {
+		http.Redirect(w, r, back+"&error=wrong_pictures", http.StatusSeeOther)
+		return
+	}
+
+	user, err := h.userRepo.LoginByPicturePassword(r.Context(), class.ID, studentID, secret)
+	if errors.Is(err, repository.ErrAccountBlocked) {
+		http.Redirect(w, r, back+"&error=account_blocked", http.StatusSeeOther)
+		return
+	}
+	if repository.IsTimeout(err) {
+		middleware.ServerError(w, "", err)
+		return
+	}
+	if err != nil {
+		slog.Info("picture login failed", "student_id", studentID, "class_id", class.ID)
+		h.registerFailure(r.Context(), ipKey, studentKey)
+		http.Redirect(w, r, back+"&error=wrong_pictures", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.throttleRepo.Reset(r.Context(), studentKey); err != nil {
+		slog.Error("failed to reset picture login throttle", "error", err)
+	}
+
+	if err := startUserSession(w, r, h.store, h.sessionRepo, user); err != nil {
+		slog.Error("failed to create session", "error", err, "user_id", user.ID)
+		http.Redirect(w, r, back+"&error=session_error", http.StatusSeeOther)
+		return
+	}
+
+	slog.Info("picture login", "user_id", user.ID, "class_id", class.ID)
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
+
+func (h *PictureLoginHandler) registerFailure(ctx context.Context, ipKey, studentKey string) {
+	if err := h.throttleRepo.RegisterFailure(ctx, ipKey, ipLoginPolicy); err != nil {
+		slog.Error("failed to register picture login failure", "error", err)
+	}
+	if studentKey == "" {
+		return
+	}
+	if err := h.throttleRepo.RegisterFailure(ctx, studentKey, pictureLoginPolicy); err != nil {
+		slog.Error("failed to register picture login failure", "error", err)
+	}
+}
+
+// PicturePasswordPage - учитель задает ученику своего класса картиночный пароль
+func (h *PictureLoginHandler) PicturePasswordPage(w http.ResponseWriter, r *http.Request) {
+	studentID, err := strconv.Atoi(r.FormValue("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	session, _ := h.store.Get(r, "app-session")
+	teacherID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	err = h.teacherRepo.ForTeacher(teacherID).CheckStudentManage(r.Context(), studentID)
+	if errors.Is(err, repository.ErrNotInScope) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to check student class", "error", err, "student_id", studentID)
+		middleware.ServerError(w, "Ошибка проверки ученика", err)
+		return
+	}
+
+	student, err := h.userRepo.GetByID(r.Context(), studentID)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения ученика", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"CSRFToken": middleware.CSRFToken(r),
+		"Student":   student,
+		"Pictures":  loginPictures,
+		"MinLength": internal.PictureSecretMinLength,
+		"MaxLength": internal.PictureSecretMaxLength,
+		"ClassID":   r.FormValue("class_id"),
+		"BackURL":   classBackURL(r),
+		"Error":     "",
+	}
+
+	if r.Method == http.MethodPost {
+		secret, ok := parsePictureSecret(r.FormValue("secret"))
+		if !ok {
+			data["Error"] = fmt.Sprintf("Выберите от %d до %d картинок", internal.PictureSecretMinLength, internal.PictureSecretMaxLength)
+			h.render(w, "picture_password.html", data)
+			return
+		}
+
+		if err := h.userRepo.SetPicturePassword(r.Context(), studentID, secret); err != nil {
+			slog.Error("failed to set picture password", "error", err, "student_id", studentID)
+			middleware.ServerError(w, "Ошибка сохранения", err)
+			return
+		}
+
+		if err := h.throttleRepo.Reset(r.Context(), repository.LoginThrottlePictureKey(studentID)); err != nil {
+			slog.Error("failed to reset picture login throttle", "error", err)
+		}
+
+		slog.Info("picture password set", "student_id", studentID)
+		h.audit.Record(r, "student.picture_password", "user", studentID, nil, nil)
+		http.Redirect(w, r, classBackURL(r), http.StatusSeeOther)
+		return
+	}
+
+	h.render(w, "picture_password.html", data)
+}
+
+// RotateClassCode выдает классу учителя новый код для входа по картинкам
+func (h *PictureLoginHandler) RotateClassCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, class, ok := selectTeacherClass(w, r, h.store, h.teacherRepo)
+	if !ok || !requireClassLead(w, class) {
+		return
+	}
+
+	if _, err := h.teacherRepo.RotateClassLoginCode(r.Context(), class.ID); err != nil {
+		slog.Error("failed to rotate class login code", "error", err, "class_id", class.ID)
+		middleware.ServerError(w, "Ошибка смены кода класса", err)
+		return
+	}
+
+	slog.Info("class login code rotated", "class_id", class.ID)
+	h.audit.Record(r, "class.login_code", "class", class.ID, nil, nil)
+	http.Redirect(w, r, classURL(class.ID), http.StatusSeeOther)
+}
+
+func (h *PictureLoginHandler) render(w http.ResponseWriter, name string, data map[string]interface{}) {
+	if err := h.tmpl.ExecuteTemplate(w, name, data); err != nil {
+		slog.Error("failed to render template", "template", name, "error", err)
+	}
+}
@@ -1,120 +1,232 @@
 package handler
 
 import (
+	"edugame/internal"
+	"edugame/internal/entity"
+	middleware "edugame/internal/midlleware"
 	"edugame/internal/repository"
-	"fmt"
+	"errors"
 	"html/template"
+	"log/slog"
 	"net/http"
-	"strconv"
-	"time"
+	"net/url"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/gorilla/sessions"
 )
 
+// RegistrationHandler - самостоятельная регистрация учеников по коду класса
+// и регистрация сотрудников по приглашению администратора
 type RegistrationHandler struct {
-	userRepo *repository.UserRepository
-	tmpl     *template.Template
-	store    *sessions.CookieStore
+	userRepo     repository.Users
+	teacherRepo  repository.Teachers
+	inviteRepo   repository.Invites
+	sessionRepo  repository.Sessions
+	throttleRepo repository.LoginThrottles
+	tmpl         *template.Template
+	store        *sessions.CookieStore
 }
 
-func NewRegistrationHandler(userRepo *repository.UserRepository, store *sessions.CookieStore) *RegistrationHandler {
+func NewRegistrationHandler(
+	userRepo repository.Users,
+	teacherRepo repository.Teachers,
+	inviteRepo repository.Invites,
+	sessionRepo repository.Sessions,
+	throttleRepo repository.LoginThrottles,
+	store *sessions.CookieStore,
+) *RegistrationHandler {
 	tmpl := template.Must(template.ParseFiles(
 		"internal/templates/register.html",
+		"internal/templates/invite.html",
 	))
 
 	return &RegistrationHandler{
-		userRepo: userRepo,
-		tmpl:     tmpl,
-		store:    store,
+		userRepo:     userRepo,
+		teacherRepo:  teacherRepo,
+		inviteRepo:   inviteRepo,
+		sessionRepo:  sessionRepo,
+		throttleRepo: throttleRepo,
+		tmpl:         tmpl,
+		store:        store,
 	}
 }
 
 func (h *RegistrationHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
-	classes, err := h.userRepo.GetAllClasses()
+	h.renderRegister(w, r, "", map[string]string{
+		"join_code": r.URL.Query().Get("code"),
+	})
+}
+
+// Register создает заявку ученика в класс по коду. Войти можно после подтверждения учителем.
+func (h *RegistrationHandler) Register(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.RegisterPage(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Ошибка обработки формы", http.StatusBadRequest)
+		return
+	}
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+	fullName := strings.TrimSpace(r.FormValue("full_name"))
+	joinCode := repository.NormalizeResetCode(r.FormValue("join_code"))
+
+	form := map[string]string{
+		"username":  username,
+		"full_name": fullName,
+		"join_code": joinCode,
+	}
+
+	if msg := validateNewAccount(username, password, fullName); msg != "" {
+		h.renderRegister(w, r, msg, form)
+		return
+	}
+
+	ipKey := "join-" + repository.LoginThrottleIPKey(clientIP(r))
+
+	wait, err := h.throttleRepo.RetryAfter(r.Context(), ipKey)
 	if err != nil {
-		fmt.Println(err)
+		slog.Error("failed to check join throttle", "error", err)
+	}
+	if wait > 0 {
+		h.renderRegister(w, r, "Слишком много неверных кодов. Подождите немного и попробуйте снова", form)
 		return
 	}
 
-	fmt.Println(len(classes))
+	class, err := h.teacherRepo.GetClassByJoinCode(r.Context(), joinCode)
+	if err != nil {
+		if err := h.throttleRepo.RegisterFailure(r.Context(), ipKey, resetIPPolicy); err != nil {
+			slog.Error("failed to register join failure", "error", err)
+		}
+		h.renderRegister(w, r, "Код класса не найден. Уточните его у учителя", form)
+		return
+	}
 
-	data := map[string]interface{}{
-		"Title":   "Регистрация",
-		"Error":   "",
-		"Classes": classes,
-		"Form":    map[string]string{},
+	user, err := h.userRepo.RegisterStudentRequest(r.Context(), username, password, fullName, class.ID)
+	if err != nil {
+		slog.Error("failed to register student", "error", err, "class_id", class.ID)
+		h.renderRegister(w, r, "Ошибка регистрации: возможно, такой логин уже занят", form)
+		return
 	}
 
-	h.tmpl.Execute(w, data)
+	slog.Info("student registration request", "user_id", user.ID, "class_id", class.ID)
+	http.Redirect(w, r, "/login?message="+url.QueryEscape("Заявка в "+class.Name+" отправлена. Войти можно после подтверждения учителем"), http.StatusSeeOther)
 }
 
-func (h *RegistrationHandler) Register(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		h.RegisterPage(w, r)
+// InvitePage - регистрация сотрудника по ссылке-приглашению
+func (h *RegistrationHandler) InvitePage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	invite, err := h.inviteRepo.GetValid(r.Context(), token)
+	if err != nil && !errors.Is(err, repository.ErrInviteInvalid) {
+		slog.Error("failed to get invite", "error", err)
+		middleware.ServerError(w, "Ошибка проверки приглашения", err)
 		return
 	}
 
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Ошибка обработки формы", http.StatusBadRequest)
+	h.renderInvite(w, r, token, invite, "", map[string]string{})
+}
+
+// AcceptInvite создает учетную запись сотрудника по приглашению
+func (h *RegistrationHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.InvitePage(w, r)
 		return
 	}
 
-	username := r.FormValue("username")
+	token := r.FormValue("token")
+	username := strings.TrimSpace(r.FormValue("username"))
 	password := r.FormValue("password")
-	fullName := r.FormValue("full_name")
-	role := r.FormValue("role")
-
-	var classID int
-	if role == "student" {
-		if classStr := r.FormValue("class_id"); classStr != "" {
-			id, _ := strconv.Atoi(classStr)
-			classID = id
-		}
+	fullName := strings.TrimSpace(r.FormValue("full_name"))
+
+	form := map[string]string{
+		"username":  username,
+		"full_name": fullName,
 	}
 
-	user, err := h.userRepo.Register(username, password, role, fullName, &classID)
+	invite, err := h.inviteRepo.GetValid(r.Context(), token)
 	if err != nil {
-		classes, _ := h.userRepo.GetAllClasses()
-		data := map[string]interface{}{
-			"Title":   "Регистрация",
-			"Error":   "Ошибка регистрации: " + err.Error(),
-			"Classes": classes,
-			"Form": map[string]string{
-				"username":  username,
-				"full_name": fullName,
-				"role":      role,
-			},
+		if !errors.Is(err, repository.ErrInviteInvalid) {
+			slog.Error("failed to get invite", "error", err)
 		}
-		h.tmpl.Execute(w, data)
+		h.renderInvite(w, r, token, nil, "", form)
 		return
 	}
 
-	sessionToken, err := h.userRepo.CreateSession(user.ID)
+	if msg := validateNewAccount(username, password, fullName); msg != "" {
+		h.renderInvite(w, r, token, invite, msg, form)
+		return
+	}
+
+	userID, err := h.inviteRepo.Accept(r.Context(), token, username, password, fullName)
+	if errors.Is(err, repository.ErrInviteInvalid) {
+		h.renderInvite(w, r, token, nil, "", form)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to accept invite", "error", err, "invite_id", invite.ID)
+		h.renderInvite(w, r, token, invite, "Ошибка регистрации: возможно, такой логин уже занят", form)
+		return
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
 	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	slog.Info("staff invite accepted", "invite_id", invite.ID, "user_id", userID, "role", invite.RoleName)
+
+	if err := startUserSession(w, r, h.store, h.sessionRepo, user); err != nil {
 		http.Redirect(w, r, "/login?error=session_error", http.StatusSeeOther)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-	})
+	// Стартовую страницу по правам роли выберет LoginPage
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// validateNewAccount возвращает текст ошибки или пустую строку
+func validateNewAccount(username, password, fullName string) string {
+	switch {
+	case username == "" || password == "" || fullName == "":
+		return "Заполните все поля"
+	case utf8.RuneCountInString(password) < internal.PasswordMinLength:
+		return "Пароль слишком короткий"
+	}
+	return ""
+}
+
+func (h *RegistrationHandler) renderRegister(w http.ResponseWriter, r *http.Request, errMsg string, form map[string]string) {
+	data := map[string]interface{}{
+		"Title":     "Регистрация",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Error":     errMsg,
+		"Form":      form,
+		"MinLength": internal.PasswordMinLength,
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "register.html", data); err != nil {
+		slog.Error("failed to render register page", "error", err)
+	}
+}
+
+func (h *RegistrationHandler) renderInvite(w http.ResponseWriter, r *http.Request, token string, invite *entity.StaffInvite, errMsg string, form map[string]string) {
+	data := map[string]interface{}{
+		"Title":     "Регистрация по приглашению",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Token":     token,
+		"Invite":    invite,
+		"Error":     errMsg,
+		"Form":      form,
+		"MinLength": internal.PasswordMinLength,
+	}
 
-	session, _ := h.store.Get(r, "app-session")
-	session.Values["user_id"] = user.ID
-	session.Values["username"] = user.Username
-	session.Values["role"] = user.Role
-	session.Save(r, w)
-
-	switch user.Role.Name {
-	case "student":
-		http.Redirect(w, r, "/home", http.StatusSeeOther)
-	case "teacher":
-		http.Redirect(w, r, "/teacher_home", http.StatusSeeOther)
-	default:
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	if err := h.tmpl.ExecuteTemplate(w, "invite.html", data); err != nil {
+		slog.Error("failed to render invite page", "error", err)
 	}
 }
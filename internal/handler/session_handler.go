@@ -0,0 +1,138 @@
+package handler
+
+import (
+	middleware "edugame/internal/midlleware"
+	"edugame/internal/repository"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+)
+
+// SessionHandler - страница "Мои активные сеансы"
+type SessionHandler struct {
+	sessionRepo repository.Sessions
+	tmpl        *template.Template
+	store       *sessions.CookieStore
+}
+
+func NewSessionHandler(sessionRepo repository.Sessions, store *sessions.CookieStore) *SessionHandler {
+	tmpl := template.Must(template.ParseFiles("internal/templates/sessions.html"))
+
+	return &SessionHandler{
+		sessionRepo: sessionRepo,
+		tmpl:        tmpl,
+		store:       store,
+	}
+}
+
+// SessionsPage - список активных сеансов пользователя
+func (h *SessionHandler) SessionsPage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.currentUserID(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	userSessions, err := h.sessionRepo.GetUserSessions(r.Context(), userID, currentSessionToken(r))
+	if err != nil {
+		slog.Error("failed to get user sessions", "error", err, "user_id", userID)
+		middleware.ServerError(w, "Ошибка получения сеансов", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":     "Активные сеансы",
+		"CSRFToken": middleware.CSRFToken(r),
+		"Sessions":  userSessions,
+		"HomeURL":   middleware.HomeURL(r),
+		"Message":   r.URL.Query().Get("message"),
+	}
+
+	if err := h.tmpl.Execute(w, data); err != nil {
+		slog.Error("failed to render sessions page", "error", err)
+	}
+}
+
+// Revoke завершает один из сеансов пользователя
+func (h *SessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := h.currentUserID(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID сеанса", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.sessionRepo.DeleteUserSession(r.Context(), userID, sessionID)
+	if err != nil {
+		slog.Error("failed to revoke session", "error", err, "user_id", userID, "session_id", sessionID)
+		middleware.ServerError(w, "Ошибка завершения сеанса", err)
+		return
+	}
+	if !deleted {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/sessions?message=Сеанс+завершен", http.StatusSeeOther)
+}
+
+// RevokeOthers завершает все сеансы пользователя, кроме текущего ("выйти на всех устройствах")
+func (h *SessionHandler) RevokeOthers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := h.currentUserID(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	current := currentSessionToken(r)
+	if current == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	count, err := h.sessionRepo.DeleteUserSessions(r.Context(), userID, current)
+	if err != nil {
+		slog.Error("failed to revoke sessions", "error", err, "user_id", userID)
+		middleware.ServerError(w, "Ошибка завершения сеансов", err)
+		return
+	}
+
+	slog.Info("user revoked other sessions", "user_id", userID, "count", count)
+	http.Redirect(w, r, "/sessions?message=Остальные+сеансы+завершены", http.StatusSeeOther)
+}
+
+func (h *SessionHandler) currentUserID(r *http.Request) (int, bool) {
+	session, err := h.store.Get(r, "app-session")
+	if err != nil {
+		return 0, false
+	}
+
+	userID, ok := session.Values["user_id"].(int)
+	return userID, ok && userID > 0
+}
+
+func currentSessionToken(r *http.Request) string {
+	cookie, err := r.Cookie(middleware.SessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
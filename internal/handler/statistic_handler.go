@@ -2,6 +2,7 @@ package handler
 
 import (
 	"edugame/internal/entity"
+	middleware "edugame/internal/midlleware"
 	"edugame/internal/repository"
 	"encoding/json"
 	"fmt"
@@ -15,12 +16,12 @@ import (
 
 type StatsHandler struct {
 	tmpl             *template.Template
-	userProgressRepo *repository.UserProgressRepository
-	userRepo         *repository.UserRepository
+	userProgressRepo repository.Progress
+	userRepo         repository.Users
 	store            *sessions.CookieStore
 }
 
-func NewStatsHandler(up *repository.UserProgressRepository, u *repository.UserRepository, store *sessions.CookieStore) *StatsHandler {
+func NewStatsHandler(up repository.Progress, u repository.Users, store *sessions.CookieStore) *StatsHandler {
 	funcMap := template.FuncMap{
 		"percent": func(correct, total int) int {
 			if total == 0 {
@@ -70,20 +71,21 @@ func (h *StatsHandler) StatsPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stats, err := h.userProgressRepo.GetUserAllProgress(userId)
+	stats, err := h.userProgressRepo.GetUserAllProgress(r.Context(), userId)
 	if err != nil {
 		fmt.Println("Error: ", err)
-		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения статистики", err)
 		return
 	}
 
-	slog.Info("asdk", stats)
+	slog.Info("user progress loaded", "stats", stats)
 
 	total, correct := h.GetTotalAndCorrectCount(stats)
 	fmt.Println("Количество типов для пользователя: ", len(stats))
 
 	data := map[string]interface{}{
 		"Title":        "Статистика",
+		"CSRFToken":    middleware.CSRFToken(r),
 		"Stats":        stats,
 		"TotalCount":   total,
 		"CorrectCount": correct,
@@ -118,9 +120,9 @@ func (h *StatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stats, err := h.userProgressRepo.GetUserAllProgress(userID)
+	stats, err := h.userProgressRepo.GetUserAllProgress(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения статистики", err)
 		return
 	}
 
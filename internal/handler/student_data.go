@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"archive/zip"
+	"database/sql"
+	"edugame/internal/entity"
+	middleware "edugame/internal/midlleware"
+	"edugame/internal/repository"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportStudentData отдает архив со всеми данными ученика и записывает выгрузку в журнал.
+// Проверка доступа к ученику - на вызывающем обработчике.
+func exportStudentData(w http.ResponseWriter, r *http.Request, repo repository.StudentData, audit *Auditor, studentID int) {
+	export, err := repo.Export(r.Context(), studentID)
+	if !studentDataError(w, r, err, studentID) {
+		return
+	}
+
+	name := "student-" + strconv.Itoa(studentID) + "-" + export.ExportedAt.Format("20060102-150405") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	// Архив с персональными данными не должен оседать в кешах
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := writeStudentArchive(w, export); err != nil {
+		slog.Error("failed to write student archive", "error", err, "student_id", studentID)
+		return
+	}
+
+	slog.Info("student data exported", "student_id", studentID)
+	audit.Record(r, "student.export", "user", studentID, nil, map[string]int{
+		"classes":  len(export.Classes),
+		"attempts": len(export.Attempts),
+		"progress": len(export.Progress),
+		"sessions": len(export.Sessions),
+	})
+}
+
+// eraseStudentData обезличивает ученика. В журнал попадают только счетчики:
+// запись об удалении не должна хранить удаленные данные.
+func eraseStudentData(w http.ResponseWriter, r *http.Request, repo repository.StudentData, audit *Auditor, studentID, erasedBy int) bool {
+	result, err := repo.Erase(r.Context(), studentID, erasedBy)
+	if !studentDataError(w, r, err, studentID) {
+		return false
+	}
+
+	slog.Info("student data erased", "student_id", studentID, "erased_by", erasedBy)
+	audit.Record(r, "student.erase", "user", studentID, nil, result)
+	return true
+}
+
+// studentDataError отвечает на ошибку выгрузки или удаления; true - ошибки не было
+func studentDataError(w http.ResponseWriter, r *http.Request, err error, studentID int) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		http.NotFound(w, r)
+	case errors.Is(err, repository.ErrNotStudent), errors.Is(err, repository.ErrAlreadyErased):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		middleware.ServerError(w, "Ошибка обработки данных ученика", err)
+		slog.Error("failed to process student data", "error", err, "student_id", studentID)
+	}
+	return false
+}
+
+// writeStudentArchive пишет zip: student.json со всей выгрузкой и по CSV на каждую таблицу
+func writeStudentArchive(w io.Writer, export *entity.StudentDataExport) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create("student.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(export); err != nil {
+		return err
+	}
+
+	u := export.User
+	tables := []struct {
+		name   string
+		header []string
+		rows   [][]string
+	}{
+		{"user.csv",
+			[]string{"id", "username", "full_name", "email", "role", "school_id", "school_name", "blocked", "blocked_reason",
+				"blocked_at", "pending", "has_picture_password", "created_at", "erased_at"},
+			[][]string{{strconv.Itoa(u.ID), u.Username, u.FullName, u.Email, u.Role, optionalID(u.SchoolID), u.SchoolName,
+				strconv.FormatBool(u.Blocked), u.BlockedReason, csvTime(u.BlockedAt), strconv.FormatBool(u.Pending),
+				strconv.FormatBool(u.HasPicturePassword), u.CreatedAt.Format(time.RFC3339), csvTime(u.ErasedAt)}},
+		},
+		{"class_memberships.csv", []string{"class_id", "class_name", "grade", "school_name", "joined_at"}, nil},
+		{"attempts.csv", []string{"id", "equation_type_id", "equation_text", "correct_answer", "user_answer", "is_correct", "created_at"}, nil},
+		{"user_progress.csv", []string{"equation_type_id", "equation_type_name", "attempts_count", "correct_count", "is_unlocked",
+			"first_unlocked_at", "last_attempt_at", "created_at", "updated_at"}, nil},
+		{"sessions.csv", []string{"id", "user_agent", "ip_address", "created_at", "last_seen_at", "expires_at"}, nil},
+		{"audit_log.csv", []string{"id", "action", "before_state", "after_state", "created_at"}, nil},
+	}
+	for _, c := range export.Classes {
+		tables[1].rows = append(tables[1].rows, []string{
+			strconv.Itoa(c.ClassID), c.ClassName, strconv.Itoa(c.Grade), c.SchoolName, c.JoinedAt.Format(time.RFC3339),
+		})
+	}
+	for _, a := range export.Attempts {
+		tables[2].rows = append(tables[2].rows, []string{
+			strconv.Itoa(a.ID), strconv.Itoa(a.EquationTypeID), a.EquationText, a.CorrectAnswer, a.UserAnswer,
+			strconv.FormatBool(a.IsCorrect), a.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	for _, p := range export.Progress {
+		tables[3].rows = append(tables[3].rows, []string{
+			strconv.Itoa(p.EquationTypeID), p.EquationTypeName, strconv.Itoa(p.AttemptsCount), strconv.Itoa(p.CorrectCount),
+			strconv.FormatBool(p.IsUnlocked), csvTime(p.FirstUnlockedAt), csvTime(p.LastAttemptAt),
+			p.CreatedAt.Format(time.RFC3339), p.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+	for _, s := range export.Sessions {
+		tables[4].rows = append(tables[4].rows, []string{
+			strconv.Itoa(s.ID), s.UserAgent, s.IPAddress,
+			s.CreatedAt.Format(time.RFC3339), s.LastSeenAt.Format(time.RFC3339), s.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+
+	for _, a := range export.Audit {
+		tables[5].rows = append(tables[5].rows, []string{
+			strconv.FormatInt(a.ID, 10), a.Action, a.Before, a.After, a.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	for _, t := range tables {
+		f, err := zw.Create(t.name)
+		if err != nil {
+			return err
+		}
+		// BOM, чтобы Excel распознал UTF-8
+		if _, err := f.Write([]byte("\xEF\xBB\xBF")); err != nil {
+			return err
+		}
+		cw := csv.NewWriter(f)
+		cw.Write(t.header)
+		cw.WriteAll(t.rows)
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
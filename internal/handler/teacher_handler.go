@@ -2,23 +2,35 @@
 package handler
 
 import (
+	"edugame/internal"
+	"edugame/internal/entity"
+	middleware "edugame/internal/midlleware"
 	"edugame/internal/repository"
+	"errors"
 	"html/template"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/sessions"
 )
 
 type TeacherHandlers struct {
-	teacherRepo *repository.TeacherRepository
+	teacherRepo repository.Teachers
+	userRepo    repository.Users
+	schoolRepo  repository.Schools
+	resetRepo   repository.PasswordResets
+	guardRepo   repository.Guardians
+	dataRepo    repository.StudentData
+	audit       *Auditor
 	tmpl        *template.Template
 	store       *sessions.CookieStore
 }
 
-func NewTeacherHandlers(teacherRepo *repository.TeacherRepository, store *sessions.CookieStore) *TeacherHandlers {
+func NewTeacherHandlers(teacherRepo repository.Teachers, userRepo repository.Users, schoolRepo repository.Schools, resetRepo repository.PasswordResets, guardRepo repository.Guardians, dataRepo repository.StudentData, auditRepo repository.AuditLog, store *sessions.CookieStore) *TeacherHandlers {
 	tmpl := template.Must(template.ParseFiles(
 		"internal/templates/class_statisctics.html",
 		"internal/templates/student_statisctics.html",
@@ -26,53 +38,65 @@ func NewTeacherHandlers(teacherRepo *repository.TeacherRepository, store *sessio
 		"internal/templates/student_attempts.html",
 		"internal/templates/director_student.html",
 		"internal/templates/director_student_attempts.html",
-		"internal/templates/director_class.html"))
+		"internal/templates/director_class.html",
+		"internal/templates/reset_code.html",
+		"internal/templates/reset_codes.html",
+		"internal/templates/guardian_code.html",
+		"internal/templates/teacher_home.html"))
 
 	return &TeacherHandlers{
 		teacherRepo: teacherRepo,
+		userRepo:    userRepo,
+		schoolRepo:  schoolRepo,
+		resetRepo:   resetRepo,
+		guardRepo:   guardRepo,
+		dataRepo:    dataRepo,
+		audit:       NewAuditor(auditRepo, store),
 		tmpl:        tmpl,
 		store:       store,
 	}
 }
 
-func (h *TeacherHandlers) TeacherOnly(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		session, err := h.store.Get(r, "app-session")
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		role, ok := session.Values["role"].(string)
-		if !ok || role != "teacher" {
-			http.Error(w, "Доступ запрещен", http.StatusForbidden)
-			return
-		}
-
-		next(w, r)
+func (h *TeacherHandlers) DirectorHome(w http.ResponseWriter, r *http.Request) {
+	scope, schoolID, ok := h.directorScope(w, r)
+	if !ok {
+		return
 	}
-}
 
-func (h *TeacherHandlers) DirectorHome(w http.ResponseWriter, r *http.Request) {
-	log.Println("!")
-	classes, err := h.teacherRepo.GetAllClasses()
+	classes, err := scope.GetAllClasses(r.Context())
 	if err != nil {
-		http.Error(w, "Ошибка получения классов", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения классов", err)
 		log.Printf("Ошибка GetAllClasses: %v\n", err)
 		return
 	}
 
-	stats, err := h.teacherRepo.GetClassesStatistics()
+	stats, err := scope.GetClassesStatistics(r.Context())
 	if err != nil {
-		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения статистики", err)
 		log.Printf("Ошибка GetClassesStatistics: %v\n", err)
 		return
 	}
 
 	data := map[string]interface{}{
+		"CSRFToken":  middleware.CSRFToken(r),
 		"Title":      "Панель директора",
 		"Classes":    classes,
 		"ClassStats": nil, // по умолчанию nil
+		"SchoolID":   0,
+		"Schools":    nil,
+	}
+
+	if schoolID != nil {
+		data["SchoolID"] = *schoolID
+	}
+
+	// Пользователь уровня района выбирает школу из списка
+	if middleware.HasPermission(r, entity.PermDistrictStatsView) {
+		schools, err := h.schoolRepo.GetAll(r.Context())
+		if err != nil {
+			log.Printf("Ошибка получения школ: %v\n", err)
+		}
+		data["Schools"] = schools
 	}
 
 	if overallStats, exists := stats[0]; exists {
@@ -97,7 +121,7 @@ func (h *TeacherHandlers) DirectorHome(w http.ResponseWriter, r *http.Request) {
 	err = h.tmpl.ExecuteTemplate(w, "director_overall_stats.html", data)
 	if err != nil {
 		log.Printf("Ошибка рендеринга шаблона: %v\n", err)
-		http.Error(w, "Ошибка отображения страницы", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка отображения страницы", err)
 		return
 	}
 }
@@ -111,18 +135,33 @@ func (h *TeacherHandlers) DirectorClassStats(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	scope, _, ok := h.directorScope(w, r)
+	if !ok {
+		return
+	}
+
+	if err := scope.CheckClass(r.Context(), classID); err != nil {
+		if errors.Is(err, repository.ErrNotInScope) {
+			http.NotFound(w, r)
+			return
+		}
+		middleware.ServerError(w, "Ошибка проверки класса", err)
+		log.Printf("Ошибка CheckClass: %v\n", err)
+		return
+	}
+
 	log.Printf("Запрос статистики класса ID: %d\n", classID)
 
-	stats, err := h.teacherRepo.GetClassStatistics(classID)
+	stats, err := h.teacherRepo.GetClassStatistics(r.Context(), classID)
 	if err != nil {
-		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения статистики", err)
 		log.Printf("Ошибка GetClassStatistics: %v\n", err)
 		return
 	}
 
-	students, err := h.teacherRepo.GetClassStudents(classID)
+	students, err := h.teacherRepo.GetClassStudents(r.Context(), classID)
 	if err != nil {
-		http.Error(w, "Ошибка получения учеников", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения учеников", err)
 		log.Printf("Ошибка GetClassStudents: %v\n", err)
 		return
 	}
@@ -131,56 +170,101 @@ func (h *TeacherHandlers) DirectorClassStats(w http.ResponseWriter, r *http.Requ
 	log.Printf("Учеников в классе: %d\n", len(students))
 
 	data := map[string]interface{}{
-		"Title":    "Статистика класса",
-		"ClassID":  classID,
-		"Stats":    stats,
-		"Students": students,
+		"CSRFToken": middleware.CSRFToken(r),
+		"Title":     "Статистика класса",
+		"ClassID":   classID,
+		"Stats":     stats,
+		"Students":  students,
 	}
 
 	err = h.tmpl.ExecuteTemplate(w, "director_class.html", data)
 	if err != nil {
 		log.Printf("Ошибка рендеринга шаблона: %v\n", err)
-		http.Error(w, "Ошибка отображения страницы", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка отображения страницы", err)
 	}
 }
 
-func (h *TeacherHandlers) ClassStatistics(w http.ResponseWriter, r *http.Request) {
-	session, _ := h.store.Get(r, "app-session")
-	teacherID, ok := session.Values["user_id"].(int)
+// TeacherHome - список всех классов учителя с краткой статистикой
+func (h *TeacherHandlers) TeacherHome(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.teacherScope(w, r)
 	if !ok {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	class, err := h.teacherRepo.GetTeacherClass(teacherID)
+	summaries, err := scope.GetClassSummaries(r.Context())
 	if err != nil {
-		http.Error(w, "Ошибка получения класса", http.StatusInternalServerError)
-		slog.Error("failed to get teacher's class", "error", err, "teacher_id", teacherID)
+		middleware.ServerError(w, "Ошибка получения классов", err)
+		slog.Error("failed to get teacher's classes", "error", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"CSRFToken": middleware.CSRFToken(r),
+		"Classes":   summaries,
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "teacher_home.html", data); err != nil {
+		log.Println(err)
+	}
+}
+
+func (h *TeacherHandlers) ClassStatistics(w http.ResponseWriter, r *http.Request) {
+	teacherID, class, ok := selectTeacherClass(w, r, h.store, h.teacherRepo)
+	if !ok {
 		return
 	}
 
-	stats, err := h.teacherRepo.GetClassStatistics(class.ID)
+	classes, err := h.teacherRepo.ForTeacher(teacherID).GetClasses(r.Context())
 	if err != nil {
-		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		log.Printf("Ошибка получения классов учителя: %v", err)
+	}
+
+	stats, err := h.teacherRepo.GetClassStatistics(r.Context(), class.ID)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения статистики", err)
 		log.Println(err)
 		return
 	}
 
-	students, err := h.teacherRepo.GetClassStudents(class.ID)
+	students, err := h.teacherRepo.GetClassStudents(r.Context(), class.ID)
 	if err != nil {
-		http.Error(w, "Ошибка получения учеников", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения учеников", err)
 		log.Println(err)
 		return
 	}
 
-	dailyResults, err := h.teacherRepo.GetDailyClassResults(class.ID, 0)
+	dailyResults, err := h.teacherRepo.GetDailyClassResults(r.Context(), class.ID, 0)
 	if err != nil {
-		log.Printf("Ошибка получения статистики недели:", err)
+		log.Printf("Ошибка получения статистики недели: %v", err)
 		return
 	}
 
+	loginCode, err := h.teacherRepo.GetClassLoginCode(r.Context(), class.ID)
+	if err != nil {
+		log.Printf("Ошибка получения кода класса: %v", err)
+	}
+
+	joinCode, err := h.teacherRepo.GetClassJoinCode(r.Context(), class.ID)
+	if err != nil {
+		log.Printf("Ошибка получения кода регистрации: %v", err)
+	}
+
+	pending, err := h.teacherRepo.GetPendingStudents(r.Context(), class.ID)
+	if err != nil {
+		log.Printf("Ошибка получения заявок: %v", err)
+	}
+
 	data := map[string]interface{}{
+		"CSRFToken":    middleware.CSRFToken(r),
 		"ClassID":      class.ID,
+		"ClassName":    class.Name,
+		"StaffRole":    entity.StaffRoleTitle(class.StaffRole),
+		"CanManage":    class.CanManageStudents(),
+		"IsLead":       class.IsLead(),
+		"Classes":      classes,
+		"LoginCode":    loginCode,
+		"JoinCode":     joinCode,
+		"Pending":      pending,
 		"Stats":        stats,
 		"Students":     students,
 		"DailyResults": dailyResults,
@@ -192,7 +276,509 @@ func (h *TeacherHandlers) ClassStatistics(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// UnlockStudent снимает временную блокировку входа с ученика своего класса
+func (h *TeacherHandlers) UnlockStudent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teacherID, class, ok := selectTeacherClass(w, r, h.store, h.teacherRepo)
+	if !ok || !requireClassManage(w, class) {
+		return
+	}
+
+	studentID, err := strconv.Atoi(r.FormValue("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	unlocked, err := h.teacherRepo.UnlockStudent(r.Context(), class.ID, studentID)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка разблокировки ученика", err)
+		slog.Error("failed to unlock student", "error", err, "student_id", studentID)
+		return
+	}
+	if !unlocked {
+		http.NotFound(w, r)
+		return
+	}
+
+	slog.Info("student unlocked", "teacher_id", teacherID, "student_id", studentID)
+	h.audit.Record(r, "student.unlock", "user", studentID, nil, nil)
+	http.Redirect(w, r, classURL(class.ID), http.StatusSeeOther)
+}
+
+// SetStudentBlocked блокирует (decision=block, с причиной) или разблокирует ученика своего класса
+func (h *TeacherHandlers) SetStudentBlocked(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, _ := h.store.Get(r, "app-session")
+	teacherID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	studentID, err := strconv.Atoi(r.FormValue("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkStudent(w, r, teacherID, studentID) {
+		return
+	}
+
+	var after interface{}
+	switch r.FormValue("decision") {
+	case "block":
+		reason := strings.TrimSpace(r.FormValue("reason"))
+		if reason == "" || len([]rune(reason)) > 500 {
+			http.Error(w, "Укажите причину блокировки (до 500 символов)", http.StatusBadRequest)
+			return
+		}
+		err = h.userRepo.Block(r.Context(), studentID, reason, teacherID)
+		after = map[string]string{"blocked_reason": reason}
+	case "unblock":
+		err = h.userRepo.Unblock(r.Context(), studentID)
+	default:
+		http.Error(w, "Некорректное действие", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		middleware.ServerError(w, "Ошибка изменения блокировки", err)
+		slog.Error("failed to change student block", "error", err, "student_id", studentID)
+		return
+	}
+
+	slog.Info("student block changed", "teacher_id", teacherID, "student_id", studentID, "decision", r.FormValue("decision"))
+	h.audit.Record(r, "student."+r.FormValue("decision"), "user", studentID, nil, after)
+	http.Redirect(w, r, classBackURL(r), http.StatusSeeOther)
+}
+
+// teacherScope - доступ к данным только учеников классов вошедшего учителя
+func (h *TeacherHandlers) teacherScope(w http.ResponseWriter, r *http.Request) (repository.TeacherScope, bool) {
+	session, _ := h.store.Get(r, "app-session")
+	teacherID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return nil, false
+	}
+
+	return h.teacherRepo.ForTeacher(teacherID), true
+}
+
+// selectTeacherClass возвращает класс учителя из параметра class_id. Без параметра берется
+// единственный класс учителя, а при нескольких классах GET уводит на список классов.
+// Чужой класс - 404.
+func selectTeacherClass(w http.ResponseWriter, r *http.Request, store *sessions.CookieStore, teacherRepo repository.Teachers) (int, *entity.Class, bool) {
+	session, _ := store.Get(r, "app-session")
+	teacherID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, nil, false
+	}
+
+	scope := teacherRepo.ForTeacher(teacherID)
+
+	if value := r.FormValue("class_id"); value != "" {
+		classID, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Некорректный ID класса", http.StatusBadRequest)
+			return 0, nil, false
+		}
+
+		class, err := scope.GetClass(r.Context(), classID)
+		if errors.Is(err, repository.ErrNotInScope) {
+			http.NotFound(w, r)
+			return 0, nil, false
+		}
+		if err != nil {
+			middleware.ServerError(w, "Ошибка получения класса", err)
+			slog.Error("failed to get teacher's class", "error", err, "teacher_id", teacherID, "class_id", classID)
+			return 0, nil, false
+		}
+
+		return teacherID, class, true
+	}
+
+	classes, err := scope.GetClasses(r.Context())
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения класса", err)
+		slog.Error("failed to get teacher's classes", "error", err, "teacher_id", teacherID)
+		return 0, nil, false
+	}
+
+	if len(classes) == 1 {
+		return teacherID, classes[0], true
+	}
+
+	if r.Method == http.MethodGet {
+		http.Redirect(w, r, "/teacher", http.StatusSeeOther)
+	} else {
+		http.Error(w, "Не выбран класс", http.StatusBadRequest)
+	}
+	return 0, nil, false
+}
+
+// classURL - страница класса учителя
+func classURL(classID int) string {
+	return "/teacher/class?class_id=" + strconv.Itoa(classID)
+}
+
+// classBackURL - возврат на страницу класса, с которой пришла форма
+func classBackURL(r *http.Request) string {
+	if classID, err := strconv.Atoi(r.FormValue("class_id")); err == nil {
+		return classURL(classID)
+	}
+	return "/teacher/class"
+}
+
+// directorScope - доступ директора к своей школе. Пользователь с правом district.stats.view
+// видит все школы или школу из параметра school_id. Возвращает также выбранную школу.
+func (h *TeacherHandlers) directorScope(w http.ResponseWriter, r *http.Request) (repository.SchoolScope, *int, bool) {
+	session, _ := h.store.Get(r, "app-session")
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return nil, nil, false
+	}
+
+	if middleware.HasPermission(r, entity.PermDistrictStatsView) {
+		if schoolID, err := strconv.Atoi(r.URL.Query().Get("school_id")); err == nil && schoolID > 0 {
+			return h.teacherRepo.ForSchool(&schoolID), &schoolID, true
+		}
+		return h.teacherRepo.ForSchool(nil), nil, true
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения пользователя", err)
+		slog.Error("failed to get director", "error", err, "user_id", userID)
+		return nil, nil, false
+	}
+
+	if user.SchoolID == nil {
+		http.Error(w, "Учетная запись не привязана к школе. Обратитесь к администратору", http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	return h.teacherRepo.ForSchool(user.SchoolID), user.SchoolID, true
+}
+
+// requireClassManage отвечает 403, если наблюдатель пытается работать с учениками класса
+func requireClassManage(w http.ResponseWriter, class *entity.Class) bool {
+	if !class.CanManageStudents() {
+		http.Error(w, "Недостаточно прав в этом классе", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requireClassLead отвечает 403, если действие доступно только ведущему учителю класса
+func requireClassLead(w http.ResponseWriter, class *entity.Class) bool {
+	if !class.IsLead() {
+		http.Error(w, "Недостаточно прав в этом классе", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checkStudent отвечает 404, если ученик не из класса, где учитель может с ним работать
+// (наблюдателю ученики доступны только на чтение)
+func (h *TeacherHandlers) checkStudent(w http.ResponseWriter, r *http.Request, teacherID, studentID int) bool {
+	err := h.teacherRepo.ForTeacher(teacherID).CheckStudentManage(r.Context(), studentID)
+	if errors.Is(err, repository.ErrNotInScope) {
+		http.NotFound(w, r)
+		return false
+	}
+	if err != nil {
+		middleware.ServerError(w, "Ошибка проверки ученика", err)
+		slog.Error("failed to check student class", "error", err, "student_id", studentID)
+		return false
+	}
+
+	return true
+}
+
+// ReviewStudent подтверждает или отклоняет заявку ученика в класс учителя
+func (h *TeacherHandlers) ReviewStudent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teacherID, class, ok := selectTeacherClass(w, r, h.store, h.teacherRepo)
+	if !ok || !requireClassManage(w, class) {
+		return
+	}
+
+	studentID, err := strconv.Atoi(r.FormValue("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	var done bool
+	switch decision := r.FormValue("decision"); decision {
+	case "approve":
+		done, err = h.teacherRepo.ApproveStudent(r.Context(), class.ID, studentID)
+	case "reject":
+		done, err = h.teacherRepo.RejectStudent(r.Context(), class.ID, studentID)
+	default:
+		http.Error(w, "Некорректное решение", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		middleware.ServerError(w, "Ошибка обработки заявки", err)
+		slog.Error("failed to review student", "error", err, "student_id", studentID)
+		return
+	}
+	if !done {
+		http.NotFound(w, r)
+		return
+	}
+
+	slog.Info("student request reviewed", "teacher_id", teacherID, "student_id", studentID, "decision", r.FormValue("decision"))
+	h.audit.Record(r, "student."+r.FormValue("decision"), "user", studentID, nil, map[string]int{"class_id": class.ID})
+	http.Redirect(w, r, classURL(class.ID), http.StatusSeeOther)
+}
+
+// RotateJoinCode выдает классу учителя новый код регистрации
+func (h *TeacherHandlers) RotateJoinCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, class, ok := selectTeacherClass(w, r, h.store, h.teacherRepo)
+	if !ok || !requireClassLead(w, class) {
+		return
+	}
+
+	if _, err := h.teacherRepo.RotateClassJoinCode(r.Context(), class.ID); err != nil {
+		middleware.ServerError(w, "Ошибка смены кода класса", err)
+		slog.Error("failed to rotate join code", "error", err, "class_id", class.ID)
+		return
+	}
+
+	h.audit.Record(r, "class.join_code", "class", class.ID, nil, nil)
+
+	http.Redirect(w, r, classURL(class.ID), http.StatusSeeOther)
+}
+
+// IssueResetCode выдает ученику своего класса одноразовый код сброса пароля
+// и показывает листок с кодом для печати
+func (h *TeacherHandlers) IssueResetCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, _ := h.store.Get(r, "app-session")
+	teacherID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	studentID, err := strconv.Atoi(r.FormValue("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkStudent(w, r, teacherID, studentID) {
+		return
+	}
+
+	code, resetCode, err := h.resetRepo.Issue(r.Context(), studentID, teacherID, internal.PasswordResetCodeTTL)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка выдачи кода", err)
+		slog.Error("failed to issue reset code", "error", err, "student_id", studentID)
+		return
+	}
+
+	slog.Info("password reset code issued", "teacher_id", teacherID, "student_id", studentID, "code_id", resetCode.ID)
+	h.audit.Record(r, "student.reset_code", "user", studentID, nil, map[string]interface{}{
+		"code_id":    resetCode.ID,
+		"expires_at": resetCode.ExpiresAt,
+	})
+
+	studentStats, _ := h.teacherRepo.GetStudentStatistics(r.Context(), studentID)
+
+	resetURL := middleware.BaseURL(r) + "/reset?code=" + url.QueryEscape(code)
+
+	data := map[string]interface{}{
+		"CSRFToken":   middleware.CSRFToken(r),
+		"StudentInfo": studentStats["student_info"],
+		"Code":        repository.FormatResetCode(code),
+		"ResetURL":    resetURL,
+		"ExpiresAt":   resetCode.ExpiresAt,
+		"BackURL":     classBackURL(r),
+	}
+
+	// Страницу с кодом нельзя кешировать: код показывается один раз
+	w.Header().Set("Cache-Control", "no-store")
+	if err := h.tmpl.ExecuteTemplate(w, "reset_code.html", data); err != nil {
+		slog.Error("failed to render reset code page", "error", err, "student_id", studentID)
+	}
+}
+
+// IssueGuardianCode выдает для ученика своего класса код привязки родителя
+// и показывает листок с кодом, который ученик отнесет домой
+func (h *TeacherHandlers) IssueGuardianCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, _ := h.store.Get(r, "app-session")
+	teacherID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	studentID, err := strconv.Atoi(r.FormValue("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkStudent(w, r, teacherID, studentID) {
+		return
+	}
+
+	code, guardianCode, err := h.guardRepo.IssueCode(r.Context(), studentID, teacherID, internal.GuardianCodeTTL)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка выдачи кода", err)
+		slog.Error("failed to issue guardian code", "error", err, "student_id", studentID)
+		return
+	}
+
+	slog.Info("guardian code issued", "teacher_id", teacherID, "student_id", studentID, "code_id", guardianCode.ID)
+	h.audit.Record(r, "student.guardian_code", "user", studentID, nil, map[string]interface{}{
+		"code_id":    guardianCode.ID,
+		"expires_at": guardianCode.ExpiresAt,
+	})
+
+	studentStats, _ := h.teacherRepo.GetStudentStatistics(r.Context(), studentID)
+
+	joinURL := middleware.BaseURL(r) + "/guardian?code=" + url.QueryEscape(code)
+
+	data := map[string]interface{}{
+		"CSRFToken":   middleware.CSRFToken(r),
+		"StudentInfo": studentStats["student_info"],
+		"Code":        repository.FormatResetCode(code),
+		"JoinURL":     joinURL,
+		"ExpiresAt":   guardianCode.ExpiresAt,
+		"BackURL":     classBackURL(r),
+	}
+
+	// Страницу с кодом нельзя кешировать: код показывается один раз
+	w.Header().Set("Cache-Control", "no-store")
+	if err := h.tmpl.ExecuteTemplate(w, "guardian_code.html", data); err != nil {
+		slog.Error("failed to render guardian code page", "error", err, "student_id", studentID)
+	}
+}
+
+// ExportStudentData выгружает архив со всеми данными ученика своего класса - для ответа на запрос родителей
+func (h *TeacherHandlers) ExportStudentData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, _ := h.store.Get(r, "app-session")
+	teacherID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	studentID, err := strconv.Atoi(r.FormValue("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkStudent(w, r, teacherID, studentID) {
+		return
+	}
+
+	exportStudentData(w, r, h.dataRepo, h.audit, studentID)
+}
+
+// EraseStudentData обезличивает ученика своего класса по запросу родителей.
+// Ученик остается в классе под обезличенным именем, чтобы не менялась статистика класса.
+func (h *TeacherHandlers) EraseStudentData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, _ := h.store.Get(r, "app-session")
+	teacherID, ok := session.Values["user_id"].(int)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	studentID, err := strconv.Atoi(r.FormValue("student_id"))
+	if err != nil {
+		http.Error(w, "Некорректный ID ученика", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkStudent(w, r, teacherID, studentID) {
+		return
+	}
+
+	if !eraseStudentData(w, r, h.dataRepo, h.audit, studentID, teacherID) {
+		return
+	}
+	http.Redirect(w, r, classBackURL(r), http.StatusSeeOther)
+}
+
+// ResetCodes - журнал выданных кодов сброса пароля по классу учителя
+func (h *TeacherHandlers) ResetCodes(w http.ResponseWriter, r *http.Request) {
+	_, class, ok := selectTeacherClass(w, r, h.store, h.teacherRepo)
+	if !ok || !requireClassManage(w, class) {
+		return
+	}
+
+	codes, err := h.resetRepo.GetClassResetCodes(r.Context(), class.ID, 200)
+	if err != nil {
+		middleware.ServerError(w, "Ошибка получения журнала", err)
+		slog.Error("failed to get reset codes", "error", err, "class_id", class.ID)
+		return
+	}
+
+	data := map[string]interface{}{
+		"CSRFToken": middleware.CSRFToken(r),
+		"ClassID":   class.ID,
+		"ClassName": class.Name,
+		"Codes":     codes,
+	}
+
+	if err := h.tmpl.ExecuteTemplate(w, "reset_codes.html", data); err != nil {
+		slog.Error("failed to render reset codes", "error", err, "class_id", class.ID)
+	}
+}
+
 func (h *TeacherHandlers) StudentStatistics(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.teacherScope(w, r)
+	if !ok {
+		return
+	}
+
 	studentIDStr := r.URL.Query().Get("student_id")
 	studentID, err := strconv.Atoi(studentIDStr)
 	if err != nil {
@@ -201,17 +787,27 @@ func (h *TeacherHandlers) StudentStatistics(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	stats, err := h.teacherRepo.GetStudentStatistics(studentID)
+	stats, err := scope.GetStudentStatistics(r.Context(), studentID)
+	if errors.Is(err, repository.ErrNotInScope) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения статистики", err)
 		return
 	}
 
+	stats["CSRFToken"] = middleware.CSRFToken(r)
 	h.tmpl.ExecuteTemplate(w, "student_statisctics.html", stats)
 }
 
 func (h *TeacherHandlers) StudentAttemptsByType(w http.ResponseWriter, r *http.Request) {
+	scope, ok := h.teacherScope(w, r)
+	if !ok {
+		return
+	}
+
 	studentIDStr := r.URL.Query().Get("student_id")
 	typeIDStr := r.URL.Query().Get("type_id")
 
@@ -232,18 +828,23 @@ func (h *TeacherHandlers) StudentAttemptsByType(w http.ResponseWriter, r *http.R
 	}
 	log.Println(typeID)
 
-	attempts, err := h.teacherRepo.GetStudentAttemptsByType(studentID, typeID)
+	attempts, err := scope.GetStudentAttemptsByType(r.Context(), studentID, typeID)
+	if errors.Is(err, repository.ErrNotInScope) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Ошибка получения попыток", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения попыток", err)
 		log.Println(err)
 		return
 	}
 	log.Println(attempts)
 
-	studentStats, _ := h.teacherRepo.GetStudentStatistics(studentID)
+	studentStats, _ := h.teacherRepo.GetStudentStatistics(r.Context(), studentID)
 	log.Println(studentStats)
 
 	data := map[string]interface{}{
+		"CSRFToken":   middleware.CSRFToken(r),
 		"StudentInfo": studentStats["student_info"],
 		"Attempts":    attempts,
 		"TypeID":      typeID,
@@ -256,6 +857,11 @@ func (h *TeacherHandlers) StudentAttemptsByType(w http.ResponseWriter, r *http.R
 }
 
 func (h *TeacherHandlers) DirectorStudentStatistics(w http.ResponseWriter, r *http.Request) {
+	scope, _, ok := h.directorScope(w, r)
+	if !ok {
+		return
+	}
+
 	studentIDStr := r.URL.Query().Get("student_id")
 	studentID, err := strconv.Atoi(studentIDStr)
 	if err != nil {
@@ -264,17 +870,27 @@ func (h *TeacherHandlers) DirectorStudentStatistics(w http.ResponseWriter, r *ht
 		return
 	}
 
-	stats, err := h.teacherRepo.GetStudentStatistics(studentID)
+	stats, err := scope.GetStudentStatistics(r.Context(), studentID)
+	if errors.Is(err, repository.ErrNotInScope) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Ошибка получения статистики", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения статистики", err)
 		return
 	}
 
+	stats["CSRFToken"] = middleware.CSRFToken(r)
 	h.tmpl.ExecuteTemplate(w, "director_student.html", stats)
 }
 
 func (h *TeacherHandlers) DirectorStudentAttemptsByType(w http.ResponseWriter, r *http.Request) {
+	scope, _, ok := h.directorScope(w, r)
+	if !ok {
+		return
+	}
+
 	studentIDStr := r.URL.Query().Get("student_id")
 	typeIDStr := r.URL.Query().Get("type_id")
 
@@ -295,18 +911,23 @@ func (h *TeacherHandlers) DirectorStudentAttemptsByType(w http.ResponseWriter, r
 	}
 	log.Println(typeID)
 
-	attempts, err := h.teacherRepo.GetStudentAttemptsByType(studentID, typeID)
+	attempts, err := scope.GetStudentAttemptsByType(r.Context(), studentID, typeID)
+	if errors.Is(err, repository.ErrNotInScope) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Ошибка получения попыток", http.StatusInternalServerError)
+		middleware.ServerError(w, "Ошибка получения попыток", err)
 		log.Println(err)
 		return
 	}
 	log.Println(attempts)
 
-	studentStats, _ := h.teacherRepo.GetStudentStatistics(studentID)
+	studentStats, _ := h.teacherRepo.GetStudentStatistics(r.Context(), studentID)
 	log.Println(studentStats)
 
 	data := map[string]interface{}{
+		"CSRFToken":   middleware.CSRFToken(r),
 		"StudentInfo": studentStats["student_info"],
 		"Attempts":    attempts,
 		"TypeID":      typeID,
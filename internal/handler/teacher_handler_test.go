@@ -0,0 +1,453 @@
+package handler
+
+import (
+	"database/sql"
+	"edugame/internal/entity"
+	"edugame/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	testTeacherID      = 7
+	testForeignStudent = 42
+	testOwnStudent     = 15
+)
+
+func TestMain(m *testing.M) {
+	// Шаблоны подключаются по путям от корня репозитория
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type teacherTestEnv struct {
+	db       *sql.DB
+	mock     sqlmock.Sqlmock
+	store    *sessions.CookieStore
+	teacher  *TeacherHandlers
+	pictures *PictureLoginHandler
+	parent   *ParentHandler
+}
+
+func newTeacherTestEnv(t *testing.T) *teacherTestEnv {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store := sessions.NewCookieStore([]byte("test-secret-key-32-bytes-long!!!"))
+	teacherRepo := repository.NewTeacherRepository(db, repository.QueryTimeouts{})
+	userRepo := repository.NewUserRepository(db, repository.QueryTimeouts{})
+	sessionRepo := repository.NewSessionRepository(db, repository.QueryTimeouts{})
+	throttleRepo := repository.NewLoginThrottleRepository(db, repository.QueryTimeouts{})
+	auditRepo := repository.NewAuditRepository(db, repository.QueryTimeouts{})
+	guardianRepo := repository.NewGuardianRepository(db, repository.QueryTimeouts{})
+
+	return &teacherTestEnv{
+		db:    db,
+		mock:  mock,
+		store: store,
+		teacher: NewTeacherHandlers(teacherRepo, userRepo, repository.NewSchoolRepository(db, repository.QueryTimeouts{}),
+			repository.NewPasswordResetRepository(db, repository.QueryTimeouts{}), guardianRepo,
+			repository.NewStudentDataRepository(db, repository.QueryTimeouts{}), auditRepo, store),
+		pictures: NewPictureLoginHandler(userRepo, teacherRepo, sessionRepo, throttleRepo, auditRepo, store),
+		parent:   NewParentHandler(guardianRepo, teacherRepo, userRepo, sessionRepo, throttleRepo, auditRepo, store),
+	}
+}
+
+// request создает запрос от имени учителя testTeacherID
+func (env *teacherTestEnv) request(t *testing.T, method, target string, form url.Values) *http.Request {
+	t.Helper()
+	return env.requestAs(t, testTeacherID, "teacher", method, target, form)
+}
+
+// requestAs создает запрос с gorilla-сессией вошедшего пользователя
+func (env *teacherTestEnv) requestAs(t *testing.T, userID int, role, method, target string, form url.Values) *http.Request {
+	t.Helper()
+
+	var r *http.Request
+	if method == http.MethodPost {
+		r = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, target, nil)
+	}
+
+	rec := httptest.NewRecorder()
+	sess, _ := env.store.Get(r, "app-session")
+	sess.Values["user_id"] = userID
+	sess.Values["role"] = role
+	if err := sess.Save(r, rec); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+
+	return r
+}
+
+func (env *teacherTestEnv) expectScopeCheck(studentID int, allowed bool) {
+	env.mock.ExpectQuery(`SELECT EXISTS .*JOIN class_staff cs .*cs\.user_id = \$1`).
+		WithArgs(testTeacherID, studentID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(allowed))
+}
+
+func (env *teacherTestEnv) expectTeacherClass(classID int) {
+	env.expectTeacherClassRole(classID, entity.StaffRoleLead)
+}
+
+// expectTeacherClassRole - единственный класс учителя с заданной ролью в нем
+func (env *teacherTestEnv) expectTeacherClassRole(classID int, role string) {
+	env.mock.ExpectQuery(`FROM classes c\s+JOIN class_staff cs ON cs\.class_id = c\.id AND cs\.user_id = \$1`).
+		WithArgs(testTeacherID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "grade", "teacher_id", "school_id", "role"}).
+			AddRow(classID, "3А", 3, testTeacherID, 1, role))
+}
+
+// Каждый маршрут учителя с student_id чужого ученика должен отвечать 404
+// и не выполнять никаких запросов к данным ученика
+func TestTeacherRoutesHideForeignStudents(t *testing.T) {
+	foreign := url.Values{"student_id": {"42"}}
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		form    url.Values
+		expect  func(env *teacherTestEnv)
+		handler func(env *teacherTestEnv) http.HandlerFunc
+	}{
+		{
+			name:    "student statistics",
+			method:  http.MethodGet,
+			target:  "/teacher/student?student_id=42",
+			expect:  func(env *teacherTestEnv) { env.expectScopeCheck(testForeignStudent, false) },
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.StudentStatistics },
+		},
+		{
+			name:    "student attempts",
+			method:  http.MethodGet,
+			target:  "/teacher/student/attempts?student_id=42&type_id=1",
+			expect:  func(env *teacherTestEnv) { env.expectScopeCheck(testForeignStudent, false) },
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.StudentAttemptsByType },
+		},
+		{
+			name:    "reset code",
+			method:  http.MethodPost,
+			target:  "/teacher/student/reset-code",
+			form:    foreign,
+			expect:  func(env *teacherTestEnv) { env.expectScopeCheck(testForeignStudent, false) },
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.IssueResetCode },
+		},
+		{
+			name:    "guardian code",
+			method:  http.MethodPost,
+			target:  "/teacher/student/guardian-code",
+			form:    foreign,
+			expect:  func(env *teacherTestEnv) { env.expectScopeCheck(testForeignStudent, false) },
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.IssueGuardianCode },
+		},
+		{
+			name:    "block",
+			method:  http.MethodPost,
+			target:  "/teacher/student/block",
+			form:    url.Values{"student_id": {"42"}, "decision": {"block"}, "reason": {"test"}},
+			expect:  func(env *teacherTestEnv) { env.expectScopeCheck(testForeignStudent, false) },
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.SetStudentBlocked },
+		},
+		{
+			name:    "picture password",
+			method:  http.MethodGet,
+			target:  "/teacher/student/picture-password?student_id=42",
+			expect:  func(env *teacherTestEnv) { env.expectScopeCheck(testForeignStudent, false) },
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.pictures.PicturePasswordPage },
+		},
+		{
+			name:   "unlock",
+			method: http.MethodPost,
+			target: "/teacher/student/unlock",
+			form:   foreign,
+			expect: func(env *teacherTestEnv) {
+				env.expectTeacherClass(3)
+				env.mock.ExpectBegin()
+				env.mock.ExpectQuery(`UPDATE users`).WithArgs(testForeignStudent, 3).WillReturnError(sql.ErrNoRows)
+				env.mock.ExpectRollback()
+			},
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.UnlockStudent },
+		},
+		{
+			name:   "review",
+			method: http.MethodPost,
+			target: "/teacher/student/review",
+			form:   url.Values{"student_id": {"42"}, "decision": {"approve"}},
+			expect: func(env *teacherTestEnv) {
+				env.expectTeacherClass(3)
+				env.mock.ExpectExec(`UPDATE users SET pending = FALSE`).
+					WithArgs(testForeignStudent, 3).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.ReviewStudent },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTeacherTestEnv(t)
+			tt.expect(env)
+
+			rec := httptest.NewRecorder()
+			tt.handler(env)(rec, env.request(t, tt.method, tt.target, tt.form))
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+			}
+			if err := env.mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTeacherCanManageOwnStudent(t *testing.T) {
+	env := newTeacherTestEnv(t)
+	env.expectScopeCheck(testOwnStudent, true)
+	env.mock.ExpectExec(`UPDATE users SET blocked = FALSE`).
+		WithArgs(testOwnStudent).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	env.mock.ExpectExec(`INSERT INTO audit_log`).
+		WithArgs(testTeacherID, "", "student.unblock", "user", testOwnStudent, "", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	form := url.Values{"student_id": {"15"}, "decision": {"unblock"}}
+	rec := httptest.NewRecorder()
+	env.teacher.SetStudentBlocked(rec, env.request(t, http.MethodPost, "/teacher/student/block", form))
+
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	if err := env.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Чужой class_id дает 404, а без class_id учитель с несколькими классами попадает на их список
+func TestTeacherClassSelection(t *testing.T) {
+	t.Run("foreign class", func(t *testing.T) {
+		env := newTeacherTestEnv(t)
+		env.mock.ExpectQuery(`JOIN class_staff cs ON cs\.class_id = c\.id AND cs\.user_id = \$2\s+WHERE c\.id = \$1`).
+			WithArgs(99, testTeacherID).
+			WillReturnError(sql.ErrNoRows)
+
+		rec := httptest.NewRecorder()
+		env.teacher.ClassStatistics(rec, env.request(t, http.MethodGet, "/teacher/class?class_id=99", nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+		if err := env.mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("several classes", func(t *testing.T) {
+		env := newTeacherTestEnv(t)
+		env.mock.ExpectQuery(`FROM classes c\s+JOIN class_staff cs ON cs\.class_id = c\.id AND cs\.user_id = \$1`).
+			WithArgs(testTeacherID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "grade", "teacher_id", "school_id", "role"}).
+				AddRow(3, "3А", 3, testTeacherID, 1, entity.StaffRoleLead).
+				AddRow(4, "4Б", 4, 8, 1, entity.StaffRoleAssistant))
+
+		rec := httptest.NewRecorder()
+		env.teacher.ClassStatistics(rec, env.request(t, http.MethodGet, "/teacher/class", nil))
+
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/teacher" {
+			t.Errorf("status = %d, location = %q, want redirect to /teacher", rec.Code, rec.Header().Get("Location"))
+		}
+		if err := env.mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// Наблюдатель видит класс, но не может работать с учениками и менять коды класса
+func TestClassViewerIsReadOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		form    url.Values
+		handler func(env *teacherTestEnv) http.HandlerFunc
+	}{
+		{
+			name:    "unlock",
+			target:  "/teacher/student/unlock",
+			form:    url.Values{"student_id": {"15"}},
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.UnlockStudent },
+		},
+		{
+			name:    "join code",
+			target:  "/teacher/class/join-code",
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.RotateJoinCode },
+		},
+		{
+			name:    "login code",
+			target:  "/teacher/class/login-code",
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.pictures.RotateClassCode },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTeacherTestEnv(t)
+			env.expectTeacherClassRole(3, entity.StaffRoleViewer)
+
+			rec := httptest.NewRecorder()
+			tt.handler(env)(rec, env.request(t, http.MethodPost, tt.target, tt.form))
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+			}
+			if err := env.mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTeacherRoutesRequireSession(t *testing.T) {
+	env := newTeacherTestEnv(t)
+
+	rec := httptest.NewRecorder()
+	env.teacher.StudentStatistics(rec, httptest.NewRequest(http.MethodGet, "/teacher/student?student_id=15", nil))
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Errorf("status = %d, location = %q, want redirect to /login", rec.Code, rec.Header().Get("Location"))
+	}
+	if err := env.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+const (
+	testDirectorID    = 9
+	testDirectorClass = 5
+	testOtherSchool   = 2
+)
+
+// expectDirector - директор testDirectorID привязан к школе 1
+func (env *teacherTestEnv) expectDirector() {
+	env.mock.ExpectQuery(`FROM users WHERE id = \$1`).
+		WithArgs(testDirectorID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "username", "role_id", "fullname", "school_id", "created_at", "blocked", "blocked_reason", "blocked_at",
+		}).AddRow(testDirectorID, "director1", 4, "Директор", 1, time.Now(), false, nil, nil))
+	env.mock.ExpectQuery(`FROM roles WHERE id = \$1`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "created_at"}).
+			AddRow(4, "director", "Директор", time.Now()))
+}
+
+// Директор не видит классы и учеников чужой школы
+func TestDirectorRoutesHideOtherSchools(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		expect  func(env *teacherTestEnv)
+		handler func(env *teacherTestEnv) http.HandlerFunc
+	}{
+		{
+			name:   "class",
+			target: "/director/class?class_id=5",
+			expect: func(env *teacherTestEnv) {
+				env.mock.ExpectQuery(`SELECT EXISTS .*FROM classes WHERE id = \$1`).
+					WithArgs(testDirectorClass, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.DirectorClassStats },
+		},
+		{
+			name:   "student",
+			target: "/director/student?student_id=42",
+			expect: func(env *teacherTestEnv) {
+				env.mock.ExpectQuery(`SELECT EXISTS .*c\.school_id = \$2`).
+					WithArgs(testForeignStudent, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.DirectorStudentStatistics },
+		},
+		{
+			name:   "student attempts",
+			target: "/director/student/attempts?student_id=42&type_id=1",
+			expect: func(env *teacherTestEnv) {
+				env.mock.ExpectQuery(`SELECT EXISTS .*c\.school_id = \$2`).
+					WithArgs(testForeignStudent, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			handler: func(env *teacherTestEnv) http.HandlerFunc { return env.teacher.DirectorStudentAttemptsByType },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTeacherTestEnv(t)
+			env.expectDirector()
+			tt.expect(env)
+
+			rec := httptest.NewRecorder()
+			tt.handler(env)(rec, env.requestAs(t, testDirectorID, "director", http.MethodGet, tt.target, nil))
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+			}
+			if err := env.mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Недельная сетка класса читается из student_hourly_stats одним запросом на весь класс
+func TestDailyClassResultsUsesSingleRollupQuery(t *testing.T) {
+	env := newTeacherTestEnv(t)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	env.mock.ExpectQuery(`FROM users u\s+JOIN student_classes sc`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "fullname", "locked", "picture", "blocked", "reason", "blocked_at"}).
+			AddRow(testOwnStudent, "ivan", "Иванов Иван", false, false, false, "", nil).
+			AddRow(16, "petr", "Петров Петр", false, false, false, "", nil))
+	env.mock.ExpectQuery(`FROM student_hourly_stats`).
+		WillReturnRows(sqlmock.NewRows([]string{"student_id", "day", "hour", "attempts_count", "correct_count"}).
+			AddRow(testOwnStudent, today, 10, 10, 10).
+			AddRow(testOwnStudent, today, 11, 10, 7))
+
+	repo := repository.NewTeacherRepository(env.db, repository.QueryTimeouts{})
+	results, err := repo.GetDailyClassResults(t.Context(), 3, 0)
+	if err != nil {
+		t.Fatalf("GetDailyClassResults: %v", err)
+	}
+
+	if results.Stats.TotalSessions != 2 || results.Stats.PerfectSessions != 1 || results.Stats.TotalCorrect != 17 {
+		t.Errorf("stats = %+v, want 2 sessions, 1 perfect, 17 correct", results.Stats)
+	}
+	if len(results.Students) != 2 || !results.Students[0].IsActive || results.Students[1].IsActive {
+		t.Errorf("students = %+v, want only the first one active", results.Students)
+	}
+	if err := env.mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
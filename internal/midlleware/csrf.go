@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"edugame/internal/session"
+	"encoding/base64"
+	"log/slog"
+	"mime"
+	"net/http"
+)
+
+const (
+	CSRFFieldName  = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+type csrfContextKey struct{}
+
+// CSRF - middleware защиты от подделки межсайтовых запросов.
+// Токен хранится в gorilla-сессии "app-session" и передается в шаблоны через CSRFToken.
+// Формы присылают токен скрытым полем, JSON-запросы - заголовком X-CSRF-Token.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store := session.GetStore()
+		if store == nil {
+			http.Error(w, "Session store not initialized", http.StatusInternalServerError)
+			return
+		}
+
+		sess, _ := store.Get(r, "app-session")
+
+		token, ok := sess.Values[CSRFFieldName].(string)
+		if !ok || token == "" {
+			var err error
+			token, err = generateCSRFToken()
+			if err != nil {
+				http.Error(w, "Ошибка создания CSRF-токена", http.StatusInternalServerError)
+				return
+			}
+
+			sess.Values[CSRFFieldName] = token
+			if err := sess.Save(r, w); err != nil {
+				slog.Error("failed to save csrf token", "error", err)
+			}
+		}
+
+		if !isSafeMethod(r.Method) {
+			submitted := r.Header.Get(CSRFHeaderName)
+			if submitted == "" && !isJSONRequest(r) {
+				submitted = r.FormValue(CSRFFieldName)
+			}
+
+			if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+				slog.Warn("csrf token mismatch", "path", r.URL.Path, "method", r.Method)
+				http.Error(w, "Недействительный CSRF-токен", http.StatusForbidden)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), csrfContextKey{}, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CSRFToken возвращает CSRF-токен текущего запроса для подстановки в шаблон
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey{}).(string)
+	return token
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+func generateCSRFToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
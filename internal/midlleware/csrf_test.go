@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"edugame/internal/session"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// csrfClient получает токен и cookie сессии так же, как браузер при открытии формы
+func csrfClient(t *testing.T) (string, []*http.Cookie) {
+	t.Helper()
+
+	var token string
+	page := CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = CSRFToken(r)
+	}))
+	rec := httptest.NewRecorder()
+	page.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+	if token == "" || len(rec.Result().Cookies()) == 0 {
+		t.Fatalf("GET did not issue a token: %q, cookies %v", token, rec.Result().Cookies())
+	}
+	return token, rec.Result().Cookies()
+}
+
+func TestCSRF(t *testing.T) {
+	session.InitStore("test-secret-key-32-bytes-long!!!")
+
+	var called bool
+	h := CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	token, cookies := csrfClient(t)
+
+	form := func(target, submitted string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(url.Values{
+			"username":    {"petya"},
+			CSRFFieldName: {submitted},
+		}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	jsonRequest := func(header, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/check-item", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			r.Header.Set(CSRFHeaderName, header)
+		}
+		return r
+	}
+
+	cases := []struct {
+		name    string
+		request *http.Request
+		cookies bool
+		want    int
+	}{
+		{"safe method", httptest.NewRequest(http.MethodGet, "/teacher", nil), false, http.StatusOK},
+		{"public login", form("/auth/login", token), true, http.StatusOK},
+		{"public reset", form("/auth/reset", token), true, http.StatusOK},
+		{"login without session", form("/auth/login", token), false, http.StatusForbidden},
+		{"reset without token", form("/auth/reset", ""), true, http.StatusForbidden},
+		{"token mismatch", form("/auth/login", token+"x"), true, http.StatusForbidden},
+		{"json header", jsonRequest(token, `{"user_answer":"4"}`), true, http.StatusOK},
+		{"json without header", jsonRequest("", `{"user_answer":"4"}`), true, http.StatusForbidden},
+		{"json wrong header", jsonRequest("forged", `{"user_answer":"4"}`), true, http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			called = false
+			if tc.cookies {
+				for _, c := range cookies {
+					tc.request.AddCookie(c)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, tc.request)
+
+			if rec.Code != tc.want || called != (tc.want == http.StatusOK) {
+				t.Errorf("status %d, handler called %v, want %d", rec.Code, called, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"edugame/internal/repository"
+	"net/http"
+)
+
+// ServerError отвечает на ошибку при обработке запроса. Если запрос к БД не уложился
+// в отведенное время, клиент получает 503 и может повторить попытку, иначе - 500 с сообщением msg.
+func ServerError(w http.ResponseWriter, msg string, err error) {
+	if repository.IsTimeout(err) {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Сервер перегружен, попробуйте позже", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, msg, http.StatusInternalServerError)
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"edugame/internal/entity"
+	"edugame/internal/repository"
+	"edugame/internal/session"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type permissionsKey struct{}
+
+// LoadPermissions - middleware, загружающее права роли вошедшего пользователя в контекст запроса.
+// Права читаются из БД на каждый запрос, поэтому изменения роли в админке действуют сразу.
+// Должно стоять после ValidateSession, чтобы не загружать права по отозванной сессии.
+func LoadPermissions(permissionRepo repository.Permissions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			store := session.GetStore()
+			if store == nil {
+				http.Error(w, "Session store not initialized", http.StatusInternalServerError)
+				return
+			}
+
+			sess, _ := store.Get(r, "app-session")
+			userID, ok := sess.Values["user_id"].(int)
+			if !ok || userID == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			codes, err := permissionRepo.GetUserPermissions(r.Context(), userID)
+			if err != nil {
+				slog.Error("failed to load permissions", "error", err, "user_id", userID)
+				ServerError(w, "Ошибка проверки прав", err)
+				return
+			}
+
+			permissions := make(map[string]bool, len(codes))
+			for _, code := range codes {
+				permissions[code] = true
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), permissionsKey{}, permissions)))
+		})
+	}
+}
+
+// HasPermission сообщает, есть ли право у пользователя запроса
+func HasPermission(r *http.Request, permission string) bool {
+	permissions, _ := r.Context().Value(permissionsKey{}).(map[string]bool)
+	return permissions[permission]
+}
+
+// HomeURL - стартовая страница пользователя по правам его роли
+func HomeURL(r *http.Request) string {
+	switch {
+	case HasPermission(r, entity.PermAdminPanel):
+		return "/admin/dashboard"
+	case HasPermission(r, entity.PermSchoolStatsView):
+		return "/director"
+	case HasPermission(r, entity.PermClassStatsView):
+		return "/teacher"
+	case HasPermission(r, entity.PermChildrenView):
+		return "/parent"
+	case HasPermission(r, entity.PermQuizSolve):
+		return "/home"
+	default:
+		return "/sessions"
+	}
+}
+
+// RequirePermission - доступ к маршруту только для пользователей, чья роль имеет право permission.
+// Без входа - на страницу входа, без права - на свою стартовую страницу (для API и POST - 403).
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, loggedIn := r.Context().Value(permissionsKey{}).(map[string]bool); !loggedIn {
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					http.Error(w, "Требуется вход", http.StatusUnauthorized)
+					return
+				}
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+
+			if HasPermission(r, permission) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			slog.Info("permission denied", "permission", permission, "path", r.URL.Path)
+
+			home := HomeURL(r)
+			if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") && home != r.URL.Path {
+				http.Redirect(w, r, home, http.StatusSeeOther)
+				return
+			}
+
+			http.Error(w, "Доступ запрещен", http.StatusForbidden)
+		})
+	}
+}
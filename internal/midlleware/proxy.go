@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ParseTrustedProxies разбирает список доверенных прокси через запятую: адреса или подсети в нотации CIDR
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("неверный адрес прокси %q", part)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("неверная подсеть прокси %q: %w", part, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// RealIP подставляет в RemoteAddr адрес клиента из X-Forwarded-For, но только для запросов,
+// пришедших от доверенного прокси. Заголовок разбирается справа налево до первого адреса
+// не из списка прокси: более ранние значения может подделать сам клиент.
+// Без доверенных прокси заголовок не учитывается вовсе. X-Forwarded-Proto от недоверенного
+// клиента удаляется, чтобы IsHTTPS и BaseURL не зависели от подделанного заголовка.
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	isTrusted := func(ip net.IP) bool {
+		for _, network := range trusted {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			if remote := net.ParseIP(host); remote == nil || !isTrusted(remote) {
+				if r.Header.Get("X-Forwarded-Proto") != "" {
+					r = r.Clone(r.Context())
+					r.Header.Del("X-Forwarded-Proto")
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			forwarded := r.Header.Get("X-Forwarded-For")
+			if forwarded == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			parts := strings.Split(forwarded, ",")
+			for i := len(parts) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(parts[i]))
+				if ip == nil {
+					break
+				}
+				if i > 0 && isTrusted(ip) {
+					continue
+				}
+
+				r = r.Clone(r.Context())
+				r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+				break
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type publicURLKey struct{}
+
+// ParsePublicURL проверяет адрес сайта из настроек, например "https://edugame.example".
+// Возвращает его без завершающей косой черты; пустая строка допустима.
+func ParsePublicURL(raw string) (string, error) {
+	raw = strings.TrimRight(strings.TrimSpace(raw), "/")
+	if raw == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return "", fmt.Errorf("неверный адрес сайта %q: нужен вид https://example.org", raw)
+	}
+	return raw, nil
+}
+
+// PublicURL задает адрес сайта, от которого строятся ссылки-приглашения, ссылки сброса
+// и обратный адрес SSO. Без него адрес берется из запроса, а Host присылает сам клиент.
+func PublicURL(base string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if base == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), publicURLKey{}, base)))
+		})
+	}
+}
+
+// BaseURL - адрес сайта для ссылок: из настроек, иначе по заголовкам запроса
+func BaseURL(r *http.Request) string {
+	if base, ok := r.Context().Value(publicURLKey{}).(string); ok {
+		return base
+	}
+
+	scheme := "http"
+	if IsHTTPS(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// IsHTTPS - сайт открыт по HTTPS: по настройкам, напрямую или через доверенный прокси
+func IsHTTPS(r *http.Request) bool {
+	if base, ok := r.Context().Value(publicURLKey{}).(string); ok {
+		return strings.HasPrefix(base, "https://")
+	}
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.5")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		trusted   bool
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"no trusted proxies", false, "203.0.113.7:5000", "198.51.100.1", "203.0.113.7:5000"},
+		{"untrusted peer", true, "203.0.113.7:5000", "198.51.100.1", "203.0.113.7:5000"},
+		{"trusted peer", true, "10.1.2.3:5000", "198.51.100.1", "198.51.100.1:0"},
+		{"spoofed left part", true, "10.1.2.3:5000", "1.1.1.1, 198.51.100.1", "198.51.100.1:0"},
+		{"proxy chain", true, "192.168.1.5:5000", "198.51.100.1, 10.9.9.9", "198.51.100.1:0"},
+		{"garbage", true, "10.1.2.3:5000", "not-an-ip", "10.1.2.3:5000"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxies := trusted
+			if !tc.trusted {
+				proxies = nil
+			}
+
+			var got string
+			h := RealIP(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tc.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+}
+
+// Адрес для ссылок не зависит от Host и X-Forwarded-Proto, присланных клиентом
+func TestBaseURL(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		public string
+		remote string
+		host   string
+		want   string
+		https  bool
+	}{
+		{"untrusted proto", "", "203.0.113.7:5000", "school.example", "http://school.example", false},
+		{"trusted proto", "", "10.1.2.3:5000", "school.example", "https://school.example", true},
+		{"public url", "https://edugame.example", "203.0.113.7:5000", "evil.example", "https://edugame.example", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			var https bool
+			h := RealIP(trusted)(PublicURL(tc.public)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, https = BaseURL(r), IsHTTPS(r)
+			})))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			r.Host = tc.host
+			r.Header.Set("X-Forwarded-Proto", "https")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tc.want || https != tc.https {
+				t.Errorf("BaseURL = %q, IsHTTPS = %v, want %q, %v", got, https, tc.want, tc.https)
+			}
+		})
+	}
+
+	if base, err := ParsePublicURL("https://edugame.example/"); err != nil || base != "https://edugame.example" {
+		t.Errorf("ParsePublicURL = %q, %v", base, err)
+	}
+	for _, bad := range []string{"edugame.example", "ftp://edugame.example", "https://edugame.example/app"} {
+		if _, err := ParsePublicURL(bad); err == nil {
+			t.Errorf("ParsePublicURL(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"database/sql"
+	"edugame/internal"
+	"edugame/internal/repository"
+	"edugame/internal/session"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SessionCookieName - cookie с токеном серверной сессии (строка в user_sessions)
+const SessionCookieName = "session_token"
+
+// authSessionKeys - значения gorilla-сессии, описывающие вошедшего пользователя
+var authSessionKeys = []string{"user_id", "username", "role", "full_name"}
+
+// ValidateSession - middleware проверки серверной сессии на каждый запрос.
+// Gorilla-cookie только подписана, поэтому сама по себе не отзывается: пользователь
+// считается вошедшим, пока в user_sessions есть живая строка с токеном из cookie
+// session_token и она принадлежит тому же пользователю. Иначе данные входа
+// стираются из gorilla-сессии. Сессия продлевается при активности.
+func ValidateSession(sessionRepo repository.Sessions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			store := session.GetStore()
+			if store == nil {
+				http.Error(w, "Session store not initialized", http.StatusInternalServerError)
+				return
+			}
+
+			sess, _ := store.Get(r, "app-session")
+			userID, ok := sess.Values["user_id"].(int)
+			if !ok || userID == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var tokenUserID int
+			var refreshed bool
+
+			cookie, err := r.Cookie(SessionCookieName)
+			if err == nil {
+				tokenUserID, refreshed, err = sessionRepo.Touch(r.Context(), cookie.Value, internal.SessionTTL, internal.SessionTouchInterval)
+			}
+
+			if err != nil && !errors.Is(err, http.ErrNoCookie) && !errors.Is(err, sql.ErrNoRows) {
+				slog.Error("failed to validate session", "error", err, "user_id", userID)
+				ServerError(w, "Ошибка проверки сессии", err)
+				return
+			}
+
+			if err != nil || tokenUserID != userID {
+				for _, key := range authSessionKeys {
+					delete(sess.Values, key)
+				}
+				if err := sess.Save(r, w); err != nil {
+					slog.Error("failed to clear session", "error", err)
+				}
+				ClearSessionCookie(w)
+
+				slog.Info("session revoked or expired", "user_id", userID, "path", r.URL.Path)
+
+				switch {
+				case isPublicPath(r.URL.Path):
+					next.ServeHTTP(w, r)
+				case strings.HasPrefix(r.URL.Path, "/api/"):
+					http.Error(w, "Сессия завершена", http.StatusUnauthorized)
+				default:
+					http.Redirect(w, r, "/login?error=session_expired", http.StatusSeeOther)
+				}
+				return
+			}
+
+			if refreshed {
+				SetSessionCookie(w, cookie.Value)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SetSessionCookie выставляет cookie с токеном серверной сессии
+func SetSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(internal.SessionTTL),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie удаляет cookie с токеном серверной сессии
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+func isPublicPath(path string) bool {
+	return path == "/" || path == "/index" || path == "/login" || path == "/auth/login" ||
+		path == "/register" || path == "/auth/register" || path == "/reset" || path == "/auth/reset" ||
+		path == "/invite" || path == "/auth/invite" || path == "/guardian" || path == "/auth/guardian" ||
+		path == "/picture-login" || path == "/auth/picture-login" ||
+		strings.HasPrefix(path, "/auth/oidc/") || strings.HasPrefix(path, "/static/")
+}
@@ -0,0 +1,47 @@
+package oidc
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Cache хранит клиентов провайдеров, чтобы не выполнять discovery при каждом входе.
+// Ключ - вся конфигурация, поэтому изменение настроек провайдера сразу дает нового клиента.
+type Cache struct {
+	client *http.Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[Config]cacheEntry
+}
+
+type cacheEntry struct {
+	provider  *Provider
+	expiresAt time.Time
+}
+
+func NewCache(client *http.Client, ttl time.Duration) *Cache {
+	return &Cache{client: client, ttl: ttl, entries: make(map[Config]cacheEntry)}
+}
+
+// Get возвращает клиента провайдера, при необходимости выполняя discovery
+func (c *Cache) Get(config Config) (*Provider, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[config]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.provider, nil
+	}
+
+	provider, err := Discover(c.client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[config] = cacheEntry{provider: provider, expiresAt: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return provider, nil
+}
@@ -0,0 +1,150 @@
+package oidc_test
+
+import (
+	"edugame/internal/oidc"
+	"edugame/internal/oidc/mockidp"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const (
+	testClientID    = "edugame"
+	testSecret      = "secret"
+	testRedirectURL = "http://app.test/auth/oidc/callback"
+)
+
+var testUsers = []mockidp.User{
+	{Subject: "42", Username: "teacher1", Name: "Учитель", Roles: []string{"teacher", "staff"}},
+}
+
+func startIdP(t *testing.T) (*httptest.Server, *oidc.Provider) {
+	t.Helper()
+
+	ts := httptest.NewServer(nil)
+	t.Cleanup(ts.Close)
+
+	idp, err := mockidp.New(ts.URL, testClientID, testSecret, testUsers)
+	if err != nil {
+		t.Fatalf("mockidp: %v", err)
+	}
+	ts.Config.Handler = idp
+
+	provider, err := oidc.Discover(ts.Client(), oidc.Config{
+		Issuer:       ts.URL,
+		ClientID:     testClientID,
+		ClientSecret: testSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       "profile",
+	})
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	return ts, provider
+}
+
+// authorize проходит страницу входа провайдера и возвращает код из редиректа
+func authorize(t *testing.T, provider *oidc.Provider, state, nonce, verifier string) string {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(provider.AuthCodeURL(state, nonce, verifier) + "&login=teacher1")
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if got := location.Query().Get("state"); got != state {
+		t.Fatalf("state = %q, want %q", got, state)
+	}
+
+	return location.Query().Get("code")
+}
+
+func TestAuthCodeFlowWithPKCE(t *testing.T) {
+	_, provider := startIdP(t)
+
+	verifier, _ := oidc.RandomString()
+	code := authorize(t, provider, "state-1", "nonce-1", verifier)
+
+	rawIDToken, err := provider.Exchange(code, verifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	claims, err := provider.Verify(rawIDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	if claims.String("sub") != "42" || claims.String("preferred_username") != "teacher1" {
+		t.Errorf("unexpected claims: %v", claims)
+	}
+	if roles := claims.Strings("roles"); len(roles) != 2 || roles[0] != "teacher" {
+		t.Errorf("roles = %v", roles)
+	}
+
+	// Код одноразовый
+	if _, err := provider.Exchange(code, verifier); err == nil {
+		t.Error("second exchange of the same code succeeded")
+	}
+}
+
+func TestExchangeRequiresVerifier(t *testing.T) {
+	_, provider := startIdP(t)
+
+	verifier, _ := oidc.RandomString()
+	code := authorize(t, provider, "state", "nonce", verifier)
+
+	if _, err := provider.Exchange(code, "wrong-verifier"); err == nil {
+		t.Fatal("exchange with wrong PKCE verifier succeeded")
+	}
+}
+
+func TestVerifyRejectsWrongNonce(t *testing.T) {
+	_, provider := startIdP(t)
+
+	verifier, _ := oidc.RandomString()
+	code := authorize(t, provider, "state", "nonce", verifier)
+	rawIDToken, err := provider.Exchange(code, verifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	if _, err := provider.Verify(rawIDToken, "other-nonce"); !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Fatalf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+// Токен, подписанный чужим ключом с тем же issuer и kid, не проходит проверку подписи
+func TestVerifyRejectsForeignSignature(t *testing.T) {
+	ts, provider := startIdP(t)
+
+	forger, err := mockidp.New(ts.URL, testClientID, testSecret, testUsers)
+	if err != nil {
+		t.Fatalf("mockidp: %v", err)
+	}
+	original := ts.Config.Handler
+	ts.Config.Handler = forger
+
+	verifier, _ := oidc.RandomString()
+	code := authorize(t, provider, "state", "nonce", verifier)
+	rawIDToken, err := provider.Exchange(code, verifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	ts.Config.Handler = original
+	if _, err := provider.Verify(rawIDToken, "nonce"); !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Fatalf("err = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,461 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrNoCurrentYear - текущий учебный год не задан (миграция создает его автоматически)
+var ErrNoCurrentYear = errors.New("текущий учебный год не задан")
+
+// ErrMaxGrade - класс последней параллели нельзя перевести, только выпустить
+var ErrMaxGrade = fmt.Errorf("класс %d параллели можно только выпустить", entity.MaxGrade)
+
+// RolloverPlan - решения администратора для перехода на новый учебный год
+type RolloverPlan struct {
+	NewYearName  string
+	NewYearStart time.Time
+	// ClassActions - решение по классу; классы без решения переводятся в следующую параллель
+	ClassActions map[int]string
+	// Graduate и Unenroll - ученики, которые покидают свои классы независимо от решения по классу
+	Graduate []int
+	Unenroll []int
+	ClosedBy int
+}
+
+// RolloverResult - что изменилось при переходе на новый год
+type RolloverResult struct {
+	Year              *entity.AcademicYear
+	Promoted          int
+	Kept              int
+	GraduatedClasses  int
+	GraduatedStudents int
+	Unenrolled        int
+}
+
+// RolloverClass - класс в мастере перехода: с учениками, чтобы выпустить или отчислить их отдельно
+type RolloverClass struct {
+	entity.Class
+	SchoolName string
+	Students   []RolloverStudent
+}
+
+// PromotedName - название класса после перевода в следующую параллель
+func (c *RolloverClass) PromotedName() string {
+	return entity.PromotedClassName(c.Name, c.Grade, c.Grade+1)
+}
+
+// CanPromote - класс не в последней параллели
+func (c *RolloverClass) CanPromote() bool {
+	return c.Grade < entity.MaxGrade
+}
+
+type RolloverStudent struct {
+	ID       int
+	Username string
+	FullName string
+}
+
+type AcademicYearRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewAcademicYearRepository(db *sql.DB, timeouts QueryTimeouts) *AcademicYearRepository {
+	return &AcademicYearRepository{db: db, timeouts: timeouts}
+}
+
+const academicYearColumns = `id, name, starts_on, is_current, closed_at, closed_by, created_at`
+
+func scanAcademicYear(row interface{ Scan(...any) error }) (*entity.AcademicYear, error) {
+	var year entity.AcademicYear
+	var closedAt sql.NullTime
+	var closedBy sql.NullInt64
+	if err := row.Scan(&year.ID, &year.Name, &year.StartsOn, &year.IsCurrent, &closedAt, &closedBy, &year.CreatedAt); err != nil {
+		return nil, err
+	}
+	if closedAt.Valid {
+		year.ClosedAt = &closedAt.Time
+	}
+	if closedBy.Valid {
+		id := int(closedBy.Int64)
+		year.ClosedBy = &id
+	}
+	return &year, nil
+}
+
+// GetAll - учебные годы, последние первыми
+func (r *AcademicYearRepository) GetAll(ctx context.Context) ([]entity.AcademicYear, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+academicYearColumns+` FROM academic_years ORDER BY starts_on DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var years []entity.AcademicYear
+	for rows.Next() {
+		year, err := scanAcademicYear(rows)
+		if err != nil {
+			return nil, err
+		}
+		years = append(years, *year)
+	}
+
+	return years, rows.Err()
+}
+
+// GetCurrent - текущий учебный год; ErrNoCurrentYear, если он не задан
+func (r *AcademicYearRepository) GetCurrent(ctx context.Context) (*entity.AcademicYear, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	year, err := scanAcademicYear(r.db.QueryRowContext(ctx, `SELECT `+academicYearColumns+` FROM academic_years WHERE is_current`))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoCurrentYear
+	}
+	return year, err
+}
+
+func (r *AcademicYearRepository) GetByID(ctx context.Context, id int) (*entity.AcademicYear, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return scanAcademicYear(r.db.QueryRowContext(ctx, `SELECT `+academicYearColumns+` FROM academic_years WHERE id = $1`, id))
+}
+
+// GetClassSnapshots - итоги классов за закрытый год
+func (r *AcademicYearRepository) GetClassSnapshots(ctx context.Context, yearID int) ([]entity.YearClassSnapshot, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT academic_year_id, class_id, school_id, school_name, class_name, grade, teacher_name, outcome,
+               students_count, active_students, attempts_count, correct_count
+        FROM academic_year_classes
+        WHERE academic_year_id = $1
+        ORDER BY school_name, grade, class_name
+    `, yearID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []entity.YearClassSnapshot
+	for rows.Next() {
+		var s entity.YearClassSnapshot
+		var schoolID sql.NullInt64
+		if err := rows.Scan(&s.AcademicYearID, &s.ClassID, &schoolID, &s.SchoolName, &s.ClassName, &s.Grade, &s.TeacherName,
+			&s.Outcome, &s.StudentsCount, &s.ActiveStudents, &s.AttemptsCount, &s.CorrectCount); err != nil {
+			return nil, err
+		}
+		if schoolID.Valid {
+			id := int(schoolID.Int64)
+			s.SchoolID = &id
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// GetStudentSnapshots - итоги учеников класса за закрытый год
+func (r *AcademicYearRepository) GetStudentSnapshots(ctx context.Context, yearID, classID int) ([]entity.YearStudentSnapshot, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT academic_year_id, class_id, student_id, username, full_name,
+               attempts_count, correct_count, last_attempt_at, outcome
+        FROM academic_year_students
+        WHERE academic_year_id = $1 AND class_id = $2
+        ORDER BY full_name
+    `, yearID, classID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []entity.YearStudentSnapshot
+	for rows.Next() {
+		var s entity.YearStudentSnapshot
+		var lastAttempt sql.NullTime
+		if err := rows.Scan(&s.AcademicYearID, &s.ClassID, &s.StudentID, &s.Username, &s.FullName,
+			&s.AttemptsCount, &s.CorrectCount, &lastAttempt, &s.Outcome); err != nil {
+			return nil, err
+		}
+		if lastAttempt.Valid {
+			s.LastAttemptAt = &lastAttempt.Time
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// GetRolloverClasses - действующие классы с учениками для мастера перехода
+func (r *AcademicYearRepository) GetRolloverClasses(ctx context.Context) ([]RolloverClass, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT c.id, c.name, c.grade, COALESCE(c.teacher_id, 0), c.school_id, c.created_at, COALESCE(s.name, ''),
+               u.id, u.username, u.fullname
+        FROM classes c
+        LEFT JOIN schools s ON s.id = c.school_id
+        LEFT JOIN student_classes sc ON sc.class_id = c.id
+        LEFT JOIN users u ON u.id = sc.student_id AND NOT u.pending AND u.deleted_at IS NULL
+            AND u.role_id = (SELECT id FROM roles WHERE name = 'student')
+        WHERE c.deleted_at IS NULL
+        ORDER BY COALESCE(s.name, ''), c.grade, c.name, c.id, u.fullname
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var classes []RolloverClass
+	for rows.Next() {
+		var c RolloverClass
+		var schoolID, studentID sql.NullInt64
+		var username, fullName sql.NullString
+		if err := rows.Scan(&c.ID, &c.Name, &c.Grade, &c.TeacherID, &schoolID, &c.CreatedAt, &c.SchoolName,
+			&studentID, &username, &fullName); err != nil {
+			return nil, err
+		}
+
+		if n := len(classes); n == 0 || classes[n-1].ID != c.ID {
+			if schoolID.Valid {
+				id := int(schoolID.Int64)
+				c.SchoolID = &id
+			}
+			classes = append(classes, c)
+		}
+		if studentID.Valid {
+			last := &classes[len(classes)-1]
+			last.Students = append(last.Students, RolloverStudent{ID: int(studentID.Int64), Username: username.String, FullName: fullName.String})
+		}
+	}
+
+	return classes, rows.Err()
+}
+
+// Rollover закрывает текущий учебный год и открывает новый одной транзакцией:
+// сохраняет снимки статистики классов и учеников, выпускает и отчисляет учеников,
+// переводит классы в следующую параллель и создает прогресс по типам новой параллели
+func (r *AcademicYearRepository) Rollover(ctx context.Context, plan RolloverPlan) (*RolloverResult, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var currentID int
+	var startsOn time.Time
+	err = tx.QueryRowContext(ctx, `SELECT id, starts_on FROM academic_years WHERE is_current FOR UPDATE`).Scan(&currentID, &startsOn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoCurrentYear
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type promotion struct {
+		id, grade int
+		name      string
+	}
+	var promote []promotion
+	var keep, graduate []int64
+	result := &RolloverResult{}
+
+	err = func() error {
+		rows, err := tx.QueryContext(ctx, `SELECT id, name, grade FROM classes WHERE deleted_at IS NULL ORDER BY id FOR UPDATE`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var p promotion
+			if err := rows.Scan(&p.id, &p.name, &p.grade); err != nil {
+				return err
+			}
+			switch plan.ClassActions[p.id] {
+			case entity.RolloverKeep:
+				keep = append(keep, int64(p.id))
+			case entity.RolloverGraduate:
+				graduate = append(graduate, int64(p.id))
+			default:
+				if p.grade >= entity.MaxGrade {
+					return fmt.Errorf("%s: %w", p.name, ErrMaxGrade)
+				}
+				promote = append(promote, p)
+			}
+		}
+		return rows.Err()
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	graduateStudents := toInt64s(plan.Graduate)
+	unenroll := toInt64s(plan.Unenroll)
+
+	// Снимки года до любых изменений: состав и статистика на момент закрытия
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO academic_year_classes (academic_year_id, class_id, school_id, school_name, class_name, grade,
+                                           teacher_name, outcome, students_count, active_students, attempts_count, correct_count)
+        SELECT $1, c.id, c.school_id, COALESCE(s.name, ''), c.name, c.grade, COALESCE(t.fullname, ''),
+               CASE WHEN c.id = ANY($3) THEN 'keep' WHEN c.id = ANY($4) THEN 'graduate' ELSE 'promote' END,
+               COUNT(DISTINCT u.id), COUNT(DISTINCT a.user_id), COUNT(a.id), COUNT(a.id) FILTER (WHERE a.is_correct)
+        FROM classes c
+        LEFT JOIN schools s ON s.id = c.school_id
+        LEFT JOIN users t ON t.id = c.teacher_id
+        LEFT JOIN student_classes sc ON sc.class_id = c.id
+        LEFT JOIN users u ON u.id = sc.student_id AND NOT u.pending AND u.deleted_at IS NULL
+            AND u.role_id = (SELECT id FROM roles WHERE name = 'student')
+        LEFT JOIN attempts a ON a.user_id = u.id AND a.created_at >= $2
+        WHERE c.deleted_at IS NULL
+        GROUP BY c.id, s.name, t.fullname
+    `, currentID, startsOn, pq.Array(keep), pq.Array(graduate))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO academic_year_students (academic_year_id, class_id, student_id, username, full_name,
+                                            attempts_count, correct_count, last_attempt_at, outcome)
+        SELECT $1, c.id, u.id, u.username, u.fullname,
+               COUNT(a.id), COUNT(a.id) FILTER (WHERE a.is_correct), MAX(a.created_at),
+               CASE WHEN u.id = ANY($5) THEN 'unenrolled'
+                    WHEN u.id = ANY($6) OR c.id = ANY($4) THEN 'graduated'
+                    WHEN c.id = ANY($3) THEN 'kept'
+                    ELSE 'promoted' END
+        FROM classes c
+        JOIN student_classes sc ON sc.class_id = c.id
+        JOIN users u ON u.id = sc.student_id AND NOT u.pending AND u.deleted_at IS NULL
+            AND u.role_id = (SELECT id FROM roles WHERE name = 'student')
+        LEFT JOIN attempts a ON a.user_id = u.id AND a.created_at >= $2
+        WHERE c.deleted_at IS NULL
+        GROUP BY c.id, u.id
+    `, currentID, startsOn, pq.Array(keep), pq.Array(graduate), pq.Array(unenroll), pq.Array(graduateStudents))
+	if err != nil {
+		return nil, err
+	}
+
+	// Выпущенные и отчисленные по одному ученики покидают все классы
+	err = tx.QueryRowContext(ctx, `
+        WITH removed AS (
+            DELETE FROM student_classes
+            WHERE student_id = ANY($1)
+              AND class_id IN (SELECT id FROM classes WHERE deleted_at IS NULL)
+            RETURNING student_id
+        )
+        SELECT COUNT(DISTINCT student_id) FROM removed
+    `, pq.Array(unenroll)).Scan(&result.Unenrolled)
+	if err != nil {
+		return nil, err
+	}
+
+	// Счетчик выпускников: выпущенные отдельно и ученики выпускных классов
+	err = tx.QueryRowContext(ctx, `
+        SELECT COUNT(DISTINCT sc.student_id)
+        FROM student_classes sc
+        JOIN classes c ON c.id = sc.class_id AND c.deleted_at IS NULL
+        JOIN users u ON u.id = sc.student_id AND NOT u.pending AND u.deleted_at IS NULL
+            AND u.role_id = (SELECT id FROM roles WHERE name = 'student')
+        WHERE sc.student_id = ANY($1) OR sc.class_id = ANY($2)
+    `, pq.Array(graduateStudents), pq.Array(graduate)).Scan(&result.GraduatedStudents)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        DELETE FROM student_classes
+        WHERE student_id = ANY($1)
+          AND class_id IN (SELECT id FROM classes WHERE deleted_at IS NULL)
+    `, pq.Array(graduateStudents))
+	if err != nil {
+		return nil, err
+	}
+
+	// Выпускной класс уходит в корзину вместе с составом: его итоги остаются в снимке
+	if _, err := tx.ExecContext(ctx, `UPDATE classes SET deleted_at = NOW() WHERE id = ANY($1)`, pq.Array(graduate)); err != nil {
+		return nil, err
+	}
+
+	promoted := make([]int64, 0, len(promote))
+	for _, p := range promote {
+		newGrade := p.grade + 1
+		_, err := tx.ExecContext(ctx, `UPDATE classes SET grade = $1, name = $2 WHERE id = $3`,
+			newGrade, entity.PromotedClassName(p.name, p.grade, newGrade), p.id)
+		if err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, int64(p.id))
+	}
+
+	// Прогресс по типам новой параллели: триггер срабатывает только при добавлении в класс
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO user_progress (user_id, equation_type_id, is_unlocked, first_unlocked_at)
+        SELECT sc.student_id, et.id, et.is_available, CURRENT_TIMESTAMP
+        FROM student_classes sc
+        JOIN classes c ON c.id = sc.class_id
+        JOIN users u ON u.id = sc.student_id AND u.deleted_at IS NULL
+            AND u.role_id = (SELECT id FROM roles WHERE name = 'student')
+        JOIN equation_types et ON et.class = c.grade AND et.deleted_at IS NULL
+        WHERE c.id = ANY($1)
+        ON CONFLICT (user_id, equation_type_id) DO NOTHING
+    `, pq.Array(promoted))
+	if err != nil {
+		return nil, err
+	}
+
+	var closedBy sql.NullInt64
+	if plan.ClosedBy > 0 {
+		closedBy = sql.NullInt64{Int64: int64(plan.ClosedBy), Valid: true}
+	}
+	_, err = tx.ExecContext(ctx, `
+        UPDATE academic_years SET is_current = FALSE, closed_at = NOW(), closed_by = $2 WHERE id = $1
+    `, currentID, closedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Year, err = scanAcademicYear(tx.QueryRowContext(ctx, `
+        INSERT INTO academic_years (name, starts_on, is_current)
+        VALUES ($1, $2, TRUE)
+        RETURNING `+academicYearColumns,
+		plan.NewYearName, plan.NewYearStart))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	result.Promoted = len(promote)
+	result.Kept = len(keep)
+	result.GraduatedClasses = len(graduate)
+	return result, nil
+}
+
+func toInt64s(ids []int) []int64 {
+	out := make([]int64, len(ids))
+	for i, id := range ids {
+		out[i] = int64(id)
+	}
+	return out
+}
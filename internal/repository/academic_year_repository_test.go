@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"edugame/internal/entity"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+// newRolloverMock - транзакция перехода до разбора классов: текущий год и список классов
+func newRolloverMock(t *testing.T, startsOn time.Time, classes *sqlmock.Rows) (*AcademicYearRepository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, starts_on FROM academic_years WHERE is_current FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "starts_on"}).AddRow(int64(1), startsOn))
+	mock.ExpectQuery(`SELECT id, name, grade FROM classes WHERE deleted_at IS NULL ORDER BY id FOR UPDATE`).
+		WillReturnRows(classes)
+
+	return NewAcademicYearRepository(db, QueryTimeouts{}), mock
+}
+
+// Снимки пишутся до изменений, выпуск и отчисление считаются в той же транзакции, что и перевод классов
+func TestRolloverRunsInOneTransaction(t *testing.T) {
+	startsOn := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	newStart := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	repo, mock := newRolloverMock(t, startsOn, sqlmock.NewRows([]string{"id", "name", "grade"}).
+		AddRow(int64(1), "2А", int64(2)).
+		AddRow(int64(2), "5Б", int64(5)).
+		AddRow(int64(3), "11А", int64(11)))
+
+	keep, graduate := pq.Array([]int64{2}), pq.Array([]int64{3})
+	graduateStudents, unenroll := pq.Array([]int64{10}), pq.Array([]int64{11})
+
+	mock.ExpectExec(`INSERT INTO academic_year_classes .+ FROM classes c`).
+		WithArgs(1, startsOn, keep, graduate).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`INSERT INTO academic_year_students .+ FROM classes c`).
+		WithArgs(1, startsOn, keep, graduate, unenroll, graduateStudents).
+		WillReturnResult(sqlmock.NewResult(0, 20))
+	mock.ExpectQuery(`WITH removed AS \(\s*DELETE FROM student_classes .+ SELECT COUNT\(DISTINCT student_id\) FROM removed`).
+		WithArgs(unenroll).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(1)))
+	mock.ExpectQuery(`SELECT COUNT\(DISTINCT sc.student_id\)\s+FROM student_classes sc .+ WHERE sc.student_id = ANY\(\$1\) OR sc.class_id = ANY\(\$2\)`).
+		WithArgs(graduateStudents, graduate).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(8)))
+	mock.ExpectExec(`DELETE FROM student_classes\s+WHERE student_id = ANY\(\$1\)`).
+		WithArgs(graduateStudents).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE classes SET deleted_at = NOW\(\) WHERE id = ANY\(\$1\)`).
+		WithArgs(graduate).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE classes SET grade = \$1, name = \$2 WHERE id = \$3`).
+		WithArgs(3, "3А", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO user_progress .+ WHERE c.id = ANY\(\$1\)`).
+		WithArgs(pq.Array([]int64{1})).
+		WillReturnResult(sqlmock.NewResult(0, 12))
+	mock.ExpectExec(`UPDATE academic_years SET is_current = FALSE, closed_at = NOW\(\), closed_by = \$2 WHERE id = \$1`).
+		WithArgs(1, int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO academic_years \(name, starts_on, is_current\)`).
+		WithArgs("2026/2027", newStart).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "starts_on", "is_current", "closed_at", "closed_by", "created_at"}).
+			AddRow(int64(2), "2026/2027", newStart, true, nil, nil, newStart))
+	mock.ExpectCommit()
+
+	result, err := repo.Rollover(context.Background(), RolloverPlan{
+		NewYearName:  "2026/2027",
+		NewYearStart: newStart,
+		ClassActions: map[int]string{2: entity.RolloverKeep, 3: entity.RolloverGraduate},
+		Graduate:     []int{10},
+		Unenroll:     []int{11},
+		ClosedBy:     5,
+	})
+	if err != nil {
+		t.Fatalf("Rollover: %v", err)
+	}
+	if result.Year == nil || result.Year.ID != 2 || !result.Year.IsCurrent {
+		t.Errorf("new year = %+v", result.Year)
+	}
+	if result.Promoted != 1 || result.Kept != 1 || result.GraduatedClasses != 1 ||
+		result.GraduatedStudents != 8 || result.Unenrolled != 1 {
+		t.Errorf("result = %+v", result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Класс последней параллели без решения о выпуске откатывает переход до любых изменений
+func TestRolloverRollsBackMaxGradePromotion(t *testing.T) {
+	repo, mock := newRolloverMock(t, time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), sqlmock.NewRows([]string{"id", "name", "grade"}).
+		AddRow(int64(1), "11А", int64(entity.MaxGrade)))
+	mock.ExpectRollback()
+
+	_, err := repo.Rollover(context.Background(), RolloverPlan{NewYearName: "2026/2027"})
+	if !errors.Is(err, ErrMaxGrade) {
+		t.Fatalf("Rollover error = %v, want ErrMaxGrade", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
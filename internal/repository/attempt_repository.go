@@ -1,48 +1,68 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"edugame/internal/entity"
 	"time"
 )
 
 type AttemptRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewAttemptRepository(db *sql.DB) *AttemptRepository {
-	return &AttemptRepository{db: db}
+func NewAttemptRepository(db *sql.DB, timeouts QueryTimeouts) *AttemptRepository {
+	return &AttemptRepository{db: db, timeouts: timeouts}
 }
 
-// Сохранить попытку решения
-func (a *AttemptRepository) SaveAttempt(attempt entity.Attempt) error {
-	_, err := a.db.Exec(`
+// Сохранить попытку решения. Если у попытки задано время (офлайн-решение), оно сохраняется как есть.
+func (a *AttemptRepository) SaveAttempt(ctx context.Context, attempt entity.Attempt) error {
+	ctx, cancel := a.timeouts.query(ctx)
+	defer cancel()
+
+	return insertAttempt(ctx, a.db, attempt)
+}
+
+// execer - *sql.DB или *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertAttempt сохраняет попытку и обновляет прогресс ученика
+func insertAttempt(ctx context.Context, db execer, attempt entity.Attempt) error {
+	createdAt := attempt.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	_, err := db.ExecContext(ctx, `
 		INSERT INTO attempts
-		(user_id, equation_type_id, equation_text, correct_answer, user_answer, is_correct, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, attempt.UserID, attempt.EquationTypeID, attempt.EquationText, attempt.CorrectAnswer, attempt.UserAnswer, attempt.IsCorrect, time.Now())
+		(user_id, equation_type_id, equation_text, correct_answer, user_answer, is_correct, credit, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, attempt.UserID, attempt.EquationTypeID, attempt.EquationText, attempt.CorrectAnswer, attempt.UserAnswer, attempt.IsCorrect, attempt.Credit, createdAt)
 
 	if err != nil {
 		return err
 	}
 
 	if attempt.IsCorrect {
-		_, err = a.db.Exec(`
+		_, err = db.ExecContext(ctx, `
 			UPDATE user_progress
 			SET attempts_count = attempts_count + 1,
 			correct_count = correct_count + 1,
-			last_attempt_at = $1,
+			last_attempt_at = GREATEST(last_attempt_at, $1),
 			updated_at = $2
 			WHERE user_id = $3 AND equation_type_id = $4
-		`, time.Now(), time.Now(), attempt.UserID, attempt.EquationTypeID)
+		`, createdAt, time.Now(), attempt.UserID, attempt.EquationTypeID)
 	} else {
-		_, err = a.db.Exec(`
+		_, err = db.ExecContext(ctx, `
 			UPDATE user_progress
 			SET attempts_count = attempts_count + 1,
-			last_attempt_at = $1,
+			last_attempt_at = GREATEST(last_attempt_at, $1),
 			updated_at = $2
 			WHERE user_id = $3 AND equation_type_id = $4
-		`, time.Now(), time.Now(), attempt.UserID, attempt.EquationTypeID)
+		`, createdAt, time.Now(), attempt.UserID, attempt.EquationTypeID)
 	}
 
 	return err
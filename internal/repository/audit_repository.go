@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditRepository - журнал аудита. Записи только добавляются, изменение и удаление
+// запрещены триггером в БД.
+type AuditRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewAuditRepository(db *sql.DB, timeouts QueryTimeouts) *AuditRepository {
+	return &AuditRepository{db: db, timeouts: timeouts}
+}
+
+// AuditFilter - условия выборки журнала, пустые поля не ограничивают
+type AuditFilter struct {
+	Actor      string // часть логина
+	Action     string // точное действие или префикс с точкой, например "user."
+	TargetType string
+	TargetID   *int
+	From       *time.Time
+	To         *time.Time
+}
+
+// Record добавляет запись. Пустые before/after сохраняются как NULL.
+func (r *AuditRepository) Record(ctx context.Context, entry *entity.AuditEntry) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO audit_log (actor_id, actor_name, action, target_type, target_id, before_state, after_state, ip_address)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::jsonb, NULLIF($7, '')::jsonb, $8)
+    `, entry.ActorID, entry.ActorName, entry.Action, entry.TargetType, entry.TargetID,
+		entry.Before, entry.After, entry.IPAddress)
+	return err
+}
+
+const auditColumns = `
+        SELECT id, actor_id, actor_name, action, target_type, target_id,
+               COALESCE(before_state::text, ''), COALESCE(after_state::text, ''), ip_address, created_at
+        FROM audit_log`
+
+func scanAuditEntry(rows *sql.Rows) (entity.AuditEntry, error) {
+	var e entity.AuditEntry
+	err := rows.Scan(
+		&e.ID, &e.ActorID, &e.ActorName, &e.Action, &e.TargetType, &e.TargetID,
+		&e.Before, &e.After, &e.IPAddress, &e.CreatedAt,
+	)
+	return e, err
+}
+
+// Find возвращает записи по фильтру, новые сверху. limit <= 0 - без ограничения.
+func (r *AuditRepository) Find(ctx context.Context, filter AuditFilter, limit, offset int) ([]entity.AuditEntry, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	where, args := filter.where()
+
+	query := auditColumns + where + `
+        ORDER BY id DESC`
+	if limit > 0 {
+		args = append(args, limit, offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []entity.AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Each передает записи по фильтру в fn по одной, новые сверху, не собирая журнал в памяти.
+// Ошибка fn прерывает чтение и возвращается.
+func (r *AuditRepository) Each(ctx context.Context, filter AuditFilter, fn func(entity.AuditEntry) error) error {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	where, args := filter.where()
+
+	rows, err := r.db.QueryContext(ctx, auditColumns+where+`
+        ORDER BY id DESC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Count - число записей по фильтру
+func (r *AuditRepository) Count(ctx context.Context, filter AuditFilter) (int, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	where, args := filter.where()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&count)
+	return count, err
+}
+
+func (f AuditFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Actor != "" {
+		add("actor_name ILIKE '%%' || $%d || '%%'", f.Actor)
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		add("action LIKE $%d || '%%'", f.Action)
+	} else if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != nil {
+		add("target_id = $%d", *f.TargetID)
+	}
+	if f.From != nil {
+		add("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < $%d", *f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Matches проверяет запись по тем же условиям, что и where - для реализаций без SQL
+func (f AuditFilter) Matches(e entity.AuditEntry) bool {
+	if f.Actor != "" && !strings.Contains(strings.ToLower(e.ActorName), strings.ToLower(f.Actor)) {
+		return false
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		if !strings.HasPrefix(e.Action, f.Action) {
+			return false
+		}
+	} else if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if f.TargetType != "" && e.TargetType != f.TargetType {
+		return false
+	}
+	if f.TargetID != nil && (e.TargetID == nil || *e.TargetID != *f.TargetID) {
+		return false
+	}
+	if f.From != nil && e.CreatedAt.Before(*f.From) {
+		return false
+	}
+	if f.To != nil && !e.CreatedAt.Before(*f.To) {
+		return false
+	}
+	return true
+}
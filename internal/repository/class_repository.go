@@ -1,23 +1,28 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"edugame/internal/entity"
 )
 
 type ClassRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewClassRepository(db *sql.DB) *ClassRepository {
-	return &ClassRepository{db: db}
+func NewClassRepository(db *sql.DB, timeouts QueryTimeouts) *ClassRepository {
+	return &ClassRepository{db: db, timeouts: timeouts}
 }
 
 // GetAll получает все классы
-func (r *ClassRepository) GetAll() ([]entity.Class, error) {
-	query := `SELECT id, name, grade, teacher_id, school_id, created_at FROM classes ORDER BY grade, name`
+func (r *ClassRepository) GetAll(ctx context.Context) ([]entity.Class, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
 
-	rows, err := r.db.Query(query)
+	query := `SELECT id, name, grade, COALESCE(teacher_id, 0), school_id, created_at FROM classes WHERE deleted_at IS NULL ORDER BY grade, name`
+
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -45,13 +50,16 @@ func (r *ClassRepository) GetAll() ([]entity.Class, error) {
 }
 
 // GetByID получает класс по ID
-func (r *ClassRepository) GetByID(id int) (*entity.Class, error) {
-	query := `SELECT id, name, grade, teacher_id, school_id, created_at FROM classes WHERE id = $1`
+func (r *ClassRepository) GetByID(ctx context.Context, id int) (*entity.Class, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, grade, COALESCE(teacher_id, 0), school_id, created_at FROM classes WHERE id = $1 AND deleted_at IS NULL`
 
 	var class entity.Class
 	var schoolID sql.NullInt64
 
-	err := r.db.QueryRow(query, id).Scan(&class.ID, &class.Name, &class.Grade, &class.TeacherID, &schoolID, &class.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&class.ID, &class.Name, &class.Grade, &class.TeacherID, &schoolID, &class.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -64,8 +72,11 @@ func (r *ClassRepository) GetByID(id int) (*entity.Class, error) {
 	return &class, nil
 }
 
-// Create создает новый класс
-func (r *ClassRepository) Create(name string, grade, teacherID int, schoolID *int) (*entity.Class, error) {
+// Create создает новый класс. Учитель класса добавляется в его состав как ведущий.
+func (r *ClassRepository) Create(ctx context.Context, name string, grade, teacherID int, schoolID *int) (*entity.Class, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	var schoolIDNull sql.NullInt64
 	if schoolID != nil {
 		schoolIDNull = sql.NullInt64{Int64: int64(*schoolID), Valid: true}
@@ -80,12 +91,26 @@ func (r *ClassRepository) Create(name string, grade, teacherID int, schoolID *in
 	var class entity.Class
 	var retSchoolID sql.NullInt64
 
-	err := r.db.QueryRow(query, name, grade, teacherID, schoolIDNull).Scan(
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, name, grade, teacherID, schoolIDNull).Scan(
 		&class.ID, &class.Name, &class.Grade, &class.TeacherID, &retSchoolID, &class.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := setClassLead(ctx, tx, class.ID, 0, teacherID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	if retSchoolID.Valid {
 		sid := int(retSchoolID.Int64)
 		class.SchoolID = &sid
@@ -94,8 +119,12 @@ func (r *ClassRepository) Create(name string, grade, teacherID int, schoolID *in
 	return &class, nil
 }
 
-// Update обновляет класс
-func (r *ClassRepository) Update(id int, name string, grade, teacherID int, schoolID *int) (*entity.Class, error) {
+// Update обновляет класс. При смене учителя прежний исключается из состава класса,
+// а новый становится ведущим.
+func (r *ClassRepository) Update(ctx context.Context, id int, name string, grade, teacherID int, schoolID *int) (*entity.Class, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	var schoolIDNull sql.NullInt64
 	if schoolID != nil {
 		schoolIDNull = sql.NullInt64{Int64: int64(*schoolID), Valid: true}
@@ -104,19 +133,39 @@ func (r *ClassRepository) Update(id int, name string, grade, teacherID int, scho
 	query := `
 		UPDATE classes 
 		SET name = $1, grade = $2, teacher_id = $3, school_id = $4
-		WHERE id = $5
+		WHERE id = $5 AND deleted_at IS NULL
 		RETURNING id, name, grade, teacher_id, school_id, created_at
 	`
 
 	var class entity.Class
 	var retSchoolID sql.NullInt64
 
-	err := r.db.QueryRow(query, name, grade, teacherID, schoolIDNull, id).Scan(
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var oldTeacherID sql.NullInt64
+	err = tx.QueryRowContext(ctx, `SELECT teacher_id FROM classes WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&oldTeacherID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, query, name, grade, teacherID, schoolIDNull, id).Scan(
 		&class.ID, &class.Name, &class.Grade, &class.TeacherID, &retSchoolID, &class.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := setClassLead(ctx, tx, id, int(oldTeacherID.Int64), teacherID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	if retSchoolID.Valid {
 		sid := int(retSchoolID.Int64)
 		class.SchoolID = &sid
@@ -125,18 +174,44 @@ func (r *ClassRepository) Update(id int, name string, grade, teacherID int, scho
 	return &class, nil
 }
 
-// Delete удаляет класс
-func (r *ClassRepository) Delete(id int) error {
-	query := `DELETE FROM classes WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+// setClassLead синхронизирует состав класса с его учителем (classes.teacher_id)
+func setClassLead(ctx context.Context, tx *sql.Tx, classID, oldTeacherID, teacherID int) error {
+	if oldTeacherID > 0 && oldTeacherID != teacherID {
+		_, err := tx.ExecContext(ctx, `DELETE FROM class_staff WHERE class_id = $1 AND user_id = $2`, classID, oldTeacherID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if teacherID <= 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO class_staff (class_id, user_id, role) VALUES ($1, $2, 'lead')
+		ON CONFLICT (class_id, user_id) DO UPDATE SET role = 'lead'
+	`, classID, teacherID)
+	return err
+}
+
+// Delete переносит класс в корзину. Ученики остаются в составе класса и вернутся вместе с ним.
+func (r *ClassRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `UPDATE classes SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
 // GetByTeacherID получает классы учителя
-func (r *ClassRepository) GetByTeacherID(teacherID int) ([]entity.Class, error) {
-	query := `SELECT id, name, grade, teacher_id, school_id, created_at FROM classes WHERE teacher_id = $1 ORDER BY grade, name`
+func (r *ClassRepository) GetByTeacherID(ctx context.Context, teacherID int) ([]entity.Class, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, grade, teacher_id, school_id, created_at FROM classes WHERE teacher_id = $1 AND deleted_at IS NULL ORDER BY grade, name`
 
-	rows, err := r.db.Query(query, teacherID)
+	rows, err := r.db.QueryContext(ctx, query, teacherID)
 	if err != nil {
 		return nil, err
 	}
@@ -164,10 +239,13 @@ func (r *ClassRepository) GetByTeacherID(teacherID int) ([]entity.Class, error)
 }
 
 // GetBySchoolID получает классы школы
-func (r *ClassRepository) GetBySchoolID(schoolID int) ([]entity.Class, error) {
-	query := `SELECT id, name, grade, teacher_id, school_id, created_at FROM classes WHERE school_id = $1 ORDER BY grade, name`
+func (r *ClassRepository) GetBySchoolID(ctx context.Context, schoolID int) ([]entity.Class, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, grade, COALESCE(teacher_id, 0), school_id, created_at FROM classes WHERE school_id = $1 AND deleted_at IS NULL ORDER BY grade, name`
 
-	rows, err := r.db.Query(query, schoolID)
+	rows, err := r.db.QueryContext(ctx, query, schoolID)
 	if err != nil {
 		return nil, err
 	}
@@ -195,24 +273,37 @@ func (r *ClassRepository) GetBySchoolID(schoolID int) ([]entity.Class, error) {
 }
 
 // GetStudentsCount получает количество учеников в классе
-func (r *ClassRepository) GetStudentsCount(classID int) (int, error) {
-	query := `SELECT COUNT(*) FROM student_classes WHERE class_id = $1`
+func (r *ClassRepository) GetStudentsCount(ctx context.Context, classID int) (int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*) FROM student_classes sc
+		JOIN users u ON u.id = sc.student_id
+		WHERE sc.class_id = $1 AND u.deleted_at IS NULL
+	`
 
 	var count int
-	err := r.db.QueryRow(query, classID).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, classID).Scan(&count)
 	return count, err
 }
 
 // AddStudentToClass добавляет ученика в класс
-func (r *ClassRepository) AddStudentToClass(studentID, classID int) error {
+func (r *ClassRepository) AddStudentToClass(ctx context.Context, studentID, classID int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `INSERT INTO student_classes (student_id, class_id) VALUES ($1, $2)`
-	_, err := r.db.Exec(query, studentID, classID)
+	_, err := r.db.ExecContext(ctx, query, studentID, classID)
 	return err
 }
 
 // RemoveStudentFromClass удаляет ученика из класса
-func (r *ClassRepository) RemoveStudentFromClass(studentID, classID int) error {
+func (r *ClassRepository) RemoveStudentFromClass(ctx context.Context, studentID, classID int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `DELETE FROM student_classes WHERE student_id = $1 AND class_id = $2`
-	_, err := r.db.Exec(query, studentID, classID)
+	_, err := r.db.ExecContext(ctx, query, studentID, classID)
 	return err
 }
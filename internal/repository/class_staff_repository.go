@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+)
+
+// ClassStaffRepository - сотрудники классов (таблица class_staff)
+type ClassStaffRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewClassStaffRepository(db *sql.DB, timeouts QueryTimeouts) *ClassStaffRepository {
+	return &ClassStaffRepository{db: db, timeouts: timeouts}
+}
+
+// GetByClass - сотрудники класса, ведущие учителя первыми
+func (r *ClassStaffRepository) GetByClass(ctx context.Context, classID int) ([]*entity.ClassStaff, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT cs.class_id, cs.user_id, u.username, u.fullname, cs.role, cs.created_at
+        FROM class_staff cs
+        JOIN users u ON u.id = cs.user_id
+        WHERE cs.class_id = $1 AND u.deleted_at IS NULL
+        ORDER BY CASE cs.role WHEN 'lead' THEN 0 WHEN 'assistant' THEN 1 ELSE 2 END, u.fullname
+    `, classID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var staff []*entity.ClassStaff
+	for rows.Next() {
+		var s entity.ClassStaff
+		if err := rows.Scan(&s.ClassID, &s.UserID, &s.Username, &s.FullName, &s.Role, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		staff = append(staff, &s)
+	}
+
+	return staff, rows.Err()
+}
+
+// Get - участие сотрудника в классе. Если его нет, возвращается sql.ErrNoRows.
+func (r *ClassStaffRepository) Get(ctx context.Context, classID, userID int) (*entity.ClassStaff, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	var s entity.ClassStaff
+	err := r.db.QueryRowContext(ctx, `
+        SELECT cs.class_id, cs.user_id, u.username, u.fullname, cs.role, cs.created_at
+        FROM class_staff cs
+        JOIN users u ON u.id = cs.user_id
+        WHERE cs.class_id = $1 AND cs.user_id = $2 AND u.deleted_at IS NULL
+    `, classID, userID).Scan(&s.ClassID, &s.UserID, &s.Username, &s.FullName, &s.Role, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Set добавляет сотрудника в класс или меняет его роль
+func (r *ClassStaffRepository) Set(ctx context.Context, classID, userID int, role string) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO class_staff (class_id, user_id, role) VALUES ($1, $2, $3)
+        ON CONFLICT (class_id, user_id) DO UPDATE SET role = EXCLUDED.role
+    `, classID, userID, role)
+	return err
+}
+
+// Remove исключает сотрудника из класса. Возвращает false, если его там не было.
+func (r *ClassStaffRepository) Remove(ctx context.Context, classID, userID int) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM class_staff WHERE class_id = $1 AND user_id = $2`, classID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
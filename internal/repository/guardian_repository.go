@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrGuardianCodeInvalid - код привязки не найден, уже использован, заменен или истек
+var ErrGuardianCodeInvalid = errors.New("код привязки недействителен")
+
+// ErrAlreadyLinked - ученик уже привязан к этому родителю
+var ErrAlreadyLinked = errors.New("ученик уже привязан")
+
+// GuardianRepository - привязка родителей к ученикам по кодам от учителя
+// и еженедельные сводки для родителей.
+// Коды используют тот же алфавит и хеширование, что и коды сброса пароля.
+type GuardianRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewGuardianRepository(db *sql.DB, timeouts QueryTimeouts) *GuardianRepository {
+	return &GuardianRepository{db: db, timeouts: timeouts}
+}
+
+// IssueCode выдает новый код привязки для ученика. Ранее выданные неиспользованные коды отзываются.
+func (r *GuardianRepository) IssueCode(ctx context.Context, studentID, issuedBy int, ttl time.Duration) (string, *entity.GuardianCode, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	code, err := generateResetCode()
+	if err != nil {
+		return "", nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE guardian_codes SET revoked_at = $2
+        WHERE student_id = $1 AND used_at IS NULL AND revoked_at IS NULL
+    `, studentID, now)
+	if err != nil {
+		return "", nil, err
+	}
+
+	guardianCode := &entity.GuardianCode{
+		StudentID: studentID,
+		IssuedBy:  issuedBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO guardian_codes (student_id, code_hash, issued_by, created_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id
+    `, studentID, hashResetCode(code), issuedBy, now, guardianCode.ExpiresAt).Scan(&guardianCode.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", nil, err
+	}
+
+	return code, guardianCode, nil
+}
+
+// redeemGuardianCode погашает код в транзакции и возвращает ID ученика
+func redeemGuardianCode(ctx context.Context, tx *sql.Tx, code string, parentID int, now time.Time) (int, error) {
+	var codeID, studentID int
+	err := tx.QueryRowContext(ctx, `
+        SELECT id, student_id FROM guardian_codes
+        WHERE code_hash = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $2
+          AND student_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+        FOR UPDATE
+    `, hashResetCode(code), now).Scan(&codeID, &studentID)
+	if err == sql.ErrNoRows {
+		return 0, ErrGuardianCodeInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE guardian_codes SET used_at = $2, used_by = $3 WHERE id = $1`, codeID, now, parentID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+        INSERT INTO guardians (parent_id, student_id, created_at) VALUES ($1, $2, $3)
+        ON CONFLICT (parent_id, student_id) DO NOTHING
+    `, parentID, studentID, now)
+	if err != nil {
+		return 0, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if affected == 0 {
+		return 0, ErrAlreadyLinked
+	}
+
+	return studentID, nil
+}
+
+// RegisterParent создает учетную запись родителя и сразу привязывает ученика по коду.
+// Возвращает ID родителя и ID ученика.
+func (r *GuardianRepository) RegisterParent(ctx context.Context, code, username, password, fullName string) (int, int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var parentID int
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO users (username, password_hash, role_id, fullname)
+        VALUES ($1, $2, (SELECT id FROM roles WHERE name = 'parent'), $3)
+        RETURNING id
+    `, username, string(hashedPassword), fullName).Scan(&parentID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	studentID, err := redeemGuardianCode(ctx, tx, code, parentID, time.Now())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return parentID, studentID, tx.Commit()
+}
+
+// LinkByCode привязывает к существующему родителю еще одного ученика. Возвращает ID ученика.
+func (r *GuardianRepository) LinkByCode(ctx context.Context, parentID int, code string) (int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	studentID, err := redeemGuardianCode(ctx, tx, code, parentID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return studentID, tx.Commit()
+}
+
+// GetChildren - дети родителя с названием класса
+func (r *GuardianRepository) GetChildren(ctx context.Context, parentID int) ([]*entity.Child, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT u.id, u.fullname,
+               COALESCE((SELECT c.name FROM student_classes sc
+                         JOIN classes c ON c.id = sc.class_id
+                         WHERE sc.student_id = u.id AND c.deleted_at IS NULL
+                         ORDER BY c.grade DESC LIMIT 1), ''),
+               g.weekly_summary, g.created_at
+        FROM guardians g
+        JOIN users u ON u.id = g.student_id
+        WHERE g.parent_id = $1 AND NOT u.pending AND u.deleted_at IS NULL
+        ORDER BY u.fullname
+    `, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var children []*entity.Child
+	for rows.Next() {
+		var c entity.Child
+		if err := rows.Scan(&c.ID, &c.FullName, &c.ClassName, &c.WeeklySummary, &c.LinkedAt); err != nil {
+			return nil, err
+		}
+		children = append(children, &c)
+	}
+
+	return children, rows.Err()
+}
+
+// SetWeeklySummary включает или выключает еженедельную сводку по ребенку.
+// Возвращает false, если ученик не привязан к родителю.
+func (r *GuardianRepository) SetWeeklySummary(ctx context.Context, parentID, studentID int, enabled bool) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+        UPDATE guardians SET weekly_summary = $3 WHERE parent_id = $1 AND student_id = $2
+    `, parentID, studentID, enabled)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GenerateWeeklySummaries подводит итоги прошедшей недели для всех подписанных родителей.
+// Сессия считается так же, как в недельной сетке учителя: 10 примеров в течение одного часа.
+// Уже созданные сводки не меняются, поэтому метод можно вызывать повторно.
+func (r *GuardianRepository) GenerateWeeklySummaries(ctx context.Context) (int64, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	monday := getMondayOfWeek(time.Now())
+	weekEnd := time.Date(monday.Year(), monday.Month(), monday.Day(), 0, 0, 0, 0, time.UTC)
+	weekStart := weekEnd.AddDate(0, 0, -7)
+
+	result, err := r.db.ExecContext(ctx, `
+        WITH sessions AS (
+            SELECT a.user_id,
+                   COUNT(*) AS total,
+                   SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END) AS correct
+            FROM attempts a
+            WHERE a.created_at >= $1::date AND a.created_at < $2::date
+              AND a.user_id IN (SELECT student_id FROM guardians WHERE weekly_summary)
+            GROUP BY a.user_id, DATE(a.created_at), EXTRACT(HOUR FROM a.created_at)
+            HAVING COUNT(*) = 10
+        )
+        INSERT INTO weekly_summaries (parent_id, student_id, week_start, sessions, perfect_sessions, correct, total)
+        SELECT g.parent_id, g.student_id, $1::date,
+               COUNT(s.user_id),
+               COUNT(*) FILTER (WHERE s.correct = 10),
+               COALESCE(SUM(s.correct), 0),
+               COALESCE(SUM(s.total), 0)
+        FROM guardians g
+        LEFT JOIN sessions s ON s.user_id = g.student_id
+        WHERE g.weekly_summary
+          AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id IN (g.parent_id, g.student_id) AND u.deleted_at IS NOT NULL)
+        GROUP BY g.parent_id, g.student_id
+        ON CONFLICT (parent_id, student_id, week_start) DO NOTHING
+    `, weekStart.Format("2006-01-02"), weekEnd.Format("2006-01-02"))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetSummaries - последние еженедельные сводки родителя по всем детям
+func (r *GuardianRepository) GetSummaries(ctx context.Context, parentID, limit int) ([]*entity.WeeklySummary, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT w.student_id, u.fullname, w.week_start, w.sessions, w.perfect_sessions, w.correct, w.total
+        FROM weekly_summaries w
+        JOIN users u ON u.id = w.student_id
+        JOIN guardians g ON g.parent_id = w.parent_id AND g.student_id = w.student_id
+        WHERE w.parent_id = $1 AND u.deleted_at IS NULL
+        ORDER BY w.week_start DESC, u.fullname
+        LIMIT $2
+    `, parentID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*entity.WeeklySummary
+	for rows.Next() {
+		var s entity.WeeklySummary
+		if err := rows.Scan(
+			&s.StudentID, &s.StudentName, &s.WeekStart, &s.Sessions, &s.PerfectSessions, &s.Correct, &s.Total,
+		); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &s)
+	}
+
+	return summaries, rows.Err()
+}
@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"edugame/internal/entity"
+	"edugame/internal/generator"
+	"time"
+)
+
+// Интерфейсы репозиториев, от которых зависят обработчики и middleware.
+// Реализации на PostgreSQL - типы *Repository этого пакета,
+// реализация в памяти для тестов - пакет repository/memory.
+
+// Users - учетные записи, вход по паролю и по картинкам, блокировки
+type Users interface {
+	Register(ctx context.Context, username, password, roleName, fullName string, classID *int) (*entity.User, error)
+	RegisterStudentRequest(ctx context.Context, username, password, fullName string, classID int) (*entity.User, error)
+	Login(ctx context.Context, username, password string) (*entity.User, error)
+	RegisterFailedLogin(ctx context.Context, username string, threshold int, lockFor time.Duration) (bool, error)
+	ResetFailedLogins(ctx context.Context, userID int) error
+	Block(ctx context.Context, userID int, reason string, blockedBy int) error
+	Unblock(ctx context.Context, userID int) error
+	SetPicturePassword(ctx context.Context, userID int, secret string) error
+	LoginByPicturePassword(ctx context.Context, classID, userID int, secret string) (*entity.User, error)
+	GetByID(ctx context.Context, id int) (*entity.User, error)
+	GetAllUsers(ctx context.Context) ([]entity.User, error)
+	GetUserByRoleType(ctx context.Context, roleName string) ([]entity.User, error)
+	GetUsersWithPermission(ctx context.Context, permission string) ([]entity.User, error)
+	UpdateUser(ctx context.Context, id int, username, fullName, email string, roleID int, schoolID *int) (*entity.User, error)
+	DeleteUser(ctx context.Context, id int) error
+	GetStudentClass(ctx context.Context, studentID int) (int, error)
+}
+
+// Types - типы уравнений с диапазонами операндов
+type Types interface {
+	GetAll(ctx context.Context) ([]generator.EquationType, error)
+	GetListTypes(ctx context.Context, class int) ([]generator.EquationType, error)
+	GetTypeById(ctx context.Context, id int) (generator.EquationType, error)
+	Create(ctx context.Context, et generator.EquationType) (*generator.EquationType, error)
+	Update(ctx context.Context, et generator.EquationType) (*generator.EquationType, error)
+	Delete(ctx context.Context, id int) error
+	ToggleAvailability(ctx context.Context, id int) error
+}
+
+// Progress - прогресс ученика по типам уравнений
+type Progress interface {
+	GetUserAllProgress(ctx context.Context, userId int) ([]entity.UserProgress, error)
+	GetUserTypeStatistics(ctx context.Context, userID int) (map[int]TypeStat, error)
+}
+
+// Attempts - попытки решения примеров
+type Attempts interface {
+	SaveAttempt(ctx context.Context, attempt entity.Attempt) error
+}
+
+// Teachers - классы и ученики глазами учителя: коды класса, заявки, статистика.
+// Доступ к конкретным ученикам - только через области ForTeacher, ForSchool и ForParent.
+type Teachers interface {
+	GetClassStudents(ctx context.Context, classID int) ([]ClassStudent, error)
+	GetClassLoginCode(ctx context.Context, classID int) (string, error)
+	RotateClassLoginCode(ctx context.Context, classID int) (string, error)
+	GetClassByLoginCode(ctx context.Context, code string) (ClassRef, error)
+	GetClassJoinCode(ctx context.Context, classID int) (string, error)
+	RotateClassJoinCode(ctx context.Context, classID int) (string, error)
+	GetClassByJoinCode(ctx context.Context, code string) (ClassRef, error)
+	GetPendingStudents(ctx context.Context, classID int) ([]PendingStudent, error)
+	ApproveStudent(ctx context.Context, classID, studentID int) (bool, error)
+	RejectStudent(ctx context.Context, classID, studentID int) (bool, error)
+	UnlockStudent(ctx context.Context, classID, studentID int) (bool, error)
+	GetClassStatistics(ctx context.Context, classID int) (map[string]interface{}, error)
+	GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error)
+	GetDailyClassResults(ctx context.Context, classID int, weeksOffset int) (*DailyClassResults, error)
+
+	ForTeacher(teacherID int) TeacherScope
+	ForSchool(schoolID *int) SchoolScope
+	ForParent(parentID int) ParentScope
+}
+
+// TeacherScope - доступ учителя только к классам, в состав которых он входит
+type TeacherScope interface {
+	GetClasses(ctx context.Context) ([]*entity.Class, error)
+	GetClass(ctx context.Context, classID int) (*entity.Class, error)
+	GetClassSummaries(ctx context.Context) ([]*ClassSummary, error)
+	CheckStudent(ctx context.Context, studentID int) error
+	CheckStudentManage(ctx context.Context, studentID int) error
+	GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error)
+	GetStudentAttemptsByType(ctx context.Context, studentID, typeID int) ([]map[string]interface{}, error)
+}
+
+// SchoolScope - доступ директора только к классам и ученикам своей школы
+type SchoolScope interface {
+	GetAllClasses(ctx context.Context) ([]*entity.Class, error)
+	GetClassesStatistics(ctx context.Context) (map[int]map[string]interface{}, error)
+	CheckClass(ctx context.Context, classID int) error
+	CheckStudent(ctx context.Context, studentID int) error
+	GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error)
+	GetStudentAttemptsByType(ctx context.Context, studentID, typeID int) ([]map[string]interface{}, error)
+}
+
+// ParentScope - доступ родителя только к привязанным детям, только на чтение
+type ParentScope interface {
+	CheckStudent(ctx context.Context, studentID int) error
+	GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error)
+	GetStudentWeeklyResults(ctx context.Context, studentID, weeksOffset int) (*DailyClassResults, error)
+}
+
+// Sessions - серверные сессии пользователей
+type Sessions interface {
+	Create(ctx context.Context, userID int, userAgent, ipAddress string, ttl time.Duration) (string, error)
+	Touch(ctx context.Context, token string, ttl, touchEvery time.Duration) (userID int, refreshed bool, err error)
+	GetUserSessions(ctx context.Context, userID int, currentToken string) ([]*entity.UserSession, error)
+	Delete(ctx context.Context, token string) error
+	DeleteUserSession(ctx context.Context, userID, sessionID int) (bool, error)
+	DeleteUserSessions(ctx context.Context, userID int, exceptToken string) (int64, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// LoginThrottles - счетчики неудачных попыток входа по ключам
+type LoginThrottles interface {
+	RetryAfter(ctx context.Context, keys ...string) (time.Duration, error)
+	RegisterFailure(ctx context.Context, key string, policy ThrottlePolicy) error
+	Reserve(ctx context.Context, key string, policy ThrottlePolicy) (time.Duration, error)
+	Release(ctx context.Context, key string, policy ThrottlePolicy) error
+	Reset(ctx context.Context, key string) error
+}
+
+// PasswordResets - одноразовые коды сброса пароля
+type PasswordResets interface {
+	Issue(ctx context.Context, studentID, issuedBy int, ttl time.Duration) (string, *entity.PasswordResetCode, error)
+	Redeem(ctx context.Context, code, newPassword, ipAddress string) (int, error)
+	GetClassResetCodes(ctx context.Context, classID int, limit int) ([]*entity.PasswordResetCode, error)
+}
+
+// Invites - приглашения сотрудников
+type Invites interface {
+	Create(ctx context.Context, roleID int, schoolID *int, note string, createdBy int, ttl time.Duration) (string, error)
+	GetValid(ctx context.Context, token string) (*entity.StaffInvite, error)
+	Accept(ctx context.Context, token, username, password, fullName string) (int, error)
+	GetAll(ctx context.Context, limit int) ([]*entity.StaffInvite, error)
+	Revoke(ctx context.Context, id int) error
+}
+
+// Quizzes - выданные наборы примеров и состояние ответов на них.
+// Методы с userID находят только наборы этого ученика.
+type Quizzes interface {
+	CreateQuiz(ctx context.Context, userID int, items []entity.QuizItem) (int, error)
+	GetItems(ctx context.Context, quizID, userID int) (map[int]entity.QuizItem, error)
+	AnswerItem(ctx context.Context, quizID, userID, itemID int, answer string, maxTries int) (*entity.QuizItem, error)
+	LockItem(ctx context.Context, quizID, userID, itemID int, correct bool) (bool, error)
+}
+
+// OfflineBundles - наборы примеров для решения без сети
+type OfflineBundles interface {
+	CreateBundle(ctx context.Context, userID int, items []entity.OfflineItem, issuedAt, expiresAt time.Time) (*entity.OfflineBundle, error)
+	GetBundle(ctx context.Context, id int) (*entity.OfflineBundle, error)
+	SyncBundle(ctx context.Context, id int, syncedAt time.Time, attempts []entity.Attempt) (bool, error)
+}
+
+// OIDCProviders - провайдеры единого входа и привязанные к ним учетные записи
+type OIDCProviders interface {
+	GetAll(ctx context.Context) ([]entity.OIDCProvider, error)
+	GetEnabled(ctx context.Context) ([]entity.OIDCProvider, error)
+	GetByID(ctx context.Context, id int) (*entity.OIDCProvider, error)
+	GetBySlug(ctx context.Context, slug string) (*entity.OIDCProvider, error)
+	Create(ctx context.Context, p *entity.OIDCProvider) error
+	Update(ctx context.Context, p *entity.OIDCProvider) error
+	Delete(ctx context.Context, id int) error
+	FindIdentity(ctx context.Context, providerID int, subject string) (int, error)
+	LinkIdentity(ctx context.Context, providerID int, subject string, userID int) error
+	TouchIdentity(ctx context.Context, providerID int, subject string) error
+	FindLinkCandidate(ctx context.Context, schoolID int, email string) (userID int, roleName string, err error)
+	Provision(ctx context.Context, provider *entity.OIDCProvider, subject, username, fullName, roleName string) (int, error)
+	SetUserRole(ctx context.Context, userID int, roleName string) (previous string, err error)
+}
+
+// AuditLog - журнал аудита, только добавление и чтение
+type AuditLog interface {
+	Record(ctx context.Context, entry *entity.AuditEntry) error
+	Find(ctx context.Context, filter AuditFilter, limit, offset int) ([]entity.AuditEntry, error)
+	Each(ctx context.Context, filter AuditFilter, fn func(entity.AuditEntry) error) error
+	Count(ctx context.Context, filter AuditFilter) (int, error)
+}
+
+// Permissions - справочник прав и права пользователей
+type Permissions interface {
+	GetAll(ctx context.Context) ([]entity.Permission, error)
+	GetUserPermissions(ctx context.Context, userID int) ([]string, error)
+}
+
+// Roles - роли и их права
+type Roles interface {
+	GetAll(ctx context.Context) ([]entity.Role, error)
+	GetByID(ctx context.Context, id int) (*entity.Role, error)
+	Create(ctx context.Context, name, description string, permissions []string) (*entity.Role, error)
+	Update(ctx context.Context, id int, description string, permissions []string) error
+	Delete(ctx context.Context, id int) error
+}
+
+// Schools - школы
+type Schools interface {
+	GetAll(ctx context.Context) ([]entity.School, error)
+	GetByID(ctx context.Context, id int) (*entity.School, error)
+	Create(ctx context.Context, name, address, phone, email string) (*entity.School, error)
+	Update(ctx context.Context, id int, name, address, phone, email string) (*entity.School, error)
+	Delete(ctx context.Context, id int) error
+}
+
+// Classes - классы для админки
+type Classes interface {
+	GetAll(ctx context.Context) ([]entity.Class, error)
+	GetByID(ctx context.Context, id int) (*entity.Class, error)
+	Create(ctx context.Context, name string, grade, teacherID int, schoolID *int) (*entity.Class, error)
+	Update(ctx context.Context, id int, name string, grade, teacherID int, schoolID *int) (*entity.Class, error)
+	Delete(ctx context.Context, id int) error
+}
+
+// ClassStaff - состав сотрудников классов
+type ClassStaff interface {
+	GetByClass(ctx context.Context, classID int) ([]*entity.ClassStaff, error)
+	Get(ctx context.Context, classID, userID int) (*entity.ClassStaff, error)
+	Set(ctx context.Context, classID, userID int, role string) error
+	Remove(ctx context.Context, classID, userID int) (bool, error)
+}
+
+// Guardians - привязка родителей к ученикам и еженедельные сводки
+type Guardians interface {
+	IssueCode(ctx context.Context, studentID, issuedBy int, ttl time.Duration) (string, *entity.GuardianCode, error)
+	RegisterParent(ctx context.Context, code, username, password, fullName string) (int, int, error)
+	LinkByCode(ctx context.Context, parentID int, code string) (int, error)
+	GetChildren(ctx context.Context, parentID int) ([]*entity.Child, error)
+	SetWeeklySummary(ctx context.Context, parentID, studentID int, enabled bool) (bool, error)
+	GenerateWeeklySummaries(ctx context.Context) (int64, error)
+	GetSummaries(ctx context.Context, parentID, limit int) ([]*entity.WeeklySummary, error)
+}
+
+// Trash - корзина удаленных школ, классов, пользователей и типов уравнений
+type Trash interface {
+	GetItems(ctx context.Context) ([]entity.TrashItem, error)
+	Restore(ctx context.Context, kind string, id int) error
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+}
+
+// AcademicYears - учебные годы, переход на новый год и архив закрытых лет
+type AcademicYears interface {
+	GetAll(ctx context.Context) ([]entity.AcademicYear, error)
+	GetCurrent(ctx context.Context) (*entity.AcademicYear, error)
+	GetByID(ctx context.Context, id int) (*entity.AcademicYear, error)
+	GetClassSnapshots(ctx context.Context, yearID int) ([]entity.YearClassSnapshot, error)
+	GetStudentSnapshots(ctx context.Context, yearID, classID int) ([]entity.YearStudentSnapshot, error)
+	GetRolloverClasses(ctx context.Context) ([]RolloverClass, error)
+	Rollover(ctx context.Context, plan RolloverPlan) (*RolloverResult, error)
+}
+
+// StudentData - выгрузка и удаление персональных данных ученика по запросу родителей
+type StudentData interface {
+	Export(ctx context.Context, studentID int) (*entity.StudentDataExport, error)
+	Erase(ctx context.Context, studentID, erasedBy int) (*ErasureResult, error)
+}
+
+var (
+	_ Users          = (*UserRepository)(nil)
+	_ Types          = (*TypeRepository)(nil)
+	_ Progress       = (*UserProgressRepository)(nil)
+	_ Attempts       = (*AttemptRepository)(nil)
+	_ Teachers       = (*TeacherRepository)(nil)
+	_ Sessions       = (*SessionRepository)(nil)
+	_ LoginThrottles = (*LoginThrottleRepository)(nil)
+	_ PasswordResets = (*PasswordResetRepository)(nil)
+	_ Invites        = (*InviteRepository)(nil)
+	_ Quizzes        = (*QuizRepository)(nil)
+	_ OfflineBundles = (*OfflineRepository)(nil)
+	_ OIDCProviders  = (*OIDCRepository)(nil)
+	_ AuditLog       = (*AuditRepository)(nil)
+	_ Permissions    = (*PermissionRepository)(nil)
+	_ Roles          = (*RoleRepository)(nil)
+	_ Schools        = (*SchoolRepository)(nil)
+	_ Classes        = (*ClassRepository)(nil)
+	_ ClassStaff     = (*ClassStaffRepository)(nil)
+	_ Guardians      = (*GuardianRepository)(nil)
+	_ Trash          = (*TrashRepository)(nil)
+	_ AcademicYears  = (*AcademicYearRepository)(nil)
+	_ StudentData    = (*StudentDataRepository)(nil)
+)
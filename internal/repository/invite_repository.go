@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInviteInvalid - приглашение не найдено, уже использовано, отозвано или истекло
+var ErrInviteInvalid = errors.New("приглашение недействительно")
+
+// InviteRepository - приглашения сотрудников. Учетные записи учителей и
+// администрации создаются только по ним, самостоятельная регистрация - только для учеников.
+type InviteRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewInviteRepository(db *sql.DB, timeouts QueryTimeouts) *InviteRepository {
+	return &InviteRepository{db: db, timeouts: timeouts}
+}
+
+// Create выдает приглашение и возвращает токен для ссылки
+func (r *InviteRepository) Create(ctx context.Context, roleID int, schoolID *int, note string, createdBy int, ttl time.Duration) (string, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	_, err = r.db.ExecContext(ctx, `
+        INSERT INTO staff_invites (token_hash, role_id, school_id, note, created_by, created_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, hashToken(token), roleID, schoolID, note, createdBy, now, now.Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetValid возвращает действующее приглашение по токену
+func (r *InviteRepository) GetValid(ctx context.Context, token string) (*entity.StaffInvite, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	invite, err := r.scanInvite(r.db.QueryRowContext(ctx, `
+        SELECT i.id, i.role_id, ro.name, i.school_id, i.note, i.created_by,
+               i.created_at, i.expires_at, i.used_at, i.used_by, i.revoked_at
+        FROM staff_invites i
+        JOIN roles ro ON ro.id = i.role_id
+        WHERE i.token_hash = $1 AND i.used_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > $2
+          AND (i.school_id IS NULL OR i.school_id IN (SELECT id FROM schools WHERE deleted_at IS NULL))
+    `, hashToken(token), time.Now()))
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteInvalid
+	}
+
+	return invite, err
+}
+
+// Accept создает учетную запись по приглашению и погашает его
+func (r *InviteRepository) Accept(ctx context.Context, token, username, password, fullName string) (int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var inviteID, roleID int
+	var schoolID sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+        SELECT id, role_id, school_id FROM staff_invites
+        WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $2
+          AND (school_id IS NULL OR school_id IN (SELECT id FROM schools WHERE deleted_at IS NULL))
+        FOR UPDATE
+    `, hashToken(token), now).Scan(&inviteID, &roleID, &schoolID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInviteInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO users (username, password_hash, role_id, fullname, school_id)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id
+    `, username, string(hashedPassword), roleID, fullName, schoolID).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE staff_invites SET used_at = $2, used_by = $3 WHERE id = $1`, inviteID, now, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// GetAll - последние приглашения для админки
+func (r *InviteRepository) GetAll(ctx context.Context, limit int) ([]*entity.StaffInvite, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT i.id, i.role_id, ro.name, i.school_id, i.note, i.created_by,
+               i.created_at, i.expires_at, i.used_at, i.used_by, i.revoked_at
+        FROM staff_invites i
+        JOIN roles ro ON ro.id = i.role_id
+        ORDER BY i.created_at DESC
+        LIMIT $1
+    `, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []*entity.StaffInvite
+	for rows.Next() {
+		invite, err := r.scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, rows.Err()
+}
+
+// Revoke отзывает неиспользованное приглашение
+func (r *InviteRepository) Revoke(ctx context.Context, id int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE staff_invites SET revoked_at = $2 WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+    `, id, time.Now())
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (r *InviteRepository) scanInvite(row rowScanner) (*entity.StaffInvite, error) {
+	var invite entity.StaffInvite
+	var schoolID, createdBy, usedBy sql.NullInt64
+	var usedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&invite.ID, &invite.RoleID, &invite.RoleName, &schoolID, &invite.Note, &createdBy,
+		&invite.CreatedAt, &invite.ExpiresAt, &usedAt, &usedBy, &revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if schoolID.Valid {
+		id := int(schoolID.Int64)
+		invite.SchoolID = &id
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		invite.CreatedBy = &id
+	}
+	if usedBy.Valid {
+		id := int(usedBy.Int64)
+		invite.UsedBy = &id
+	}
+	if usedAt.Valid {
+		invite.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		invite.RevokedAt = &revokedAt.Time
+	}
+
+	return &invite, nil
+}
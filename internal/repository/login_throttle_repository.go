@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoginThrottleUserKey - ключ счетчика ошибок для имени пользователя
+func LoginThrottleUserKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+// LoginThrottleIPKey - ключ счетчика ошибок для IP-адреса
+func LoginThrottleIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginThrottlePictureKey - ключ счетчика ошибок входа по картинкам для ученика
+func LoginThrottlePictureKey(userID int) string {
+	return "picture:" + strconv.Itoa(userID)
+}
+
+// LoginThrottleRepository хранит счетчики неудачных входов по ключам
+// (имя пользователя, IP-адрес) в БД, чтобы ограничения действовали
+// на всех экземплярах приложения и переживали перезапуск.
+type LoginThrottleRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewLoginThrottleRepository(db *sql.DB, timeouts QueryTimeouts) *LoginThrottleRepository {
+	return &LoginThrottleRepository{db: db, timeouts: timeouts}
+}
+
+// ThrottlePolicy - правила экспоненциальной задержки для одного вида ключей
+type ThrottlePolicy struct {
+	FreeAttempts int           // сколько ошибок допускается без задержки
+	BaseDelay    time.Duration // задержка после первой "платной" ошибки
+	MaxDelay     time.Duration // верхняя граница задержки
+	Window       time.Duration // через сколько без ошибок счетчик обнуляется
+}
+
+// Delay возвращает задержку после failures неудачных попыток
+func (p ThrottlePolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	return delay
+}
+
+// RetryAfter возвращает, сколько еще нужно ждать до следующей попытки входа
+// по самому строгому из переданных ключей
+func (r *LoginThrottleRepository) RetryAfter(ctx context.Context, keys ...string) (time.Duration, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	var wait time.Duration
+
+	for _, key := range keys {
+		var blockedUntil sql.NullTime
+		err := r.db.QueryRowContext(ctx, `
+			SELECT blocked_until FROM login_throttles WHERE throttle_key = $1
+		`, key).Scan(&blockedUntil)
+
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if blockedUntil.Valid {
+			if d := time.Until(blockedUntil.Time); d > wait {
+				wait = d
+			}
+		}
+	}
+
+	return wait, nil
+}
+
+// Счетчик после еще одной ошибки: ошибки старше окна политики ($6 секунд) не учитываются
+const throttleFailuresAfter = `CASE WHEN login_throttles.last_failure_at > $2 - make_interval(secs => $6)
+	THEN login_throttles.failures + 1 ELSE 1 END`
+
+// throttleBlockedUntil - конец задержки для счетчика failures, тот же расчет, что в ThrottlePolicy.Delay.
+// Показатель степени ограничен, чтобы при тысячах ошибок с одного IP не было переполнения.
+func throttleBlockedUntil(failures string) string {
+	return `CASE WHEN ` + failures + ` > $3
+		THEN $2 + make_interval(secs => LEAST($4 * power(2, LEAST(` + failures + ` - $3 - 1, 30)), $5)) END`
+}
+
+// throttleUpsert увеличивает счетчик одним оператором: строка ключа блокируется
+// на время обновления, поэтому параллельные ошибки не теряются даже для нового ключа
+var throttleUpsert = `
+	INSERT INTO login_throttles (throttle_key, failures, last_failure_at, blocked_until)
+	VALUES ($1, 1, $2, ` + throttleBlockedUntil("1") + `)
+	ON CONFLICT (throttle_key) DO UPDATE
+	SET failures = ` + throttleFailuresAfter + `,
+		last_failure_at = $2,
+		blocked_until = ` + throttleBlockedUntil(throttleFailuresAfter)
+
+func throttleArgs(key string, now time.Time, policy ThrottlePolicy) []interface{} {
+	return []interface{}{key, now, policy.FreeAttempts, policy.BaseDelay.Seconds(),
+		policy.MaxDelay.Seconds(), policy.Window.Seconds()}
+}
+
+// RegisterFailure увеличивает счетчик ошибок по ключу и назначает задержку
+func (r *LoginThrottleRepository) RegisterFailure(ctx context.Context, key string, policy ThrottlePolicy) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, throttleUpsert, throttleArgs(key, time.Now(), policy)...)
+	return err
+}
+
+// Reserve засчитывает попытку входа по ключу как ошибку еще до проверки пароля.
+// Если ключ сейчас под задержкой, попытка не засчитывается и возвращается время ожидания.
+// Проверка и увеличение счетчика выполняются одним оператором, поэтому из пачки
+// параллельных попыток задержку обходят не больше, чем позволяет политика.
+func (r *LoginThrottleRepository) Reserve(ctx context.Context, key string, policy ThrottlePolicy) (time.Duration, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	now := time.Now()
+
+	var failures int
+	err := r.db.QueryRowContext(ctx, throttleUpsert+`
+		WHERE login_throttles.blocked_until IS NULL OR login_throttles.blocked_until <= $2
+		RETURNING failures
+	`, throttleArgs(key, now, policy)...).Scan(&failures)
+	if err == nil {
+		return 0, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	var blockedUntil time.Time
+	err = r.db.QueryRowContext(ctx, `
+		SELECT blocked_until FROM login_throttles WHERE throttle_key = $1
+	`, key).Scan(&blockedUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	// Задержка могла закончиться между двумя запросами - ждать все равно не меньше секунды
+	if wait := blockedUntil.Sub(now); wait > time.Second {
+		return wait, nil
+	}
+	return time.Second, nil
+}
+
+// Release возвращает попытку, засчитанную Reserve, если вход оказался успешным
+// или не дошел до проверки пароля. Задержка снимается, если без этой попытки
+// ошибок остается не больше бесплатных.
+func (r *LoginThrottleRepository) Release(ctx context.Context, key string, policy ThrottlePolicy) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE login_throttles
+		SET failures = GREATEST(failures - 1, 0),
+			blocked_until = CASE WHEN failures - 1 > $2 THEN blocked_until END
+		WHERE throttle_key = $1
+	`, key, policy.FreeAttempts)
+	return err
+}
+
+// Reset сбрасывает счетчик ошибок по ключу
+func (r *LoginThrottleRepository) Reset(ctx context.Context, key string) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_throttles WHERE throttle_key = $1`, key)
+	return err
+}
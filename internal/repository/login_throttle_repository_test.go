@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Попытка засчитывается одним INSERT ... ON CONFLICT без транзакции и SELECT FOR UPDATE:
+// для нового ключа блокировать было бы нечего, и параллельные ошибки терялись бы
+func TestReserveCountsAttemptInOneStatement(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	policy := ThrottlePolicy{FreeAttempts: 3, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, Window: time.Hour}
+	upsert := `INSERT INTO login_throttles .+ ON CONFLICT \(throttle_key\) DO UPDATE\s+` +
+		`SET failures = CASE WHEN .+ THEN login_throttles.failures \+ 1 ELSE 1 END.+` +
+		`WHERE login_throttles.blocked_until IS NULL OR login_throttles.blocked_until <= \$2\s+RETURNING failures`
+
+	mock.ExpectQuery(upsert).
+		WithArgs("user:petya", sqlmock.AnyArg(), 3, 2.0, 60.0, 3600.0).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+
+	// Ключ под задержкой: строка не обновлена, возвращается остаток ожидания
+	mock.ExpectQuery(upsert).
+		WithArgs("user:petya", sqlmock.AnyArg(), 3, 2.0, 60.0, 3600.0).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}))
+	mock.ExpectQuery(`SELECT blocked_until FROM login_throttles WHERE throttle_key = \$1`).
+		WithArgs("user:petya").
+		WillReturnRows(sqlmock.NewRows([]string{"blocked_until"}).AddRow(time.Now().Add(time.Minute)))
+
+	repo := NewLoginThrottleRepository(db, QueryTimeouts{})
+	if wait, err := repo.Reserve(context.Background(), "user:petya", policy); err != nil || wait != 0 {
+		t.Fatalf("first Reserve = %v, %v", wait, err)
+	}
+	if wait, err := repo.Reserve(context.Background(), "user:petya", policy); err != nil || wait < 50*time.Second {
+		t.Fatalf("blocked Reserve = %v, %v, want about a minute", wait, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,336 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"sort"
+	"time"
+)
+
+type schoolRepo struct{ s *Store }
+
+func (r *schoolRepo) GetAll(ctx context.Context) ([]entity.School, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var schools []entity.School
+	for _, school := range r.s.schools {
+		schools = append(schools, *school)
+	}
+	sort.SliceStable(schools, func(i, j int) bool {
+		if schools[i].Name != schools[j].Name {
+			return schools[i].Name < schools[j].Name
+		}
+		return schools[i].ID < schools[j].ID
+	})
+
+	return schools, nil
+}
+
+func (r *schoolRepo) GetByID(ctx context.Context, id int) (*entity.School, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	school, ok := r.s.schools[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	out := *school
+	return &out, nil
+}
+
+func (r *schoolRepo) Create(ctx context.Context, name, address, phone, email string) (*entity.School, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	school := &entity.School{
+		ID:        r.s.next("schools"),
+		Name:      name,
+		Address:   address,
+		Phone:     phone,
+		Email:     email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.s.schools[school.ID] = school
+
+	out := *school
+	return &out, nil
+}
+
+func (r *schoolRepo) Update(ctx context.Context, id int, name, address, phone, email string) (*entity.School, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	school, ok := r.s.schools[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	school.Name = name
+	school.Address = address
+	school.Phone = phone
+	school.Email = email
+	school.UpdatedAt = time.Now()
+
+	out := *school
+	return &out, nil
+}
+
+// Delete переносит школу в корзину вместе с ее классами и пользователями
+func (r *schoolRepo) Delete(ctx context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.trashSchool(id, time.Now())
+	return nil
+}
+
+// deleteSchool окончательно удаляет школу с приглашениями и провайдерами входа.
+// Классы и пользователи школы к этому моменту уже удалены.
+func (s *Store) deleteSchool(id int) {
+	delete(s.schools, id)
+
+	invites := s.invites[:0]
+	for _, inv := range s.invites {
+		if inv.SchoolID == nil || *inv.SchoolID != id {
+			invites = append(invites, inv)
+		}
+	}
+	s.invites = invites
+
+	for providerID, p := range s.providers {
+		if p.SchoolID != nil && *p.SchoolID == id {
+			s.deleteProvider(providerID)
+		}
+	}
+}
+
+type classRepo struct{ s *Store }
+
+func (r *classRepo) GetAll(ctx context.Context) ([]entity.Class, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var classes []entity.Class
+	for _, c := range r.s.sortedClasses(nil) {
+		classes = append(classes, publicClass(c))
+	}
+
+	return classes, nil
+}
+
+func (r *classRepo) GetByID(ctx context.Context, id int) (*entity.Class, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c, ok := r.s.classes[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	out := publicClass(c)
+	return &out, nil
+}
+
+// Create создает класс; учитель класса становится его ведущим
+func (r *classRepo) Create(ctx context.Context, name string, grade, teacherID int, schoolID *int) (*entity.Class, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c := &class{Class: entity.Class{
+		ID:        r.s.next("classes"),
+		Name:      name,
+		Grade:     grade,
+		TeacherID: teacherID,
+		SchoolID:  copyInt(schoolID),
+		CreatedAt: time.Now(),
+	}}
+	r.s.classes[c.ID] = c
+
+	r.s.setClassLead(c.ID, 0, teacherID)
+
+	out := publicClass(c)
+	return &out, nil
+}
+
+// Update обновляет класс; прежний учитель исключается из состава, новый становится ведущим
+func (r *classRepo) Update(ctx context.Context, id int, name string, grade, teacherID int, schoolID *int) (*entity.Class, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c, ok := r.s.classes[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	oldTeacherID := c.TeacherID
+	c.Name = name
+	c.Grade = grade
+	c.TeacherID = teacherID
+	c.SchoolID = copyInt(schoolID)
+
+	r.s.setClassLead(id, oldTeacherID, teacherID)
+
+	out := publicClass(c)
+	return &out, nil
+}
+
+func (r *classRepo) Delete(ctx context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.trashClass(id, time.Now())
+	return nil
+}
+
+// setClassLead синхронизирует состав класса с его учителем, как setClassLead в PostgreSQL-реализации
+func (s *Store) setClassLead(classID, oldTeacherID, teacherID int) {
+	if oldTeacherID > 0 && oldTeacherID != teacherID {
+		s.removeStaff(classID, oldTeacherID)
+	}
+	if teacherID > 0 {
+		s.setStaff(classID, teacherID, entity.StaffRoleLead)
+	}
+}
+
+// deleteClass удаляет класс с каскадом по student_classes и class_staff
+func (s *Store) deleteClass(id int) {
+	delete(s.classes, id)
+
+	kept := s.studentClasses[:0]
+	for _, sc := range s.studentClasses {
+		if sc[1] != id {
+			kept = append(kept, sc)
+		}
+	}
+	s.studentClasses = kept
+
+	staff := s.staff[:0]
+	for _, m := range s.staff {
+		if m.ClassID != id {
+			staff = append(staff, m)
+		}
+	}
+	s.staff = staff
+}
+
+// sortedClasses - классы школы (nil - все), по параллели и названию
+func (s *Store) sortedClasses(schoolID *int) []*class {
+	var classes []*class
+	for _, c := range s.classes {
+		if schoolID == nil || (c.SchoolID != nil && *c.SchoolID == *schoolID) {
+			classes = append(classes, c)
+		}
+	}
+	sort.SliceStable(classes, func(i, j int) bool {
+		if classes[i].Grade != classes[j].Grade {
+			return classes[i].Grade < classes[j].Grade
+		}
+		if classes[i].Name != classes[j].Name {
+			return classes[i].Name < classes[j].Name
+		}
+		return classes[i].ID < classes[j].ID
+	})
+	return classes
+}
+
+func publicClass(c *class) entity.Class {
+	out := c.Class
+	out.SchoolID = copyInt(c.SchoolID)
+	out.StaffRole = ""
+	return out
+}
+
+type staffRepo struct{ s *Store }
+
+// staffRoleOrder - порядок ролей в списке сотрудников: ведущие первыми
+var staffRoleOrder = map[string]int{
+	entity.StaffRoleLead:      0,
+	entity.StaffRoleAssistant: 1,
+}
+
+func (r *staffRepo) GetByClass(ctx context.Context, classID int) ([]*entity.ClassStaff, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var staff []*entity.ClassStaff
+	for _, m := range r.s.staff {
+		if m.ClassID != classID {
+			continue
+		}
+		if out := r.s.publicStaff(m); out != nil {
+			staff = append(staff, out)
+		}
+	}
+
+	sort.SliceStable(staff, func(i, j int) bool {
+		oi, ok := staffRoleOrder[staff[i].Role]
+		if !ok {
+			oi = 2
+		}
+		oj, ok := staffRoleOrder[staff[j].Role]
+		if !ok {
+			oj = 2
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		return staff[i].FullName < staff[j].FullName
+	})
+
+	return staff, nil
+}
+
+func (r *staffRepo) Get(ctx context.Context, classID, userID int) (*entity.ClassStaff, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	m := r.s.staffMember(classID, userID)
+	if m == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	out := r.s.publicStaff(m)
+	if out == nil {
+		return nil, sql.ErrNoRows
+	}
+	return out, nil
+}
+
+func (r *staffRepo) Set(ctx context.Context, classID, userID int, role string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.classes[classID]; !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := r.s.users[userID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	r.s.setStaff(classID, userID, role)
+	return nil
+}
+
+func (r *staffRepo) Remove(ctx context.Context, classID, userID int) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.removeStaff(classID, userID), nil
+}
+
+func (s *Store) publicStaff(m *entity.ClassStaff) *entity.ClassStaff {
+	u, ok := s.users[m.UserID]
+	if !ok {
+		return nil
+	}
+
+	out := *m
+	out.Username = u.Username
+	out.FullName = u.FullName
+	return &out
+}
@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"context"
+	"edugame/internal/entity"
+	"edugame/internal/repository"
+	"sort"
+	"time"
+)
+
+type guardianRepo struct{ s *Store }
+
+func (r *guardianRepo) IssueCode(ctx context.Context, studentID, issuedBy int, ttl time.Duration) (string, *entity.GuardianCode, error) {
+	code, err := newCode(resetCodeLength)
+	if err != nil {
+		return "", nil, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+
+	for _, c := range r.s.guardianCodes {
+		if c.StudentID == studentID && c.UsedAt == nil && c.RevokedAt == nil {
+			revokedAt := now
+			c.RevokedAt = &revokedAt
+		}
+	}
+
+	gc := &guardianCode{
+		GuardianCode: entity.GuardianCode{
+			ID:        r.s.next("guardian_codes"),
+			StudentID: studentID,
+			IssuedBy:  issuedBy,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ttl),
+		},
+		code: code,
+	}
+	r.s.guardianCodes = append(r.s.guardianCodes, gc)
+
+	out := gc.GuardianCode
+	return code, &out, nil
+}
+
+func (r *guardianRepo) RegisterParent(ctx context.Context, code, username, password, fullName string) (int, int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// Как в транзакции PostgreSQL: при неверном коде учетная запись не создается
+	gc := r.s.validGuardianCode(code)
+
+	parent, err := r.s.insertUser(username, password, "parent", fullName, nil, false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if gc == nil {
+		r.s.deleteUser(parent.ID)
+		return 0, 0, repository.ErrGuardianCodeInvalid
+	}
+
+	studentID, err := r.s.redeemGuardianCode(gc, parent.ID)
+	if err != nil {
+		r.s.deleteUser(parent.ID)
+		return 0, 0, err
+	}
+
+	return parent.ID, studentID, nil
+}
+
+func (r *guardianRepo) LinkByCode(ctx context.Context, parentID int, code string) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	gc := r.s.validGuardianCode(code)
+	if gc == nil {
+		return 0, repository.ErrGuardianCodeInvalid
+	}
+
+	return r.s.redeemGuardianCode(gc, parentID)
+}
+
+func (s *Store) validGuardianCode(code string) *guardianCode {
+	now := time.Now()
+	for _, c := range s.guardianCodes {
+		if c.code == code && c.UsedAt == nil && c.RevokedAt == nil && c.ExpiresAt.After(now) {
+			return c
+		}
+	}
+	return nil
+}
+
+// redeemGuardianCode погашает код и привязывает ученика; повторная привязка - ErrAlreadyLinked,
+// при этом код остается неиспользованным, как после отката транзакции
+func (s *Store) redeemGuardianCode(gc *guardianCode, parentID int) (int, error) {
+	for _, g := range s.guardians {
+		if g.parentID == parentID && g.studentID == gc.StudentID {
+			return 0, repository.ErrAlreadyLinked
+		}
+	}
+
+	now := time.Now()
+	gc.UsedAt = &now
+	gc.UsedBy = &parentID
+
+	s.guardians = append(s.guardians, &guardian{parentID: parentID, studentID: gc.StudentID, createdAt: now})
+
+	return gc.StudentID, nil
+}
+
+func (r *guardianRepo) GetChildren(ctx context.Context, parentID int) ([]*entity.Child, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var children []*entity.Child
+	for _, g := range r.s.guardians {
+		u, ok := r.s.users[g.studentID]
+		if g.parentID != parentID || !ok || u.pending {
+			continue
+		}
+
+		children = append(children, &entity.Child{
+			ID:            u.ID,
+			FullName:      u.FullName,
+			ClassName:     r.s.childClassName(u.ID),
+			WeeklySummary: g.weeklySummary,
+			LinkedAt:      g.createdAt,
+		})
+	}
+	sort.SliceStable(children, func(i, j int) bool { return children[i].FullName < children[j].FullName })
+
+	return children, nil
+}
+
+// childClassName - класс ученика со старшей параллелью
+func (s *Store) childClassName(studentID int) string {
+	var best *class
+	for _, classID := range s.studentClassIDs(studentID) {
+		if c, ok := s.classes[classID]; ok && (best == nil || c.Grade > best.Grade) {
+			best = c
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.Name
+}
+
+func (r *guardianRepo) SetWeeklySummary(ctx context.Context, parentID, studentID int, enabled bool) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, g := range r.s.guardians {
+		if g.parentID == parentID && g.studentID == studentID {
+			g.weeklySummary = enabled
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *guardianRepo) GenerateWeeklySummaries(ctx context.Context) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	y, m, d := now.AddDate(0, 0, -((int(now.Weekday()) + 6) % 7)).Date()
+	weekEnd := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	weekStart := weekEnd.AddDate(0, 0, -7)
+	weekStartDate := time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day(), 0, 0, 0, 0, time.UTC)
+
+	var created int64
+	for _, g := range r.s.guardians {
+		if !g.weeklySummary || r.s.hasSummary(g.parentID, g.studentID, weekStartDate) {
+			continue
+		}
+
+		sessions, err := r.s.dailySessions(ctx, g.studentID, weekStart, weekEnd.AddDate(0, 0, -1))
+		if err != nil {
+			return created, err
+		}
+
+		summary := &weeklySummary{
+			WeeklySummary: entity.WeeklySummary{StudentID: g.studentID, WeekStart: weekStartDate},
+			parentID:      g.parentID,
+		}
+		for _, day := range sessions {
+			for _, session := range day {
+				summary.Sessions++
+				if session.Correct == 10 {
+					summary.PerfectSessions++
+				}
+				summary.Correct += session.Correct
+				summary.Total += session.Total
+			}
+		}
+
+		r.s.summaries = append(r.s.summaries, summary)
+		created++
+	}
+
+	return created, nil
+}
+
+func (s *Store) hasSummary(parentID, studentID int, weekStart time.Time) bool {
+	for _, w := range s.summaries {
+		if w.parentID == parentID && w.StudentID == studentID && w.WeekStart.Equal(weekStart) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *guardianRepo) GetSummaries(ctx context.Context, parentID, limit int) ([]*entity.WeeklySummary, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	linked := make(map[int]bool)
+	for _, g := range r.s.guardians {
+		if g.parentID == parentID {
+			linked[g.studentID] = true
+		}
+	}
+
+	var summaries []*entity.WeeklySummary
+	for _, w := range r.s.summaries {
+		u, ok := r.s.users[w.StudentID]
+		if w.parentID != parentID || !linked[w.StudentID] || !ok {
+			continue
+		}
+		out := w.WeeklySummary
+		out.StudentName = u.FullName
+		summaries = append(summaries, &out)
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if !summaries[i].WeekStart.Equal(summaries[j].WeekStart) {
+			return summaries[i].WeekStart.After(summaries[j].WeekStart)
+		}
+		return summaries[i].StudentName < summaries[j].StudentName
+	})
+	if len(summaries) > limit {
+		summaries = summaries[:limit]
+	}
+
+	return summaries, nil
+}
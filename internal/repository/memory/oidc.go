@@ -0,0 +1,335 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"edugame/internal/repository"
+	"sort"
+	"strings"
+	"time"
+)
+
+type oidcRepo struct{ s *Store }
+
+func (r *oidcRepo) GetAll(ctx context.Context) ([]entity.OIDCProvider, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.sortedProviders(false), nil
+}
+
+func (r *oidcRepo) GetEnabled(ctx context.Context) ([]entity.OIDCProvider, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.sortedProviders(true), nil
+}
+
+func (r *oidcRepo) GetByID(ctx context.Context, id int) (*entity.OIDCProvider, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	p, ok := r.s.providers[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	out := copyProvider(p)
+	return &out, nil
+}
+
+func (r *oidcRepo) GetBySlug(ctx context.Context, slug string) (*entity.OIDCProvider, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, p := range r.s.providers {
+		if p.Slug == slug && r.s.liveSchool(p.SchoolID) {
+			out := copyProvider(p)
+			return &out, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (r *oidcRepo) Create(ctx context.Context, p *entity.OIDCProvider) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.slugTaken(p.Slug, 0) {
+		return errDuplicate("oidc_providers_slug_key")
+	}
+
+	p.ID = r.s.next("oidc_providers")
+	p.CreatedAt = time.Now()
+
+	stored := copyProvider(p)
+	r.s.providers[p.ID] = &stored
+
+	return nil
+}
+
+func (r *oidcRepo) Update(ctx context.Context, p *entity.OIDCProvider) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	old, ok := r.s.providers[p.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if r.s.slugTaken(p.Slug, p.ID) {
+		return errDuplicate("oidc_providers_slug_key")
+	}
+
+	stored := copyProvider(p)
+	stored.CreatedAt = old.CreatedAt
+	if stored.ClientSecret == "" {
+		stored.ClientSecret = old.ClientSecret
+	}
+	r.s.providers[p.ID] = &stored
+
+	return nil
+}
+
+func (r *oidcRepo) Delete(ctx context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.deleteProvider(id)
+	return nil
+}
+
+func (r *oidcRepo) FindIdentity(ctx context.Context, providerID int, subject string) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if i := r.s.identity(providerID, subject); i != nil {
+		return i.userID, nil
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (r *oidcRepo) LinkIdentity(ctx context.Context, providerID int, subject string, userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.linkIdentity(providerID, subject, userID, time.Time{})
+}
+
+func (r *oidcRepo) TouchIdentity(ctx context.Context, providerID int, subject string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if i := r.s.identity(providerID, subject); i != nil {
+		i.lastLoginAt = time.Now()
+	}
+	return nil
+}
+
+func (r *oidcRepo) FindLinkCandidate(ctx context.Context, schoolID int, email string) (int, string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var found *user
+	for _, u := range r.s.users {
+		if u.pending || u.SchoolID == nil || *u.SchoolID != schoolID || !strings.EqualFold(u.email, email) {
+			continue
+		}
+		if found != nil {
+			return 0, "", repository.ErrAmbiguousLink
+		}
+		found = u
+	}
+	if found == nil {
+		return 0, "", sql.ErrNoRows
+	}
+
+	return found.ID, r.s.userRole(found.ID), nil
+}
+
+func (r *oidcRepo) Provision(ctx context.Context, provider *entity.OIDCProvider, subject, username, fullName, roleName string) (int, error) {
+	secret, err := newToken()
+	if err != nil {
+		return 0, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, err := r.s.insertUser(username, secret, roleName, fullName, provider.SchoolID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := r.s.linkIdentity(provider.ID, subject, u.ID, time.Now()); err != nil {
+		r.s.deleteUser(u.ID)
+		return 0, err
+	}
+
+	return u.ID, nil
+}
+
+func (r *oidcRepo) SetUserRole(ctx context.Context, userID int, roleName string) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[userID]
+	ro := r.s.roleByName(roleName)
+	if !ok || ro == nil || u.RoleID == ro.ID {
+		return "", nil
+	}
+
+	previous := r.s.userRole(userID)
+	u.RoleID = ro.ID
+	return previous, nil
+}
+
+func (s *Store) identity(providerID int, subject string) *identity {
+	for _, i := range s.identities {
+		if i.providerID == providerID && i.subject == subject {
+			return i
+		}
+	}
+	return nil
+}
+
+func (s *Store) linkIdentity(providerID int, subject string, userID int, lastLoginAt time.Time) error {
+	if _, ok := s.providers[providerID]; !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := s.users[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	if s.identity(providerID, subject) != nil {
+		return errDuplicate("user_identities_provider_id_subject_key")
+	}
+
+	s.identities = append(s.identities, &identity{
+		providerID: providerID, subject: subject, userID: userID, lastLoginAt: lastLoginAt,
+	})
+	return nil
+}
+
+// deleteProvider удаляет провайдера вместе с привязками пользователей
+func (s *Store) deleteProvider(id int) {
+	delete(s.providers, id)
+
+	identities := s.identities[:0]
+	for _, i := range s.identities {
+		if i.providerID != id {
+			identities = append(identities, i)
+		}
+	}
+	s.identities = identities
+}
+
+func (s *Store) slugTaken(slug string, exceptID int) bool {
+	for _, p := range s.providers {
+		if p.Slug == slug && p.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) sortedProviders(enabledOnly bool) []entity.OIDCProvider {
+	var providers []entity.OIDCProvider
+	for _, p := range s.providers {
+		if !enabledOnly || (p.Enabled && s.liveSchool(p.SchoolID)) {
+			providers = append(providers, copyProvider(p))
+		}
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		if providers[i].Name != providers[j].Name {
+			return providers[i].Name < providers[j].Name
+		}
+		return providers[i].ID < providers[j].ID
+	})
+	return providers
+}
+
+func copyProvider(p *entity.OIDCProvider) entity.OIDCProvider {
+	out := *p
+	out.SchoolID = copyInt(p.SchoolID)
+	if p.RoleMapping != nil {
+		out.RoleMapping = make(map[string]string, len(p.RoleMapping))
+		for k, v := range p.RoleMapping {
+			out.RoleMapping[k] = v
+		}
+	}
+	return out
+}
+
+type auditRepo struct{ s *Store }
+
+// Record добавляет запись; журнал в памяти, как и в БД, только дополняется
+func (r *auditRepo) Record(ctx context.Context, entry *entity.AuditEntry) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.appendAudit(*entry)
+	return nil
+}
+
+// appendAudit добавляет запись журнала, вызывается под s.mu
+func (s *Store) appendAudit(e entity.AuditEntry) {
+	e.ID = int64(s.next("audit_log"))
+	e.ActorID = copyInt(e.ActorID)
+	e.TargetID = copyInt(e.TargetID)
+	e.CreatedAt = time.Now()
+	s.audit = append(s.audit, e)
+}
+
+func (r *auditRepo) Find(ctx context.Context, filter repository.AuditFilter, limit, offset int) ([]entity.AuditEntry, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var entries []entity.AuditEntry
+	skipped := 0
+	for i := len(r.s.audit) - 1; i >= 0; i-- {
+		e := r.s.audit[i]
+		if !filter.Matches(e) {
+			continue
+		}
+		if limit > 0 {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			if len(entries) == limit {
+				break
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func (r *auditRepo) Each(ctx context.Context, filter repository.AuditFilter, fn func(entity.AuditEntry) error) error {
+	entries, err := r.Find(ctx, filter, 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *auditRepo) Count(ctx context.Context, filter repository.AuditFilter) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	count := 0
+	for _, e := range r.s.audit {
+		if filter.Matches(e) {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,454 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"edugame/internal/generator"
+	"edugame/internal/repository"
+	"sort"
+	"time"
+)
+
+type typeRepo struct{ s *Store }
+
+func (r *typeRepo) GetAll(ctx context.Context) ([]generator.EquationType, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	types := r.s.typesWhere(func(*generator.EquationType) bool { return true })
+	sort.SliceStable(types, func(i, j int) bool {
+		if types[i].Class != types[j].Class {
+			return types[i].Class < types[j].Class
+		}
+		return types[i].Name < types[j].Name
+	})
+
+	return types, nil
+}
+
+func (r *typeRepo) GetListTypes(ctx context.Context, class int) ([]generator.EquationType, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.typesWhere(func(t *generator.EquationType) bool { return t.Class == class }), nil
+}
+
+func (r *typeRepo) GetTypeById(ctx context.Context, id int) (generator.EquationType, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t, ok := r.s.types[id]
+	if !ok {
+		return generator.EquationType{}, sql.ErrNoRows
+	}
+
+	return copyType(t), nil
+}
+
+func (r *typeRepo) Create(ctx context.Context, et generator.EquationType) (*generator.EquationType, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	et.ID = r.s.next("equation_types")
+	et.IsAvailable = true
+	stored := copyType(&et)
+	r.s.types[et.ID] = &stored
+
+	out := copyType(&stored)
+	return &out, nil
+}
+
+func (r *typeRepo) Update(ctx context.Context, et generator.EquationType) (*generator.EquationType, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.types[et.ID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	stored := copyType(&et)
+	r.s.types[et.ID] = &stored
+
+	out := copyType(&stored)
+	return &out, nil
+}
+
+func (r *typeRepo) Delete(ctx context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.trashType(id, time.Now())
+	return nil
+}
+
+// deleteType окончательно удаляет тип уравнения
+func (s *Store) deleteType(id int) {
+	delete(s.types, id)
+
+	// attempts.equation_type_id и quiz_items.equation_type_id - ON DELETE SET NULL
+	for i := range s.attempts {
+		if s.attempts[i].EquationTypeID == id {
+			s.attempts[i].EquationTypeID = 0
+		}
+	}
+	for _, q := range s.quizzes {
+		for _, item := range q.items {
+			if item.EquationTypeID == id {
+				item.EquationTypeID = 0
+			}
+		}
+	}
+}
+
+func (r *typeRepo) ToggleAvailability(ctx context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if t, ok := r.s.types[id]; ok {
+		t.IsAvailable = !t.IsAvailable
+	}
+	return nil
+}
+
+// AddType добавляет тип уравнения как есть, с сохранением признака доступности.
+// Нужен для подготовки данных в тестах: Create, как и в PostgreSQL, всегда делает тип доступным.
+func (s *Store) AddType(et generator.EquationType) generator.EquationType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	et.ID = s.next("equation_types")
+	stored := copyType(&et)
+	s.types[et.ID] = &stored
+
+	return copyType(&stored)
+}
+
+func (s *Store) typesWhere(match func(*generator.EquationType) bool) []generator.EquationType {
+	ids := make([]int, 0, len(s.types))
+	for id := range s.types {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	types := make([]generator.EquationType, 0)
+	for _, id := range ids {
+		if t := s.types[id]; match(t) {
+			types = append(types, copyType(t))
+		}
+	}
+	return types
+}
+
+func copyType(t *generator.EquationType) generator.EquationType {
+	out := *t
+	out.Operands = append([]generator.OperandRange(nil), t.Operands...)
+	return out
+}
+
+// progressTypes - типы уравнений, по которым у ученика есть строки user_progress:
+// триггеры создают их для типов, совпадающих с параллелью любого из его классов,
+// а строки прошлых параллелей остаются после перехода на новый учебный год
+func (s *Store) progressTypes(studentID int) []*generator.EquationType {
+	grades := make(map[int]bool)
+	for _, classID := range s.studentClassIDs(studentID) {
+		if c, ok := s.classes[classID]; ok {
+			grades[c.Grade] = true
+		}
+	}
+	for grade := range s.pastGrades[studentID] {
+		grades[grade] = true
+	}
+
+	ids := make([]int, 0)
+	for id, t := range s.types {
+		if grades[t.Class] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	types := make([]*generator.EquationType, 0, len(ids))
+	for _, id := range ids {
+		types = append(types, s.types[id])
+	}
+	return types
+}
+
+// typeStat считает попытки ученика по типу - то, что в PostgreSQL копится в user_progress
+func (s *Store) typeStat(studentID, typeID int) repository.TypeStat {
+	stat := repository.TypeStat{TypeID: typeID}
+	for _, a := range s.attempts {
+		if a.UserID != studentID || a.EquationTypeID != typeID {
+			continue
+		}
+		stat.Attempts++
+		if a.IsCorrect {
+			stat.Correct++
+		}
+		if !stat.LastAttempt.Valid || a.CreatedAt.After(stat.LastAttempt.Time) {
+			stat.LastAttempt = sql.NullTime{Time: a.CreatedAt, Valid: true}
+		}
+	}
+	return stat
+}
+
+type progressRepo struct{ s *Store }
+
+func (r *progressRepo) GetUserAllProgress(ctx context.Context, userId int) ([]entity.UserProgress, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[userId]
+	if !ok {
+		return nil, nil
+	}
+
+	var ups []entity.UserProgress
+	for i, t := range r.s.progressTypes(userId) {
+		stat := r.s.typeStat(userId, t.ID)
+
+		up := entity.UserProgress{
+			Id:               i + 1,
+			UserId:           userId,
+			Username:         u.Username,
+			EquationTypeId:   t.ID,
+			EquationTypeName: t.Name,
+			Description:      t.Description,
+			AttemptsCount:    stat.Attempts,
+			CorrectCount:     stat.Correct,
+			IsUnlocked:       t.IsAvailable,
+		}
+		if stat.LastAttempt.Valid {
+			up.LastAttemptAt = sql.NullString{String: stat.LastAttempt.Time.Format(time.RFC3339), Valid: true}
+		}
+		ups = append(ups, up)
+	}
+
+	return ups, nil
+}
+
+func (r *progressRepo) GetUserTypeStatistics(ctx context.Context, userID int) (map[int]repository.TypeStat, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stats := make(map[int]repository.TypeStat)
+
+	// Как и в PostgreSQL - типы параллели первого класса ученика
+	classIDs := r.s.studentClassIDs(userID)
+	if len(classIDs) == 0 {
+		return stats, nil
+	}
+	c, ok := r.s.classes[classIDs[0]]
+	if !ok {
+		return stats, nil
+	}
+
+	for id, t := range r.s.types {
+		if t.Class == c.Grade {
+			stats[id] = r.s.typeStat(userID, id)
+		}
+	}
+
+	return stats, nil
+}
+
+type attemptRepo struct{ s *Store }
+
+func (r *attemptRepo) SaveAttempt(ctx context.Context, attempt entity.Attempt) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[attempt.UserID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	r.s.saveAttempt(attempt)
+	return nil
+}
+
+// saveAttempt добавляет попытку, вызывается под s.mu
+func (s *Store) saveAttempt(attempt entity.Attempt) {
+	if attempt.CreatedAt.IsZero() {
+		attempt.CreatedAt = time.Now()
+	}
+	attempt.ID = s.next("attempts")
+	s.attempts = append(s.attempts, attempt)
+}
+
+// GetAttempts возвращает все попытки ученика в порядке сохранения
+func (s *Store) GetAttempts(userID int) []entity.Attempt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attempts []entity.Attempt
+	for _, a := range s.attempts {
+		if a.UserID == userID {
+			attempts = append(attempts, a)
+		}
+	}
+	return attempts
+}
+
+type quiz struct {
+	userID int
+	items  map[int]*entity.QuizItem
+}
+
+type quizRepo struct{ s *Store }
+
+func (r *quizRepo) CreateQuiz(ctx context.Context, userID int, items []entity.QuizItem) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, q := range r.s.quizzes {
+		if q.userID == userID {
+			delete(r.s.quizzes, id)
+		}
+	}
+
+	id := r.s.next("quizzes")
+	q := &quiz{userID: userID, items: make(map[int]*entity.QuizItem)}
+	for _, item := range items {
+		stored := entity.QuizItem{
+			QuizID: id, ItemID: item.ItemID, EquationTypeID: item.EquationTypeID,
+			Text: item.Text, CorrectAnswer: item.CorrectAnswer,
+		}
+		q.items[item.ItemID] = &stored
+	}
+	r.s.quizzes[id] = q
+
+	return id, nil
+}
+
+func (r *quizRepo) GetItems(ctx context.Context, quizID, userID int) (map[int]entity.QuizItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	q, ok := r.s.quizzes[quizID]
+	if !ok || q.userID != userID || len(q.items) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	items := make(map[int]entity.QuizItem, len(q.items))
+	for id, item := range q.items {
+		items[id] = *item
+	}
+	return items, nil
+}
+
+func (r *quizRepo) AnswerItem(ctx context.Context, quizID, userID, itemID int, answer string, maxTries int) (*entity.QuizItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	item, ok := r.s.quizItem(quizID, userID, itemID)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if item.Locked {
+		out := *item
+		return &out, repository.ErrQuizItemLocked
+	}
+
+	item.Tries++
+	item.Correct = answer == item.CorrectAnswer
+	item.Locked = item.Correct || item.Tries >= maxTries
+
+	out := *item
+	return &out, nil
+}
+
+func (r *quizRepo) LockItem(ctx context.Context, quizID, userID, itemID int, correct bool) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	item, ok := r.s.quizItem(quizID, userID, itemID)
+	if !ok || item.Locked {
+		return false, nil
+	}
+
+	item.Locked = true
+	item.Correct = correct
+	return true, nil
+}
+
+func (s *Store) quizItem(quizID, userID, itemID int) (*entity.QuizItem, bool) {
+	q, ok := s.quizzes[quizID]
+	if !ok || q.userID != userID {
+		return nil, false
+	}
+	item, ok := q.items[itemID]
+	return item, ok
+}
+
+// GetQuizItems возвращает примеры набора вместе с верными ответами (для тестов)
+func (s *Store) GetQuizItems(quizID int) map[int]entity.QuizItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make(map[int]entity.QuizItem)
+	if q, ok := s.quizzes[quizID]; ok {
+		for id, item := range q.items {
+			items[id] = *item
+		}
+	}
+	return items
+}
+
+type offlineRepo struct{ s *Store }
+
+func (r *offlineRepo) CreateBundle(ctx context.Context, userID int, items []entity.OfflineItem, issuedAt, expiresAt time.Time) (*entity.OfflineBundle, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	bundle := &entity.OfflineBundle{
+		ID:        r.s.next("offline_bundles"),
+		UserID:    userID,
+		Items:     append([]entity.OfflineItem(nil), items...),
+		IssuedAt:  issuedAt,
+		ExpiresAt: expiresAt,
+	}
+	r.s.bundles[bundle.ID] = bundle
+
+	out := *bundle
+	out.Items = append([]entity.OfflineItem(nil), bundle.Items...)
+	return &out, nil
+}
+
+func (r *offlineRepo) GetBundle(ctx context.Context, id int) (*entity.OfflineBundle, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	bundle, ok := r.s.bundles[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	out := *bundle
+	out.Items = append([]entity.OfflineItem(nil), bundle.Items...)
+	out.SyncedAt = copyTime(bundle.SyncedAt)
+	return &out, nil
+}
+
+func (r *offlineRepo) SyncBundle(ctx context.Context, id int, syncedAt time.Time, attempts []entity.Attempt) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	bundle, ok := r.s.bundles[id]
+	if !ok || bundle.SyncedAt != nil {
+		return false, nil
+	}
+
+	// Как и в транзакции PostgreSQL: либо сохраняются все попытки, либо ни одной
+	for _, attempt := range attempts {
+		if _, ok := r.s.users[attempt.UserID]; !ok {
+			return false, sql.ErrNoRows
+		}
+	}
+	for _, attempt := range attempts {
+		r.s.saveAttempt(attempt)
+	}
+
+	bundle.SyncedAt = &syncedAt
+	return true, nil
+}
@@ -0,0 +1,441 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"edugame/internal/repository"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type sessionRepo struct{ s *Store }
+
+func (r *sessionRepo) Create(ctx context.Context, userID int, userAgent, ipAddress string, ttl time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	id := r.s.next("user_sessions")
+	r.s.sessions[id] = &session{
+		UserSession: entity.UserSession{
+			ID:         id,
+			UserID:     userID,
+			UserAgent:  userAgent,
+			IPAddress:  ipAddress,
+			CreatedAt:  now,
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(ttl),
+		},
+		token: token,
+	}
+
+	return token, nil
+}
+
+func (r *sessionRepo) Touch(ctx context.Context, token string, ttl, touchEvery time.Duration) (int, bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+
+	sess := r.s.sessionByToken(token)
+	if sess == nil || !sess.ExpiresAt.After(now) {
+		return 0, false, sql.ErrNoRows
+	}
+	if u, ok := r.s.users[sess.UserID]; !ok || u.Blocked {
+		return 0, false, sql.ErrNoRows
+	}
+
+	if now.Sub(sess.LastSeenAt) < touchEvery {
+		return sess.UserID, false, nil
+	}
+
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(ttl)
+
+	return sess.UserID, true, nil
+}
+
+func (r *sessionRepo) GetUserSessions(ctx context.Context, userID int, currentToken string) ([]*entity.UserSession, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+
+	var sessions []*entity.UserSession
+	for _, sess := range r.s.sessions {
+		if sess.UserID != userID || !sess.ExpiresAt.After(now) {
+			continue
+		}
+		out := sess.UserSession
+		out.Current = currentToken != "" && sess.token == currentToken
+		sessions = append(sessions, &out)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+
+	return sessions, nil
+}
+
+func (r *sessionRepo) Delete(ctx context.Context, token string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if sess := r.s.sessionByToken(token); sess != nil {
+		delete(r.s.sessions, sess.ID)
+	}
+	return nil
+}
+
+func (r *sessionRepo) DeleteUserSession(ctx context.Context, userID, sessionID int) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	sess, ok := r.s.sessions[sessionID]
+	if !ok || sess.UserID != userID {
+		return false, nil
+	}
+
+	delete(r.s.sessions, sessionID)
+	return true, nil
+}
+
+func (r *sessionRepo) DeleteUserSessions(ctx context.Context, userID int, exceptToken string) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.deleteUserSessions(userID, exceptToken), nil
+}
+
+func (r *sessionRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+
+	var deleted int64
+	for id, sess := range r.s.sessions {
+		if !sess.ExpiresAt.After(now) {
+			delete(r.s.sessions, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (s *Store) sessionByToken(token string) *session {
+	if token == "" {
+		return nil
+	}
+	for _, sess := range s.sessions {
+		if sess.token == token {
+			return sess
+		}
+	}
+	return nil
+}
+
+type throttleRepo struct{ s *Store }
+
+func (r *throttleRepo) RetryAfter(ctx context.Context, keys ...string) (time.Duration, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var wait time.Duration
+	for _, key := range keys {
+		if t, ok := r.s.throttles[key]; ok {
+			if d := time.Until(t.blockedUntil); d > wait {
+				wait = d
+			}
+		}
+	}
+
+	return wait, nil
+}
+
+func (r *throttleRepo) RegisterFailure(ctx context.Context, key string, policy repository.ThrottlePolicy) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.registerThrottleFailure(key, policy, time.Now())
+	return nil
+}
+
+func (r *throttleRepo) Reserve(ctx context.Context, key string, policy repository.ThrottlePolicy) (time.Duration, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	if t, ok := r.s.throttles[key]; ok && t.blockedUntil.After(now) {
+		return max(t.blockedUntil.Sub(now), time.Second), nil
+	}
+
+	r.s.registerThrottleFailure(key, policy, now)
+	return 0, nil
+}
+
+func (r *throttleRepo) Release(ctx context.Context, key string, policy repository.ThrottlePolicy) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t, ok := r.s.throttles[key]
+	if !ok {
+		return nil
+	}
+	t.failures = max(t.failures-1, 0)
+	if t.failures <= policy.FreeAttempts {
+		t.blockedUntil = time.Time{}
+	}
+	return nil
+}
+
+// registerThrottleFailure увеличивает счетчик ключа, вызывается под s.mu
+func (s *Store) registerThrottleFailure(key string, policy repository.ThrottlePolicy, now time.Time) {
+	t, ok := s.throttles[key]
+	if !ok {
+		t = &throttle{}
+		s.throttles[key] = t
+	}
+
+	if t.lastFailure.IsZero() || now.Sub(t.lastFailure) > policy.Window {
+		t.failures = 0
+	}
+	t.failures++
+	t.lastFailure = now
+
+	t.blockedUntil = time.Time{}
+	if delay := policy.Delay(t.failures); delay > 0 {
+		t.blockedUntil = now.Add(delay)
+	}
+}
+
+func (r *throttleRepo) Reset(ctx context.Context, key string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.throttles, key)
+	return nil
+}
+
+type resetRepo struct{ s *Store }
+
+// resetCodeLength - длина кода сброса, как в PostgreSQL-реализации
+const resetCodeLength = 8
+
+func (r *resetRepo) Issue(ctx context.Context, studentID, issuedBy int, ttl time.Duration) (string, *entity.PasswordResetCode, error) {
+	code, err := newCode(resetCodeLength)
+	if err != nil {
+		return "", nil, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+
+	for _, c := range r.s.resetCodes {
+		if c.UserID == studentID && c.UsedAt == nil && c.RevokedAt == nil {
+			revokedAt := now
+			c.RevokedAt = &revokedAt
+		}
+	}
+
+	rc := &resetCode{
+		PasswordResetCode: entity.PasswordResetCode{
+			ID:        r.s.next("password_reset_codes"),
+			UserID:    studentID,
+			IssuedBy:  issuedBy,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ttl),
+		},
+		code: code,
+	}
+	r.s.resetCodes = append(r.s.resetCodes, rc)
+
+	out := rc.PasswordResetCode
+	return code, &out, nil
+}
+
+func (r *resetRepo) Redeem(ctx context.Context, code, newPassword, ipAddress string) (int, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), passwordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	code = repository.NormalizeResetCode(code)
+
+	for _, c := range r.s.resetCodes {
+		if c.code != code || c.UsedAt != nil || c.RevokedAt != nil || !c.ExpiresAt.After(now) {
+			continue
+		}
+
+		usedAt := now
+		c.UsedAt = &usedAt
+		c.UsedIP = ipAddress
+
+		if u, ok := r.s.users[c.UserID]; ok {
+			u.passwordHash = string(hash)
+			u.failedLogins = 0
+			u.lockedUntil = time.Time{}
+		}
+		r.s.deleteUserSessions(c.UserID, "")
+
+		return c.UserID, nil
+	}
+
+	return 0, repository.ErrResetCodeInvalid
+}
+
+func (r *resetRepo) GetClassResetCodes(ctx context.Context, classID int, limit int) ([]*entity.PasswordResetCode, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var codes []*entity.PasswordResetCode
+	for i := len(r.s.resetCodes) - 1; i >= 0 && len(codes) < limit; i-- {
+		c := r.s.resetCodes[i]
+		student, ok := r.s.users[c.UserID]
+		issuer, issuerOK := r.s.users[c.IssuedBy]
+		if !ok || !issuerOK || !r.s.inClass(c.UserID, classID) {
+			continue
+		}
+
+		out := c.PasswordResetCode
+		out.StudentName = student.FullName
+		out.IssuedByName = issuer.FullName
+		out.UsedAt = copyTime(c.UsedAt)
+		out.RevokedAt = copyTime(c.RevokedAt)
+		codes = append(codes, &out)
+	}
+
+	return codes, nil
+}
+
+type inviteRepo struct{ s *Store }
+
+func (r *inviteRepo) Create(ctx context.Context, roleID int, schoolID *int, note string, createdBy int, ttl time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.roles[roleID]; !ok {
+		return "", sql.ErrNoRows
+	}
+
+	now := time.Now()
+	r.s.invites = append(r.s.invites, &invite{
+		StaffInvite: entity.StaffInvite{
+			ID:        r.s.next("staff_invites"),
+			RoleID:    roleID,
+			SchoolID:  copyInt(schoolID),
+			Note:      note,
+			CreatedBy: &createdBy,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ttl),
+		},
+		token: token,
+	})
+
+	return token, nil
+}
+
+func (r *inviteRepo) GetValid(ctx context.Context, token string) (*entity.StaffInvite, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	inv := r.s.validInvite(token)
+	if inv == nil {
+		return nil, repository.ErrInviteInvalid
+	}
+
+	return r.s.publicInvite(inv), nil
+}
+
+func (r *inviteRepo) Accept(ctx context.Context, token, username, password, fullName string) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	inv := r.s.validInvite(token)
+	if inv == nil {
+		return 0, repository.ErrInviteInvalid
+	}
+
+	u, err := r.s.insertUser(username, password, r.s.roles[inv.RoleID].Name, fullName, inv.SchoolID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	inv.UsedAt = &now
+	inv.UsedBy = &u.ID
+
+	return u.ID, nil
+}
+
+func (r *inviteRepo) GetAll(ctx context.Context, limit int) ([]*entity.StaffInvite, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var invites []*entity.StaffInvite
+	for i := len(r.s.invites) - 1; i >= 0 && len(invites) < limit; i-- {
+		invites = append(invites, r.s.publicInvite(r.s.invites[i]))
+	}
+
+	return invites, nil
+}
+
+func (r *inviteRepo) Revoke(ctx context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, inv := range r.s.invites {
+		if inv.ID == id && inv.UsedAt == nil && inv.RevokedAt == nil {
+			now := time.Now()
+			inv.RevokedAt = &now
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) validInvite(token string) *invite {
+	now := time.Now()
+	for _, inv := range s.invites {
+		if inv.token == token && inv.UsedAt == nil && inv.RevokedAt == nil && inv.ExpiresAt.After(now) && s.liveSchool(inv.SchoolID) {
+			return inv
+		}
+	}
+	return nil
+}
+
+func (s *Store) publicInvite(inv *invite) *entity.StaffInvite {
+	out := inv.StaffInvite
+	if r, ok := s.roles[inv.RoleID]; ok {
+		out.RoleName = r.Name
+	}
+	out.SchoolID = copyInt(inv.SchoolID)
+	out.CreatedBy = copyInt(inv.CreatedBy)
+	out.UsedBy = copyInt(inv.UsedBy)
+	out.UsedAt = copyTime(inv.UsedAt)
+	out.RevokedAt = copyTime(inv.RevokedAt)
+	return &out
+}
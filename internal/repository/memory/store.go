@@ -0,0 +1,483 @@
+// Package memory - реализация интерфейсов репозиториев в памяти процесса.
+// Повторяет поведение PostgreSQL-реализации (включая триггеры и каскадные удаления),
+// чтобы обработчики можно было тестировать без базы данных.
+package memory
+
+import (
+	"crypto/rand"
+	"edugame/internal/entity"
+	"edugame/internal/generator"
+	"edugame/internal/repository"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost - стоимость bcrypt для паролей в памяти: тестам не нужна стойкость к перебору
+const passwordCost = bcrypt.MinCost
+
+// Алфавит кодов сброса, привязки и кодов класса - тот же, что в PostgreSQL-реализации
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+type user struct {
+	entity.User
+	email        string
+	passwordHash string
+	pictureHash  string
+	pending      bool
+	failedLogins int
+	lockedUntil  time.Time
+	erasedAt     *time.Time
+}
+
+type role struct {
+	entity.Role
+	permissions []string
+}
+
+type class struct {
+	entity.Class
+	loginCode string
+	joinCode  string
+}
+
+type session struct {
+	entity.UserSession
+	token string
+}
+
+type throttle struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+type resetCode struct {
+	entity.PasswordResetCode
+	code string
+}
+
+type invite struct {
+	entity.StaffInvite
+	token string
+}
+
+type identity struct {
+	providerID  int
+	subject     string
+	userID      int
+	lastLoginAt time.Time
+}
+
+type guardianCode struct {
+	entity.GuardianCode
+	code string
+}
+
+type guardian struct {
+	parentID      int
+	studentID     int
+	weeklySummary bool
+	createdAt     time.Time
+}
+
+type weeklySummary struct {
+	entity.WeeklySummary
+	parentID int
+}
+
+// Store - общее хранилище всех репозиториев. Репозитории, полученные из одного Store,
+// видят данные друг друга, как таблицы одной базы. Безопасен для конкурентного использования.
+type Store struct {
+	mu  sync.Mutex
+	seq map[string]int
+
+	roles       map[int]*role
+	permissions []entity.Permission
+
+	users          map[int]*user
+	schools        map[int]*entity.School
+	classes        map[int]*class
+	studentClasses [][2]int // пары (student_id, class_id) в порядке добавления
+	staff          []*entity.ClassStaff
+
+	types    map[int]*generator.EquationType
+	attempts []entity.Attempt
+	bundles  map[int]*entity.OfflineBundle
+	quizzes  map[int]*quiz
+
+	sessions   map[int]*session
+	throttles  map[string]*throttle
+	resetCodes []*resetCode
+	invites    []*invite
+
+	providers  map[int]*entity.OIDCProvider
+	identities []*identity
+
+	audit []entity.AuditEntry
+
+	guardianCodes []*guardianCode
+	guardians     []*guardian
+	summaries     []*weeklySummary
+
+	trash map[trashKey]*trashed
+
+	years        []*entity.AcademicYear
+	yearClasses  []entity.YearClassSnapshot
+	yearStudents []entity.YearStudentSnapshot
+	pastGrades   map[int]map[int]bool // параллели, из которых ученик перешел: их прогресс сохраняется
+}
+
+// New создает пустое хранилище со встроенными ролями и правами (как после миграций)
+func New() *Store {
+	s := &Store{
+		seq:        make(map[string]int),
+		roles:      make(map[int]*role),
+		users:      make(map[int]*user),
+		schools:    make(map[int]*entity.School),
+		classes:    make(map[int]*class),
+		types:      make(map[int]*generator.EquationType),
+		bundles:    make(map[int]*entity.OfflineBundle),
+		quizzes:    make(map[int]*quiz),
+		sessions:   make(map[int]*session),
+		throttles:  make(map[string]*throttle),
+		providers:  make(map[int]*entity.OIDCProvider),
+		trash:      make(map[trashKey]*trashed),
+		pastGrades: make(map[int]map[int]bool),
+	}
+
+	permissions := []entity.Permission{
+		{Code: entity.PermQuizSolve, Description: "Решать примеры и смотреть свою статистику"},
+		{Code: entity.PermClassStatsView, Description: "Смотреть статистику своего класса"},
+		{Code: entity.PermClassStudentsManage, Description: "Управлять учениками своего класса: заявки, коды, блокировка"},
+		{Code: entity.PermSchoolStatsView, Description: "Смотреть статистику всех классов школы"},
+		{Code: entity.PermDistrictStatsView, Description: "Смотреть статистику всех школ района"},
+		{Code: entity.PermAdminPanel, Description: "Открывать админ-панель"},
+		{Code: entity.PermUsersManage, Description: "Управлять пользователями и приглашениями"},
+		{Code: entity.PermSchoolsManage, Description: "Управлять школами и классами"},
+		{Code: entity.PermEquationTypesManage, Description: "Управлять типами уравнений"},
+		{Code: entity.PermRolesManage, Description: "Управлять ролями и правами"},
+		{Code: entity.PermAuditView, Description: "Просматривать и выгружать журнал аудита"},
+		{Code: entity.PermChildrenView, Description: "Смотреть успеваемость своих детей"},
+	}
+	for _, p := range permissions {
+		p.ID = s.next("permissions")
+		s.permissions = append(s.permissions, p)
+	}
+
+	builtin := []struct {
+		name, description string
+		permissions       []string
+	}{
+		{"student", "Ученик", []string{entity.PermQuizSolve}},
+		{"teacher", "Учитель", []string{entity.PermClassStatsView, entity.PermClassStudentsManage}},
+		{"admin", "Администратор", []string{
+			entity.PermAdminPanel, entity.PermUsersManage, entity.PermSchoolsManage, entity.PermEquationTypesManage,
+			entity.PermRolesManage, entity.PermAuditView, entity.PermSchoolStatsView, entity.PermDistrictStatsView,
+		}},
+		{"director", "Директор", []string{entity.PermSchoolStatsView}},
+		{"district", "Специалист управления образования", []string{entity.PermSchoolStatsView, entity.PermDistrictStatsView}},
+		{"parent", "Родитель", []string{entity.PermChildrenView}},
+	}
+	for _, b := range builtin {
+		id := s.next("roles")
+		s.roles[id] = &role{
+			Role: entity.Role{
+				ID: id, Name: b.name, Description: b.description, IsSystem: true, CreatedAt: time.Now(),
+			},
+			permissions: b.permissions,
+		}
+	}
+
+	// Текущий учебный год по календарю, как его создает миграция
+	start := entity.AcademicYearStart(time.Now())
+	s.years = append(s.years, &entity.AcademicYear{
+		ID: s.next("academic_years"), Name: entity.AcademicYearName(start), StartsOn: start, IsCurrent: true, CreatedAt: time.Now(),
+	})
+
+	return s
+}
+
+// Репозитории поверх хранилища
+
+func (s *Store) Users() repository.Users                   { return &userRepo{s} }
+func (s *Store) Types() repository.Types                   { return &typeRepo{s} }
+func (s *Store) Progress() repository.Progress             { return &progressRepo{s} }
+func (s *Store) Attempts() repository.Attempts             { return &attemptRepo{s} }
+func (s *Store) Teachers() repository.Teachers             { return &teacherRepo{s} }
+func (s *Store) Sessions() repository.Sessions             { return &sessionRepo{s} }
+func (s *Store) LoginThrottles() repository.LoginThrottles { return &throttleRepo{s} }
+func (s *Store) PasswordResets() repository.PasswordResets { return &resetRepo{s} }
+func (s *Store) Invites() repository.Invites               { return &inviteRepo{s} }
+func (s *Store) Quizzes() repository.Quizzes               { return &quizRepo{s} }
+func (s *Store) OfflineBundles() repository.OfflineBundles { return &offlineRepo{s} }
+func (s *Store) OIDCProviders() repository.OIDCProviders   { return &oidcRepo{s} }
+func (s *Store) AuditLog() repository.AuditLog             { return &auditRepo{s} }
+func (s *Store) Permissions() repository.Permissions       { return &permissionRepo{s} }
+func (s *Store) Roles() repository.Roles                   { return &roleRepo{s} }
+func (s *Store) Schools() repository.Schools               { return &schoolRepo{s} }
+func (s *Store) Classes() repository.Classes               { return &classRepo{s} }
+func (s *Store) ClassStaff() repository.ClassStaff         { return &staffRepo{s} }
+func (s *Store) Guardians() repository.Guardians           { return &guardianRepo{s} }
+func (s *Store) Trash() repository.Trash                   { return &trashRepo{s} }
+func (s *Store) AcademicYears() repository.AcademicYears   { return &yearRepo{s} }
+func (s *Store) StudentData() repository.StudentData       { return &studentDataRepo{s} }
+
+// next выдает следующий ID таблицы, как последовательность SERIAL
+func (s *Store) next(table string) int {
+	s.seq[table]++
+	return s.seq[table]
+}
+
+func (s *Store) roleByName(name string) *role {
+	for _, r := range s.roles {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// userRole - имя роли пользователя (пустая строка, если пользователя нет)
+func (s *Store) userRole(userID int) string {
+	u, ok := s.users[userID]
+	if !ok {
+		return ""
+	}
+	if r, ok := s.roles[u.RoleID]; ok {
+		return r.Name
+	}
+	return ""
+}
+
+// usernameTaken - логин занят живым пользователем или пользователем в корзине
+func (s *Store) usernameTaken(username string) bool {
+	for _, u := range s.users {
+		if u.Username == username {
+			return true
+		}
+	}
+	for _, t := range s.trash {
+		if t.user != nil && t.user.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+// insertUser добавляет пользователя; занятый логин - ошибка уникальности
+func (s *Store) insertUser(username, password, roleName, fullName string, schoolID *int, pending bool) (*user, error) {
+	r := s.roleByName(roleName)
+	if r == nil {
+		return nil, errRoleNotFound(roleName)
+	}
+	if s.usernameTaken(username) {
+		return nil, errDuplicate("users_username_key")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &user{
+		User: entity.User{
+			ID:        s.next("users"),
+			Username:  username,
+			RoleID:    r.ID,
+			FullName:  fullName,
+			SchoolID:  copyInt(schoolID),
+			CreatedAt: time.Now(),
+		},
+		passwordHash: string(hash),
+		pending:      pending,
+	}
+	s.users[u.ID] = u
+
+	return u, nil
+}
+
+// publicUser - копия пользователя с заполненной ролью, как ее возвращает UserRepository
+func (s *Store) publicUser(u *user) *entity.User {
+	out := u.User
+	out.SchoolID = copyInt(u.SchoolID)
+	out.BlockedAt = copyTime(u.BlockedAt)
+	if r, ok := s.roles[u.RoleID]; ok {
+		role := r.Role
+		role.Permissions = nil
+		out.Role = &role
+	}
+	return &out
+}
+
+// addStudentToClass - вставка в student_classes
+func (s *Store) addStudentToClass(studentID, classID int) {
+	s.studentClasses = append(s.studentClasses, [2]int{studentID, classID})
+}
+
+// studentClassIDs - классы ученика в порядке добавления
+func (s *Store) studentClassIDs(studentID int) []int {
+	var ids []int
+	for _, sc := range s.studentClasses {
+		if sc[0] == studentID {
+			ids = append(ids, sc[1])
+		}
+	}
+	return ids
+}
+
+func (s *Store) inClass(studentID, classID int) bool {
+	for _, sc := range s.studentClasses {
+		if sc[0] == studentID && sc[1] == classID {
+			return true
+		}
+	}
+	return false
+}
+
+// classMembers - ученики класса (роль student), по ФИО; pending - включать ли неподтвержденных
+func (s *Store) classMembers(classID int, pending bool) []*user {
+	var members []*user
+	for _, sc := range s.studentClasses {
+		if sc[1] != classID {
+			continue
+		}
+		u, ok := s.users[sc[0]]
+		if !ok || s.userRole(u.ID) != "student" || (u.pending && !pending) {
+			continue
+		}
+		members = append(members, u)
+	}
+	sortUsersByName(members)
+	return members
+}
+
+func (s *Store) staffMember(classID, userID int) *entity.ClassStaff {
+	for _, m := range s.staff {
+		if m.ClassID == classID && m.UserID == userID {
+			return m
+		}
+	}
+	return nil
+}
+
+// setStaff - upsert в class_staff
+func (s *Store) setStaff(classID, userID int, role string) {
+	if m := s.staffMember(classID, userID); m != nil {
+		m.Role = role
+		return
+	}
+	s.staff = append(s.staff, &entity.ClassStaff{ClassID: classID, UserID: userID, Role: role, CreatedAt: time.Now()})
+}
+
+func (s *Store) removeStaff(classID, userID int) bool {
+	for i, m := range s.staff {
+		if m.ClassID == classID && m.UserID == userID {
+			s.staff = append(s.staff[:i], s.staff[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// deleteUserSessions удаляет сессии пользователя, кроме сессии с токеном except
+func (s *Store) deleteUserSessions(userID int, except string) int64 {
+	var deleted int64
+	for id, sess := range s.sessions {
+		if sess.UserID == userID && (except == "" || sess.token != except) {
+			delete(s.sessions, id)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+func newCode(length int) (string, error) {
+	code := make([]byte, length)
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = codeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+func copyInt(v *int) *int {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func copyTime(v *time.Time) *time.Time {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// errDuplicate - нарушение ограничения уникальности, как его сообщает PostgreSQL
+func errDuplicate(constraint string) error {
+	return fmt.Errorf("повторяющееся значение ключа нарушает ограничение уникальности %q", constraint)
+}
+
+func errRoleNotFound(name string) error {
+	return fmt.Errorf("роль '%s' не найдена", name)
+}
+
+func sortUsersByName(users []*user) {
+	sort.SliceStable(users, func(i, j int) bool { return users[i].FullName < users[j].FullName })
+}
+
+var (
+	_ repository.Users          = (*userRepo)(nil)
+	_ repository.Types          = (*typeRepo)(nil)
+	_ repository.Progress       = (*progressRepo)(nil)
+	_ repository.Attempts       = (*attemptRepo)(nil)
+	_ repository.Teachers       = (*teacherRepo)(nil)
+	_ repository.TeacherScope   = (*teacherScope)(nil)
+	_ repository.SchoolScope    = (*schoolScope)(nil)
+	_ repository.ParentScope    = (*parentScope)(nil)
+	_ repository.Sessions       = (*sessionRepo)(nil)
+	_ repository.LoginThrottles = (*throttleRepo)(nil)
+	_ repository.PasswordResets = (*resetRepo)(nil)
+	_ repository.Invites        = (*inviteRepo)(nil)
+	_ repository.Quizzes        = (*quizRepo)(nil)
+	_ repository.OfflineBundles = (*offlineRepo)(nil)
+	_ repository.OIDCProviders  = (*oidcRepo)(nil)
+	_ repository.AuditLog       = (*auditRepo)(nil)
+	_ repository.Permissions    = (*permissionRepo)(nil)
+	_ repository.Roles          = (*roleRepo)(nil)
+	_ repository.Schools        = (*schoolRepo)(nil)
+	_ repository.Classes        = (*classRepo)(nil)
+	_ repository.ClassStaff     = (*staffRepo)(nil)
+	_ repository.Guardians      = (*guardianRepo)(nil)
+	_ repository.Trash          = (*trashRepo)(nil)
+	_ repository.AcademicYears  = (*yearRepo)(nil)
+	_ repository.StudentData    = (*studentDataRepo)(nil)
+)
@@ -0,0 +1,214 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"edugame/internal/repository"
+	"sort"
+	"time"
+)
+
+type studentDataRepo struct{ s *Store }
+
+func (r *studentDataRepo) Export(ctx context.Context, studentID int) (*entity.StudentDataExport, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[studentID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if r.s.userRole(studentID) != "student" {
+		return nil, repository.ErrNotStudent
+	}
+
+	export := &entity.StudentDataExport{
+		ExportedAt: time.Now(),
+		User: entity.StudentRecord{
+			ID:                 u.ID,
+			Username:           u.Username,
+			FullName:           u.FullName,
+			Email:              u.email,
+			Role:               "student",
+			SchoolID:           copyInt(u.SchoolID),
+			Blocked:            u.Blocked,
+			BlockedReason:      u.BlockedReason,
+			BlockedAt:          copyTime(u.BlockedAt),
+			Pending:            u.pending,
+			HasPicturePassword: u.pictureHash != "",
+			CreatedAt:          u.CreatedAt,
+			ErasedAt:           copyTime(u.erasedAt),
+		},
+	}
+	if u.SchoolID != nil {
+		if school, ok := r.s.schools[*u.SchoolID]; ok {
+			export.User.SchoolName = school.Name
+		}
+	}
+
+	for _, classID := range r.s.studentClassIDs(studentID) {
+		c, ok := r.s.classes[classID]
+		if !ok {
+			continue
+		}
+		record := entity.StudentClassRecord{ClassID: c.ID, ClassName: c.Name, Grade: c.Grade, JoinedAt: c.CreatedAt}
+		if c.SchoolID != nil {
+			if school, ok := r.s.schools[*c.SchoolID]; ok {
+				record.SchoolName = school.Name
+			}
+		}
+		export.Classes = append(export.Classes, record)
+	}
+
+	for _, a := range r.s.attempts {
+		if a.UserID == studentID {
+			export.Attempts = append(export.Attempts, a)
+		}
+	}
+
+	for _, t := range r.s.progressTypes(studentID) {
+		stat := r.s.typeStat(studentID, t.ID)
+		p := entity.StudentProgressRecord{
+			EquationTypeID:   t.ID,
+			EquationTypeName: t.Name,
+			AttemptsCount:    stat.Attempts,
+			CorrectCount:     stat.Correct,
+			IsUnlocked:       t.IsAvailable,
+			CreatedAt:        u.CreatedAt,
+			UpdatedAt:        u.CreatedAt,
+		}
+		if stat.LastAttempt.Valid {
+			last := stat.LastAttempt.Time
+			p.LastAttemptAt = &last
+			p.UpdatedAt = last
+		}
+		export.Progress = append(export.Progress, p)
+	}
+
+	for _, sess := range r.s.sessions {
+		if sess.UserID == studentID {
+			out := sess.UserSession
+			out.SessionToken = ""
+			export.Sessions = append(export.Sessions, out)
+		}
+	}
+	sort.Slice(export.Sessions, func(i, j int) bool { return export.Sessions[i].ID < export.Sessions[j].ID })
+
+	for _, e := range r.s.audit {
+		if e.TargetType == "user" && e.TargetID != nil && *e.TargetID == studentID {
+			export.Audit = append(export.Audit, entity.StudentAuditRecord{
+				ID: e.ID, Action: e.Action, Before: e.Before, After: e.After, CreatedAt: e.CreatedAt,
+			})
+		}
+	}
+
+	return export, nil
+}
+
+func (r *studentDataRepo) Erase(ctx context.Context, studentID, erasedBy int) (*repository.ErasureResult, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[studentID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if r.s.userRole(studentID) != "student" {
+		return nil, repository.ErrNotStudent
+	}
+	if u.erasedAt != nil {
+		return nil, repository.ErrAlreadyErased
+	}
+
+	now := time.Now()
+	delete(r.s.throttles, "user:"+u.Username)
+	u.Username = entity.ErasedUsername(studentID)
+	u.FullName = entity.ErasedFullName
+	u.email = ""
+	u.passwordHash = "!"
+	u.pictureHash = ""
+	u.Blocked = true
+	u.BlockedReason = "Персональные данные удалены"
+	u.BlockedAt = &now
+	u.failedLogins = 0
+	u.lockedUntil = time.Time{}
+	u.erasedAt = &now
+
+	result := &repository.ErasureResult{
+		ClassesKept:     len(r.s.studentClassIDs(studentID)),
+		SessionsDeleted: r.s.deleteUserSessions(studentID, ""),
+	}
+	for _, a := range r.s.attempts {
+		if a.UserID == studentID {
+			result.AttemptsKept++
+		}
+	}
+
+	identities := r.s.identities[:0]
+	for _, i := range r.s.identities {
+		if i.userID == studentID {
+			result.IdentitiesDeleted++
+			continue
+		}
+		identities = append(identities, i)
+	}
+	r.s.identities = identities
+
+	guardians := r.s.guardians[:0]
+	for _, g := range r.s.guardians {
+		if g.studentID == studentID {
+			result.GuardiansDeleted++
+			continue
+		}
+		guardians = append(guardians, g)
+	}
+	r.s.guardians = guardians
+
+	guardianCodes := r.s.guardianCodes[:0]
+	for _, c := range r.s.guardianCodes {
+		if c.StudentID != studentID {
+			guardianCodes = append(guardianCodes, c)
+		}
+	}
+	r.s.guardianCodes = guardianCodes
+
+	summaries := r.s.summaries[:0]
+	for _, w := range r.s.summaries {
+		if w.StudentID != studentID {
+			summaries = append(summaries, w)
+		}
+	}
+	r.s.summaries = summaries
+
+	codes := r.s.resetCodes[:0]
+	for _, c := range r.s.resetCodes {
+		if c.UserID != studentID {
+			codes = append(codes, c)
+		}
+	}
+	r.s.resetCodes = codes
+
+	for id, b := range r.s.bundles {
+		if b.UserID == studentID {
+			delete(r.s.bundles, id)
+		}
+	}
+
+	for id, q := range r.s.quizzes {
+		if q.userID == studentID {
+			delete(r.s.quizzes, id)
+		}
+	}
+
+	// Строки архива пересоздаются в PostgreSQL с обезличенным именем; цифры не меняются
+	for i := range r.s.yearStudents {
+		if st := &r.s.yearStudents[i]; st.StudentID == studentID {
+			st.Username = entity.ErasedUsername(studentID)
+			st.FullName = entity.ErasedFullName
+			result.YearRecordsAnonymized++
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,968 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal"
+	"edugame/internal/entity"
+	"edugame/internal/generator"
+	"edugame/internal/repository"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type teacherRepo struct{ s *Store }
+
+func (r *teacherRepo) GetClassStudents(ctx context.Context, classID int) ([]repository.ClassStudent, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+
+	var students []repository.ClassStudent
+	for _, u := range r.s.classMembers(classID, false) {
+		if u.pending {
+			continue
+		}
+		students = append(students, repository.ClassStudent{
+			ID:                 u.ID,
+			Username:           u.Username,
+			FullName:           u.FullName,
+			IsLocked:           u.lockedUntil.After(now),
+			HasPicturePassword: u.pictureHash != "",
+			IsBlocked:          u.Blocked,
+			BlockedReason:      u.BlockedReason,
+			BlockedAt:          copyTime(u.BlockedAt),
+		})
+	}
+
+	return students, nil
+}
+
+func (r *teacherRepo) GetClassLoginCode(ctx context.Context, classID int) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c, ok := r.s.classes[classID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return c.loginCode, nil
+}
+
+func (r *teacherRepo) RotateClassLoginCode(ctx context.Context, classID int) (string, error) {
+	return r.rotateClassCode(classID, internal.ClassLoginCodeLength, func(c *class) *string { return &c.loginCode })
+}
+
+func (r *teacherRepo) GetClassByLoginCode(ctx context.Context, code string) (repository.ClassRef, error) {
+	return r.getClassByCode(code, func(c *class) string { return c.loginCode })
+}
+
+func (r *teacherRepo) GetClassJoinCode(ctx context.Context, classID int) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c, ok := r.s.classes[classID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return c.joinCode, nil
+}
+
+func (r *teacherRepo) RotateClassJoinCode(ctx context.Context, classID int) (string, error) {
+	return r.rotateClassCode(classID, internal.ClassJoinCodeLength, func(c *class) *string { return &c.joinCode })
+}
+
+func (r *teacherRepo) GetClassByJoinCode(ctx context.Context, code string) (repository.ClassRef, error) {
+	return r.getClassByCode(code, func(c *class) string { return c.joinCode })
+}
+
+// rotateClassCode выдает классу новый уникальный код; field выбирает, какой из кодов меняется
+func (r *teacherRepo) rotateClassCode(classID, length int, field func(*class) *string) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	c, ok := r.s.classes[classID]
+	if !ok {
+		// UPDATE без совпавших строк в PostgreSQL-реализации ошибки не дает
+		return newCode(length)
+	}
+
+	for i := 0; i < 5; i++ {
+		code, err := newCode(length)
+		if err != nil {
+			return "", err
+		}
+
+		taken := false
+		for _, other := range r.s.classes {
+			if other.ID != classID && *field(other) == code {
+				taken = true
+				break
+			}
+		}
+		if taken {
+			continue
+		}
+
+		*field(c) = code
+		return code, nil
+	}
+
+	return "", fmt.Errorf("не удалось подобрать уникальный код класса")
+}
+
+func (r *teacherRepo) getClassByCode(code string, field func(*class) string) (repository.ClassRef, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	code = repository.NormalizeResetCode(code)
+	if code == "" {
+		return repository.ClassRef{}, sql.ErrNoRows
+	}
+
+	for _, c := range r.s.classes {
+		if field(c) == code {
+			return repository.ClassRef{ID: c.ID, Name: c.Name, Grade: c.Grade}, nil
+		}
+	}
+
+	return repository.ClassRef{}, sql.ErrNoRows
+}
+
+func (r *teacherRepo) GetPendingStudents(ctx context.Context, classID int) ([]repository.PendingStudent, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var students []repository.PendingStudent
+	for _, u := range r.s.classUsers(classID) {
+		if u.pending {
+			students = append(students, repository.PendingStudent{
+				ID: u.ID, Username: u.Username, FullName: u.FullName, CreatedAt: u.CreatedAt,
+			})
+		}
+	}
+	sort.SliceStable(students, func(i, j int) bool { return students[i].CreatedAt.Before(students[j].CreatedAt) })
+
+	return students, nil
+}
+
+func (r *teacherRepo) ApproveStudent(ctx context.Context, classID, studentID int) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[studentID]
+	if !ok || !u.pending || !r.s.inClass(studentID, classID) {
+		return false, nil
+	}
+
+	u.pending = false
+	return true, nil
+}
+
+func (r *teacherRepo) RejectStudent(ctx context.Context, classID, studentID int) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[studentID]
+	if !ok || !u.pending || !r.s.inClass(studentID, classID) {
+		return false, nil
+	}
+
+	r.s.deleteUser(studentID)
+	return true, nil
+}
+
+func (r *teacherRepo) UnlockStudent(ctx context.Context, classID, studentID int) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[studentID]
+	if !ok || !r.s.inClass(studentID, classID) {
+		return false, nil
+	}
+
+	u.failedLogins = 0
+	u.lockedUntil = time.Time{}
+	delete(r.s.throttles, repository.LoginThrottleUserKey(u.Username))
+	delete(r.s.throttles, repository.LoginThrottlePictureKey(studentID))
+
+	return true, nil
+}
+
+func (r *teacherRepo) GetClassStatistics(ctx context.Context, classID int) (map[string]interface{}, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stats := make(map[string]interface{})
+
+	var total, correct int
+	members := r.s.classMembers(classID, false)
+	for _, u := range members {
+		t, c := r.s.attemptTotals(u.ID)
+		total += t
+		correct += c
+	}
+
+	stats["student_count"] = len(members)
+	stats["total_attempts"] = total
+	stats["correct_attempts"] = correct
+	if total > 0 {
+		stats["accuracy_percent"] = percent(correct, total)
+	} else {
+		stats["accuracy_percent"] = 0
+	}
+
+	userIDs := r.s.classUserIDs(classID)
+	stats["activity"] = r.s.activity(userIDs)
+	stats["type_statistics"] = r.s.typeStatistics(userIDs)
+
+	topStudents := r.s.topStudents(classID)
+	if len(topStudents) > 5 {
+		topStudents = topStudents[:5]
+	}
+	stats["top_students"] = topStudents
+
+	return stats, nil
+}
+
+func (r *teacherRepo) GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.studentStatistics(studentID)
+}
+
+func (r *teacherRepo) GetDailyClassResults(ctx context.Context, classID int, weeksOffset int) (*repository.DailyClassResults, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	students := make([]repository.StudentInfo, 0)
+	for _, u := range r.s.classMembers(classID, false) {
+		students = append(students, repository.StudentInfo{ID: u.ID, FullName: u.FullName})
+	}
+
+	return repository.BuildWeeklyResults(ctx, students, weeksOffset, r.s.dailySessions)
+}
+
+func (r *teacherRepo) ForTeacher(teacherID int) repository.TeacherScope {
+	return &teacherScope{s: r.s, teacherID: teacherID}
+}
+
+func (r *teacherRepo) ForSchool(schoolID *int) repository.SchoolScope {
+	return &schoolScope{s: r.s, schoolID: copyInt(schoolID)}
+}
+
+func (r *teacherRepo) ForParent(parentID int) repository.ParentScope {
+	return &parentScope{s: r.s, parentID: parentID}
+}
+
+// Статистика. Вспомогательные методы вызываются под s.mu.
+
+// classUsers - все пользователи, записанные в класс, независимо от роли и подтверждения
+func (s *Store) classUsers(classID int) []*user {
+	var users []*user
+	for _, sc := range s.studentClasses {
+		if sc[1] != classID {
+			continue
+		}
+		if u, ok := s.users[sc[0]]; ok {
+			users = append(users, u)
+		}
+	}
+	return users
+}
+
+func (s *Store) classUserIDs(classID int) map[int]bool {
+	ids := make(map[int]bool)
+	for _, u := range s.classUsers(classID) {
+		ids[u.ID] = true
+	}
+	return ids
+}
+
+func (s *Store) attemptTotals(userID int) (total, correct int) {
+	for _, a := range s.attempts {
+		if a.UserID == userID {
+			total++
+			if a.IsCorrect {
+				correct++
+			}
+		}
+	}
+	return total, correct
+}
+
+// activitySince - начало окна активности: CURRENT_DATE - INTERVAL '7 days'
+func activitySince() time.Time {
+	y, m, d := time.Now().AddDate(0, 0, -7).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// activity - попытки пользователей за последние 7 дней по датам, новые даты первыми
+func (s *Store) activity(userIDs map[int]bool) []map[string]interface{} {
+	since := activitySince()
+
+	type day struct {
+		date              time.Time
+		attempts, correct int
+	}
+	days := make(map[string]*day)
+
+	for _, a := range s.attempts {
+		if !userIDs[a.UserID] || a.CreatedAt.Before(since) {
+			continue
+		}
+		y, m, d := a.CreatedAt.Date()
+		key := a.CreatedAt.Format("2006-01-02")
+		if days[key] == nil {
+			days[key] = &day{date: time.Date(y, m, d, 0, 0, 0, 0, a.CreatedAt.Location())}
+		}
+		days[key].attempts++
+		if a.IsCorrect {
+			days[key].correct++
+		}
+	}
+
+	sorted := make([]*day, 0, len(days))
+	for _, d := range days {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].date.After(sorted[j].date) })
+
+	var activity []map[string]interface{}
+	for _, d := range sorted {
+		activity = append(activity, map[string]interface{}{
+			"date":     d.date.Format("02.01"),
+			"attempts": d.attempts,
+			"correct":  d.correct,
+			"accuracy": percent(d.correct, d.attempts),
+		})
+	}
+	return activity
+}
+
+// typeStatistics - попытки пользователей по типам уравнений, самые решаемые типы первыми
+func (s *Store) typeStatistics(userIDs map[int]bool) []map[string]interface{} {
+	type typeCount struct {
+		name              string
+		attempts, correct int
+	}
+	counts := make(map[int]*typeCount)
+
+	for _, a := range s.attempts {
+		t, ok := s.types[a.EquationTypeID]
+		if !userIDs[a.UserID] || !ok {
+			continue
+		}
+		if counts[t.ID] == nil {
+			counts[t.ID] = &typeCount{name: t.Name}
+		}
+		counts[t.ID].attempts++
+		if a.IsCorrect {
+			counts[t.ID].correct++
+		}
+	}
+
+	sorted := make([]*typeCount, 0, len(counts))
+	for _, c := range counts {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].attempts != sorted[j].attempts {
+			return sorted[i].attempts > sorted[j].attempts
+		}
+		return sorted[i].name < sorted[j].name
+	})
+
+	var typeStats []map[string]interface{}
+	for _, c := range sorted {
+		typeStats = append(typeStats, map[string]interface{}{
+			"type_name": c.name,
+			"attempts":  c.attempts,
+			"correct":   c.correct,
+			"accuracy":  percent(c.correct, c.attempts),
+		})
+	}
+	return typeStats
+}
+
+// topStudents - пользователи класса по убыванию числа верных ответов
+func (s *Store) topStudents(classID int) []map[string]interface{} {
+	users := s.classUsers(classID)
+
+	type row struct {
+		u              *user
+		total, correct int
+	}
+	rows := make([]row, 0, len(users))
+	for _, u := range users {
+		total, correct := s.attemptTotals(u.ID)
+		rows = append(rows, row{u: u, total: total, correct: correct})
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].correct > rows[j].correct })
+
+	var top []map[string]interface{}
+	for _, r := range rows {
+		top = append(top, map[string]interface{}{
+			"id":       r.u.ID,
+			"name":     r.u.FullName,
+			"total":    r.total,
+			"correct":  r.correct,
+			"accuracy": percent(r.correct, r.total),
+		})
+	}
+	return top
+}
+
+func (s *Store) classesStatistics(schoolID *int) map[int]map[string]interface{} {
+	classes := s.sortedClasses(schoolID)
+
+	overall := map[string]interface{}{
+		"total_classes":         0,
+		"total_students":        0,
+		"total_attempts":        0,
+		"total_correct":         0,
+		"overall_accuracy":      0.0,
+		"most_active_class":     nil,
+		"best_performing_class": nil,
+		// Дублирующие поля для шаблона
+		"student_count":    0,
+		"correct_attempts": 0,
+		"accuracy_percent": 0.0,
+		"top_students":     []map[string]interface{}{},
+	}
+	result := map[int]map[string]interface{}{0: overall}
+
+	if len(classes) == 0 {
+		return result
+	}
+
+	var totalStudents, totalAttempts, totalCorrect int
+	var mostActiveClass, bestPerformingClass map[string]interface{}
+	maxAttempts := 0
+	maxAccuracy := 0.0
+	var allTopStudents []map[string]interface{}
+
+	for _, c := range classes {
+		data := map[string]interface{}{
+			"class_id":                 c.ID,
+			"class_name":               c.Name,
+			"grade":                    c.Grade,
+			"student_count":            0,
+			"total_attempts":           0,
+			"correct_attempts":         0,
+			"accuracy_percent":         0.0,
+			"avg_attempts_per_student": 0.0,
+		}
+
+		var studentCount, attempts, correct int
+		for _, u := range s.classUsers(c.ID) {
+			if s.userRole(u.ID) != "student" {
+				continue
+			}
+			studentCount++
+			t, c := s.attemptTotals(u.ID)
+			attempts += t
+			correct += c
+		}
+
+		if studentCount > 0 {
+			data["student_count"] = studentCount
+			data["total_attempts"] = attempts
+			data["correct_attempts"] = correct
+			if attempts > 0 {
+				data["accuracy_percent"] = percent(correct, attempts)
+			}
+			data["avg_attempts_per_student"] = float64(attempts) / float64(studentCount)
+		}
+
+		userIDs := s.classUserIDs(c.ID)
+		if activity := s.activity(userIDs); activity != nil {
+			data["activity"] = activity
+		}
+		if typeStats := s.typeStatistics(userIDs); typeStats != nil {
+			data["type_statistics"] = typeStats
+		}
+		if top := s.topStudents(c.ID); len(top) > 0 {
+			if len(top) > 5 {
+				top = top[:5]
+			}
+			data["top_students"] = top
+			allTopStudents = append(allTopStudents, top...)
+		}
+
+		totalStudents += studentCount
+		totalAttempts += attempts
+		totalCorrect += correct
+
+		if attempts > maxAttempts {
+			maxAttempts = attempts
+			mostActiveClass = map[string]interface{}{
+				"class_id":   c.ID,
+				"class_name": c.Name,
+				"attempts":   attempts,
+			}
+		}
+
+		accuracy, _ := data["accuracy_percent"].(float64)
+		if attempts > 0 && accuracy > maxAccuracy {
+			maxAccuracy = accuracy
+			bestPerformingClass = map[string]interface{}{
+				"class_id":   c.ID,
+				"class_name": c.Name,
+				"accuracy":   accuracy,
+			}
+		}
+
+		result[c.ID] = data
+	}
+
+	overall["total_classes"] = len(classes)
+	overall["total_students"] = totalStudents
+	overall["total_attempts"] = totalAttempts
+	overall["total_correct"] = totalCorrect
+	overall["most_active_class"] = mostActiveClass
+	overall["best_performing_class"] = bestPerformingClass
+	overall["student_count"] = totalStudents
+	overall["correct_attempts"] = totalCorrect
+
+	if totalAttempts > 0 {
+		accuracy := percent(totalCorrect, totalAttempts)
+		overall["overall_accuracy"] = accuracy
+		overall["accuracy_percent"] = accuracy
+	}
+
+	if len(allTopStudents) > 0 {
+		sort.SliceStable(allTopStudents, func(i, j int) bool {
+			accI, _ := allTopStudents[i]["accuracy"].(float64)
+			accJ, _ := allTopStudents[j]["accuracy"].(float64)
+			return accI > accJ
+		})
+		if len(allTopStudents) > 10 {
+			allTopStudents = allTopStudents[:10]
+		}
+		overall["top_students"] = allTopStudents
+	}
+
+	return result
+}
+
+func (s *Store) studentStatistics(studentID int) (map[string]interface{}, error) {
+	u, ok := s.users[studentID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	stats := make(map[string]interface{})
+
+	stats["student_info"] = map[string]interface{}{
+		"id":         studentID,
+		"username":   u.Username,
+		"fullname":   u.FullName,
+		"created_at": u.CreatedAt.Format(time.RFC3339Nano),
+	}
+
+	total, correct := s.attemptTotals(studentID)
+	stats["overall"] = map[string]interface{}{
+		"total_attempts":   total,
+		"correct_attempts": correct,
+		"accuracy":         percent(correct, total),
+	}
+
+	types := s.typesWhere(func(*generator.EquationType) bool { return true })
+	sort.SliceStable(types, func(i, j int) bool {
+		if types[i].Class != types[j].Class {
+			return types[i].Class < types[j].Class
+		}
+		return types[i].Name < types[j].Name
+	})
+
+	var typeStats []map[string]interface{}
+	for _, t := range types {
+		stat := s.typeStat(studentID, t.ID)
+		lastAttempt := "Не решал"
+		if stat.LastAttempt.Valid {
+			lastAttempt = stat.LastAttempt.Time.Format("02.01.2006 15:04")
+		}
+
+		typeStats = append(typeStats, map[string]interface{}{
+			"type_id":      t.ID,
+			"type_name":    t.Name,
+			"class":        t.Class,
+			"attempts":     stat.Attempts,
+			"correct":      stat.Correct,
+			"accuracy":     percent(stat.Correct, stat.Attempts),
+			"last_attempt": lastAttempt,
+		})
+	}
+	stats["type_statistics"] = typeStats
+
+	var recentAttempts []map[string]interface{}
+	for _, a := range s.studentAttempts(studentID, func(a entity.Attempt) bool {
+		_, ok := s.types[a.EquationTypeID]
+		return ok
+	}) {
+		if len(recentAttempts) == 10 {
+			break
+		}
+		recentAttempts = append(recentAttempts, map[string]interface{}{
+			"id":             a.ID,
+			"equation_text":  a.EquationText,
+			"correct_answer": a.CorrectAnswer,
+			"user_answer":    a.UserAnswer,
+			"is_correct":     a.IsCorrect,
+			"created_at":     a.CreatedAt.Format("02.01 15:04"),
+			"type_name":      s.types[a.EquationTypeID].Name,
+		})
+	}
+	stats["recent_attempts"] = recentAttempts
+
+	return stats, nil
+}
+
+func (s *Store) studentAttemptsByType(studentID, typeID int) []map[string]interface{} {
+	var attempts []map[string]interface{}
+	for _, a := range s.studentAttempts(studentID, func(a entity.Attempt) bool { return a.EquationTypeID == typeID }) {
+		status, statusClass := "❌ Неправильно", "incorrect"
+		if a.IsCorrect {
+			status, statusClass = "✅ Правильно", "correct"
+		}
+
+		attempts = append(attempts, map[string]interface{}{
+			"id":             a.ID,
+			"equation_text":  a.EquationText,
+			"correct_answer": a.CorrectAnswer,
+			"user_answer":    a.UserAnswer,
+			"is_correct":     a.IsCorrect,
+			"created_at":     a.CreatedAt.Format("02.01.2006 15:04"),
+			"status":         status,
+			"status_class":   statusClass,
+		})
+	}
+	return attempts
+}
+
+// studentAttempts - попытки ученика, подходящие под match, новые первыми
+func (s *Store) studentAttempts(studentID int, match func(entity.Attempt) bool) []entity.Attempt {
+	var attempts []entity.Attempt
+	for _, a := range s.attempts {
+		if a.UserID == studentID && match(a) {
+			attempts = append(attempts, a)
+		}
+	}
+	sort.SliceStable(attempts, func(i, j int) bool { return attempts[i].CreatedAt.After(attempts[j].CreatedAt) })
+	return attempts
+}
+
+// dailySessions - полные сессии ученика (ровно 10 попыток за час) по датам, как GetStudentDailyResults.
+// Вызывается из BuildWeeklyResults под s.mu.
+func (s *Store) dailySessions(_ context.Context, studentID int, startDate, endDate time.Time) (map[string][]repository.SessionResult, error) {
+	start := startDate.Format("2006-01-02")
+	end := endDate.Format("2006-01-02")
+
+	type hourKey struct {
+		date string
+		hour int
+	}
+	groups := make(map[hourKey]*repository.SessionResult)
+
+	for _, a := range s.attempts {
+		date := a.CreatedAt.Format("2006-01-02")
+		if a.UserID != studentID || date < start || date > end {
+			continue
+		}
+		key := hourKey{date: date, hour: a.CreatedAt.Hour()}
+		if groups[key] == nil {
+			groups[key] = &repository.SessionResult{Hour: key.hour}
+		}
+		groups[key].Total++
+		if a.IsCorrect {
+			groups[key].Correct++
+		}
+	}
+
+	keys := make([]hourKey, 0, len(groups))
+	for key, g := range groups {
+		if g.Total == 10 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].date != keys[j].date {
+			return keys[i].date < keys[j].date
+		}
+		return keys[i].hour < keys[j].hour
+	})
+
+	results := make(map[string][]repository.SessionResult)
+	for _, key := range keys {
+		results[key.date] = append(results[key.date], *groups[key])
+	}
+	return results, nil
+}
+
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+// teacherScope - классы, в состав которых входит учитель (class_staff)
+type teacherScope struct {
+	s         *Store
+	teacherID int
+}
+
+func (sc *teacherScope) GetClasses(ctx context.Context) ([]*entity.Class, error) {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	var classes []*entity.Class
+	for _, c := range sc.s.sortedClasses(nil) {
+		if m := sc.s.staffMember(c.ID, sc.teacherID); m != nil {
+			out := publicClass(c)
+			out.StaffRole = m.Role
+			classes = append(classes, &out)
+		}
+	}
+
+	return classes, nil
+}
+
+func (sc *teacherScope) GetClass(ctx context.Context, classID int) (*entity.Class, error) {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	c, ok := sc.s.classes[classID]
+	m := sc.s.staffMember(classID, sc.teacherID)
+	if !ok || m == nil {
+		return nil, repository.ErrNotInScope
+	}
+
+	out := publicClass(c)
+	out.StaffRole = m.Role
+	return &out, nil
+}
+
+func (sc *teacherScope) GetClassSummaries(ctx context.Context) ([]*repository.ClassSummary, error) {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	since := activitySince()
+
+	var summaries []*repository.ClassSummary
+	for _, c := range sc.s.sortedClasses(nil) {
+		m := sc.s.staffMember(c.ID, sc.teacherID)
+		if m == nil {
+			continue
+		}
+
+		summary := &repository.ClassSummary{ID: c.ID, Name: c.Name, Grade: c.Grade, Role: m.Role}
+		for _, u := range sc.s.classUsers(c.ID) {
+			if u.pending {
+				summary.PendingCount++
+				continue
+			}
+			summary.StudentCount++
+			for _, a := range sc.s.attempts {
+				if a.UserID != u.ID {
+					continue
+				}
+				summary.TotalAttempts++
+				if a.IsCorrect {
+					summary.CorrectAttempts++
+				}
+				if !a.CreatedAt.Before(since) {
+					summary.WeekAttempts++
+				}
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+func (sc *teacherScope) CheckStudent(ctx context.Context, studentID int) error {
+	return sc.checkStudent(studentID, entity.StaffRoles)
+}
+
+func (sc *teacherScope) CheckStudentManage(ctx context.Context, studentID int) error {
+	return sc.checkStudent(studentID, []string{entity.StaffRoleLead, entity.StaffRoleAssistant})
+}
+
+func (sc *teacherScope) checkStudent(studentID int, roles []string) error {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	u, ok := sc.s.users[studentID]
+	if !ok || u.pending {
+		return repository.ErrNotInScope
+	}
+
+	for _, classID := range sc.s.studentClassIDs(studentID) {
+		m := sc.s.staffMember(classID, sc.teacherID)
+		if m == nil {
+			continue
+		}
+		for _, role := range roles {
+			if m.Role == role {
+				return nil
+			}
+		}
+	}
+
+	return repository.ErrNotInScope
+}
+
+func (sc *teacherScope) GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error) {
+	if err := sc.CheckStudent(ctx, studentID); err != nil {
+		return nil, err
+	}
+
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	return sc.s.studentStatistics(studentID)
+}
+
+func (sc *teacherScope) GetStudentAttemptsByType(ctx context.Context, studentID, typeID int) ([]map[string]interface{}, error) {
+	if err := sc.CheckStudent(ctx, studentID); err != nil {
+		return nil, err
+	}
+
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	return sc.s.studentAttemptsByType(studentID, typeID), nil
+}
+
+// schoolScope - классы и ученики школы; без школы - все
+type schoolScope struct {
+	s        *Store
+	schoolID *int
+}
+
+func (sc *schoolScope) GetAllClasses(ctx context.Context) ([]*entity.Class, error) {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	var classes []*entity.Class
+	for _, c := range sc.s.sortedClasses(sc.schoolID) {
+		out := publicClass(c)
+		out.CreatedAt = time.Time{}
+		classes = append(classes, &out)
+	}
+
+	return classes, nil
+}
+
+func (sc *schoolScope) GetClassesStatistics(ctx context.Context) (map[int]map[string]interface{}, error) {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	return sc.s.classesStatistics(sc.schoolID), nil
+}
+
+func (sc *schoolScope) CheckClass(ctx context.Context, classID int) error {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	if c, ok := sc.s.classes[classID]; ok && sc.inSchool(c) {
+		return nil
+	}
+	return repository.ErrNotInScope
+}
+
+func (sc *schoolScope) CheckStudent(ctx context.Context, studentID int) error {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	for _, classID := range sc.s.studentClassIDs(studentID) {
+		if c, ok := sc.s.classes[classID]; ok && sc.inSchool(c) {
+			return nil
+		}
+	}
+	return repository.ErrNotInScope
+}
+
+func (sc *schoolScope) inSchool(c *class) bool {
+	return sc.schoolID == nil || (c.SchoolID != nil && *c.SchoolID == *sc.schoolID)
+}
+
+func (sc *schoolScope) GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error) {
+	if err := sc.CheckStudent(ctx, studentID); err != nil {
+		return nil, err
+	}
+
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	return sc.s.studentStatistics(studentID)
+}
+
+func (sc *schoolScope) GetStudentAttemptsByType(ctx context.Context, studentID, typeID int) ([]map[string]interface{}, error) {
+	if err := sc.CheckStudent(ctx, studentID); err != nil {
+		return nil, err
+	}
+
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	return sc.s.studentAttemptsByType(studentID, typeID), nil
+}
+
+// parentScope - только привязанные к родителю подтвержденные ученики
+type parentScope struct {
+	s        *Store
+	parentID int
+}
+
+func (sc *parentScope) CheckStudent(ctx context.Context, studentID int) error {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	_, err := sc.child(studentID)
+	return err
+}
+
+func (sc *parentScope) child(studentID int) (*user, error) {
+	u, ok := sc.s.users[studentID]
+	if !ok || u.pending {
+		return nil, repository.ErrNotInScope
+	}
+
+	for _, g := range sc.s.guardians {
+		if g.parentID == sc.parentID && g.studentID == studentID {
+			return u, nil
+		}
+	}
+	return nil, repository.ErrNotInScope
+}
+
+func (sc *parentScope) GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error) {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	if _, err := sc.child(studentID); err != nil {
+		return nil, err
+	}
+
+	return sc.s.studentStatistics(studentID)
+}
+
+func (sc *parentScope) GetStudentWeeklyResults(ctx context.Context, studentID, weeksOffset int) (*repository.DailyClassResults, error) {
+	sc.s.mu.Lock()
+	defer sc.s.mu.Unlock()
+
+	u, err := sc.child(studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	students := []repository.StudentInfo{{ID: u.ID, FullName: u.FullName}}
+	return repository.BuildWeeklyResults(ctx, students, weeksOffset, sc.s.dailySessions)
+}
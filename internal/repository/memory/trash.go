@@ -0,0 +1,260 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"edugame/internal/generator"
+	"edugame/internal/repository"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// trashKey - объект корзины: вид и ID
+type trashKey struct {
+	kind string
+	id   int
+}
+
+// trashed - удаленная строка. В PostgreSQL она остается в своей таблице с deleted_at,
+// здесь переносится из живой карты, чтобы остальные репозитории ее не видели.
+type trashed struct {
+	deletedAt time.Time
+	school    *entity.School
+	class     *class
+	user      *user
+	typ       *generator.EquationType
+}
+
+// schoolID - школа удаленного класса или пользователя
+func (t *trashed) schoolID() *int {
+	switch {
+	case t.class != nil:
+		return t.class.SchoolID
+	case t.user != nil:
+		return t.user.SchoolID
+	}
+	return nil
+}
+
+func (s *Store) trashUser(id int, at time.Time) {
+	u, ok := s.users[id]
+	if !ok {
+		return
+	}
+	delete(s.users, id)
+	s.deleteUserSessions(id, "")
+	s.trash[trashKey{entity.TrashUser, id}] = &trashed{deletedAt: at, user: u}
+}
+
+// trashClass переносит класс в корзину; состав учеников и сотрудников сохраняется
+func (s *Store) trashClass(id int, at time.Time) {
+	c, ok := s.classes[id]
+	if !ok {
+		return
+	}
+	delete(s.classes, id)
+	s.trash[trashKey{entity.TrashClass, id}] = &trashed{deletedAt: at, class: c}
+}
+
+// trashSchool переносит в корзину школу, ее классы и пользователей с одним временем удаления
+func (s *Store) trashSchool(id int, at time.Time) {
+	school, ok := s.schools[id]
+	if !ok {
+		return
+	}
+	delete(s.schools, id)
+	s.trash[trashKey{entity.TrashSchool, id}] = &trashed{deletedAt: at, school: school}
+
+	for classID, c := range s.classes {
+		if c.SchoolID != nil && *c.SchoolID == id {
+			s.trashClass(classID, at)
+		}
+	}
+	for userID, u := range s.users {
+		if u.SchoolID != nil && *u.SchoolID == id {
+			s.trashUser(userID, at)
+		}
+	}
+}
+
+func (s *Store) trashType(id int, at time.Time) {
+	et, ok := s.types[id]
+	if !ok {
+		return
+	}
+	delete(s.types, id)
+	s.trash[trashKey{entity.TrashEquationType, id}] = &trashed{deletedAt: at, typ: et}
+}
+
+// liveSchool - школа не в корзине (nil - объект без школы)
+func (s *Store) liveSchool(schoolID *int) bool {
+	if schoolID == nil {
+		return true
+	}
+	_, deleted := s.trash[trashKey{entity.TrashSchool, *schoolID}]
+	return !deleted
+}
+
+// cascaded - объект удален вместе со своей школой
+func (s *Store) cascaded(t *trashed) bool {
+	schoolID := t.schoolID()
+	if schoolID == nil {
+		return false
+	}
+	school, ok := s.trash[trashKey{entity.TrashSchool, *schoolID}]
+	return ok && school.deletedAt.Equal(t.deletedAt)
+}
+
+// restore возвращает строку в живую карту
+func (s *Store) restore(key trashKey) {
+	t := s.trash[key]
+	delete(s.trash, key)
+	switch {
+	case t.school != nil:
+		s.schools[key.id] = t.school
+	case t.class != nil:
+		s.classes[key.id] = t.class
+	case t.user != nil:
+		s.users[key.id] = t.user
+	case t.typ != nil:
+		s.types[key.id] = t.typ
+	}
+}
+
+type trashRepo struct{ s *Store }
+
+func (r *trashRepo) GetItems(ctx context.Context) ([]entity.TrashItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cascaded := make(map[int]int)
+	for _, t := range r.s.trash {
+		if r.s.cascaded(t) {
+			cascaded[*t.schoolID()]++
+		}
+	}
+
+	var items []entity.TrashItem
+	for key, t := range r.s.trash {
+		if r.s.cascaded(t) {
+			continue
+		}
+
+		item := entity.TrashItem{Kind: key.kind, ID: key.id, DeletedAt: t.deletedAt}
+		switch {
+		case t.school != nil:
+			item.Name = t.school.Name
+			item.Cascaded = cascaded[key.id]
+		case t.class != nil:
+			item.Name = t.class.Name
+			if schoolID := t.schoolID(); schoolID != nil {
+				if school, ok := r.s.schools[*schoolID]; ok {
+					item.Details = school.Name
+				} else if st, ok := r.s.trash[trashKey{entity.TrashSchool, *schoolID}]; ok {
+					item.Details = st.school.Name
+				}
+			}
+		case t.user != nil:
+			item.Name = t.user.FullName
+			item.Details = t.user.Username
+		case t.typ != nil:
+			item.Name = t.typ.Name
+			item.Details = fmt.Sprintf("%d класс", t.typ.Class)
+		}
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].DeletedAt.Equal(items[j].DeletedAt) {
+			return items[i].DeletedAt.After(items[j].DeletedAt)
+		}
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].ID < items[j].ID
+	})
+
+	return items, nil
+}
+
+func (r *trashRepo) Restore(ctx context.Context, kind string, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if !entity.ValidTrashKind(kind) {
+		return fmt.Errorf("неизвестный вид объекта корзины: %s", kind)
+	}
+
+	key := trashKey{kind, id}
+	t, ok := r.s.trash[key]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	switch kind {
+	case entity.TrashSchool:
+		for k, child := range r.s.trash {
+			if schoolID := child.schoolID(); schoolID != nil && *schoolID == id && child.deletedAt.Equal(t.deletedAt) {
+				r.s.restore(k)
+			}
+		}
+	case entity.TrashClass, entity.TrashUser:
+		if !r.s.liveSchool(t.schoolID()) {
+			return repository.ErrParentDeleted
+		}
+	}
+
+	r.s.restore(key)
+	return nil
+}
+
+func (r *trashRepo) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	expired := make(map[trashKey]bool)
+	for key, t := range r.s.trash {
+		if t.deletedAt.Before(deletedBefore) {
+			expired[key] = true
+		}
+	}
+	// Вместе со школой исчезают все ее классы и пользователи, даже удаленные позже
+	for key, t := range r.s.trash {
+		if schoolID := t.schoolID(); schoolID != nil && expired[trashKey{entity.TrashSchool, *schoolID}] {
+			expired[key] = true
+		}
+	}
+
+	// Строки возвращаются в живые карты и удаляются с каскадом, как DELETE в PostgreSQL
+	var purged int64
+	for _, kind := range []string{entity.TrashClass, entity.TrashUser, entity.TrashSchool, entity.TrashEquationType} {
+		for key := range expired {
+			if key.kind != kind {
+				continue
+			}
+			id := key.id
+			r.s.appendAudit(entity.AuditEntry{
+				Action:     kind + ".purge",
+				TargetType: kind,
+				TargetID:   &id,
+				Before:     fmt.Sprintf(`{"deleted_at": %q}`, r.s.trash[key].deletedAt.Format(time.RFC3339)),
+			})
+			r.s.restore(key)
+			switch kind {
+			case entity.TrashClass:
+				r.s.deleteClass(key.id)
+			case entity.TrashUser:
+				r.s.deleteUser(key.id)
+			case entity.TrashSchool:
+				r.s.deleteSchool(key.id)
+			case entity.TrashEquationType:
+				r.s.deleteType(key.id)
+			}
+			purged++
+		}
+	}
+
+	return purged, nil
+}
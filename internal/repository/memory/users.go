@@ -0,0 +1,516 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"edugame/internal/repository"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type userRepo struct{ s *Store }
+
+func (r *userRepo) Register(ctx context.Context, username, password, roleName, fullName string, classID *int) (*entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, err := r.s.insertUser(username, password, roleName, fullName, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if roleName == "student" && classID != nil {
+		r.s.addStudentToClass(u.ID, *classID)
+	}
+
+	return r.s.publicUser(u), nil
+}
+
+func (r *userRepo) RegisterStudentRequest(ctx context.Context, username, password, fullName string, classID int) (*entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.classes[classID]; !ok {
+		return nil, errors.New("класс не найден")
+	}
+
+	u, err := r.s.insertUser(username, password, "student", fullName, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	r.s.addStudentToClass(u.ID, classID)
+
+	return r.s.publicUser(u), nil
+}
+
+func (r *userRepo) Login(ctx context.Context, username, password string) (*entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u := r.s.userByUsername(username)
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if u.lockedUntil.After(time.Now()) {
+		return nil, repository.ErrAccountLocked
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.passwordHash), []byte(password)); err != nil {
+		return nil, err
+	}
+
+	if u.pending {
+		return nil, repository.ErrAccountPending
+	}
+	if u.Blocked {
+		return nil, repository.ErrAccountBlocked
+	}
+
+	return r.s.publicUser(u), nil
+}
+
+func (r *userRepo) RegisterFailedLogin(ctx context.Context, username string, threshold int, lockFor time.Duration) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u := r.s.userByUsername(username)
+	if u == nil {
+		return false, nil
+	}
+
+	u.failedLogins++
+	if u.failedLogins >= threshold {
+		u.failedLogins = 0
+		u.lockedUntil = time.Now().Add(lockFor)
+	}
+
+	return u.lockedUntil.After(time.Now()), nil
+}
+
+func (r *userRepo) ResetFailedLogins(ctx context.Context, userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if u, ok := r.s.users[userID]; ok {
+		u.failedLogins = 0
+	}
+	return nil
+}
+
+func (r *userRepo) Block(ctx context.Context, userID int, reason string, blockedBy int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now()
+	u.Blocked = true
+	u.BlockedReason = reason
+	u.BlockedAt = &now
+	r.s.deleteUserSessions(userID, "")
+
+	return nil
+}
+
+func (r *userRepo) Unblock(ctx context.Context, userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	u.Blocked = false
+	u.BlockedReason = ""
+	u.BlockedAt = nil
+
+	return nil
+}
+
+func (r *userRepo) SetPicturePassword(ctx context.Context, userID int, secret string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), passwordCost)
+	if err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if u, ok := r.s.users[userID]; ok {
+		u.pictureHash = string(hash)
+	}
+	return nil
+}
+
+func (r *userRepo) LoginByPicturePassword(ctx context.Context, classID, userID int, secret string) (*entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[userID]
+	if !ok || !r.s.inClass(userID, classID) {
+		return nil, sql.ErrNoRows
+	}
+
+	if u.pictureHash == "" {
+		return nil, errors.New("картиночный пароль не задан")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.pictureHash), []byte(secret)); err != nil {
+		return nil, err
+	}
+	if u.Blocked {
+		return nil, repository.ErrAccountBlocked
+	}
+
+	return r.s.publicUser(u), nil
+}
+
+func (r *userRepo) GetByID(ctx context.Context, id int) (*entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return r.s.publicUser(u), nil
+}
+
+func (r *userRepo) GetAllUsers(ctx context.Context) ([]entity.User, error) {
+	return r.list(func(*user) bool { return true }), nil
+}
+
+func (r *userRepo) GetUserByRoleType(ctx context.Context, roleName string) ([]entity.User, error) {
+	return r.list(func(u *user) bool { return r.s.userRole(u.ID) == roleName }), nil
+}
+
+func (r *userRepo) GetUsersWithPermission(ctx context.Context, permission string) ([]entity.User, error) {
+	return r.list(func(u *user) bool {
+		role, ok := r.s.roles[u.RoleID]
+		return ok && slices.Contains(role.permissions, permission)
+	}), nil
+}
+
+// list - пользователи по условию, новые первыми
+func (r *userRepo) list(match func(*user) bool) []entity.User {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var users []entity.User
+	for _, u := range r.s.users {
+		if match(u) {
+			pu := r.s.publicUser(u)
+			pu.SchoolID = nil
+			users = append(users, *pu)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].ID > users[j].ID
+		}
+		return users[i].CreatedAt.After(users[j].CreatedAt)
+	})
+
+	return users
+}
+
+func (r *userRepo) UpdateUser(ctx context.Context, id int, username, fullName, email string, roleID int, schoolID *int) (*entity.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if _, ok := r.s.roles[roleID]; !ok {
+		return nil, errors.New("роль не найдена")
+	}
+	if other := r.s.userByUsername(username); other != nil && other.ID != id {
+		return nil, errDuplicate("users_username_key")
+	}
+
+	u.Username = username
+	u.FullName = fullName
+	u.email = email
+	u.RoleID = roleID
+	u.SchoolID = copyInt(schoolID)
+
+	out := r.s.publicUser(u)
+	out.Blocked = false
+	out.BlockedReason = ""
+	out.BlockedAt = nil
+
+	return out, nil
+}
+
+func (r *userRepo) DeleteUser(ctx context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.trashUser(id, time.Now())
+	return nil
+}
+
+func (r *userRepo) GetStudentClass(ctx context.Context, studentID int) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, classID := range r.s.studentClassIDs(studentID) {
+		if c, ok := r.s.classes[classID]; ok {
+			return c.Grade, nil
+		}
+	}
+
+	return 0, errors.New("ученик не привязан к классу")
+}
+
+func (s *Store) userByUsername(username string) *user {
+	for _, u := range s.users {
+		if u.Username == username {
+			return u
+		}
+	}
+	return nil
+}
+
+// deleteUser удаляет пользователя с каскадом по внешним ключам схемы
+func (s *Store) deleteUser(id int) {
+	if _, ok := s.users[id]; !ok {
+		return
+	}
+	delete(s.users, id)
+
+	s.deleteUserSessions(id, "")
+
+	kept := s.studentClasses[:0]
+	for _, sc := range s.studentClasses {
+		if sc[0] != id {
+			kept = append(kept, sc)
+		}
+	}
+	s.studentClasses = kept
+
+	staff := s.staff[:0]
+	for _, m := range s.staff {
+		if m.UserID != id {
+			staff = append(staff, m)
+		}
+	}
+	s.staff = staff
+
+	attempts := s.attempts[:0]
+	for _, a := range s.attempts {
+		if a.UserID != id {
+			attempts = append(attempts, a)
+		}
+	}
+	s.attempts = attempts
+
+	for bundleID, b := range s.bundles {
+		if b.UserID == id {
+			delete(s.bundles, bundleID)
+		}
+	}
+
+	for quizID, q := range s.quizzes {
+		if q.userID == id {
+			delete(s.quizzes, quizID)
+		}
+	}
+
+	codes := s.resetCodes[:0]
+	for _, c := range s.resetCodes {
+		if c.UserID != id {
+			codes = append(codes, c)
+		}
+	}
+	s.resetCodes = codes
+
+	for _, inv := range s.invites {
+		if inv.CreatedBy != nil && *inv.CreatedBy == id {
+			inv.CreatedBy = nil
+		}
+		if inv.UsedBy != nil && *inv.UsedBy == id {
+			inv.UsedBy = nil
+		}
+	}
+
+	identities := s.identities[:0]
+	for _, i := range s.identities {
+		if i.userID != id {
+			identities = append(identities, i)
+		}
+	}
+	s.identities = identities
+
+	guardians := s.guardians[:0]
+	for _, g := range s.guardians {
+		if g.parentID != id && g.studentID != id {
+			guardians = append(guardians, g)
+		}
+	}
+	s.guardians = guardians
+
+	gcodes := s.guardianCodes[:0]
+	for _, c := range s.guardianCodes {
+		if c.StudentID != id && c.IssuedBy != id {
+			if c.UsedBy != nil && *c.UsedBy == id {
+				c.UsedBy = nil
+			}
+			gcodes = append(gcodes, c)
+		}
+	}
+	s.guardianCodes = gcodes
+
+	summaries := s.summaries[:0]
+	for _, w := range s.summaries {
+		if w.parentID != id && w.StudentID != id {
+			summaries = append(summaries, w)
+		}
+	}
+	s.summaries = summaries
+}
+
+type permissionRepo struct{ s *Store }
+
+func (r *permissionRepo) GetAll(ctx context.Context) ([]entity.Permission, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return append([]entity.Permission(nil), r.s.permissions...), nil
+}
+
+func (r *permissionRepo) GetUserPermissions(ctx context.Context, userID int) ([]string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[userID]
+	if !ok {
+		return nil, nil
+	}
+	role, ok := r.s.roles[u.RoleID]
+	if !ok {
+		return nil, nil
+	}
+
+	return append([]string(nil), role.permissions...), nil
+}
+
+type roleRepo struct{ s *Store }
+
+func (r *roleRepo) GetAll(ctx context.Context) ([]entity.Role, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var roles []entity.Role
+	for _, role := range r.s.roles {
+		out := role.Role
+		out.Permissions = nil
+		roles = append(roles, out)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+
+	return roles, nil
+}
+
+func (r *roleRepo) GetByID(ctx context.Context, id int) (*entity.Role, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	role, ok := r.s.roles[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	out := role.Role
+	out.Permissions = r.s.knownPermissions(role.permissions)
+
+	return &out, nil
+}
+
+func (r *roleRepo) Create(ctx context.Context, name, description string, permissions []string) (*entity.Role, error) {
+	r.s.mu.Lock()
+	if r.s.roleByName(name) != nil {
+		r.s.mu.Unlock()
+		return nil, errDuplicate("roles_name_key")
+	}
+
+	id := r.s.next("roles")
+	r.s.roles[id] = &role{
+		Role:        entity.Role{ID: id, Name: name, Description: description, CreatedAt: time.Now()},
+		permissions: r.s.knownPermissions(permissions),
+	}
+	r.s.mu.Unlock()
+
+	return r.GetByID(ctx, id)
+}
+
+func (r *roleRepo) Update(ctx context.Context, id int, description string, permissions []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	role, ok := r.s.roles[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if role.IsSystem {
+		return repository.ErrSystemRole
+	}
+
+	role.Description = description
+	role.permissions = r.s.knownPermissions(permissions)
+
+	return nil
+}
+
+func (r *roleRepo) Delete(ctx context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	role, ok := r.s.roles[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if role.IsSystem {
+		return repository.ErrSystemRole
+	}
+
+	for _, u := range r.s.users {
+		if u.RoleID == id {
+			return repository.ErrRoleInUse
+		}
+	}
+	for _, inv := range r.s.invites {
+		if inv.RoleID == id {
+			return repository.ErrRoleInUse
+		}
+	}
+
+	delete(r.s.roles, id)
+	return nil
+}
+
+// knownPermissions оставляет только существующие коды прав в порядке справочника
+func (s *Store) knownPermissions(codes []string) []string {
+	wanted := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		wanted[c] = true
+	}
+
+	var known []string
+	for _, p := range s.permissions {
+		if wanted[p.Code] {
+			known = append(known, p.Code)
+		}
+	}
+	return known
+}
@@ -0,0 +1,290 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"edugame/internal/repository"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type yearRepo struct{ s *Store }
+
+func (r *yearRepo) GetAll(ctx context.Context) ([]entity.AcademicYear, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var years []entity.AcademicYear
+	for _, y := range r.s.years {
+		years = append(years, copyYear(y))
+	}
+	sort.SliceStable(years, func(i, j int) bool { return years[i].StartsOn.After(years[j].StartsOn) })
+	return years, nil
+}
+
+func (r *yearRepo) GetCurrent(ctx context.Context) (*entity.AcademicYear, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if y := r.s.currentYear(); y != nil {
+		out := copyYear(y)
+		return &out, nil
+	}
+	return nil, repository.ErrNoCurrentYear
+}
+
+func (r *yearRepo) GetByID(ctx context.Context, id int) (*entity.AcademicYear, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, y := range r.s.years {
+		if y.ID == id {
+			out := copyYear(y)
+			return &out, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *yearRepo) GetClassSnapshots(ctx context.Context, yearID int) ([]entity.YearClassSnapshot, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var snapshots []entity.YearClassSnapshot
+	for _, c := range r.s.yearClasses {
+		if c.AcademicYearID == yearID {
+			c.SchoolID = copyInt(c.SchoolID)
+			snapshots = append(snapshots, c)
+		}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		a, b := snapshots[i], snapshots[j]
+		if a.SchoolName != b.SchoolName {
+			return a.SchoolName < b.SchoolName
+		}
+		if a.Grade != b.Grade {
+			return a.Grade < b.Grade
+		}
+		return a.ClassName < b.ClassName
+	})
+	return snapshots, nil
+}
+
+func (r *yearRepo) GetStudentSnapshots(ctx context.Context, yearID, classID int) ([]entity.YearStudentSnapshot, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var snapshots []entity.YearStudentSnapshot
+	for _, st := range r.s.yearStudents {
+		if st.AcademicYearID == yearID && st.ClassID == classID {
+			st.LastAttemptAt = copyTime(st.LastAttemptAt)
+			snapshots = append(snapshots, st)
+		}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].FullName < snapshots[j].FullName })
+	return snapshots, nil
+}
+
+func (r *yearRepo) GetRolloverClasses(ctx context.Context) ([]repository.RolloverClass, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var classes []repository.RolloverClass
+	for _, c := range r.s.sortedClasses(nil) {
+		rc := repository.RolloverClass{Class: publicClass(c)}
+		if c.SchoolID != nil {
+			if school, ok := r.s.schools[*c.SchoolID]; ok {
+				rc.SchoolName = school.Name
+			}
+		}
+		for _, u := range r.s.classMembers(c.ID, false) {
+			rc.Students = append(rc.Students, repository.RolloverStudent{ID: u.ID, Username: u.Username, FullName: u.FullName})
+		}
+		classes = append(classes, rc)
+	}
+	sort.SliceStable(classes, func(i, j int) bool { return classes[i].SchoolName < classes[j].SchoolName })
+	return classes, nil
+}
+
+func (r *yearRepo) Rollover(ctx context.Context, plan repository.RolloverPlan) (*repository.RolloverResult, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	current := r.s.currentYear()
+	if current == nil {
+		return nil, repository.ErrNoCurrentYear
+	}
+	for _, y := range r.s.years {
+		if y.Name == plan.NewYearName {
+			return nil, errDuplicate("academic_years_name_key")
+		}
+	}
+
+	classes := r.s.sortedClasses(nil)
+	actions := make(map[int]string, len(classes))
+	for _, c := range classes {
+		action := plan.ClassActions[c.ID]
+		if action != entity.RolloverKeep && action != entity.RolloverGraduate {
+			action = entity.RolloverPromote
+			if c.Grade >= entity.MaxGrade {
+				return nil, fmt.Errorf("%s: %w", c.Name, repository.ErrMaxGrade)
+			}
+		}
+		actions[c.ID] = action
+	}
+
+	graduate := idSet(plan.Graduate)
+	unenroll := idSet(plan.Unenroll)
+	now := time.Now()
+	result := &repository.RolloverResult{}
+
+	// Снимки года до любых изменений
+	graduates := make(map[int]bool)
+	for _, c := range classes {
+		snapshot := entity.YearClassSnapshot{
+			AcademicYearID: current.ID,
+			ClassID:        c.ID,
+			SchoolID:       copyInt(c.SchoolID),
+			ClassName:      c.Name,
+			Grade:          c.Grade,
+			Outcome:        actions[c.ID],
+		}
+		if c.SchoolID != nil {
+			if school, ok := r.s.schools[*c.SchoolID]; ok {
+				snapshot.SchoolName = school.Name
+			}
+		}
+		if t, ok := r.s.users[c.TeacherID]; ok {
+			snapshot.TeacherName = t.FullName
+		}
+
+		for _, u := range r.s.classMembers(c.ID, false) {
+			st := entity.YearStudentSnapshot{
+				AcademicYearID: current.ID,
+				ClassID:        c.ID,
+				StudentID:      u.ID,
+				Username:       u.Username,
+				FullName:       u.FullName,
+			}
+			for _, a := range r.s.attempts {
+				if a.UserID != u.ID || a.CreatedAt.Before(current.StartsOn) {
+					continue
+				}
+				st.AttemptsCount++
+				if a.IsCorrect {
+					st.CorrectCount++
+				}
+				if st.LastAttemptAt == nil || a.CreatedAt.After(*st.LastAttemptAt) {
+					last := a.CreatedAt
+					st.LastAttemptAt = &last
+				}
+			}
+
+			switch {
+			case unenroll[u.ID]:
+				st.Outcome = entity.OutcomeUnenrolled
+			case graduate[u.ID] || actions[c.ID] == entity.RolloverGraduate:
+				st.Outcome = entity.OutcomeGraduated
+				graduates[u.ID] = true
+			case actions[c.ID] == entity.RolloverKeep:
+				st.Outcome = entity.OutcomeKept
+			default:
+				st.Outcome = entity.OutcomePromoted
+			}
+
+			snapshot.StudentsCount++
+			if st.AttemptsCount > 0 {
+				snapshot.ActiveStudents++
+			}
+			snapshot.AttemptsCount += st.AttemptsCount
+			snapshot.CorrectCount += st.CorrectCount
+			r.s.yearStudents = append(r.s.yearStudents, st)
+		}
+		r.s.yearClasses = append(r.s.yearClasses, snapshot)
+	}
+
+	// Выпущенные и отчисленные по одному ученики покидают все действующие классы
+	unenrolled := make(map[int]bool)
+	kept := r.s.studentClasses[:0]
+	for _, sc := range r.s.studentClasses {
+		_, live := r.s.classes[sc[1]]
+		if live && (unenroll[sc[0]] || graduate[sc[0]]) {
+			if unenroll[sc[0]] {
+				unenrolled[sc[0]] = true
+			}
+			continue
+		}
+		kept = append(kept, sc)
+	}
+	r.s.studentClasses = kept
+	result.Unenrolled = len(unenrolled)
+	result.GraduatedStudents = len(graduates)
+
+	for _, c := range classes {
+		switch actions[c.ID] {
+		case entity.RolloverKeep:
+			result.Kept++
+		case entity.RolloverGraduate:
+			r.s.trashClass(c.ID, now)
+			result.GraduatedClasses++
+		default:
+			// Прогресс прошлой параллели остается, новой - появляется вместе с параллелью класса
+			for _, u := range r.s.classMembers(c.ID, false) {
+				if r.s.pastGrades[u.ID] == nil {
+					r.s.pastGrades[u.ID] = make(map[int]bool)
+				}
+				r.s.pastGrades[u.ID][c.Grade] = true
+			}
+			newGrade := c.Grade + 1
+			c.Name = entity.PromotedClassName(c.Name, c.Grade, newGrade)
+			c.Grade = newGrade
+			result.Promoted++
+		}
+	}
+
+	current.IsCurrent = false
+	current.ClosedAt = &now
+	if plan.ClosedBy > 0 {
+		closedBy := plan.ClosedBy
+		current.ClosedBy = &closedBy
+	}
+
+	year := &entity.AcademicYear{
+		ID:        r.s.next("academic_years"),
+		Name:      plan.NewYearName,
+		StartsOn:  plan.NewYearStart,
+		IsCurrent: true,
+		CreatedAt: now,
+	}
+	r.s.years = append(r.s.years, year)
+
+	out := copyYear(year)
+	result.Year = &out
+	return result, nil
+}
+
+func (s *Store) currentYear() *entity.AcademicYear {
+	for _, y := range s.years {
+		if y.IsCurrent {
+			return y
+		}
+	}
+	return nil
+}
+
+func copyYear(y *entity.AcademicYear) entity.AcademicYear {
+	out := *y
+	out.ClosedAt = copyTime(y.ClosedAt)
+	out.ClosedBy = copyInt(y.ClosedBy)
+	return out
+}
+
+func idSet(ids []int) map[int]bool {
+	set := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
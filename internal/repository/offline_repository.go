@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"encoding/json"
+	"time"
+)
+
+type OfflineRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewOfflineRepository(db *sql.DB, timeouts QueryTimeouts) *OfflineRepository {
+	return &OfflineRepository{db: db, timeouts: timeouts}
+}
+
+// CreateBundle сохраняет выданный набор вместе с верными ответами
+func (r *OfflineRepository) CreateBundle(ctx context.Context, userID int, items []entity.OfflineItem, issuedAt, expiresAt time.Time) (*entity.OfflineBundle, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO offline_bundles (user_id, items, issued_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+
+	bundle := entity.OfflineBundle{
+		UserID:    userID,
+		Items:     items,
+		IssuedAt:  issuedAt,
+		ExpiresAt: expiresAt,
+	}
+
+	err = r.db.QueryRowContext(ctx, query, userID, itemsJSON, issuedAt, expiresAt).Scan(&bundle.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bundle, nil
+}
+
+// GetBundle получает набор по ID
+func (r *OfflineRepository) GetBundle(ctx context.Context, id int) (*entity.OfflineBundle, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, items, issued_at, expires_at, synced_at
+		FROM offline_bundles
+		WHERE id = $1
+	`
+
+	var bundle entity.OfflineBundle
+	var itemsJSON []byte
+	var syncedAt sql.NullTime
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&bundle.ID, &bundle.UserID, &itemsJSON,
+		&bundle.IssuedAt, &bundle.ExpiresAt, &syncedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(itemsJSON, &bundle.Items); err != nil {
+		return nil, err
+	}
+
+	if syncedAt.Valid {
+		bundle.SyncedAt = &syncedAt.Time
+	}
+
+	return &bundle, nil
+}
+
+// SyncBundle помечает набор синхронизированным и сохраняет его попытки в одной транзакции:
+// если попытку сохранить не удалось, набор остается несинхронизированным и его можно отправить снова.
+// Возвращает false, если набор уже был синхронизирован ранее.
+func (r *OfflineRepository) SyncBundle(ctx context.Context, id int, syncedAt time.Time, attempts []entity.Attempt) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE offline_bundles
+		SET synced_at = $1
+		WHERE id = $2 AND synced_at IS NULL
+	`, syncedAt, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected != 1 {
+		return false, nil
+	}
+
+	for _, attempt := range attempts {
+		if err := insertAttempt(ctx, tx, attempt); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
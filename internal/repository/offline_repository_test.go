@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"edugame/internal/entity"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Если попытка не сохранилась, отметка о синхронизации откатывается вместе с ней,
+// иначе повторная отправка набора получила бы 409 и ответы потерялись бы
+func TestSyncBundleRollsBackWhenAttemptFails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	syncedAt := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE offline_bundles\s+SET synced_at = \$1\s+WHERE id = \$2 AND synced_at IS NULL`).
+		WithArgs(syncedAt, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO attempts`).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	repo := NewOfflineRepository(db, QueryTimeouts{})
+	attempts := []entity.Attempt{entity.NewAttempt(3, 1, "2 + 2", "4", "4")}
+	synced, err := repo.SyncBundle(context.Background(), 7, syncedAt, attempts)
+	if err == nil || synced {
+		t.Fatalf("SyncBundle = %v, %v, want error", synced, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrAmbiguousLink - почта провайдера указана у нескольких пользователей школы
+var ErrAmbiguousLink = errors.New("почта указана у нескольких пользователей")
+
+// OIDCRepository - настройки провайдеров единого входа и привязка к ним пользователей
+type OIDCRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewOIDCRepository(db *sql.DB, timeouts QueryTimeouts) *OIDCRepository {
+	return &OIDCRepository{db: db, timeouts: timeouts}
+}
+
+const oidcProviderColumns = `
+    id, slug, name, school_id, issuer, client_id, client_secret, scopes,
+    username_claim, name_claim, role_claim, role_mapping, default_role,
+    allow_provisioning, enabled, created_at`
+
+// liveProviderSchool - условие для входа: провайдер школы из корзины недоступен
+const liveProviderSchool = `(school_id IS NULL OR school_id IN (SELECT id FROM schools WHERE deleted_at IS NULL))`
+
+// GetAll - все провайдеры для админки
+func (r *OIDCRepository) GetAll(ctx context.Context) ([]entity.OIDCProvider, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.query(ctx, `SELECT `+oidcProviderColumns+` FROM oidc_providers ORDER BY name`)
+}
+
+// GetEnabled - провайдеры для кнопок на странице входа
+func (r *OIDCRepository) GetEnabled(ctx context.Context) ([]entity.OIDCProvider, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.query(ctx, `SELECT `+oidcProviderColumns+` FROM oidc_providers WHERE enabled AND `+liveProviderSchool+` ORDER BY name`)
+}
+
+func (r *OIDCRepository) GetByID(ctx context.Context, id int) (*entity.OIDCProvider, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.scanProvider(r.db.QueryRowContext(ctx, `SELECT `+oidcProviderColumns+` FROM oidc_providers WHERE id = $1`, id))
+}
+
+func (r *OIDCRepository) GetBySlug(ctx context.Context, slug string) (*entity.OIDCProvider, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.scanProvider(r.db.QueryRowContext(ctx, `SELECT `+oidcProviderColumns+` FROM oidc_providers WHERE slug = $1 AND `+liveProviderSchool, slug))
+}
+
+// Create добавляет провайдера и заполняет его ID
+func (r *OIDCRepository) Create(ctx context.Context, p *entity.OIDCProvider) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	mapping, err := json.Marshal(p.RoleMapping)
+	if err != nil {
+		return err
+	}
+
+	return r.db.QueryRowContext(ctx, `
+        INSERT INTO oidc_providers (slug, name, school_id, issuer, client_id, client_secret, scopes,
+            username_claim, name_claim, role_claim, role_mapping, default_role, allow_provisioning, enabled)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+        RETURNING id, created_at
+    `, p.Slug, p.Name, p.SchoolID, p.Issuer, p.ClientID, p.ClientSecret, p.Scopes,
+		p.UsernameClaim, p.NameClaim, p.RoleClaim, mapping, p.DefaultRole, p.AllowProvisioning, p.Enabled,
+	).Scan(&p.ID, &p.CreatedAt)
+}
+
+// Update сохраняет настройки провайдера. Пустой ClientSecret оставляет прежний секрет.
+func (r *OIDCRepository) Update(ctx context.Context, p *entity.OIDCProvider) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	mapping, err := json.Marshal(p.RoleMapping)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.ExecContext(ctx, `
+        UPDATE oidc_providers SET slug = $2, name = $3, school_id = $4, issuer = $5, client_id = $6,
+            client_secret = CASE WHEN $7 = '' THEN client_secret ELSE $7 END,
+            scopes = $8, username_claim = $9, name_claim = $10, role_claim = $11, role_mapping = $12,
+            default_role = $13, allow_provisioning = $14, enabled = $15
+        WHERE id = $1
+    `, p.ID, p.Slug, p.Name, p.SchoolID, p.Issuer, p.ClientID, p.ClientSecret, p.Scopes,
+		p.UsernameClaim, p.NameClaim, p.RoleClaim, mapping, p.DefaultRole, p.AllowProvisioning, p.Enabled)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete удаляет провайдера вместе с привязками пользователей (сами пользователи остаются)
+func (r *OIDCRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM oidc_providers WHERE id = $1`, id)
+	return err
+}
+
+// FindIdentity возвращает пользователя, привязанного к subject провайдера, или sql.ErrNoRows
+func (r *OIDCRepository) FindIdentity(ctx context.Context, providerID int, subject string) (int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	var userID int
+	err := r.db.QueryRowContext(ctx, `
+        SELECT user_id FROM user_identities WHERE provider_id = $1 AND subject = $2
+    `, providerID, subject).Scan(&userID)
+	return userID, err
+}
+
+// LinkIdentity привязывает существующего пользователя к subject провайдера
+func (r *OIDCRepository) LinkIdentity(ctx context.Context, providerID int, subject string, userID int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO user_identities (user_id, provider_id, subject) VALUES ($1, $2, $3)
+    `, userID, providerID, subject)
+	return err
+}
+
+// TouchIdentity отмечает вход через провайдера
+func (r *OIDCRepository) TouchIdentity(ctx context.Context, providerID int, subject string) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE user_identities SET last_login_at = $3 WHERE provider_id = $1 AND subject = $2
+    `, providerID, subject, time.Now())
+	return err
+}
+
+// FindLinkCandidate ищет подтвержденного пользователя школы с такой почтой для привязки к провайдеру.
+// Если почта указана у нескольких пользователей школы, возвращает ErrAmbiguousLink.
+func (r *OIDCRepository) FindLinkCandidate(ctx context.Context, schoolID int, email string) (userID int, roleName string, err error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT u.id, ro.name
+        FROM users u
+        JOIN roles ro ON ro.id = u.role_id
+        WHERE u.school_id = $1 AND LOWER(u.email) = LOWER($2)
+          AND NOT u.pending AND u.deleted_at IS NULL
+        LIMIT 2
+    `, schoolID, email)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		if err := rows.Scan(&userID, &roleName); err != nil {
+			return 0, "", err
+		}
+		found++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+
+	switch found {
+	case 0:
+		return 0, "", sql.ErrNoRows
+	case 1:
+		return userID, roleName, nil
+	}
+	return 0, "", ErrAmbiguousLink
+}
+
+// Provision создает пользователя для учетной записи провайдера и сразу привязывает ее.
+// Пароль случайный и никому не известен: войти можно только через провайдера или после сброса.
+func (r *OIDCRepository) Provision(ctx context.Context, provider *entity.OIDCProvider, subject, username, fullName, roleName string) (int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	secret, err := generateToken()
+	if err != nil {
+		return 0, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var roleID int
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM roles WHERE name = $1`, roleName).Scan(&roleID); err != nil {
+		return 0, fmt.Errorf("роль '%s' не найдена", roleName)
+	}
+
+	var userID int
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO users (username, password_hash, role_id, fullname, school_id)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id
+    `, username, string(hashedPassword), roleID, fullName, provider.SchoolID).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO user_identities (user_id, provider_id, subject, last_login_at) VALUES ($1, $2, $3, $4)
+    `, userID, provider.ID, subject, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// SetUserRole назначает роль по имени, если она изменилась у провайдера.
+// Возвращает прежнюю роль или пустую строку, если роль осталась той же.
+func (r *OIDCRepository) SetUserRole(ctx context.Context, userID int, roleName string) (string, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	var previous string
+	err := r.db.QueryRowContext(ctx, `
+        UPDATE users SET role_id = ro.id FROM roles ro, roles old
+        WHERE users.id = $1 AND ro.name = $2 AND users.role_id <> ro.id AND old.id = users.role_id
+        RETURNING old.name
+    `, userID, roleName).Scan(&previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return previous, err
+}
+
+func (r *OIDCRepository) query(ctx context.Context, query string, args ...interface{}) ([]entity.OIDCProvider, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var providers []entity.OIDCProvider
+	for rows.Next() {
+		p, err := r.scanProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, *p)
+	}
+
+	return providers, rows.Err()
+}
+
+func (r *OIDCRepository) scanProvider(row rowScanner) (*entity.OIDCProvider, error) {
+	var p entity.OIDCProvider
+	var schoolID sql.NullInt64
+	var mapping []byte
+
+	err := row.Scan(
+		&p.ID, &p.Slug, &p.Name, &schoolID, &p.Issuer, &p.ClientID, &p.ClientSecret, &p.Scopes,
+		&p.UsernameClaim, &p.NameClaim, &p.RoleClaim, &mapping, &p.DefaultRole,
+		&p.AllowProvisioning, &p.Enabled, &p.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if schoolID.Valid {
+		id := int(schoolID.Int64)
+		p.SchoolID = &id
+	}
+	if err := json.Unmarshal(mapping, &p.RoleMapping); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
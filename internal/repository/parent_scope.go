@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// parentScope - доступ родителя только к привязанным к нему детям, только на чтение.
+// Каждый метод сначала проверяет привязку ученика и возвращает ErrNotInScope.
+type parentScope struct {
+	repo     *TeacherRepository
+	parentID int
+}
+
+// ForParent возвращает репозиторий, ограниченный детьми родителя
+func (r *TeacherRepository) ForParent(parentID int) ParentScope {
+	return &parentScope{repo: r, parentID: parentID}
+}
+
+// CheckStudent проверяет, что подтвержденный ученик привязан к родителю
+func (s *parentScope) CheckStudent(ctx context.Context, studentID int) error {
+	_, err := s.studentName(ctx, studentID)
+	return err
+}
+
+// studentName возвращает ФИО привязанного ученика
+func (s *parentScope) studentName(ctx context.Context, studentID int) (string, error) {
+	ctx, cancel := s.repo.timeouts.query(ctx)
+	defer cancel()
+
+	var fullName string
+	err := s.repo.db.QueryRowContext(ctx, `
+		SELECT u.fullname
+		FROM guardians g
+		JOIN users u ON u.id = g.student_id
+		WHERE g.parent_id = $1 AND g.student_id = $2 AND NOT u.pending AND u.deleted_at IS NULL
+	`, s.parentID, studentID).Scan(&fullName)
+	if err == sql.ErrNoRows {
+		return "", ErrNotInScope
+	}
+
+	return fullName, err
+}
+
+// GetStudentStatistics - статистика своего ребенка
+func (s *parentScope) GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error) {
+	if err := s.CheckStudent(ctx, studentID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetStudentStatistics(ctx, studentID)
+}
+
+// GetStudentWeeklyResults - недельная сетка сессий своего ребенка
+func (s *parentScope) GetStudentWeeklyResults(ctx context.Context, studentID, weeksOffset int) (*DailyClassResults, error) {
+	fullName, err := s.studentName(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetStudentWeeklyResults(ctx, studentID, fullName, weeksOffset)
+}
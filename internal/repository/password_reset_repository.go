@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"edugame/internal/entity"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrResetCodeInvalid - код не найден, уже использован или истек
+var ErrResetCodeInvalid = errors.New("код сброса пароля недействителен")
+
+// Алфавит кода без похожих символов (0/O, 1/I/L), чтобы ребенок не ошибся при вводе
+const resetCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+const resetCodeLength = 8
+
+// PasswordResetRepository - одноразовые коды сброса пароля, которые выдает учитель.
+// В БД хранится только SHA-256 от кода; выданные коды остаются в таблице как журнал.
+type PasswordResetRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPasswordResetRepository(db *sql.DB, timeouts QueryTimeouts) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db, timeouts: timeouts}
+}
+
+// NormalizeResetCode приводит введенный код к каноническому виду: без пробелов и дефисов, в верхнем регистре
+func NormalizeResetCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// FormatResetCode разбивает код на группы по 4 символа для печати
+func FormatResetCode(code string) string {
+	if len(code) <= 4 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+func hashResetCode(code string) string {
+	sum := sha256.Sum256([]byte(NormalizeResetCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateResetCode() (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(resetCodeAlphabet)))
+
+	for i := 0; i < resetCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(resetCodeAlphabet[n.Int64()])
+	}
+
+	return sb.String(), nil
+}
+
+// Issue выдает ученику новый код сброса. Ранее выданные неиспользованные коды отзываются.
+func (r *PasswordResetRepository) Issue(ctx context.Context, studentID, issuedBy int, ttl time.Duration) (string, *entity.PasswordResetCode, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	code, err := generateResetCode()
+	if err != nil {
+		return "", nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE password_reset_codes SET revoked_at = $2
+        WHERE user_id = $1 AND used_at IS NULL AND revoked_at IS NULL
+    `, studentID, now)
+	if err != nil {
+		return "", nil, err
+	}
+
+	resetCode := &entity.PasswordResetCode{
+		UserID:    studentID,
+		IssuedBy:  issuedBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO password_reset_codes (user_id, code_hash, issued_by, created_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id
+    `, studentID, hashResetCode(code), issuedBy, now, resetCode.ExpiresAt).Scan(&resetCode.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", nil, err
+	}
+
+	return code, resetCode, nil
+}
+
+// Redeem погашает код и устанавливает новый пароль. Заодно снимается блокировка входа
+// и завершаются все сеансы ученика. Возвращает ID пользователя.
+func (r *PasswordResetRepository) Redeem(ctx context.Context, code, newPassword, ipAddress string) (int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var codeID, userID int
+	err = tx.QueryRowContext(ctx, `
+        SELECT id, user_id FROM password_reset_codes
+        WHERE code_hash = $1 AND used_at IS NULL AND revoked_at IS NULL AND expires_at > $2
+          AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+        FOR UPDATE
+    `, hashResetCode(code), now).Scan(&codeID, &userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrResetCodeInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE password_reset_codes SET used_at = $2, used_ip = $3 WHERE id = $1
+    `, codeID, now, ipAddress)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE users SET password_hash = $2, failed_login_count = 0, locked_until = NULL
+        WHERE id = $1
+    `, userID, string(hashedPassword))
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// GetClassResetCodes - журнал кодов, выданных ученикам класса
+func (r *PasswordResetRepository) GetClassResetCodes(ctx context.Context, classID int, limit int) ([]*entity.PasswordResetCode, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT p.id, p.user_id, s.fullname, p.issued_by, i.fullname,
+               p.created_at, p.expires_at, p.used_at, COALESCE(p.used_ip, ''), p.revoked_at
+        FROM password_reset_codes p
+        JOIN users s ON s.id = p.user_id
+        JOIN users i ON i.id = p.issued_by
+        JOIN student_classes sc ON sc.student_id = p.user_id
+        WHERE sc.class_id = $1 AND s.deleted_at IS NULL
+        ORDER BY p.created_at DESC
+        LIMIT $2
+    `, classID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []*entity.PasswordResetCode
+	for rows.Next() {
+		var c entity.PasswordResetCode
+		var usedAt, revokedAt sql.NullTime
+
+		if err := rows.Scan(
+			&c.ID, &c.UserID, &c.StudentName, &c.IssuedBy, &c.IssuedByName,
+			&c.CreatedAt, &c.ExpiresAt, &usedAt, &c.UsedIP, &revokedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if usedAt.Valid {
+			c.UsedAt = &usedAt.Time
+		}
+		if revokedAt.Valid {
+			c.RevokedAt = &revokedAt.Time
+		}
+
+		codes = append(codes, &c)
+	}
+
+	return codes, rows.Err()
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+)
+
+// PermissionRepository - справочник прав и права пользователей через их роли
+type PermissionRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewPermissionRepository(db *sql.DB, timeouts QueryTimeouts) *PermissionRepository {
+	return &PermissionRepository{db: db, timeouts: timeouts}
+}
+
+// GetAll возвращает все права
+func (r *PermissionRepository) GetAll(ctx context.Context) ([]entity.Permission, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, code, description FROM permissions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []entity.Permission
+	for rows.Next() {
+		var p entity.Permission
+		if err := rows.Scan(&p.ID, &p.Code, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+
+	return permissions, rows.Err()
+}
+
+// GetUserPermissions возвращает коды прав роли пользователя
+func (r *PermissionRepository) GetUserPermissions(ctx context.Context, userID int) ([]string, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT p.code
+        FROM users u
+        JOIN role_permissions rp ON rp.role_id = u.role_id
+        JOIN permissions p ON p.id = rp.permission_id
+        WHERE u.id = $1 AND u.deleted_at IS NULL
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, rows.Err()
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"errors"
+)
+
+// ErrQuizItemLocked - ответ на пример уже принят, новые попытки не засчитываются
+var ErrQuizItemLocked = errors.New("ответ на этот пример уже принят")
+
+type QuizRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewQuizRepository(db *sql.DB, timeouts QueryTimeouts) *QuizRepository {
+	return &QuizRepository{db: db, timeouts: timeouts}
+}
+
+// CreateQuiz сохраняет выданный набор. Прежние наборы ученика удаляются:
+// как и раньше с cookie, действует только последний открытый набор.
+func (r *QuizRepository) CreateQuiz(ctx context.Context, userID int, items []entity.QuizItem) (int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM quizzes WHERE user_id = $1`, userID); err != nil {
+		return 0, err
+	}
+
+	var quizID int
+	err = tx.QueryRowContext(ctx, `INSERT INTO quizzes (user_id) VALUES ($1) RETURNING id`, userID).Scan(&quizID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range items {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO quiz_items (quiz_id, item_id, equation_type_id, equation_text, correct_answer)
+			VALUES ($1, $2, NULLIF($3, 0), $4, $5)
+		`, quizID, item.ItemID, item.EquationTypeID, item.Text, item.CorrectAnswer)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return quizID, tx.Commit()
+}
+
+// GetItems возвращает примеры набора по номеру в наборе
+func (r *QuizRepository) GetItems(ctx context.Context, quizID, userID int) (map[int]entity.QuizItem, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT qi.quiz_id, qi.item_id, COALESCE(qi.equation_type_id, 0), qi.equation_text, qi.correct_answer,
+		       qi.tries, qi.locked, qi.is_correct
+		FROM quiz_items qi
+		JOIN quizzes q ON q.id = qi.quiz_id
+		WHERE qi.quiz_id = $1 AND q.user_id = $2
+	`, quizID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[int]entity.QuizItem)
+	for rows.Next() {
+		var item entity.QuizItem
+		if err := rows.Scan(&item.QuizID, &item.ItemID, &item.EquationTypeID, &item.Text, &item.CorrectAnswer,
+			&item.Tries, &item.Locked, &item.Correct); err != nil {
+			return nil, err
+		}
+		items[item.ItemID] = item
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return items, nil
+}
+
+// AnswerItem засчитывает попытку одним UPDATE, поэтому параллельные запросы не обойдут лимит.
+// Пример блокируется после верного ответа или после maxTries попыток.
+// Для уже заблокированного примера возвращает его состояние и ErrQuizItemLocked.
+func (r *QuizRepository) AnswerItem(ctx context.Context, quizID, userID, itemID int, answer string, maxTries int) (*entity.QuizItem, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	item := entity.QuizItem{QuizID: quizID, ItemID: itemID}
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE quiz_items qi
+		SET tries = qi.tries + 1,
+		    is_correct = qi.correct_answer = $4,
+		    locked = qi.correct_answer = $4 OR qi.tries + 1 >= $5
+		FROM quizzes q
+		WHERE q.id = qi.quiz_id AND qi.quiz_id = $1 AND q.user_id = $2 AND qi.item_id = $3 AND NOT qi.locked
+		RETURNING COALESCE(qi.equation_type_id, 0), qi.equation_text, qi.correct_answer, qi.tries, qi.locked, qi.is_correct
+	`, quizID, userID, itemID, answer, maxTries).Scan(&item.EquationTypeID, &item.Text, &item.CorrectAnswer,
+		&item.Tries, &item.Locked, &item.Correct)
+	if err == nil {
+		return &item, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// Пример не обновился: либо его нет в наборе ученика, либо он уже заблокирован
+	err = r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(qi.equation_type_id, 0), qi.equation_text, qi.correct_answer, qi.tries, qi.locked, qi.is_correct
+		FROM quiz_items qi
+		JOIN quizzes q ON q.id = qi.quiz_id
+		WHERE qi.quiz_id = $1 AND q.user_id = $2 AND qi.item_id = $3
+	`, quizID, userID, itemID).Scan(&item.EquationTypeID, &item.Text, &item.CorrectAnswer,
+		&item.Tries, &item.Locked, &item.Correct)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, ErrQuizItemLocked
+}
+
+// LockItem принимает ответ из проверки всего набора.
+// Возвращает false, если пример уже был заблокирован раньше.
+func (r *QuizRepository) LockItem(ctx context.Context, quizID, userID, itemID int, correct bool) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE quiz_items qi
+		SET locked = TRUE, is_correct = $4
+		FROM quizzes q
+		WHERE q.id = qi.quiz_id AND qi.quiz_id = $1 AND q.user_id = $2 AND qi.item_id = $3 AND NOT qi.locked
+	`, quizID, userID, itemID, correct)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
@@ -1,23 +1,37 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"edugame/internal/entity"
+	"errors"
+
+	"github.com/lib/pq"
 )
 
+// ErrSystemRole - встроенную роль нельзя изменить или удалить из админки
+var ErrSystemRole = errors.New("встроенную роль нельзя изменить")
+
+// ErrRoleInUse - роль назначена пользователям или приглашениям
+var ErrRoleInUse = errors.New("роль используется")
+
 type RoleRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewRoleRepository(db *sql.DB) *RoleRepository {
-	return &RoleRepository{db: db}
+func NewRoleRepository(db *sql.DB, timeouts QueryTimeouts) *RoleRepository {
+	return &RoleRepository{db: db, timeouts: timeouts}
 }
 
 // GetAll получает все роли
-func (r *RoleRepository) GetAll() ([]entity.Role, error) {
-	query := `SELECT id, name, description, created_at FROM roles ORDER BY id`
+func (r *RoleRepository) GetAll(ctx context.Context) ([]entity.Role, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, description, is_system, created_at FROM roles ORDER BY id`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -26,7 +40,7 @@ func (r *RoleRepository) GetAll() ([]entity.Role, error) {
 	var roles []entity.Role
 	for rows.Next() {
 		var role entity.Role
-		err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt)
+		err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.IsSystem, &role.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -36,28 +50,153 @@ func (r *RoleRepository) GetAll() ([]entity.Role, error) {
 	return roles, nil
 }
 
-// GetByID получает роль по ID
-func (r *RoleRepository) GetByID(id int) (*entity.Role, error) {
-	query := `SELECT id, name, description, created_at FROM roles WHERE id = $1`
+// GetByID получает роль по ID вместе с ее правами
+func (r *RoleRepository) GetByID(ctx context.Context, id int) (*entity.Role, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, description, is_system, created_at FROM roles WHERE id = $1`
 
 	var role entity.Role
-	err := r.db.QueryRow(query, id).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&role.ID, &role.Name, &role.Description, &role.IsSystem, &role.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	return &role, nil
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT p.code FROM role_permissions rp
+        JOIN permissions p ON p.id = rp.permission_id
+        WHERE rp.role_id = $1
+        ORDER BY p.id
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		role.Permissions = append(role.Permissions, code)
+	}
+
+	return &role, rows.Err()
 }
 
 // GetByName получает роль по имени
-func (r *RoleRepository) GetByName(name string) (*entity.Role, error) {
-	query := `SELECT id, name, description, created_at FROM roles WHERE name = $1`
+func (r *RoleRepository) GetByName(ctx context.Context, name string) (*entity.Role, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, description, is_system, created_at FROM roles WHERE name = $1`
 
 	var role entity.Role
-	err := r.db.QueryRow(query, name).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, name).Scan(&role.ID, &role.Name, &role.Description, &role.IsSystem, &role.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
 	return &role, nil
 }
+
+// Create создает пользовательскую роль с набором прав
+func (r *RoleRepository) Create(ctx context.Context, name, description string, permissions []string) (*entity.Role, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING id
+    `, name, description).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setRolePermissions(ctx, tx, id, permissions); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(ctx, id)
+}
+
+// Update меняет описание и права пользовательской роли
+func (r *RoleRepository) Update(ctx context.Context, id int, description string, permissions []string) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var isSystem bool
+	err = tx.QueryRowContext(ctx, `SELECT is_system FROM roles WHERE id = $1 FOR UPDATE`, id).Scan(&isSystem)
+	if err != nil {
+		return err
+	}
+	if isSystem {
+		return ErrSystemRole
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE roles SET description = $2 WHERE id = $1`, id, description); err != nil {
+		return err
+	}
+
+	if err := setRolePermissions(ctx, tx, id, permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete удаляет пользовательскую роль, если она никому не назначена
+func (r *RoleRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	var isSystem, inUse bool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT is_system,
+               EXISTS (SELECT 1 FROM users WHERE role_id = $1)
+               OR EXISTS (SELECT 1 FROM staff_invites WHERE role_id = $1)
+        FROM roles WHERE id = $1
+    `, id).Scan(&isSystem, &inUse)
+	if err != nil {
+		return err
+	}
+	if isSystem {
+		return ErrSystemRole
+	}
+	if inUse {
+		return ErrRoleInUse
+	}
+
+	_, err = r.db.ExecContext(ctx, `DELETE FROM roles WHERE id = $1`, id)
+	return err
+}
+
+// setRolePermissions заменяет права роли. Неизвестные коды прав пропускаются.
+func setRolePermissions(ctx context.Context, tx *sql.Tx, roleID int, permissions []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO role_permissions (role_id, permission_id)
+        SELECT $1, id FROM permissions WHERE code = ANY($2)
+    `, roleID, pq.Array(permissions))
+	return err
+}
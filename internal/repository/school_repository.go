@@ -1,24 +1,29 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"edugame/internal/entity"
 	"time"
 )
 
 type SchoolRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewSchoolRepository(db *sql.DB) *SchoolRepository {
-	return &SchoolRepository{db: db}
+func NewSchoolRepository(db *sql.DB, timeouts QueryTimeouts) *SchoolRepository {
+	return &SchoolRepository{db: db, timeouts: timeouts}
 }
 
 // GetAll получает все школы
-func (r *SchoolRepository) GetAll() ([]entity.School, error) {
-	query := `SELECT id, name, address, phone, email, created_at, updated_at FROM schools ORDER BY name`
+func (r *SchoolRepository) GetAll(ctx context.Context) ([]entity.School, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
 
-	rows, err := r.db.Query(query)
+	query := `SELECT id, name, address, phone, email, created_at, updated_at FROM schools WHERE deleted_at IS NULL ORDER BY name`
+
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -38,11 +43,14 @@ func (r *SchoolRepository) GetAll() ([]entity.School, error) {
 }
 
 // GetByID получает школу по ID
-func (r *SchoolRepository) GetByID(id int) (*entity.School, error) {
-	query := `SELECT id, name, address, phone, email, created_at, updated_at FROM schools WHERE id = $1`
+func (r *SchoolRepository) GetByID(ctx context.Context, id int) (*entity.School, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, address, phone, email, created_at, updated_at FROM schools WHERE id = $1 AND deleted_at IS NULL`
 
 	var school entity.School
-	err := r.db.QueryRow(query, id).Scan(&school.ID, &school.Name, &school.Address, &school.Phone, &school.Email, &school.CreatedAt, &school.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&school.ID, &school.Name, &school.Address, &school.Phone, &school.Email, &school.CreatedAt, &school.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +59,10 @@ func (r *SchoolRepository) GetByID(id int) (*entity.School, error) {
 }
 
 // Create создает новую школу
-func (r *SchoolRepository) Create(name, address, phone, email string) (*entity.School, error) {
+func (r *SchoolRepository) Create(ctx context.Context, name, address, phone, email string) (*entity.School, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO schools (name, address, phone, email)
 		VALUES ($1, $2, $3, $4)
@@ -59,7 +70,7 @@ func (r *SchoolRepository) Create(name, address, phone, email string) (*entity.S
 	`
 
 	var school entity.School
-	err := r.db.QueryRow(query, name, address, phone, email).Scan(
+	err := r.db.QueryRowContext(ctx, query, name, address, phone, email).Scan(
 		&school.ID, &school.Name, &school.Address, &school.Phone, &school.Email, &school.CreatedAt, &school.UpdatedAt)
 	if err != nil {
 		return nil, err
@@ -69,16 +80,19 @@ func (r *SchoolRepository) Create(name, address, phone, email string) (*entity.S
 }
 
 // Update обновляет школу
-func (r *SchoolRepository) Update(id int, name, address, phone, email string) (*entity.School, error) {
+func (r *SchoolRepository) Update(ctx context.Context, id int, name, address, phone, email string) (*entity.School, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE schools 
 		SET name = $1, address = $2, phone = $3, email = $4, updated_at = $5
-		WHERE id = $6
+		WHERE id = $6 AND deleted_at IS NULL
 		RETURNING id, name, address, phone, email, created_at, updated_at
 	`
 
 	var school entity.School
-	err := r.db.QueryRow(query, name, address, phone, email, time.Now(), id).Scan(
+	err := r.db.QueryRowContext(ctx, query, name, address, phone, email, time.Now(), id).Scan(
 		&school.ID, &school.Name, &school.Address, &school.Phone, &school.Email, &school.CreatedAt, &school.UpdatedAt)
 	if err != nil {
 		return nil, err
@@ -87,9 +101,38 @@ func (r *SchoolRepository) Update(id int, name, address, phone, email string) (*
 	return &school, nil
 }
 
-// Delete удаляет школу
-func (r *SchoolRepository) Delete(id int) error {
-	query := `DELETE FROM schools WHERE id = $1`
-	_, err := r.db.Exec(query, id)
-	return err
+// Delete переносит школу в корзину вместе с ее классами и сотрудниками.
+// Все они получают одно время удаления (NOW() в транзакции), по нему корзина вернет их вместе со школой.
+func (r *SchoolRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE schools SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE classes SET deleted_at = NOW() WHERE school_id = $1 AND deleted_at IS NULL`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET deleted_at = NOW() WHERE school_id = $1 AND deleted_at IS NULL`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM user_sessions
+		WHERE user_id IN (SELECT id FROM users WHERE school_id = $1 AND deleted_at = NOW())
+	`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
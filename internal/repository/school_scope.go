@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"edugame/internal/entity"
+)
+
+// schoolScope - доступ директора только к классам и ученикам своей школы.
+// Без школы (schoolID == nil) доступны все школы - для роли уровня района.
+// Объекты чужих школ дают ErrNotInScope.
+type schoolScope struct {
+	repo     *TeacherRepository
+	schoolID *int
+}
+
+// ForSchool возвращает репозиторий, ограниченный школой
+func (r *TeacherRepository) ForSchool(schoolID *int) SchoolScope {
+	return &schoolScope{repo: r, schoolID: schoolID}
+}
+
+// GetAllClasses - классы школы
+func (s *schoolScope) GetAllClasses(ctx context.Context) ([]*entity.Class, error) {
+	return s.repo.GetAllClasses(ctx, s.schoolID)
+}
+
+// GetClassesStatistics - статистика по классам школы
+func (s *schoolScope) GetClassesStatistics(ctx context.Context) (map[int]map[string]interface{}, error) {
+	return s.repo.GetClassesStatistics(ctx, s.schoolID)
+}
+
+// CheckClass проверяет, что класс относится к школе
+func (s *schoolScope) CheckClass(ctx context.Context, classID int) error {
+	ctx, cancel := s.repo.timeouts.query(ctx)
+	defer cancel()
+
+	var exists bool
+	err := s.repo.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM classes WHERE id = $1 AND deleted_at IS NULL AND ($2::int IS NULL OR school_id = $2)
+		)
+	`, classID, s.schoolID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotInScope
+	}
+
+	return nil
+}
+
+// CheckStudent проверяет, что ученик учится в классе школы
+func (s *schoolScope) CheckStudent(ctx context.Context, studentID int) error {
+	ctx, cancel := s.repo.timeouts.query(ctx)
+	defer cancel()
+
+	var exists bool
+	err := s.repo.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM student_classes sc
+			JOIN classes c ON c.id = sc.class_id
+			JOIN users u ON u.id = sc.student_id
+			WHERE sc.student_id = $1 AND ($2::int IS NULL OR c.school_id = $2)
+			  AND c.deleted_at IS NULL AND u.deleted_at IS NULL
+		)
+	`, studentID, s.schoolID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotInScope
+	}
+
+	return nil
+}
+
+// GetStudentStatistics - статистика ученика школы
+func (s *schoolScope) GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error) {
+	if err := s.CheckStudent(ctx, studentID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetStudentStatistics(ctx, studentID)
+}
+
+// GetStudentAttemptsByType - попытки ученика школы по типу уравнений
+func (s *schoolScope) GetStudentAttemptsByType(ctx context.Context, studentID, typeID int) ([]map[string]interface{}, error) {
+	if err := s.CheckStudent(ctx, studentID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetStudentAttemptsByType(ctx, studentID, typeID)
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"edugame/internal/entity"
+	"encoding/hex"
+	"time"
+)
+
+// SessionRepository - серверные сессии пользователей (таблица user_sessions).
+// В БД хранится только SHA-256 от токена, сам токен есть лишь в cookie клиента.
+type SessionRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewSessionRepository(db *sql.DB, timeouts QueryTimeouts) *SessionRepository {
+	return &SessionRepository{db: db, timeouts: timeouts}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create создает сессию и возвращает токен для cookie
+func (r *SessionRepository) Create(ctx context.Context, userID int, userAgent, ipAddress string, ttl time.Duration) (string, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	now := time.Now()
+
+	_, err = r.db.ExecContext(ctx, `
+        INSERT INTO user_sessions (user_id, session_token, user_agent, ip_address, created_at, last_seen_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $5, $6)
+    `, userID, hashToken(token), userAgent, ipAddress, now, now.Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Touch проверяет токен и продлевает сессию на ttl.
+// Запись в БД происходит не чаще раза в touchEvery, refreshed сообщает, было ли продление.
+// Для неизвестного или истекшего токена, а также для заблокированного пользователя возвращается sql.ErrNoRows.
+func (r *SessionRepository) Touch(ctx context.Context, token string, ttl, touchEvery time.Duration) (userID int, refreshed bool, err error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	hash := hashToken(token)
+	now := time.Now()
+
+	var lastSeen time.Time
+	err = r.db.QueryRowContext(ctx, `
+        SELECT s.user_id, s.last_seen_at FROM user_sessions s
+        JOIN users u ON u.id = s.user_id
+        WHERE s.session_token = $1 AND s.expires_at > $2 AND NOT u.blocked AND u.deleted_at IS NULL
+    `, hash, now).Scan(&userID, &lastSeen)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if now.Sub(lastSeen) < touchEvery {
+		return userID, false, nil
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+        UPDATE user_sessions SET last_seen_at = $2, expires_at = $3
+        WHERE session_token = $1
+    `, hash, now, now.Add(ttl))
+	if err != nil {
+		return 0, false, err
+	}
+
+	return userID, true, nil
+}
+
+// GetUserSessions возвращает активные сессии пользователя, отмечая текущую
+func (r *SessionRepository) GetUserSessions(ctx context.Context, userID int, currentToken string) ([]*entity.UserSession, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, user_id, session_token, user_agent, ip_address, created_at, last_seen_at, expires_at
+        FROM user_sessions
+        WHERE user_id = $1 AND expires_at > $2
+        ORDER BY last_seen_at DESC
+    `, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currentHash := hashToken(currentToken)
+
+	var sessions []*entity.UserSession
+	for rows.Next() {
+		var s entity.UserSession
+		if err := rows.Scan(
+			&s.ID, &s.UserID, &s.SessionToken, &s.UserAgent, &s.IPAddress,
+			&s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		s.Current = currentToken != "" && s.SessionToken == currentHash
+		sessions = append(sessions, &s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Delete завершает сессию по токену (выход)
+func (r *SessionRepository) Delete(ctx context.Context, token string) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM user_sessions WHERE session_token = $1`, hashToken(token))
+	return err
+}
+
+// DeleteUserSession завершает одну сессию пользователя. Возвращает false, если такой сессии у него нет.
+func (r *SessionRepository) DeleteUserSession(ctx context.Context, userID, sessionID int) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_sessions WHERE id = $1 AND user_id = $2`, sessionID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// DeleteUserSessions завершает все сессии пользователя, кроме сессии с токеном exceptToken (если он задан)
+func (r *SessionRepository) DeleteUserSessions(ctx context.Context, userID int, exceptToken string) (int64, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	var result sql.Result
+	var err error
+
+	if exceptToken == "" {
+		result, err = r.db.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, userID)
+	} else {
+		result, err = r.db.ExecContext(ctx, `
+            DELETE FROM user_sessions WHERE user_id = $1 AND session_token <> $2
+        `, userID, hashToken(exceptToken))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteExpired удаляет истекшие сессии
+func (r *SessionRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_sessions WHERE expires_at <= $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
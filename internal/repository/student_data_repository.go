@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrNotStudent - выгрузка и удаление персональных данных доступны только для учеников
+var ErrNotStudent = errors.New("пользователь не является учеником")
+
+// ErrAlreadyErased - персональные данные ученика уже удалены
+var ErrAlreadyErased = errors.New("данные ученика уже удалены")
+
+// ErasureResult - что стало с данными ученика. Пишется в журнал вместо самих данных.
+type ErasureResult struct {
+	ClassesKept           int   `json:"classes_kept"`
+	AttemptsKept          int   `json:"attempts_kept"`
+	SessionsDeleted       int64 `json:"sessions_deleted"`
+	IdentitiesDeleted     int64 `json:"identities_deleted"`
+	GuardiansDeleted      int64 `json:"guardians_deleted"`
+	YearRecordsAnonymized int64 `json:"year_records_anonymized"`
+}
+
+type StudentDataRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewStudentDataRepository(db *sql.DB, timeouts QueryTimeouts) *StudentDataRepository {
+	return &StudentDataRepository{db: db, timeouts: timeouts}
+}
+
+// Export собирает все, что хранится об ученике, в одном согласованном снимке.
+// Ученика в корзине выгрузить нельзя (sql.ErrNoRows): сначала его нужно восстановить.
+func (r *StudentDataRepository) Export(ctx context.Context, studentID int) (*entity.StudentDataExport, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	export := &entity.StudentDataExport{ExportedAt: time.Now()}
+	u := &export.User
+	var role string
+	err = tx.QueryRowContext(ctx, `
+        SELECT u.id, u.username, u.fullname, COALESCE(u.email, ''), r.name, u.school_id, COALESCE(s.name, ''),
+               u.blocked, COALESCE(u.blocked_reason, ''), u.blocked_at, u.pending,
+               u.picture_password_hash IS NOT NULL, u.created_at, u.erased_at
+        FROM users u
+        JOIN roles r ON r.id = u.role_id
+        LEFT JOIN schools s ON s.id = u.school_id
+        WHERE u.id = $1 AND u.deleted_at IS NULL
+    `, studentID).Scan(&u.ID, &u.Username, &u.FullName, &u.Email, &role, &u.SchoolID, &u.SchoolName,
+		&u.Blocked, &u.BlockedReason, &u.BlockedAt, &u.Pending,
+		&u.HasPicturePassword, &u.CreatedAt, &u.ErasedAt)
+	if err != nil {
+		return nil, err
+	}
+	if role != "student" {
+		return nil, ErrNotStudent
+	}
+	u.Role = role
+
+	// Членства выгружаются и в удаленных классах: это тоже данные об ученике
+	rows, err := tx.QueryContext(ctx, `
+        SELECT c.id, c.name, COALESCE(c.grade, 0), COALESCE(s.name, ''), sc.joined_at
+        FROM student_classes sc
+        JOIN classes c ON c.id = sc.class_id
+        LEFT JOIN schools s ON s.id = c.school_id
+        WHERE sc.student_id = $1
+        ORDER BY sc.joined_at
+    `, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c entity.StudentClassRecord
+		if err := rows.Scan(&c.ClassID, &c.ClassName, &c.Grade, &c.SchoolName, &c.JoinedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Classes = append(export.Classes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+        SELECT id, user_id, COALESCE(equation_type_id, 0), equation_text, correct_answer,
+               COALESCE(user_answer, ''), is_correct, created_at
+        FROM attempts
+        WHERE user_id = $1
+        ORDER BY created_at, id
+    `, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var a entity.Attempt
+		if err := rows.Scan(&a.ID, &a.UserID, &a.EquationTypeID, &a.EquationText, &a.CorrectAnswer,
+			&a.UserAnswer, &a.IsCorrect, &a.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Attempts = append(export.Attempts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+        SELECT COALESCE(up.equation_type_id, 0), COALESCE(et.name, ''),
+               COALESCE(up.attempts_count, 0), COALESCE(up.correct_count, 0), up.is_unlocked,
+               up.first_unlocked_at, up.last_attempt_at, up.created_at, up.updated_at
+        FROM user_progress up
+        LEFT JOIN equation_types et ON et.id = up.equation_type_id
+        WHERE up.user_id = $1
+        ORDER BY et.class, up.equation_type_id
+    `, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p entity.StudentProgressRecord
+		if err := rows.Scan(&p.EquationTypeID, &p.EquationTypeName, &p.AttemptsCount, &p.CorrectCount, &p.IsUnlocked,
+			&p.FirstUnlockedAt, &p.LastAttemptAt, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Progress = append(export.Progress, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Записи журнала об ученике без логина и адреса сотрудника: это данные сотрудника, а не ученика
+	rows, err = tx.QueryContext(ctx, `
+        SELECT id, action, COALESCE(before_state::text, ''), COALESCE(after_state::text, ''), created_at
+        FROM audit_log
+        WHERE target_type = 'user' AND target_id = $1
+        ORDER BY id
+    `, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var a entity.StudentAuditRecord
+		if err := rows.Scan(&a.ID, &a.Action, &a.Before, &a.After, &a.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Audit = append(export.Audit, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Токены сеансов - секрет, их хеши в выгрузку не попадают
+	rows, err = tx.QueryContext(ctx, `
+        SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at
+        FROM user_sessions
+        WHERE user_id = $1
+        ORDER BY created_at
+    `, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var s entity.UserSession
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Sessions = append(export.Sessions, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return export, tx.Commit()
+}
+
+// Erase обезличивает ученика. Строка users, членства в классах, попытки и прогресс остаются,
+// чтобы статистика классов и архивы учебных лет не изменились; исчезает все, что указывает на человека:
+// логин, имя, почта, пароли, сеансы, привязки к SSO и родителям. Вход после этого невозможен.
+func (r *StudentDataRepository) Erase(ctx context.Context, studentID, erasedBy int) (*ErasureResult, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var username, role string
+	var erasedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+        SELECT u.username, r.name, u.erased_at
+        FROM users u
+        JOIN roles r ON r.id = u.role_id
+        WHERE u.id = $1 AND u.deleted_at IS NULL
+        FOR UPDATE OF u
+    `, studentID).Scan(&username, &role, &erasedAt)
+	if err != nil {
+		return nil, err
+	}
+	if role != "student" {
+		return nil, ErrNotStudent
+	}
+	if erasedAt.Valid {
+		return nil, ErrAlreadyErased
+	}
+
+	// Пароль "!" не может совпасть ни с одним хешем bcrypt
+	_, err = tx.ExecContext(ctx, `
+        UPDATE users
+        SET username = $2, fullname = $3, email = NULL, password_hash = '!', picture_password_hash = NULL,
+            blocked = TRUE, blocked_reason = 'Персональные данные удалены', blocked_at = NOW(), blocked_by = $4,
+            failed_login_count = 0, locked_until = NULL, erased_at = NOW()
+        WHERE id = $1
+    `, studentID, entity.ErasedUsername(studentID), entity.ErasedFullName, erasedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ErasureResult{}
+	deleted := []struct {
+		query string
+		count *int64
+	}{
+		{`DELETE FROM user_sessions WHERE user_id = $1`, &result.SessionsDeleted},
+		{`DELETE FROM user_identities WHERE user_id = $1`, &result.IdentitiesDeleted},
+		{`DELETE FROM guardians WHERE student_id = $1`, &result.GuardiansDeleted},
+		{`DELETE FROM guardian_codes WHERE student_id = $1`, nil},
+		{`DELETE FROM weekly_summaries WHERE student_id = $1`, nil},
+		{`DELETE FROM password_reset_codes WHERE user_id = $1`, nil},
+		{`DELETE FROM offline_bundles WHERE user_id = $1`, nil},
+		{`DELETE FROM quizzes WHERE user_id = $1`, nil},
+	}
+	for _, d := range deleted {
+		res, err := tx.ExecContext(ctx, d.query, studentID)
+		if err != nil {
+			return nil, err
+		}
+		if d.count != nil {
+			*d.count, _ = res.RowsAffected()
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_throttles WHERE throttle_key = $1`, "user:"+username); err != nil {
+		return nil, err
+	}
+
+	// Архив учебных лет запрещает изменение строк, поэтому строки ученика пересоздаются
+	// с обезличенным именем; цифры остаются прежними, и итоги класса сходятся.
+	// Удалить их триггер позволяет только в этой транзакции и только для этого ученика.
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('edugame.erase_student', $1, true)`, strconv.Itoa(studentID)); err != nil {
+		return nil, err
+	}
+	var snapshots []entity.YearStudentSnapshot
+	rows, err := tx.QueryContext(ctx, `
+        DELETE FROM academic_year_students WHERE student_id = $1
+        RETURNING academic_year_id, class_id, attempts_count, correct_count, last_attempt_at, outcome
+    `, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var st entity.YearStudentSnapshot
+		if err := rows.Scan(&st.AcademicYearID, &st.ClassID, &st.AttemptsCount, &st.CorrectCount, &st.LastAttemptAt, &st.Outcome); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		snapshots = append(snapshots, st)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, st := range snapshots {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO academic_year_students (academic_year_id, class_id, student_id, username, full_name,
+                                                attempts_count, correct_count, last_attempt_at, outcome)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        `, st.AcademicYearID, st.ClassID, studentID, entity.ErasedUsername(studentID), entity.ErasedFullName,
+			st.AttemptsCount, st.CorrectCount, st.LastAttemptAt, st.Outcome)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result.YearRecordsAnonymized = int64(len(snapshots))
+
+	err = tx.QueryRowContext(ctx, `
+        SELECT (SELECT COUNT(*) FROM student_classes WHERE student_id = $1),
+               (SELECT COUNT(*) FROM attempts WHERE user_id = $1)
+    `, studentID).Scan(&result.ClassesKept, &result.AttemptsKept)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
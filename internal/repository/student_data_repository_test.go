@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"edugame/internal/entity"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newEraseMock - транзакция обезличивания до первого изменения: ученик 42 с заданной ролью
+func newEraseMock(t *testing.T, role string) (*StudentDataRepository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT u.username, r.name, u.erased_at\s+FROM users u .+ FOR UPDATE OF u`).
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"username", "name", "erased_at"}).AddRow("petya", role, nil))
+
+	return NewStudentDataRepository(db, QueryTimeouts{}), mock
+}
+
+// Обезличивание снимает сессии, открывает триггер архива только для этого ученика
+// и пересоздает его строки архива с прежними цифрами
+func TestEraseAnonymizesYearSnapshots(t *testing.T) {
+	repo, mock := newEraseMock(t, "student")
+	last := time.Date(2026, 5, 20, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(`UPDATE users\s+SET username = \$2, fullname = \$3, email = NULL, password_hash = '!'`).
+		WithArgs(42, "erased-42", entity.ErasedFullName, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, d := range []struct {
+		query string
+		rows  int64
+	}{
+		{`DELETE FROM user_sessions WHERE user_id = \$1`, 2},
+		{`DELETE FROM user_identities WHERE user_id = \$1`, 1},
+		{`DELETE FROM guardians WHERE student_id = \$1`, 3},
+		{`DELETE FROM guardian_codes WHERE student_id = \$1`, 0},
+		{`DELETE FROM weekly_summaries WHERE student_id = \$1`, 0},
+		{`DELETE FROM password_reset_codes WHERE user_id = \$1`, 0},
+		{`DELETE FROM offline_bundles WHERE user_id = \$1`, 0},
+		{`DELETE FROM quizzes WHERE user_id = \$1`, 0},
+	} {
+		mock.ExpectExec(d.query).WithArgs(42).WillReturnResult(sqlmock.NewResult(0, d.rows))
+	}
+	mock.ExpectExec(`DELETE FROM login_throttles WHERE throttle_key = \$1`).
+		WithArgs("user:petya").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT set_config\('edugame.erase_student', \$1, true\)`).
+		WithArgs("42").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`DELETE FROM academic_year_students WHERE student_id = \$1\s+RETURNING`).
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"academic_year_id", "class_id", "attempts_count", "correct_count", "last_attempt_at", "outcome"}).
+			AddRow(int64(1), int64(3), int64(120), int64(95), last, entity.OutcomePromoted).
+			AddRow(int64(2), int64(3), int64(0), int64(0), nil, entity.OutcomeKept))
+	mock.ExpectExec(`INSERT INTO academic_year_students`).
+		WithArgs(1, 3, 42, "erased-42", entity.ErasedFullName, 120, 95, last, entity.OutcomePromoted).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO academic_year_students`).
+		WithArgs(2, 3, 42, "erased-42", entity.ErasedFullName, 0, 0, nil, entity.OutcomeKept).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT \(SELECT COUNT\(\*\) FROM student_classes WHERE student_id = \$1\)`).
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"classes", "attempts"}).AddRow(int64(1), int64(120)))
+	mock.ExpectCommit()
+
+	result, err := repo.Erase(context.Background(), 42, 7)
+	if err != nil {
+		t.Fatalf("Erase: %v", err)
+	}
+	want := ErasureResult{ClassesKept: 1, AttemptsKept: 120, SessionsDeleted: 2, IdentitiesDeleted: 1, GuardiansDeleted: 3, YearRecordsAnonymized: 2}
+	if *result != want {
+		t.Errorf("result = %+v, want %+v", *result, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Обезличить можно только ученика: для остальных транзакция откатывается без изменений
+func TestEraseRejectsNonStudent(t *testing.T) {
+	repo, mock := newEraseMock(t, "teacher")
+	mock.ExpectRollback()
+
+	if _, err := repo.Erase(context.Background(), 42, 7); !errors.Is(err, ErrNotStudent) {
+		t.Fatalf("Erase error = %v, want ErrNotStudent", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
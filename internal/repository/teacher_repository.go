@@ -2,62 +2,72 @@
 package repository
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"edugame/internal"
 	"edugame/internal/entity"
 	"fmt"
 	"log"
+	"math/big"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 )
 
 type TeacherRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewTeacherRepository(db *sql.DB) *TeacherRepository {
-	return &TeacherRepository{db: db}
+func NewTeacherRepository(db *sql.DB, timeouts QueryTimeouts) *TeacherRepository {
+	return &TeacherRepository{db: db, timeouts: timeouts}
 }
 
-// Получить классы учителя
-func (r *TeacherRepository) GetTeacherClass(teacherID int) (struct {
+// ClassStudent - подтвержденный ученик класса с состоянием его учетной записи
+type ClassStudent struct {
+	ID                 int
+	Username           string
+	FullName           string
+	IsLocked           bool
+	HasPicturePassword bool
+	IsBlocked          bool
+	BlockedReason      string
+	BlockedAt          *time.Time
+}
+
+// ClassRef - класс, найденный по коду входа или коду регистрации
+type ClassRef struct {
 	ID    int
 	Name  string
 	Grade int
-}, error) {
-	query := `
-		SELECT id, name, grade 
-		FROM classes 
-		WHERE teacher_id = $1
-		ORDER BY grade, name
-	`
-	var class struct {
-		ID    int
-		Name  string
-		Grade int
-	}
-
-	err := r.db.QueryRow(query, teacherID).Scan(&class.ID, &class.Name, &class.Grade)
-
-	if err != nil {
-		return class, err
-	}
+}
 
-	return class, nil
+// PendingStudent - заявка ученика, ожидающая подтверждения учителем
+type PendingStudent struct {
+	ID        int
+	Username  string
+	FullName  string
+	CreatedAt time.Time
 }
 
 // repository/teacher_repository.go
 
-// GetAllClasses получает все классы из базы данных
-func (r *TeacherRepository) GetAllClasses() ([]*entity.Class, error) {
+// GetAllClasses получает классы школы, а при schoolID == nil - все классы из базы данных
+func (r *TeacherRepository) GetAllClasses(ctx context.Context, schoolID *int) ([]*entity.Class, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
-        SELECT id, name, grade, teacher_id 
+        SELECT id, name, grade, COALESCE(teacher_id, 0), school_id
         FROM classes 
+        WHERE deleted_at IS NULL AND ($1::int IS NULL OR school_id = $1)
         ORDER BY grade, name
     `
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query, schoolID)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения классов: %w", err)
 	}
@@ -71,6 +81,7 @@ func (r *TeacherRepository) GetAllClasses() ([]*entity.Class, error) {
 			&class.Name,
 			&class.Grade,
 			&class.TeacherID,
+			&class.SchoolID,
 		)
 		if err != nil {
 			continue // пропускаем ошибки чтения
@@ -82,39 +93,32 @@ func (r *TeacherRepository) GetAllClasses() ([]*entity.Class, error) {
 }
 
 // Получить учеников класса
-func (r *TeacherRepository) GetClassStudents(classID int) ([]struct {
-	ID       int
-	Username string
-	FullName string
-}, error) {
+func (r *TeacherRepository) GetClassStudents(ctx context.Context, classID int) ([]ClassStudent, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
-		SELECT u.id, u.username, u.fullname
+		SELECT u.id, u.username, u.fullname, COALESCE(u.locked_until > NOW(), FALSE),
+		       u.picture_password_hash IS NOT NULL, u.blocked, COALESCE(u.blocked_reason, ''), u.blocked_at
 		FROM users u
 		JOIN student_classes sc ON u.id = sc.student_id
 		JOIN roles r ON u.role_id = r.id
-		WHERE sc.class_id = $1 AND r.name = 'student'
+		WHERE sc.class_id = $1 AND r.name = 'student' AND NOT u.pending AND u.deleted_at IS NULL
 		ORDER BY u.fullname
 	`
 
-	rows, err := r.db.Query(query, classID)
+	rows, err := r.db.QueryContext(ctx, query, classID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var students []struct {
-		ID       int
-		Username string
-		FullName string
-	}
+	var students []ClassStudent
 
 	for rows.Next() {
-		var student struct {
-			ID       int
-			Username string
-			FullName string
-		}
-		if err := rows.Scan(&student.ID, &student.Username, &student.FullName); err != nil {
+		var student ClassStudent
+		if err := rows.Scan(&student.ID, &student.Username, &student.FullName, &student.IsLocked, &student.HasPicturePassword,
+			&student.IsBlocked, &student.BlockedReason, &student.BlockedAt); err != nil {
 			return nil, err
 		}
 		students = append(students, student)
@@ -123,25 +127,244 @@ func (r *TeacherRepository) GetClassStudents(classID int) ([]struct {
 	return students, nil
 }
 
+// Столбцы classes с кодами класса
+const (
+	classLoginCodeColumn = "login_code"
+	classJoinCodeColumn  = "join_code"
+)
+
+// GetClassLoginCode возвращает код класса для входа по картинкам (пустая строка, если код не выдан)
+func (r *TeacherRepository) GetClassLoginCode(ctx context.Context, classID int) (string, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.getClassCode(ctx, classID, classLoginCodeColumn)
+}
+
+// RotateClassLoginCode выдает классу новый код для входа по картинкам. Старый код сразу перестает действовать.
+func (r *TeacherRepository) RotateClassLoginCode(ctx context.Context, classID int) (string, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.rotateClassCode(ctx, classID, classLoginCodeColumn, internal.ClassLoginCodeLength)
+}
+
+// GetClassByLoginCode находит класс по коду для входа по картинкам
+func (r *TeacherRepository) GetClassByLoginCode(ctx context.Context, code string) (ClassRef, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.getClassByCode(ctx, classLoginCodeColumn, code)
+}
+
+// GetClassJoinCode возвращает код класса для регистрации учеников (пустая строка, если код не выдан)
+func (r *TeacherRepository) GetClassJoinCode(ctx context.Context, classID int) (string, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.getClassCode(ctx, classID, classJoinCodeColumn)
+}
+
+// RotateClassJoinCode выдает классу новый код для регистрации учеников
+func (r *TeacherRepository) RotateClassJoinCode(ctx context.Context, classID int) (string, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.rotateClassCode(ctx, classID, classJoinCodeColumn, internal.ClassJoinCodeLength)
+}
+
+// GetClassByJoinCode находит класс по коду для регистрации
+func (r *TeacherRepository) GetClassByJoinCode(ctx context.Context, code string) (ClassRef, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	return r.getClassByCode(ctx, classJoinCodeColumn, code)
+}
+
+// column - только одна из констант class*CodeColumn, в запрос она подставляется как есть
+func (r *TeacherRepository) getClassCode(ctx context.Context, classID int, column string) (string, error) {
+	var code sql.NullString
+	err := r.db.QueryRowContext(ctx, `SELECT `+column+` FROM classes WHERE id = $1`, classID).Scan(&code)
+
+	return code.String, err
+}
+
+func (r *TeacherRepository) rotateClassCode(ctx context.Context, classID int, column string, length int) (string, error) {
+	for i := 0; i < 5; i++ {
+		code, err := generateClassCode(length)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = r.db.ExecContext(ctx, `UPDATE classes SET `+column+` = $2 WHERE id = $1`, classID, code)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			continue // такой код уже у другого класса
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return code, nil
+	}
+
+	return "", fmt.Errorf("не удалось подобрать уникальный код класса")
+}
+
+func (r *TeacherRepository) getClassByCode(ctx context.Context, column, code string) (ClassRef, error) {
+	var class ClassRef
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, name, grade FROM classes WHERE `+column+` = $1 AND deleted_at IS NULL
+	`, NormalizeResetCode(code)).Scan(&class.ID, &class.Name, &class.Grade)
+
+	return class, err
+}
+
+func generateClassCode(length int) (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(resetCodeAlphabet)))
+
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(resetCodeAlphabet[n.Int64()])
+	}
+
+	return sb.String(), nil
+}
+
+// GetPendingStudents - заявки учеников, зарегистрировавшихся по коду класса
+func (r *TeacherRepository) GetPendingStudents(ctx context.Context, classID int) ([]PendingStudent, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.username, u.fullname, u.created_at
+		FROM users u
+		JOIN student_classes sc ON u.id = sc.student_id
+		WHERE sc.class_id = $1 AND u.pending AND u.deleted_at IS NULL
+		ORDER BY u.created_at
+	`, classID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var students []PendingStudent
+
+	for rows.Next() {
+		var student PendingStudent
+		if err := rows.Scan(&student.ID, &student.Username, &student.FullName, &student.CreatedAt); err != nil {
+			return nil, err
+		}
+		students = append(students, student)
+	}
+
+	return students, rows.Err()
+}
+
+// ApproveStudent подтверждает заявку ученика класса. Возвращает false, если такой заявки нет.
+func (r *TeacherRepository) ApproveStudent(ctx context.Context, classID, studentID int) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE users SET pending = FALSE
+		WHERE id = $1 AND pending AND deleted_at IS NULL
+		  AND id IN (SELECT student_id FROM student_classes WHERE class_id = $2)
+	`, studentID, classID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// RejectStudent отклоняет заявку: неподтвержденная учетная запись удаляется
+func (r *TeacherRepository) RejectStudent(ctx context.Context, classID, studentID int) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM users
+		WHERE id = $1 AND pending
+		  AND id IN (SELECT student_id FROM student_classes WHERE class_id = $2)
+	`, studentID, classID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// UnlockStudent снимает блокировку входа с ученика класса и сбрасывает задержки по его логину.
+// Возвращает false, если ученик не состоит в классе.
+func (r *TeacherRepository) UnlockStudent(ctx context.Context, classID, studentID int) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var username string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET failed_login_count = 0, locked_until = NULL
+		WHERE id = $1
+		  AND id IN (SELECT student_id FROM student_classes WHERE class_id = $2)
+		RETURNING username
+	`, studentID, classID).Scan(&username)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM login_throttles WHERE throttle_key IN ($1, $2)
+	`, LoginThrottleUserKey(username), LoginThrottlePictureKey(studentID))
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
 // Получить статистику по классу
-func (r *TeacherRepository) GetClassStatistics(classID int) (map[string]interface{}, error) {
+func (r *TeacherRepository) GetClassStatistics(ctx context.Context, classID int) (map[string]interface{}, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
 	stats := make(map[string]interface{})
 
-	// Основная статистика класса
+	// Основная статистика класса. Все запросы читают итоги student_daily_stats, а не сами попытки
 	query := `
-        SELECT 
-            COUNT(DISTINCT u.id) as student_count,
-            COUNT(DISTINCT a.id) as total_attempts,
-            COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct_attempts
-        FROM users u
-        LEFT JOIN attempts a ON u.id = a.user_id
-        JOIN student_classes sc ON u.id = sc.student_id
-		JOIN roles r on r.id = u.role_id
-        WHERE sc.class_id = $1 AND r.name = 'student'
+        WITH members AS (
+            SELECT u.id
+            FROM users u
+            JOIN student_classes sc ON u.id = sc.student_id
+            JOIN roles r ON r.id = u.role_id
+            WHERE sc.class_id = $1 AND r.name = 'student' AND NOT u.pending AND u.deleted_at IS NULL
+        )
+        SELECT
+            (SELECT COUNT(*) FROM members) as student_count,
+            COALESCE(SUM(d.attempts_count), 0) as total_attempts,
+            COALESCE(SUM(d.correct_count), 0) as correct_attempts
+        FROM student_daily_stats d
+        WHERE d.student_id IN (SELECT id FROM members)
     `
 
 	var studentCount, totalAttempts, correctAttempts int
-	err := r.db.QueryRow(query, classID).Scan(&studentCount, &totalAttempts, &correctAttempts)
+	err := r.db.QueryRowContext(ctx, query, classID).Scan(&studentCount, &totalAttempts, &correctAttempts)
 	if err != nil {
 		return nil, err
 	}
@@ -158,20 +381,21 @@ func (r *TeacherRepository) GetClassStatistics(classID int) (map[string]interfac
 
 	// Активность по дням (последние 7 дней)
 	activityQuery := `
-        SELECT 
-            DATE(a.created_at) as date,
-            COUNT(*) as attempts,
-            SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END) as correct
-        FROM attempts a
-        JOIN users u ON a.user_id = u.id
+        SELECT
+            d.day as date,
+            SUM(d.attempts_count) as attempts,
+            SUM(d.correct_count) as correct
+        FROM student_daily_stats d
+        JOIN users u ON d.student_id = u.id
         JOIN student_classes sc ON u.id = sc.student_id
-        WHERE sc.class_id = $1 
-          AND a.created_at >= CURRENT_DATE - INTERVAL '7 days'
-        GROUP BY DATE(a.created_at)
+        WHERE sc.class_id = $1 AND u.deleted_at IS NULL
+          AND d.day >= CURRENT_DATE - 7
+        GROUP BY d.day
+        HAVING SUM(d.attempts_count) > 0
         ORDER BY date DESC
     `
 
-	rows, err := r.db.Query(activityQuery, classID)
+	rows, err := r.db.QueryContext(ctx, activityQuery, classID)
 	if err == nil {
 		defer rows.Close()
 
@@ -201,21 +425,21 @@ func (r *TeacherRepository) GetClassStatistics(classID int) (map[string]interfac
 
 	// Статистика по типам уравнений
 	typeStatsQuery := `
-        SELECT 
+        SELECT
             et.name as type_name,
-            COUNT(a.id) as attempts,
-            COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct
-        FROM equation_types et
-        LEFT JOIN attempts a ON et.id = a.equation_type_id
-        LEFT JOIN users u ON a.user_id = u.id
-        LEFT JOIN student_classes sc ON u.id = sc.student_id
-        WHERE sc.class_id = $1
+            SUM(d.attempts_count) as attempts,
+            SUM(d.correct_count) as correct
+        FROM student_daily_stats d
+        JOIN equation_types et ON et.id = d.equation_type_id
+        JOIN users u ON d.student_id = u.id
+        JOIN student_classes sc ON u.id = sc.student_id
+        WHERE sc.class_id = $1 AND u.deleted_at IS NULL AND et.deleted_at IS NULL
         GROUP BY et.id, et.name
-        HAVING COUNT(a.id) > 0
+        HAVING SUM(d.attempts_count) > 0
         ORDER BY attempts DESC
     `
 
-	typeRows, err := r.db.Query(typeStatsQuery, classID)
+	typeRows, err := r.db.QueryContext(ctx, typeStatsQuery, classID)
 	if err == nil {
 		defer typeRows.Close()
 
@@ -245,21 +469,21 @@ func (r *TeacherRepository) GetClassStatistics(classID int) (map[string]interfac
 
 	// Топ учеников
 	topStudentsQuery := `
-        SELECT 
+        SELECT
             u.id,
             u.fullname,
-            COUNT(a.id) as total_attempts,
-            COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct_attempts
+            COALESCE(SUM(d.attempts_count), 0) as total_attempts,
+            COALESCE(SUM(d.correct_count), 0) as correct_attempts
         FROM users u
-        LEFT JOIN attempts a ON u.id = a.user_id
         JOIN student_classes sc ON u.id = sc.student_id
-        WHERE sc.class_id = $1
+        LEFT JOIN student_daily_stats d ON d.student_id = u.id
+        WHERE sc.class_id = $1 AND u.deleted_at IS NULL
         GROUP BY u.id, u.fullname
         ORDER BY correct_attempts DESC
         LIMIT 5
     `
 
-	studentRows, err := r.db.Query(topStudentsQuery, classID)
+	studentRows, err := r.db.QueryContext(ctx, topStudentsQuery, classID)
 	if err == nil {
 		defer studentRows.Close()
 
@@ -291,16 +515,20 @@ func (r *TeacherRepository) GetClassStatistics(classID int) (map[string]interfac
 	return stats, nil
 }
 
-// GetClassesStatistics получает статистику по всем классам
-func (r *TeacherRepository) GetClassesStatistics() (map[int]map[string]interface{}, error) {
-	// Получаем все классы
+// GetClassesStatistics получает статистику по классам школы (schoolID == nil - по всем классам)
+func (r *TeacherRepository) GetClassesStatistics(ctx context.Context, schoolID *int) (map[int]map[string]interface{}, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	// Получаем классы
 	classesQuery := `
         SELECT id, name, grade 
         FROM classes 
+        WHERE deleted_at IS NULL AND ($1::int IS NULL OR school_id = $1)
         ORDER BY grade, name
     `
 
-	rows, err := r.db.Query(classesQuery)
+	rows, err := r.db.QueryContext(ctx, classesQuery, schoolID)
 	if err != nil {
 		return nil, fmt.Errorf("не удалось получить классы: %w", err)
 	}
@@ -352,20 +580,20 @@ func (r *TeacherRepository) GetClassesStatistics() (map[int]map[string]interface
 
 	// Основная статистика по всем классам
 	statsQuery := `
-        SELECT 
+        SELECT
             sc.class_id,
             COUNT(DISTINCT u.id) as student_count,
-            COUNT(DISTINCT a.id) as total_attempts,
-            COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct_attempts
+            COALESCE(SUM(d.attempts_count), 0) as total_attempts,
+            COALESCE(SUM(d.correct_count), 0) as correct_attempts
         FROM student_classes sc
-        JOIN users u ON sc.student_id = u.id 
-		JOIN roles r ON u.role_id = r.id AND r.name = 'student'
-        LEFT JOIN attempts a ON u.id = a.user_id
-        WHERE sc.class_id = ANY($1)
+        JOIN users u ON sc.student_id = u.id
+        JOIN roles r ON u.role_id = r.id AND r.name = 'student'
+        LEFT JOIN student_daily_stats d ON d.student_id = u.id
+        WHERE sc.class_id = ANY($1) AND u.deleted_at IS NULL
         GROUP BY sc.class_id
     `
 
-	statsRows, err := r.db.Query(statsQuery, pq.Array(classIDs))
+	statsRows, err := r.db.QueryContext(ctx, statsQuery, pq.Array(classIDs))
 	if err != nil {
 		fmt.Printf("Предупреждение: не удалось получить основную статистику: %v\n", err)
 	} else {
@@ -396,20 +624,21 @@ func (r *TeacherRepository) GetClassesStatistics() (map[int]map[string]interface
 
 	// Активность по классам (последние 7 дней)
 	activityQuery := `
-        SELECT 
+        SELECT
             sc.class_id,
-            DATE(a.created_at) as date,
-            COUNT(*) as attempts,
-            SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END) as correct
-        FROM attempts a
-        JOIN users u ON a.user_id = u.id
+            d.day as date,
+            SUM(d.attempts_count) as attempts,
+            SUM(d.correct_count) as correct
+        FROM student_daily_stats d
+        JOIN users u ON d.student_id = u.id
         JOIN student_classes sc ON u.id = sc.student_id
-        WHERE sc.class_id = ANY($1)
-          AND a.created_at >= CURRENT_DATE - INTERVAL '7 days'
-        GROUP BY sc.class_id, DATE(a.created_at)
+        WHERE sc.class_id = ANY($1) AND u.deleted_at IS NULL
+          AND d.day >= CURRENT_DATE - 7
+        GROUP BY sc.class_id, d.day
+        HAVING SUM(d.attempts_count) > 0
     `
 
-	activityRows, err := r.db.Query(activityQuery, pq.Array(classIDs))
+	activityRows, err := r.db.QueryContext(ctx, activityQuery, pq.Array(classIDs))
 	if err == nil {
 		defer activityRows.Close()
 
@@ -448,22 +677,22 @@ func (r *TeacherRepository) GetClassesStatistics() (map[int]map[string]interface
 
 	// Статистика по типам уравнений для всех классов
 	typeStatsQuery := `
-        SELECT 
+        SELECT
             sc.class_id,
             et.name as type_name,
-            COUNT(a.id) as attempts,
-            COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct
-        FROM equation_types et
-        CROSS JOIN student_classes sc
-        LEFT JOIN users u ON sc.student_id = u.id
-        LEFT JOIN attempts a ON et.id = a.equation_type_id AND a.user_id = u.id
-        WHERE sc.class_id = ANY($1)
+            SUM(d.attempts_count) as attempts,
+            SUM(d.correct_count) as correct
+        FROM student_daily_stats d
+        JOIN equation_types et ON et.id = d.equation_type_id
+        JOIN users u ON d.student_id = u.id
+        JOIN student_classes sc ON u.id = sc.student_id
+        WHERE sc.class_id = ANY($1) AND u.deleted_at IS NULL AND et.deleted_at IS NULL
         GROUP BY sc.class_id, et.id, et.name
-        HAVING COUNT(a.id) > 0
+        HAVING SUM(d.attempts_count) > 0
         ORDER BY sc.class_id, attempts DESC
     `
 
-	typeRows, err := r.db.Query(typeStatsQuery, pq.Array(classIDs))
+	typeRows, err := r.db.QueryContext(ctx, typeStatsQuery, pq.Array(classIDs))
 	if err == nil {
 		defer typeRows.Close()
 
@@ -501,21 +730,21 @@ func (r *TeacherRepository) GetClassesStatistics() (map[int]map[string]interface
 
 	// Топ учеников по каждому классу
 	topStudentsQuery := `
-        SELECT 
+        SELECT
             sc.class_id,
             u.id,
             u.fullname,
-            COUNT(a.id) as total_attempts,
-            COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct_attempts
+            COALESCE(SUM(d.attempts_count), 0) as total_attempts,
+            COALESCE(SUM(d.correct_count), 0) as correct_attempts
         FROM users u
-        LEFT JOIN attempts a ON u.id = a.user_id
         JOIN student_classes sc ON u.id = sc.student_id
-        WHERE sc.class_id = ANY($1)
+        LEFT JOIN student_daily_stats d ON d.student_id = u.id
+        WHERE sc.class_id = ANY($1) AND u.deleted_at IS NULL
         GROUP BY sc.class_id, u.id, u.fullname
         ORDER BY sc.class_id, correct_attempts DESC
     `
 
-	studentRows, err := r.db.Query(topStudentsQuery, pq.Array(classIDs))
+	studentRows, err := r.db.QueryContext(ctx, topStudentsQuery, pq.Array(classIDs))
 	if err == nil {
 		defer studentRows.Close()
 
@@ -657,18 +886,21 @@ func (r *TeacherRepository) GetClassesStatistics() (map[int]map[string]interface
 }
 
 // Получить статистику ученика
-func (r *TeacherRepository) GetStudentStatistics(studentID int) (map[string]interface{}, error) {
+func (r *TeacherRepository) GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
 	stats := make(map[string]interface{})
 
 	// Информация об ученике
 	studentQuery := `
 		SELECT u.username, u.fullname, u.created_at
 		FROM users u
-		WHERE u.id = $1
+		WHERE u.id = $1 AND u.deleted_at IS NULL
 	`
 
 	var username, fullname, createdAt string
-	err := r.db.QueryRow(studentQuery, studentID).Scan(&username, &fullname, &createdAt)
+	err := r.db.QueryRowContext(ctx, studentQuery, studentID).Scan(&username, &fullname, &createdAt)
 	if err != nil {
 		return nil, err
 	}
@@ -690,7 +922,7 @@ func (r *TeacherRepository) GetStudentStatistics(studentID int) (map[string]inte
 	`
 
 	var totalAttempts, correctAttempts int
-	err = r.db.QueryRow(overallQuery, studentID).Scan(&totalAttempts, &correctAttempts)
+	err = r.db.QueryRowContext(ctx, overallQuery, studentID).Scan(&totalAttempts, &correctAttempts)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
@@ -717,11 +949,12 @@ func (r *TeacherRepository) GetStudentStatistics(studentID int) (map[string]inte
 			MAX(a.created_at) as last_attempt
 		FROM equation_types et
 		LEFT JOIN attempts a ON et.id = a.equation_type_id AND a.user_id = $1
+		WHERE et.deleted_at IS NULL
 		GROUP BY et.id, et.name, et.class
 		ORDER BY et.class, et.name
 	`
 
-	rows, err := r.db.Query(typeStatsQuery, studentID)
+	rows, err := r.db.QueryContext(ctx, typeStatsQuery, studentID)
 	if err != nil {
 		return nil, err
 	}
@@ -772,12 +1005,12 @@ func (r *TeacherRepository) GetStudentStatistics(studentID int) (map[string]inte
 			et.name as type_name
 		FROM attempts a
 		JOIN equation_types et ON a.equation_type_id = et.id
-		WHERE a.user_id = $1
+		WHERE a.user_id = $1 AND et.deleted_at IS NULL
 		ORDER BY a.created_at DESC
 		LIMIT 10
 	`
 
-	attemptRows, err := r.db.Query(recentAttemptsQuery, studentID)
+	attemptRows, err := r.db.QueryContext(ctx, recentAttemptsQuery, studentID)
 	if err == nil {
 		defer attemptRows.Close()
 
@@ -809,7 +1042,10 @@ func (r *TeacherRepository) GetStudentStatistics(studentID int) (map[string]inte
 }
 
 // Получить попытки ученика по типу уравнения
-func (r *TeacherRepository) GetStudentAttemptsByType(studentID, typeID int) ([]map[string]interface{}, error) {
+func (r *TeacherRepository) GetStudentAttemptsByType(ctx context.Context, studentID, typeID int) ([]map[string]interface{}, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
 	query := `
 		SELECT 
 			a.id,
@@ -823,7 +1059,7 @@ func (r *TeacherRepository) GetStudentAttemptsByType(studentID, typeID int) ([]m
 		ORDER BY a.created_at DESC
 	`
 
-	rows, err := r.db.Query(query, studentID, typeID)
+	rows, err := r.db.QueryContext(ctx, query, studentID, typeID)
 	if err != nil {
 		return nil, err
 	}
@@ -866,27 +1102,30 @@ func (r *TeacherRepository) GetStudentAttemptsByType(studentID, typeID int) ([]m
 }
 
 // Получить подробную статистику по классу
-func (r *TeacherRepository) GetDetailedClassStatistics(classID int) (map[string]interface{}, error) {
+func (r *TeacherRepository) GetDetailedClassStatistics(ctx context.Context, classID int) (map[string]interface{}, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
 	stats := make(map[string]interface{})
 
-	classStats, err := r.GetClassStatistics(classID)
+	classStats, err := r.GetClassStatistics(ctx, classID)
 	if err != nil {
 		return nil, err
 	}
 
-	students, err := r.GetClassStudentsWithStats(classID)
+	students, err := r.GetClassStudentsWithStats(ctx, classID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Получаем детальную статистику по типам уравнений
-	detailedTypeStats, err := r.GetClassTypeStatistics(classID)
+	detailedTypeStats, err := r.GetClassTypeStatistics(ctx, classID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Получаем таблицу успеваемости (каждый ученик по каждому типу)
-	performanceTable, err := r.GetClassPerformanceTable(classID)
+	performanceTable, err := r.GetClassPerformanceTable(ctx, classID)
 	if err != nil {
 		return nil, err
 	}
@@ -899,26 +1138,30 @@ func (r *TeacherRepository) GetDetailedClassStatistics(classID int) (map[string]
 	return stats, nil
 }
 
-// Получить учеников класса со статистикой
-func (r *TeacherRepository) GetClassStudentsWithStats(classID int) ([]map[string]interface{}, error) {
+// Получить учеников класса со статистикой. Итоги берутся из student_daily_stats;
+// точное время последней попытки - из индекса attempts(user_id, created_at)
+func (r *TeacherRepository) GetClassStudentsWithStats(ctx context.Context, classID int) ([]map[string]interface{}, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
 	query := `
         SELECT 
             u.id,
             u.username,
             u.fullname,
-            COALESCE(COUNT(a.id), 0) as total_attempts,
-            COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct_attempts,
-            MAX(a.created_at) as last_activity
+            COALESCE(SUM(d.attempts_count), 0) as total_attempts,
+            COALESCE(SUM(d.correct_count), 0) as correct_attempts,
+            (SELECT MAX(a.created_at) FROM attempts a WHERE a.user_id = u.id) as last_activity
         FROM users u
         JOIN student_classes sc ON u.id = sc.student_id
-        LEFT JOIN attempts a ON u.id = a.user_id
+        LEFT JOIN student_daily_stats d ON d.student_id = u.id
 		JOIN roles r ON u.role_id = r.id
-        WHERE sc.class_id = $1 AND r.name = 'student'
+        WHERE sc.class_id = $1 AND r.name = 'student' AND u.deleted_at IS NULL
         GROUP BY u.id, u.username, u.fullname
         ORDER BY u.fullname
     `
 
-	rows, err := r.db.Query(query, classID)
+	rows, err := r.db.QueryContext(ctx, query, classID)
 	if err != nil {
 		return nil, err
 	}
@@ -959,26 +1202,32 @@ func (r *TeacherRepository) GetClassStudentsWithStats(classID int) ([]map[string
 }
 
 // Получить детальную статистику по типам уравнений для класса
-func (r *TeacherRepository) GetClassTypeStatistics(classID int) ([]map[string]interface{}, error) {
+func (r *TeacherRepository) GetClassTypeStatistics(ctx context.Context, classID int) ([]map[string]interface{}, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
 	query := `
         WITH class_attempts AS (
             SELECT 
                 et.id as type_id,
                 et.name as type_name,
                 et.class as type_class,
-                COUNT(a.id) as total_attempts,
-                COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct_attempts,
-                COUNT(DISTINCT a.user_id) as students_attempted
+                COALESCE(SUM(d.attempts_count), 0) as total_attempts,
+                COALESCE(SUM(d.correct_count), 0) as correct_attempts,
+                COUNT(DISTINCT d.student_id) as students_attempted
             FROM equation_types et
-            LEFT JOIN attempts a ON et.id = a.equation_type_id
-            LEFT JOIN users u ON a.user_id = u.id
-            LEFT JOIN student_classes sc ON u.id = sc.student_id AND sc.class_id = $1
+            LEFT JOIN student_daily_stats d ON d.equation_type_id = et.id AND d.attempts_count > 0
+                AND d.student_id IN (
+                    SELECT sc.student_id FROM student_classes sc JOIN users u ON u.id = sc.student_id
+                    WHERE sc.class_id = $1 AND u.deleted_at IS NULL
+                )
+            WHERE et.deleted_at IS NULL
             GROUP BY et.id, et.name, et.class
         ),
         class_students AS (
             SELECT COUNT(DISTINCT student_id) as total_students
             FROM student_classes
-            WHERE class_id = $1
+            WHERE class_id = $1 AND student_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
         )
         SELECT 
             ca.type_id,
@@ -1003,7 +1252,7 @@ func (r *TeacherRepository) GetClassTypeStatistics(classID int) ([]map[string]in
         ORDER BY ca.type_class, ca.total_attempts DESC
     `
 
-	rows, err := r.db.Query(query, classID)
+	rows, err := r.db.QueryContext(ctx, query, classID)
 	if err != nil {
 		return nil, err
 	}
@@ -1021,7 +1270,7 @@ func (r *TeacherRepository) GetClassTypeStatistics(classID int) ([]map[string]in
 		}
 
 		// Получаем статистику по ученикам для этого типа
-		studentStats, _ := r.GetTypeStudentStats(classID, typeID)
+		studentStats, _ := r.GetTypeStudentStats(ctx, classID, typeID)
 
 		typeStats = append(typeStats, map[string]interface{}{
 			"type_id":            typeID,
@@ -1041,23 +1290,26 @@ func (r *TeacherRepository) GetClassTypeStatistics(classID int) ([]map[string]in
 }
 
 // Получить статистику учеников по типу уравнения
-func (r *TeacherRepository) GetTypeStudentStats(classID, typeID int) ([]map[string]interface{}, error) {
+func (r *TeacherRepository) GetTypeStudentStats(ctx context.Context, classID, typeID int) ([]map[string]interface{}, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
 	query := `
         SELECT 
             u.id,
             u.fullname,
-            COALESCE(COUNT(a.id), 0) as attempts,
-            COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct,
-            MAX(a.created_at) as last_attempt
+            COALESCE(SUM(d.attempts_count), 0) as attempts,
+            COALESCE(SUM(d.correct_count), 0) as correct,
+            MAX(d.day) FILTER (WHERE d.attempts_count > 0) as last_attempt
         FROM users u
         JOIN student_classes sc ON u.id = sc.student_id
-        LEFT JOIN attempts a ON u.id = a.user_id AND a.equation_type_id = $2
-        WHERE sc.class_id = $1
+        LEFT JOIN student_daily_stats d ON d.student_id = u.id AND d.equation_type_id = $2
+        WHERE sc.class_id = $1 AND u.deleted_at IS NULL
         GROUP BY u.id, u.fullname
         ORDER BY u.fullname
     `
 
-	rows, err := r.db.Query(query, classID, typeID)
+	rows, err := r.db.QueryContext(ctx, query, classID, typeID)
 	if err != nil {
 		return nil, err
 	}
@@ -1097,7 +1349,10 @@ func (r *TeacherRepository) GetTypeStudentStats(classID, typeID int) ([]map[stri
 }
 
 // Получить таблицу успеваемости (ученики × типы уравнений)
-func (r *TeacherRepository) GetClassPerformanceTable(classID int) ([]map[string]interface{}, error) {
+func (r *TeacherRepository) GetClassPerformanceTable(ctx context.Context, classID int) ([]map[string]interface{}, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
 	query := `
         WITH student_type_stats AS (
             SELECT 
@@ -1105,13 +1360,13 @@ func (r *TeacherRepository) GetClassPerformanceTable(classID int) ([]map[string]
                 u.fullname,
                 et.id as type_id,
                 et.name as type_name,
-                COALESCE(COUNT(a.id), 0) as attempts,
-                COALESCE(SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END), 0) as correct
+                COALESCE(SUM(d.attempts_count), 0) as attempts,
+                COALESCE(SUM(d.correct_count), 0) as correct
             FROM users u
             JOIN student_classes sc ON u.id = sc.student_id
             CROSS JOIN equation_types et
-            LEFT JOIN attempts a ON u.id = a.user_id AND a.equation_type_id = et.id
-            WHERE sc.class_id = $1
+            LEFT JOIN student_daily_stats d ON d.student_id = u.id AND d.equation_type_id = et.id
+            WHERE sc.class_id = $1 AND u.deleted_at IS NULL AND et.deleted_at IS NULL
             GROUP BY u.id, u.fullname, et.id, et.name
         )
         SELECT 
@@ -1133,7 +1388,7 @@ func (r *TeacherRepository) GetClassPerformanceTable(classID int) ([]map[string]
         ORDER BY fullname, type_name
     `
 
-	rows, err := r.db.Query(query, classID)
+	rows, err := r.db.QueryContext(ctx, query, classID)
 	if err != nil {
 		return nil, err
 	}
@@ -1185,10 +1440,13 @@ func (r *TeacherRepository) GetClassPerformanceTable(classID int) ([]map[string]
 }
 
 // Получить имя класса по ID
-func (r *TeacherRepository) GetClassName(classID int) (string, error) {
-	query := `SELECT name FROM classes WHERE id = $1`
+func (r *TeacherRepository) GetClassName(ctx context.Context, classID int) (string, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `SELECT name FROM classes WHERE id = $1 AND deleted_at IS NULL`
 	var name string
-	err := r.db.QueryRow(query, classID).Scan(&name)
+	err := r.db.QueryRowContext(ctx, query, classID).Scan(&name)
 	if err != nil {
 		return "", err
 	}
@@ -1262,13 +1520,10 @@ func getMondayOfWeek(t time.Time) time.Time {
 	return t.AddDate(0, 0, -daysSinceMonday)
 }
 
-// GetDailyClassResults получает ежедневные результаты класса по 10 примерам за сессию
-func (r *TeacherRepository) GetDailyClassResults(classID int, weeksOffset int) (*DailyClassResults, error) {
-	// Определяем даты для недели, начиная с понедельника
-	now := time.Now()
-
+// weekBounds возвращает понедельник и воскресенье недели со сдвигом weeksOffset от текущей
+func weekBounds(weeksOffset int) (time.Time, time.Time) {
 	// Находим понедельник текущей недели
-	monday := getMondayOfWeek(now)
+	monday := getMondayOfWeek(time.Now())
 	startDate := time.Date(monday.Year(), monday.Month(), monday.Day(), 0, 0, 0, 0, time.UTC)
 	endDate := startDate.AddDate(0, 0, 6) // Воскресенье
 
@@ -1276,13 +1531,54 @@ func (r *TeacherRepository) GetDailyClassResults(classID int, weeksOffset int) (
 		startDate = startDate.AddDate(0, 0, weeksOffset*7)
 		endDate = endDate.AddDate(0, 0, weeksOffset*7)
 	}
+	return startDate, endDate
+}
+
+// GetDailyClassResults получает ежедневные результаты класса по 10 примерам за сессию
+func (r *TeacherRepository) GetDailyClassResults(ctx context.Context, classID int, weeksOffset int) (*DailyClassResults, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
 
 	// Получаем учеников класса
-	students, err := r.GetClassStudents(classID)
+	classStudents, err := r.GetClassStudents(ctx, classID)
 	if err != nil {
 		return nil, err
 	}
 
+	students := make([]StudentInfo, 0, len(classStudents))
+	studentIDs := make([]int, 0, len(classStudents))
+	for _, student := range classStudents {
+		students = append(students, StudentInfo{ID: student.ID, FullName: student.FullName})
+		studentIDs = append(studentIDs, student.ID)
+	}
+
+	// Сессии всего класса читаются одним запросом, а не отдельным запросом на каждого ученика
+	startDate, endDate := weekBounds(weeksOffset)
+	sessions, err := r.loadSessions(ctx, studentIDs, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return BuildWeeklyResults(ctx, students, weeksOffset, preloadedSessions(sessions))
+}
+
+// GetStudentWeeklyResults - та же недельная сетка сессий, но для одного ученика
+func (r *TeacherRepository) GetStudentWeeklyResults(ctx context.Context, studentID int, fullName string, weeksOffset int) (*DailyClassResults, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	return BuildWeeklyResults(ctx, []StudentInfo{{ID: studentID, FullName: fullName}}, weeksOffset, r.GetStudentDailyResults)
+}
+
+// DailySessionsFunc возвращает полные сессии ученика (по 10 примеров за час) по датам "2006-01-02"
+type DailySessionsFunc func(ctx context.Context, studentID int, startDate, endDate time.Time) (map[string][]SessionResult, error)
+
+// BuildWeeklyResults заполняет недельную сетку для учеников (заданы только ID и ФИО).
+// Сессии каждого ученика берутся из loadSessions. Ошибка загрузки возвращается целиком:
+// пустая сетка вместо 503 при таймауте выглядела бы как неделя без занятий.
+func BuildWeeklyResults(ctx context.Context, students []StudentInfo, weeksOffset int, loadSessions DailySessionsFunc) (*DailyClassResults, error) {
+	startDate, endDate := weekBounds(weeksOffset)
+
 	// Инициализируем структуру результата
 	result := &DailyClassResults{
 		WeekStart: startDate.Format("02.01"),
@@ -1306,9 +1602,9 @@ func (r *TeacherRepository) GetDailyClassResults(classID int, weeksOffset int) (
 	var totalSessions, perfectSessions, totalScore, totalAttempts int
 
 	for _, student := range students {
-		studentResults, err := r.GetStudentDailyResults(student.ID, startDate, endDate)
+		studentResults, err := loadSessions(ctx, student.ID, startDate, endDate)
 		if err != nil {
-			continue
+			return nil, err
 		}
 
 		var studentTotalScore, studentSessions int
@@ -1418,70 +1714,64 @@ func getCSSClassForResult(correct int) string {
 	}
 }
 
-func (r *TeacherRepository) GetStudentDailyResults(studentID int, startDate, endDate time.Time) (map[string][]SessionResult, error) {
-	// Запрос для получения результатов по 10 примеров за сессию
+func (r *TeacherRepository) GetStudentDailyResults(ctx context.Context, studentID int, startDate, endDate time.Time) (map[string][]SessionResult, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	sessions, err := r.loadSessions(ctx, []int{studentID}, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	if results, ok := sessions[studentID]; ok {
+		return results, nil
+	}
+	return map[string][]SessionResult{}, nil
+}
+
+// loadSessions читает полные сессии (ровно 10 примеров за час) сразу для всех учеников
+// из student_hourly_stats: ученик -> дата "2006-01-02" -> сессии по порядку часов
+func (r *TeacherRepository) loadSessions(ctx context.Context, studentIDs []int, startDate, endDate time.Time) (map[int]map[string][]SessionResult, error) {
 	query := `
-        WITH session_groups AS (
-            SELECT 
-                DATE(a.created_at) as session_date,
-                EXTRACT(HOUR FROM a.created_at) as session_hour,
-                COUNT(*) as examples_in_session,
-                SUM(CASE WHEN a.is_correct THEN 1 ELSE 0 END) as correct_in_session
-            FROM attempts a
-            WHERE a.user_id = $1
-              AND DATE(a.created_at) BETWEEN $2::date AND $3::date
-            GROUP BY DATE(a.created_at), EXTRACT(HOUR FROM a.created_at)
-            HAVING COUNT(*) = 10
-        )
-        SELECT 
-            session_date,
-            session_hour,
-            examples_in_session,
-            correct_in_session
-        FROM session_groups
-        ORDER BY session_date, session_hour
+        SELECT student_id, day, hour, attempts_count, correct_count
+        FROM student_hourly_stats
+        WHERE student_id = ANY($1)
+          AND day BETWEEN $2::date AND $3::date
+          AND attempts_count = 10
+        ORDER BY student_id, day, hour
     `
 
-	// Правильное форматирование дат
-	startDateStr := startDate.Format("2006-01-02")
-	endDateStr := endDate.Format("2006-01-02")
-
-	rows, err := r.db.Query(query, studentID, startDateStr, endDateStr)
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(studentIDs),
+		startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
 	if err != nil {
 		log.Printf("Query error: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	// Типизированная мапа
-	results := make(map[string][]SessionResult)
-
+	results := make(map[int]map[string][]SessionResult)
 	for rows.Next() {
-		var sessionDate time.Time
-		var sessionHour int
-		var examples, correct int
-
-		if err := rows.Scan(&sessionDate, &sessionHour, &examples, &correct); err != nil {
-			log.Printf("Scan error: %v", err)
-			continue
+		var studentID, hour, examples, correct int
+		var day time.Time
+		if err := rows.Scan(&studentID, &day, &hour, &examples, &correct); err != nil {
+			return nil, err
 		}
 
-		// Добавляем типизированную структуру
-		results[sessionDate.Format("2006-01-02")] = append(results[sessionDate.Format("2006-01-02")], SessionResult{
-			Hour:    sessionHour,
+		if results[studentID] == nil {
+			results[studentID] = make(map[string][]SessionResult)
+		}
+		date := day.Format("2006-01-02")
+		results[studentID][date] = append(results[studentID][date], SessionResult{
+			Hour:    hour,
 			Total:   examples,
 			Correct: correct,
 		})
 	}
+	return results, rows.Err()
+}
 
-	// Проверяем ошибки итерации
-	if err := rows.Err(); err != nil {
-		log.Printf("Rows iteration error: %v", err)
-		return nil, err
+// preloadedSessions отдает BuildWeeklyResults сессии, прочитанные одним запросом на весь класс
+func preloadedSessions(sessions map[int]map[string][]SessionResult) DailySessionsFunc {
+	return func(ctx context.Context, studentID int, startDate, endDate time.Time) (map[string][]SessionResult, error) {
+		return sessions[studentID], nil
 	}
-
-	log.Printf("Query params: studentID=%d, startDate=%s, endDate=%s",
-		studentID, startDateStr, endDateStr)
-	log.Printf("Results: %v", results)
-	return results, nil
 }
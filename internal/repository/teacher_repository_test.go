@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// rawAttemptsJoin - отчет по классу, который пересчитывает сырые попытки вместо итогов
+var rawAttemptsJoin = regexp.MustCompile(`JOIN attempts`)
+
+// newRollupMock - sqlmock, который падает на любом запросе с JOIN attempts
+func newRollupMock(t *testing.T) (*TeacherRepository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	matcher := sqlmock.QueryMatcherFunc(func(expected, actual string) error {
+		if rawAttemptsJoin.MatchString(actual) {
+			return fmt.Errorf("class report joins raw attempts: %s", actual)
+		}
+		return sqlmock.QueryMatcherRegexp.Match(expected, actual)
+	})
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(matcher))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return NewTeacherRepository(db, QueryTimeouts{}), mock
+}
+
+func TestClassReportsReadDailyRollups(t *testing.T) {
+	ctx := context.Background()
+	last := time.Date(2026, 10, 12, 14, 30, 0, 0, time.UTC)
+
+	t.Run("students with stats", func(t *testing.T) {
+		repo, mock := newRollupMock(t)
+		mock.ExpectQuery(`SUM\(d\.attempts_count\).+FROM users u.+LEFT JOIN student_daily_stats d`).
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "fullname", "total", "correct", "last"}).
+				AddRow(15, "ivan", "Иванов Иван", 20, 15, last).
+				AddRow(16, "petr", "Петров Петр", 0, 0, nil))
+
+		students, err := repo.GetClassStudentsWithStats(ctx, 3)
+		if err != nil {
+			t.Fatalf("GetClassStudentsWithStats: %v", err)
+		}
+		if len(students) != 2 || students[0]["total_attempts"] != 20 || students[0]["accuracy"] != 75.0 ||
+			students[0]["last_activity"] != "12.10.2026 14:30" || students[1]["last_activity"] != "Нет активности" {
+			t.Errorf("students = %+v", students)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("type statistics", func(t *testing.T) {
+		repo, mock := newRollupMock(t)
+		mock.ExpectQuery(`FROM equation_types et\s+LEFT JOIN student_daily_stats d`).
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"type_id", "type_name", "type_class", "total", "correct",
+				"attempted", "students", "accuracy", "coverage"}).
+				AddRow(1, "Сложение", 2, 30, 24, 2, 4, 80.0, 50.0))
+		mock.ExpectQuery(`LEFT JOIN student_daily_stats d ON d.student_id = u.id AND d.equation_type_id = \$2`).
+			WithArgs(3, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "fullname", "attempts", "correct", "last"}).
+				AddRow(15, "Иванов Иван", 20, 18, last).
+				AddRow(16, "Петров Петр", 10, 6, last))
+
+		stats, err := repo.GetClassTypeStatistics(ctx, 3)
+		if err != nil {
+			t.Fatalf("GetClassTypeStatistics: %v", err)
+		}
+		if len(stats) != 1 || stats[0]["total_attempts"] != 30 || stats[0]["students_attempted"] != 2 {
+			t.Fatalf("type stats = %+v", stats)
+		}
+		students := stats[0]["student_stats"].([]map[string]interface{})
+		total := 0
+		for _, s := range students {
+			total += s["attempts"].(int)
+		}
+		if total != 30 || students[0]["accuracy"] != 90.0 || students[0]["last_attempt"] != "12.10" {
+			t.Errorf("student stats = %+v, want totals matching the type row", students)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("class summaries", func(t *testing.T) {
+		repo, mock := newRollupMock(t)
+		mock.ExpectQuery(`LEFT JOIN student_daily_stats d ON d.student_id = u.id AND NOT u.pending`).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "grade", "role", "students", "pending",
+				"total", "correct", "week"}).
+				AddRow(3, "2А", 2, "lead", 25, 1, 400, 310, 42))
+
+		summaries, err := repo.ForTeacher(7).GetClassSummaries(ctx)
+		if err != nil {
+			t.Fatalf("GetClassSummaries: %v", err)
+		}
+		if len(summaries) != 1 || summaries[0].TotalAttempts != 400 || summaries[0].CorrectAttempts != 310 ||
+			summaries[0].WeekAttempts != 42 {
+			t.Errorf("summaries = %+v", summaries[0])
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// Таймаут при загрузке сессий доходит до обработчика, а не превращается в пустую неделю
+func TestBuildWeeklyResultsReturnsLoaderError(t *testing.T) {
+	students := []StudentInfo{{ID: 15, FullName: "Иванов Иван"}}
+	load := func(ctx context.Context, studentID int, startDate, endDate time.Time) (map[string][]SessionResult, error) {
+		return nil, context.DeadlineExceeded
+	}
+
+	result, err := BuildWeeklyResults(context.Background(), students, 0, load)
+	if result != nil || !IsTimeout(err) {
+		t.Fatalf("BuildWeeklyResults = %v, %v, want timeout", result, err)
+	}
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ErrNotInScope - объект вне области доступа (чужой класс или школа). Обработчики отвечают 404,
+// чтобы по перебору ID нельзя было узнать даже о существовании чужих учеников.
+var ErrNotInScope = errors.New("объект вне области доступа")
+
+// teacherScope - доступ учителя только к ученикам классов, в состав которых он входит (class_staff).
+// Каждый метод сначала проверяет принадлежность ученика и возвращает ErrNotInScope.
+type teacherScope struct {
+	repo      *TeacherRepository
+	teacherID int
+}
+
+// ForTeacher возвращает репозиторий, ограниченный классами учителя
+func (r *TeacherRepository) ForTeacher(teacherID int) TeacherScope {
+	return &teacherScope{repo: r, teacherID: teacherID}
+}
+
+// ClassSummary - краткая статистика класса для списка классов учителя
+type ClassSummary struct {
+	ID              int
+	Name            string
+	Grade           int
+	StudentCount    int
+	PendingCount    int
+	TotalAttempts   int
+	CorrectAttempts int
+	WeekAttempts    int    // попыток за последние 7 дней
+	Role            string // роль учителя в классе (entity.StaffRole*)
+}
+
+// RoleTitle - название роли учителя в классе
+func (c *ClassSummary) RoleTitle() string {
+	return entity.StaffRoleTitle(c.Role)
+}
+
+// Accuracy - доля верных ответов в процентах
+func (c *ClassSummary) Accuracy() float64 {
+	if c.TotalAttempts == 0 {
+		return 0
+	}
+	return float64(c.CorrectAttempts) / float64(c.TotalAttempts) * 100
+}
+
+// GetClasses - все классы учителя с его ролью в каждом
+func (s *teacherScope) GetClasses(ctx context.Context) ([]*entity.Class, error) {
+	ctx, cancel := s.repo.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := s.repo.db.QueryContext(ctx, `
+		SELECT c.id, c.name, c.grade, COALESCE(c.teacher_id, 0), c.school_id, cs.role
+		FROM classes c
+		JOIN class_staff cs ON cs.class_id = c.id AND cs.user_id = $1
+		WHERE c.deleted_at IS NULL
+		ORDER BY c.grade, c.name
+	`, s.teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var classes []*entity.Class
+	for rows.Next() {
+		var class entity.Class
+		if err := rows.Scan(
+			&class.ID, &class.Name, &class.Grade, &class.TeacherID, &class.SchoolID, &class.StaffRole,
+		); err != nil {
+			return nil, err
+		}
+		classes = append(classes, &class)
+	}
+
+	return classes, rows.Err()
+}
+
+// GetClass возвращает класс с ролью учителя в нем, если учитель входит в состав класса
+func (s *teacherScope) GetClass(ctx context.Context, classID int) (*entity.Class, error) {
+	ctx, cancel := s.repo.timeouts.query(ctx)
+	defer cancel()
+
+	var class entity.Class
+	err := s.repo.db.QueryRowContext(ctx, `
+		SELECT c.id, c.name, c.grade, COALESCE(c.teacher_id, 0), c.school_id, cs.role
+		FROM classes c
+		JOIN class_staff cs ON cs.class_id = c.id AND cs.user_id = $2
+		WHERE c.id = $1 AND c.deleted_at IS NULL
+	`, classID, s.teacherID).Scan(
+		&class.ID, &class.Name, &class.Grade, &class.TeacherID, &class.SchoolID, &class.StaffRole,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotInScope
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &class, nil
+}
+
+// GetClassSummaries - классы учителя с числом учеников, заявок и попыток
+func (s *teacherScope) GetClassSummaries(ctx context.Context) ([]*ClassSummary, error) {
+	ctx, cancel := s.repo.timeouts.report(ctx)
+	defer cancel()
+
+	rows, err := s.repo.db.QueryContext(ctx, `
+		SELECT c.id, c.name, c.grade, cs.role,
+		       COUNT(DISTINCT u.id) FILTER (WHERE NOT u.pending),
+		       COUNT(DISTINCT u.id) FILTER (WHERE u.pending),
+		       COALESCE(SUM(d.attempts_count), 0),
+		       COALESCE(SUM(d.correct_count), 0),
+		       COALESCE(SUM(d.attempts_count) FILTER (WHERE d.day >= CURRENT_DATE - 7), 0)
+		FROM classes c
+		JOIN class_staff cs ON cs.class_id = c.id AND cs.user_id = $1
+		LEFT JOIN student_classes sc ON sc.class_id = c.id
+		LEFT JOIN users u ON u.id = sc.student_id AND u.deleted_at IS NULL
+		LEFT JOIN student_daily_stats d ON d.student_id = u.id AND NOT u.pending
+		WHERE c.deleted_at IS NULL
+		GROUP BY c.id, c.name, c.grade, cs.role
+		ORDER BY c.grade, c.name
+	`, s.teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*ClassSummary
+	for rows.Next() {
+		var c ClassSummary
+		if err := rows.Scan(
+			&c.ID, &c.Name, &c.Grade, &c.Role, &c.StudentCount, &c.PendingCount,
+			&c.TotalAttempts, &c.CorrectAttempts, &c.WeekAttempts,
+		); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &c)
+	}
+
+	return summaries, rows.Err()
+}
+
+// CheckStudent проверяет, что подтвержденный ученик состоит в одном из классов учителя
+// (с любой ролью, включая наблюдателя)
+func (s *teacherScope) CheckStudent(ctx context.Context, studentID int) error {
+	return s.checkStudent(ctx, studentID, entity.StaffRoles)
+}
+
+// CheckStudentManage проверяет, что учитель может работать с учеником: разблокировать,
+// выдавать коды и т.п. Наблюдателю ученик доступен только на чтение.
+func (s *teacherScope) CheckStudentManage(ctx context.Context, studentID int) error {
+	return s.checkStudent(ctx, studentID, []string{entity.StaffRoleLead, entity.StaffRoleAssistant})
+}
+
+func (s *teacherScope) checkStudent(ctx context.Context, studentID int, roles []string) error {
+	ctx, cancel := s.repo.timeouts.query(ctx)
+	defer cancel()
+
+	var exists bool
+	err := s.repo.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM student_classes sc
+			JOIN class_staff cs ON cs.class_id = sc.class_id
+			JOIN classes c ON c.id = sc.class_id
+			JOIN users u ON u.id = sc.student_id
+			WHERE cs.user_id = $1 AND sc.student_id = $2 AND NOT u.pending
+			  AND c.deleted_at IS NULL AND u.deleted_at IS NULL
+			  AND cs.role = ANY($3)
+		)
+	`, s.teacherID, studentID, pq.Array(roles)).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotInScope
+	}
+
+	return nil
+}
+
+// GetStudentStatistics - статистика ученика своего класса
+func (s *teacherScope) GetStudentStatistics(ctx context.Context, studentID int) (map[string]interface{}, error) {
+	if err := s.CheckStudent(ctx, studentID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetStudentStatistics(ctx, studentID)
+}
+
+// GetStudentAttemptsByType - попытки ученика своего класса по типу уравнений
+func (s *teacherScope) GetStudentAttemptsByType(ctx context.Context, studentID, typeID int) ([]map[string]interface{}, error) {
+	if err := s.CheckStudent(ctx, studentID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetStudentAttemptsByType(ctx, studentID, typeID)
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// QueryTimeouts - предельное время выполнения запросов к БД.
+// Нулевое значение снимает ограничение: запрос прерывается только вместе с контекстом.
+type QueryTimeouts struct {
+	Query  time.Duration // обычные запросы
+	Report time.Duration // отчеты: статистика классов и школ, журнал аудита, сводки родителям
+}
+
+func (t QueryTimeouts) query(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Query)
+}
+
+func (t QueryTimeouts) report(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Report)
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// IsTimeout сообщает, что запрос не уложился в отведенное время: истек контекст
+// или PostgreSQL отменил запрос (query_canceled, в том числе по statement_timeout)
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
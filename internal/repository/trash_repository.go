@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"edugame/internal/entity"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrParentDeleted - объект нельзя восстановить, пока в корзине его школа
+var ErrParentDeleted = errors.New("сначала восстановите школу")
+
+type TrashRepository struct {
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+func NewTrashRepository(db *sql.DB, timeouts QueryTimeouts) *TrashRepository {
+	return &TrashRepository{db: db, timeouts: timeouts}
+}
+
+// GetItems - содержимое корзины, последние удаления первыми.
+// Классы и сотрудники, удаленные вместе со школой (то же время удаления), входят в строку школы.
+func (r *TrashRepository) GetItems(ctx context.Context) ([]entity.TrashItem, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 'school', s.id, s.name, '',
+               (SELECT COUNT(*) FROM classes c WHERE c.school_id = s.id AND c.deleted_at = s.deleted_at)
+             + (SELECT COUNT(*) FROM users u WHERE u.school_id = s.id AND u.deleted_at = s.deleted_at),
+               s.deleted_at
+        FROM schools s
+        WHERE s.deleted_at IS NOT NULL
+
+        UNION ALL
+        SELECT 'class', c.id, c.name, COALESCE(s.name, ''), 0, c.deleted_at
+        FROM classes c
+        LEFT JOIN schools s ON s.id = c.school_id
+        WHERE c.deleted_at IS NOT NULL AND s.deleted_at IS DISTINCT FROM c.deleted_at
+
+        UNION ALL
+        SELECT 'user', u.id, u.fullname, u.username, 0, u.deleted_at
+        FROM users u
+        LEFT JOIN schools s ON s.id = u.school_id
+        WHERE u.deleted_at IS NOT NULL AND s.deleted_at IS DISTINCT FROM u.deleted_at
+
+        UNION ALL
+        SELECT 'equation_type', et.id, et.name, et.class || ' класс', 0, et.deleted_at
+        FROM equation_types et
+        WHERE et.deleted_at IS NOT NULL
+
+        ORDER BY 6 DESC
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []entity.TrashItem
+	for rows.Next() {
+		var item entity.TrashItem
+		if err := rows.Scan(&item.Kind, &item.ID, &item.Name, &item.Details, &item.Cascaded, &item.DeletedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// Restore возвращает объект из корзины. Школа возвращается вместе с классами и сотрудниками,
+// удаленными одновременно с ней. Если объекта нет в корзине, возвращается sql.ErrNoRows.
+func (r *TrashRepository) Restore(ctx context.Context, kind string, id int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	switch kind {
+	case entity.TrashSchool:
+		var deletedAt time.Time
+		err := tx.QueryRowContext(ctx, `
+            SELECT deleted_at FROM schools WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE
+        `, id).Scan(&deletedAt)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE schools SET deleted_at = NULL WHERE id = $1`, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE classes SET deleted_at = NULL WHERE school_id = $1 AND deleted_at = $2`, id, deletedAt); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET deleted_at = NULL WHERE school_id = $1 AND deleted_at = $2`, id, deletedAt); err != nil {
+			return err
+		}
+
+	case entity.TrashClass, entity.TrashUser:
+		table := "classes"
+		if kind == entity.TrashUser {
+			table = "users"
+		}
+
+		var schoolDeleted bool
+		err := tx.QueryRowContext(ctx, `
+            SELECT COALESCE(s.deleted_at IS NOT NULL, FALSE)
+            FROM `+table+` t
+            LEFT JOIN schools s ON s.id = t.school_id
+            WHERE t.id = $1 AND t.deleted_at IS NOT NULL
+            FOR UPDATE OF t
+        `, id).Scan(&schoolDeleted)
+		if err != nil {
+			return err
+		}
+		if schoolDeleted {
+			return ErrParentDeleted
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET deleted_at = NULL WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+	case entity.TrashEquationType:
+		res, err := tx.ExecContext(ctx, `UPDATE equation_types SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+
+	default:
+		return fmt.Errorf("неизвестный вид объекта корзины: %s", kind)
+	}
+
+	return tx.Commit()
+}
+
+// Purge окончательно удаляет объекты, попавшие в корзину раньше deletedBefore.
+// Удаление каскадное, как до появления корзины: вместе с пользователем исчезают его попытки и прогресс.
+// На каждый удаленный объект в той же транзакции пишется запись аудита <вид>.purge.
+func (r *TrashRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, cancel := r.timeouts.report(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Пользователи, которые исчезнут: из корзины и сотрудники удаляемых школ
+	var userIDs []int64
+	err = func() error {
+		rows, err := tx.QueryContext(ctx, `
+            SELECT id FROM users WHERE deleted_at < $1
+            UNION
+            SELECT u.id FROM users u JOIN schools s ON s.id = u.school_id WHERE s.deleted_at < $1
+        `, deletedBefore)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			userIDs = append(userIDs, id)
+		}
+		return rows.Err()
+	}()
+	if err != nil {
+		return 0, err
+	}
+
+	// Ссылки без каскада: классы остаются без учителя, выданные коды сброса удаляются
+	if len(userIDs) > 0 {
+		if _, err := tx.ExecContext(ctx, `UPDATE classes SET teacher_id = NULL WHERE teacher_id = ANY($1)`, pq.Array(userIDs)); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM password_reset_codes WHERE issued_by = ANY($1)`, pq.Array(userIDs)); err != nil {
+			return 0, err
+		}
+	}
+
+	// Классы и пользователи удаляемых школ удаляются явно, а не каскадом, чтобы попасть в журнал
+	var purged int64
+	for _, step := range []struct {
+		kind, delete string
+		args         []interface{}
+	}{
+		{entity.TrashClass, `DELETE FROM classes
+            WHERE deleted_at < $1 OR school_id IN (SELECT id FROM schools WHERE deleted_at < $1)
+            RETURNING id, deleted_at`, []interface{}{deletedBefore}},
+		{entity.TrashUser, `DELETE FROM users WHERE id = ANY($1) RETURNING id, deleted_at`, []interface{}{pq.Array(userIDs)}},
+		{entity.TrashSchool, `DELETE FROM schools WHERE deleted_at < $1 RETURNING id, deleted_at`, []interface{}{deletedBefore}},
+		{entity.TrashEquationType, `DELETE FROM equation_types WHERE deleted_at < $1 RETURNING id, deleted_at`, []interface{}{deletedBefore}},
+	} {
+		res, err := tx.ExecContext(ctx, `
+            WITH purged AS (`+step.delete+`)
+            INSERT INTO audit_log (action, target_type, target_id, before_state)
+            SELECT '`+step.kind+`.purge', '`+step.kind+`', id, jsonb_build_object('deleted_at', deleted_at)
+            FROM purged
+        `, step.args...)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		purged += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
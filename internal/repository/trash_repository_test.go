@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Каждое окончательное удаление попадает в журнал аудита той же транзакцией
+func TestPurgeWritesAuditRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	before := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM users WHERE deleted_at < \$1`).
+		WithArgs(before).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+	mock.ExpectExec(`UPDATE classes SET teacher_id = NULL`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM password_reset_codes`).WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, step := range []struct {
+		table, kind string
+		rows        int64
+	}{
+		{"classes", "class", 0},
+		{"users", "user", 1},
+		{"schools", "school", 0},
+		{"equation_types", "equation_type", 2},
+	} {
+		mock.ExpectExec(`WITH purged AS \(DELETE FROM ` + step.table + `.+INSERT INTO audit_log .+'` + step.kind + `\.purge', '` + step.kind + `'`).
+			WillReturnResult(sqlmock.NewResult(0, step.rows))
+	}
+	mock.ExpectCommit()
+
+	repo := NewTrashRepository(db, QueryTimeouts{})
+	purged, err := repo.Purge(context.Background(), before)
+	if err != nil || purged != 3 {
+		t.Fatalf("Purge = %d, %v, want 3", purged, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
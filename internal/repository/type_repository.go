@@ -1,28 +1,34 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"edugame/internal/generator"
 )
 
 type TypeRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewTypeRepository(db *sql.DB) *TypeRepository {
-	return &TypeRepository{db: db}
+func NewTypeRepository(db *sql.DB, timeouts QueryTimeouts) *TypeRepository {
+	return &TypeRepository{db: db, timeouts: timeouts}
 }
 
 // GetAll получает все типы уравнений с диапазонами операндов
-func (r *TypeRepository) GetAll() ([]generator.EquationType, error) {
+func (r *TypeRepository) GetAll(ctx context.Context) ([]generator.EquationType, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
         SELECT id, class, name, description, operation, num_operands, 
                no_remainder, COALESCE(result_max, -1), is_available
         FROM equation_types
+        WHERE deleted_at IS NULL
         ORDER BY class, name
     `
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -49,7 +55,7 @@ func (r *TypeRepository) GetAll() ([]generator.EquationType, error) {
 		}
 
 		// Загружаем диапазоны операндов для этого типа уравнения
-		operands, err := r.getOperandRanges(t.ID)
+		operands, err := r.getOperandRanges(ctx, t.ID)
 		if err != nil {
 			return types, err
 		}
@@ -62,7 +68,7 @@ func (r *TypeRepository) GetAll() ([]generator.EquationType, error) {
 }
 
 // getOperandRanges получает диапазоны операндов для типа уравнения
-func (r *TypeRepository) getOperandRanges(equationTypeID int) ([]generator.OperandRange, error) {
+func (r *TypeRepository) getOperandRanges(ctx context.Context, equationTypeID int) ([]generator.OperandRange, error) {
 	query := `
 		SELECT operand_order, min_value, max_value
 		FROM operand_ranges
@@ -70,7 +76,7 @@ func (r *TypeRepository) getOperandRanges(equationTypeID int) ([]generator.Opera
 		ORDER BY operand_order
 	`
 
-	rows, err := r.db.Query(query, equationTypeID)
+	rows, err := r.db.QueryContext(ctx, query, equationTypeID)
 	if err != nil {
 		return nil, err
 	}
@@ -90,15 +96,18 @@ func (r *TypeRepository) getOperandRanges(equationTypeID int) ([]generator.Opera
 }
 
 // получить полный список типов уравнений для определенного класса
-func (r *TypeRepository) GetListTypes(class int) ([]generator.EquationType, error) {
+func (r *TypeRepository) GetListTypes(ctx context.Context, class int) ([]generator.EquationType, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
         SELECT id, class, name, description, operation, num_operands, 
                no_remainder, COALESCE(result_max, -1), is_available
         FROM equation_types
-        WHERE class = $1 
+        WHERE class = $1 AND deleted_at IS NULL
     `
 
-	rows, err := r.db.Query(query, class)
+	rows, err := r.db.QueryContext(ctx, query, class)
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +134,7 @@ func (r *TypeRepository) GetListTypes(class int) ([]generator.EquationType, erro
 		}
 
 		// Загружаем диапазоны операндов для этого типа уравнения
-		operands, err := r.getOperandRanges(t.ID)
+		operands, err := r.getOperandRanges(ctx, t.ID)
 		if err != nil {
 			return types, err
 		}
@@ -137,14 +146,17 @@ func (r *TypeRepository) GetListTypes(class int) ([]generator.EquationType, erro
 	return types, nil
 }
 
-func (r *TypeRepository) GetTypeById(id int) (generator.EquationType, error) {
+func (r *TypeRepository) GetTypeById(ctx context.Context, id int) (generator.EquationType, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	var t generator.EquationType
 
-	err := r.db.QueryRow(`
+	err := r.db.QueryRowContext(ctx, `
 		SELECT id, class, name, description, operation, num_operands, 
 		       no_remainder, COALESCE(result_max, -1), is_available
 		FROM equation_types
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`, id).Scan(
 		&t.ID,
 		&t.Class,
@@ -162,7 +174,7 @@ func (r *TypeRepository) GetTypeById(id int) (generator.EquationType, error) {
 	}
 
 	// Загружаем диапазоны операндов для этого типа уравнения
-	operands, err := r.getOperandRanges(id)
+	operands, err := r.getOperandRanges(ctx, id)
 	if err != nil {
 		return t, err
 	}
@@ -172,9 +184,12 @@ func (r *TypeRepository) GetTypeById(id int) (generator.EquationType, error) {
 }
 
 // Create создает новый тип уравнения
-func (r *TypeRepository) Create(et generator.EquationType) (*generator.EquationType, error) {
+func (r *TypeRepository) Create(ctx context.Context, et generator.EquationType) (*generator.EquationType, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	// Начинаем транзакцию
-	tx, err := r.db.Begin()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -191,7 +206,7 @@ func (r *TypeRepository) Create(et generator.EquationType) (*generator.EquationT
 	`
 
 	var newEt generator.EquationType
-	err = tx.QueryRow(query,
+	err = tx.QueryRowContext(ctx, query,
 		et.Class, et.Name, et.Description, et.Operation, et.NumOperands,
 		et.NoRemainder, nullIfMinusOne(et.ResultMax), true,
 	).Scan(
@@ -216,7 +231,7 @@ func (r *TypeRepository) Create(et generator.EquationType) (*generator.EquationT
 			INSERT INTO operand_ranges (equation_type_id, operand_order, min_value, max_value)
 			VALUES ($1, $2, $3, $4)
 		`
-		_, err = tx.Exec(opQuery, newEt.ID, op.Order, op.MinValue, op.MaxValue)
+		_, err = tx.ExecContext(ctx, opQuery, newEt.ID, op.Order, op.MinValue, op.MaxValue)
 		if err != nil {
 			return nil, err
 		}
@@ -234,9 +249,12 @@ func (r *TypeRepository) Create(et generator.EquationType) (*generator.EquationT
 }
 
 // Update обновляет тип уравнения
-func (r *TypeRepository) Update(et generator.EquationType) (*generator.EquationType, error) {
+func (r *TypeRepository) Update(ctx context.Context, et generator.EquationType) (*generator.EquationType, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	// Начинаем транзакцию
-	tx, err := r.db.Begin()
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -247,13 +265,13 @@ func (r *TypeRepository) Update(et generator.EquationType) (*generator.EquationT
 		UPDATE equation_types SET
 			class = $1, name = $2, description = $3, operation = $4, num_operands = $5,
 			no_remainder = $6, result_max = $7, is_available = $8
-		WHERE id = $9
+		WHERE id = $9 AND deleted_at IS NULL
 		RETURNING id, class, name, description, operation, num_operands,
 		          no_remainder, result_max, is_available
 	`
 
 	var newEt generator.EquationType
-	err = tx.QueryRow(query,
+	err = tx.QueryRowContext(ctx, query,
 		et.Class, et.Name, et.Description, et.Operation, et.NumOperands,
 		et.NoRemainder, nullIfMinusOne(et.ResultMax), et.IsAvailable, et.ID,
 	).Scan(
@@ -273,7 +291,7 @@ func (r *TypeRepository) Update(et generator.EquationType) (*generator.EquationT
 	}
 
 	// Удаляем старые диапазоны операндов
-	_, err = tx.Exec(`DELETE FROM operand_ranges WHERE equation_type_id = $1`, et.ID)
+	_, err = tx.ExecContext(ctx, `DELETE FROM operand_ranges WHERE equation_type_id = $1`, et.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -284,7 +302,7 @@ func (r *TypeRepository) Update(et generator.EquationType) (*generator.EquationT
 			INSERT INTO operand_ranges (equation_type_id, operand_order, min_value, max_value)
 			VALUES ($1, $2, $3, $4)
 		`
-		_, err = tx.Exec(opQuery, et.ID, op.Order, op.MinValue, op.MaxValue)
+		_, err = tx.ExecContext(ctx, opQuery, et.ID, op.Order, op.MinValue, op.MaxValue)
 		if err != nil {
 			return nil, err
 		}
@@ -301,17 +319,23 @@ func (r *TypeRepository) Update(et generator.EquationType) (*generator.EquationT
 	return &newEt, nil
 }
 
-// Delete удаляет тип уравнения
-func (r *TypeRepository) Delete(id int) error {
-	query := `DELETE FROM equation_types WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+// Delete переносит тип уравнения в корзину. Попытки и прогресс учеников по нему сохраняются.
+func (r *TypeRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `UPDATE equation_types SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
 // ToggleAvailability переключает доступность типа уравнения
-func (r *TypeRepository) ToggleAvailability(id int) error {
-	query := `UPDATE equation_types SET is_available = NOT is_available WHERE id = $1`
-	_, err := r.db.Exec(query, id)
+func (r *TypeRepository) ToggleAvailability(ctx context.Context, id int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `UPDATE equation_types SET is_available = NOT is_available WHERE id = $1 AND deleted_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
@@ -1,17 +1,19 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"edugame/internal/entity"
 	"fmt"
 )
 
 type UserProgressRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewUserProgressRepository(db *sql.DB) *UserProgressRepository {
-	return &UserProgressRepository{db: db}
+func NewUserProgressRepository(db *sql.DB, timeouts QueryTimeouts) *UserProgressRepository {
+	return &UserProgressRepository{db: db, timeouts: timeouts}
 }
 
 type TypeStat struct {
@@ -22,10 +24,13 @@ type TypeStat struct {
 }
 
 // получить прогресс определенного пользователя по определенному типу уравнений
-func (r *UserProgressRepository) GetUserProgressBySpecificEqType(userId, equationTypeId int) (entity.UserProgress, error) {
+func (r *UserProgressRepository) GetUserProgressBySpecificEqType(ctx context.Context, userId, equationTypeId int) (entity.UserProgress, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	var up entity.UserProgress
 
-	err := r.db.QueryRow(`
+	err := r.db.QueryRowContext(ctx, `
 		SELECT id, 
 			?, 
 			username, 
@@ -61,7 +66,10 @@ func (r *UserProgressRepository) GetUserProgressBySpecificEqType(userId, equatio
 	return up, err
 }
 
-func (r *UserProgressRepository) GetUserAllProgress(userId int) ([]entity.UserProgress, error) {
+func (r *UserProgressRepository) GetUserAllProgress(ctx context.Context, userId int) ([]entity.UserProgress, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	// Используем правильный многострочный литерал
 	query := `
 SELECT 
@@ -81,10 +89,10 @@ SELECT
 FROM user_progress 
 JOIN equation_types ON user_progress.equation_type_id = equation_types.id
 JOIN users ON users.id = user_progress.user_id
-WHERE user_progress.user_id = $1
+WHERE user_progress.user_id = $1 AND equation_types.deleted_at IS NULL
 `
 
-	rows, err := r.db.Query(query, userId)
+	rows, err := r.db.QueryContext(ctx, query, userId)
 
 	if err != nil {
 		return nil, err
@@ -127,7 +135,10 @@ WHERE user_progress.user_id = $1
 }
 
 // GetWeakTypesId возвращает id тех типов уравнений, в которых пользователь решил менее 70 процентов примеров правильно
-func (r *TypeRepository) GetWeakTypesId(list []entity.UserProgress) ([]int, error) {
+func (r *TypeRepository) GetWeakTypesId(ctx context.Context, list []entity.UserProgress) ([]int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	if len(list) == 0 {
 		return nil, &UserProgressRepositoryError{"No user progress"}
 	}
@@ -152,7 +163,10 @@ func (e *UserProgressRepositoryError) Error() string {
 	return "User repository error: " + e.Message
 }
 
-func (r *UserProgressRepository) GetUserTypeStatistics(userID int) (map[int]TypeStat, error) {
+func (r *UserProgressRepository) GetUserTypeStatistics(ctx context.Context, userID int) (map[int]TypeStat, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
     SELECT 
         et.id as type_id,
@@ -165,13 +179,13 @@ func (r *UserProgressRepository) GetUserTypeStatistics(userID int) (map[int]Type
         SELECT c.grade 
         FROM classes c
         JOIN student_classes sc ON c.id = sc.class_id
-        WHERE sc.student_id = $2
+        WHERE sc.student_id = $2 AND c.deleted_at IS NULL
         LIMIT 1
-    )
+    ) AND et.deleted_at IS NULL
     ORDER BY et.id
 `
 
-	rows, err := r.db.Query(query, userID, userID)
+	rows, err := r.db.QueryContext(ctx, query, userID, userID)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
@@ -2,26 +2,41 @@
 package repository
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"edugame/internal/entity"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrAccountPending - заявка ученика еще не подтверждена учителем
+var ErrAccountPending = errors.New("учетная запись ожидает подтверждения учителя")
+
+// ErrAccountBlocked - учетная запись заблокирована администратором или учителем
+var ErrAccountBlocked = errors.New("учетная запись заблокирована")
+
+// ErrAccountLocked - учетная запись временно заблокирована после серии неудачных входов
+var ErrAccountLocked = errors.New("учетная запись временно заблокирована")
+
 type UserRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *sql.DB, timeouts QueryTimeouts) *UserRepository {
+	return &UserRepository{db: db, timeouts: timeouts}
 }
 
 // Регистрация пользователя
-func (r *UserRepository) Register(username, password, roleName, fullName string, classID *int) (*entity.User, error) {
+func (r *UserRepository) Register(ctx context.Context, username, password, roleName, fullName string, classID *int) (*entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	// Хэшируем пароль
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -30,7 +45,7 @@ func (r *UserRepository) Register(username, password, roleName, fullName string,
 
 	// Получаем role_id по имени роли
 	var roleID int
-	err = r.db.QueryRow("SELECT id FROM roles WHERE name = $1", roleName).Scan(&roleID)
+	err = r.db.QueryRowContext(ctx, "SELECT id FROM roles WHERE name = $1", roleName).Scan(&roleID)
 	if err != nil {
 		return nil, fmt.Errorf("роль '%s' не найдена", roleName)
 	}
@@ -43,14 +58,14 @@ func (r *UserRepository) Register(username, password, roleName, fullName string,
         RETURNING id
     `
 
-	err = r.db.QueryRow(query, username, string(hashedPassword), roleID, fullName).Scan(&userID)
+	err = r.db.QueryRowContext(ctx, query, username, string(hashedPassword), roleID, fullName).Scan(&userID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Если ученик, добавляем в класс
 	if roleName == "student" && classID != nil {
-		_, err = r.db.Exec(
+		_, err = r.db.ExecContext(ctx,
 			"INSERT INTO student_classes (student_id, class_id) VALUES ($1, $2)",
 			userID, *classID,
 		)
@@ -59,34 +74,82 @@ func (r *UserRepository) Register(username, password, roleName, fullName string,
 		}
 	}
 
-	return r.GetByID(userID)
+	return r.GetByID(ctx, userID)
+}
+
+// RegisterStudentRequest создает ученика по коду класса. До подтверждения учителем
+// учетная запись находится в состоянии ожидания и войти в нее нельзя.
+func (r *UserRepository) RegisterStudentRequest(ctx context.Context, username, password, fullName string, classID int) (*entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO users (username, password_hash, role_id, fullname, pending)
+        VALUES ($1, $2, (SELECT id FROM roles WHERE name = 'student'), $3, TRUE)
+        RETURNING id
+    `, username, string(hashedPassword), fullName).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO student_classes (student_id, class_id) VALUES ($1, $2)`, userID, classID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(ctx, userID)
 }
 
 // Аутентификация
-func (r *UserRepository) Login(username, password string) (*entity.User, error) {
+func (r *UserRepository) Login(ctx context.Context, username, password string) (*entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	var user entity.User
 	var passwordHash string
 	var roleID int
+	var lockedUntil sql.NullTime
+	var pending bool
 
 	query := `
-        SELECT id, username, password_hash, role_id, fullname, created_at
+        SELECT id, username, password_hash, role_id, fullname, created_at, locked_until, pending, blocked
         FROM users 
-        WHERE username = $1
+        WHERE username = $1 AND deleted_at IS NULL
     `
 
-	err := r.db.QueryRow(query, username).Scan(
+	err := r.db.QueryRowContext(ctx, query, username).Scan(
 		&user.ID, &user.Username, &passwordHash,
-		&roleID, &user.FullName, &user.CreatedAt,
+		&roleID, &user.FullName, &user.CreatedAt, &lockedUntil, &pending, &user.Blocked,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+		return nil, ErrAccountLocked
+	}
+
 	user.RoleID = roleID
 
 	// Получаем информацию о роли
-	role, err := r.getRoleByID(roleID)
+	role, err := r.getRoleByID(ctx, roleID)
 	if err == nil {
 		user.Role = role
 	}
@@ -97,89 +160,179 @@ func (r *UserRepository) Login(username, password string) (*entity.User, error)
 		return nil, err
 	}
 
+	if pending {
+		return nil, ErrAccountPending
+	}
+
+	if user.Blocked {
+		return nil, ErrAccountBlocked
+	}
+
 	return &user, nil
 }
 
-// Получение роли по ID
-func (r *UserRepository) getRoleByID(roleID int) (*entity.Role, error) {
-	query := `SELECT id, name, description, created_at FROM roles WHERE id = $1`
-	var role entity.Role
-	err := r.db.QueryRow(query, roleID).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt)
+// RegisterFailedLogin увеличивает счетчик неудачных входов пользователя.
+// При достижении порога учетная запись блокируется на lockFor, а счетчик обнуляется.
+func (r *UserRepository) RegisterFailedLogin(ctx context.Context, username string, threshold int, lockFor time.Duration) (bool, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `
+        UPDATE users
+        SET failed_login_count = CASE WHEN failed_login_count + 1 >= $2 THEN 0 ELSE failed_login_count + 1 END,
+            locked_until = CASE WHEN failed_login_count + 1 >= $2 THEN $3 ELSE locked_until END
+        WHERE username = $1 AND deleted_at IS NULL
+        RETURNING locked_until
+    `
+
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, username, threshold, time.Now().Add(lockFor)).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	return &role, nil
+
+	return lockedUntil.Valid && lockedUntil.Time.After(time.Now()), nil
 }
 
-// Создание сессии
-func (r *UserRepository) CreateSession(userID int) (string, error) {
-	// Генерируем токен
-	token, err := generateToken()
+// ResetFailedLogins обнуляет счетчик неудачных входов после успешного входа
+func (r *UserRepository) ResetFailedLogins(ctx context.Context, userID int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET failed_login_count = 0 WHERE id = $1`, userID)
+	return err
+}
+
+// Block блокирует учетную запись и сразу завершает все ее сессии
+func (r *UserRepository) Block(ctx context.Context, userID int, reason string, blockedBy int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return "", err
+		return err
 	}
+	defer tx.Rollback()
 
-	expiresAt := time.Now().Add(24 * time.Hour) // Сессия на 24 часа
+	result, err := tx.ExecContext(ctx, `
+        UPDATE users SET blocked = TRUE, blocked_reason = $2, blocked_at = $3, blocked_by = $4
+        WHERE id = $1
+    `, userID, reason, time.Now(), blockedBy)
+	if err != nil {
+		return err
+	}
 
-	_, err = r.db.Exec(`
-        INSERT INTO user_sessions (user_id, session_token, expires_at)
-        VALUES ($1, $2, $3)
-    `, userID, token, expiresAt)
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
 
-	return token, err
+	return tx.Commit()
 }
 
-// Получение пользователя по токену
-func (r *UserRepository) GetBySessionToken(token string) (*entity.User, error) {
-	var user entity.User
-	var roleID int
+// Unblock снимает блокировку учетной записи
+func (r *UserRepository) Unblock(ctx context.Context, userID int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
 
-	query := `
-        SELECT u.id, u.username, u.role_id, u.fullname, u.created_at
-        FROM users u
-        JOIN user_sessions s ON u.id = s.user_id
-        WHERE s.session_token = $1 AND s.expires_at > NOW()
-    `
+	result, err := r.db.ExecContext(ctx, `
+        UPDATE users SET blocked = FALSE, blocked_reason = NULL, blocked_at = NULL, blocked_by = NULL
+        WHERE id = $1
+    `, userID)
+	if err != nil {
+		return err
+	}
 
-	err := r.db.QueryRow(query, token).Scan(
-		&user.ID, &user.Username, &roleID,
-		&user.FullName, &user.CreatedAt,
-	)
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
 
+// SetPicturePassword сохраняет хеш картиночного пароля (последовательность ключей картинок)
+func (r *UserRepository) SetPicturePassword(ctx context.Context, userID int, secret string) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `UPDATE users SET picture_password_hash = $2 WHERE id = $1`, userID, string(hashed))
+	return err
+}
+
+// LoginByPicturePassword проверяет картиночный пароль ученика класса
+func (r *UserRepository) LoginByPicturePassword(ctx context.Context, classID, userID int, secret string) (*entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	var hash sql.NullString
+	var blocked bool
+
+	err := r.db.QueryRowContext(ctx, `
+        SELECT u.picture_password_hash, u.blocked
+        FROM users u
+        JOIN student_classes sc ON sc.student_id = u.id
+        WHERE u.id = $1 AND sc.class_id = $2 AND u.deleted_at IS NULL
+    `, userID, classID).Scan(&hash, &blocked)
 	if err != nil {
 		return nil, err
 	}
 
-	user.RoleID = roleID
+	if !hash.Valid {
+		return nil, errors.New("картиночный пароль не задан")
+	}
 
-	// Получаем информацию о роли
-	role, err := r.getRoleByID(roleID)
-	if err == nil {
-		user.Role = role
+	if err := bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(secret)); err != nil {
+		return nil, err
 	}
 
-	return &user, nil
+	if blocked {
+		return nil, ErrAccountBlocked
+	}
+
+	return r.GetByID(ctx, userID)
 }
 
-// Удаление сессии (выход)
-func (r *UserRepository) Logout(token string) error {
-	_, err := r.db.Exec("DELETE FROM user_sessions WHERE session_token = $1", token)
-	return err
+// Получение роли по ID
+func (r *UserRepository) getRoleByID(ctx context.Context, roleID int) (*entity.Role, error) {
+	query := `SELECT id, name, description, created_at FROM roles WHERE id = $1`
+	var role entity.Role
+	err := r.db.QueryRowContext(ctx, query, roleID).Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
 }
 
 // Получение пользователя по ID
-func (r *UserRepository) GetByID(id int) (*entity.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	var user entity.User
 	var roleID int
 
+	var blockedReason sql.NullString
+
 	query := `
-        SELECT id, username, role_id, fullname, created_at
-        FROM users WHERE id = $1
+        SELECT id, username, role_id, fullname, school_id, created_at, blocked, blocked_reason, blocked_at
+        FROM users WHERE id = $1 AND deleted_at IS NULL
     `
 
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID, &user.Username, &roleID,
-		&user.FullName, &user.CreatedAt,
+		&user.FullName, &user.SchoolID, &user.CreatedAt,
+		&user.Blocked, &blockedReason, &user.BlockedAt,
 	)
 
 	if err != nil {
@@ -187,9 +340,10 @@ func (r *UserRepository) GetByID(id int) (*entity.User, error) {
 	}
 
 	user.RoleID = roleID
+	user.BlockedReason = blockedReason.String
 
 	// Получаем информацию о роли
-	role, err := r.getRoleByID(roleID)
+	role, err := r.getRoleByID(ctx, roleID)
 	if err == nil {
 		user.Role = role
 	}
@@ -198,14 +352,18 @@ func (r *UserRepository) GetByID(id int) (*entity.User, error) {
 }
 
 // GetAllUsers получает всех пользователей
-func (r *UserRepository) GetAllUsers() ([]entity.User, error) {
+func (r *UserRepository) GetAllUsers(ctx context.Context) ([]entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
-        SELECT id, username, role_id, fullname, created_at
+        SELECT id, username, role_id, fullname, created_at, blocked, blocked_reason, blocked_at
         FROM users
+        WHERE deleted_at IS NULL
         ORDER BY created_at DESC
     `
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -215,19 +373,22 @@ func (r *UserRepository) GetAllUsers() ([]entity.User, error) {
 	for rows.Next() {
 		var user entity.User
 		var roleID int
+		var blockedReason sql.NullString
 
 		err := rows.Scan(
 			&user.ID, &user.Username, &roleID,
 			&user.FullName, &user.CreatedAt,
+			&user.Blocked, &blockedReason, &user.BlockedAt,
 		)
 		if err != nil {
 			continue
 		}
 
 		user.RoleID = roleID
+		user.BlockedReason = blockedReason.String
 
 		// Получаем информацию о роли
-		role, err := r.getRoleByID(roleID)
+		role, err := r.getRoleByID(ctx, roleID)
 		if err == nil {
 			user.Role = role
 		}
@@ -239,16 +400,42 @@ func (r *UserRepository) GetAllUsers() ([]entity.User, error) {
 }
 
 // GetUserByRoleType получает пользователей по типу роли
-func (r *UserRepository) GetUserByRoleType(roleName string) ([]entity.User, error) {
+func (r *UserRepository) GetUserByRoleType(ctx context.Context, roleName string) ([]entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
-        SELECT u.id, u.username, u.role_id, u.fullname, u.created_at
+        SELECT u.id, u.username, u.role_id, u.fullname, u.created_at, u.blocked, u.blocked_reason, u.blocked_at
         FROM users u
         JOIN roles r ON u.role_id = r.id
-        WHERE r.name = $1
+        WHERE r.name = $1 AND u.deleted_at IS NULL
+        ORDER BY u.created_at DESC
+    `
+
+	return r.listUsers(ctx, query, roleName)
+}
+
+// GetUsersWithPermission получает пользователей, чья роль дает право permission
+// (встроенная или настроенная администратором)
+func (r *UserRepository) GetUsersWithPermission(ctx context.Context, permission string) ([]entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	query := `
+        SELECT u.id, u.username, u.role_id, u.fullname, u.created_at, u.blocked, u.blocked_reason, u.blocked_at
+        FROM users u
+        JOIN role_permissions rp ON rp.role_id = u.role_id
+        JOIN permissions p ON p.id = rp.permission_id
+        WHERE p.code = $1 AND u.deleted_at IS NULL
         ORDER BY u.created_at DESC
     `
 
-	rows, err := r.db.Query(query, roleName)
+	return r.listUsers(ctx, query, permission)
+}
+
+// listUsers читает список пользователей вместе с их ролями
+func (r *UserRepository) listUsers(ctx context.Context, query string, args ...interface{}) ([]entity.User, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -258,19 +445,22 @@ func (r *UserRepository) GetUserByRoleType(roleName string) ([]entity.User, erro
 	for rows.Next() {
 		var user entity.User
 		var roleID int
+		var blockedReason sql.NullString
 
 		err := rows.Scan(
 			&user.ID, &user.Username, &roleID,
 			&user.FullName, &user.CreatedAt,
+			&user.Blocked, &blockedReason, &user.BlockedAt,
 		)
 		if err != nil {
 			continue
 		}
 
 		user.RoleID = roleID
+		user.BlockedReason = blockedReason.String
 
 		// Получаем информацию о роли
-		role, err := r.getRoleByID(roleID)
+		role, err := r.getRoleByID(ctx, roleID)
 		if err == nil {
 			user.Role = role
 		}
@@ -282,26 +472,34 @@ func (r *UserRepository) GetUserByRoleType(roleName string) ([]entity.User, erro
 }
 
 // UpdateUser обновляет пользователя
-func (r *UserRepository) UpdateUser(id int, username, fullName, email string, roleID int, schoolID *int) (*entity.User, error) {
+func (r *UserRepository) UpdateUser(ctx context.Context, id int, username, fullName, email string, roleID int, schoolID *int) (*entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
         UPDATE users
-        SET username = $1, fullname = $2, role_id = $3
-        WHERE id = $4
-        RETURNING id, username, role_id, fullname, created_at
+        SET username = $1, fullname = $2, email = NULLIF($3, ''), role_id = $4, school_id = $5
+        WHERE id = $6 AND deleted_at IS NULL
+        RETURNING id, username, role_id, fullname, school_id, created_at
     `
 
 	var newUser entity.User
-	err := r.db.QueryRow(query, username, roleID, fullName, id).Scan(
+	var school sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, username, fullName, email, roleID, schoolID, id).Scan(
 		&newUser.ID, &newUser.Username, &newUser.RoleID,
-		&newUser.FullName, &newUser.CreatedAt,
+		&newUser.FullName, &school, &newUser.CreatedAt,
 	)
 
 	if err != nil {
 		return nil, err
 	}
+	if school.Valid {
+		id := int(school.Int64)
+		newUser.SchoolID = &id
+	}
 
 	// Получаем информацию о роли
-	role, err := r.getRoleByID(newUser.RoleID)
+	role, err := r.getRoleByID(ctx, newUser.RoleID)
 	if err == nil {
 		newUser.Role = role
 	}
@@ -309,25 +507,43 @@ func (r *UserRepository) UpdateUser(id int, username, fullName, email string, ro
 	return &newUser, nil
 }
 
-// DeleteUser удаляет пользователя
-func (r *UserRepository) DeleteUser(id int) error {
-	query := `DELETE FROM users WHERE id = $1`
-	_, err := r.db.Exec(query, id)
-	return err
+// DeleteUser переносит пользователя в корзину
+func (r *UserRepository) DeleteUser(ctx context.Context, id int) error {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Удаление мягкое: пользователь попадает в корзину, его сеансы завершаются сразу
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // Получение учеников класса (для учителя)
-func (r *UserRepository) GetStudentsByClass(classID int) ([]entity.User, error) {
+func (r *UserRepository) GetStudentsByClass(ctx context.Context, classID int) ([]entity.User, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	query := `
         SELECT u.id, u.username, u.role_id, u.fullname, u.email, u.school_id, u.created_at
         FROM users u
         JOIN student_classes sc ON u.id = sc.student_id
         JOIN roles r ON u.role_id = r.id
-        WHERE r.name = 'student' AND sc.class_id = $1
+        WHERE r.name = 'student' AND sc.class_id = $1 AND u.deleted_at IS NULL
         ORDER BY u.fullname
     `
 
-	rows, err := r.db.Query(query, classID)
+	rows, err := r.db.QueryContext(ctx, query, classID)
 	if err != nil {
 		return nil, err
 	}
@@ -349,7 +565,7 @@ func (r *UserRepository) GetStudentsByClass(classID int) ([]entity.User, error)
 		user.RoleID = roleID
 
 		// Получаем информацию о роли
-		role, err := r.getRoleByID(roleID)
+		role, err := r.getRoleByID(ctx, roleID)
 		if err == nil {
 			user.Role = role
 		}
@@ -361,10 +577,14 @@ func (r *UserRepository) GetStudentsByClass(classID int) ([]entity.User, error)
 }
 
 // Получение всех классов (для админа)
-func (r *UserRepository) GetAllClasses() ([]entity.Class, error) {
-	rows, err := r.db.Query(`
-        SELECT id, name, grade, teacher_id, school_id, created_at 
+func (r *UserRepository) GetAllClasses(ctx context.Context) ([]entity.Class, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, name, grade, COALESCE(teacher_id, 0), school_id, created_at 
         FROM classes 
+        WHERE deleted_at IS NULL
         ORDER BY grade, name
     `)
 	if err != nil {
@@ -405,18 +625,21 @@ func generateToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
 
-func (r *UserRepository) GetStudentClass(studentID int) (int, error) {
+func (r *UserRepository) GetStudentClass(ctx context.Context, studentID int) (int, error) {
+	ctx, cancel := r.timeouts.query(ctx)
+	defer cancel()
+
 	var classGrade int
 
 	query := `
         SELECT c.grade 
         FROM classes c
         JOIN student_classes sc ON c.id = sc.class_id
-        WHERE sc.student_id = $1
+        WHERE sc.student_id = $1 AND c.deleted_at IS NULL
         LIMIT 1
     `
 
-	err := r.db.QueryRow(query, studentID).Scan(&classGrade)
+	err := r.db.QueryRowContext(ctx, query, studentID).Scan(&classGrade)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, fmt.Errorf("ученик не привязан к классу")
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Аргументы UPDATE должны идти в порядке столбцов: раньше ФИО попадало в role_id,
+// а почта и школа не сохранялись вовсе
+func TestUpdateUserBindsColumnsInOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	schoolID := 5
+	mock.ExpectQuery(`UPDATE users\s+SET username = \$1, fullname = \$2, email = NULLIF\(\$3, ''\), role_id = \$4, school_id = \$5\s+WHERE id = \$6`).
+		WithArgs("ivanova", "Иванова Мария", "ivanova@school.ru", 3, schoolID, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role_id", "fullname", "school_id", "created_at"}).
+			AddRow(10, "ivanova", 3, "Иванова Мария", schoolID, time.Now()))
+	mock.ExpectQuery(`FROM roles WHERE id = \$1`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "created_at"}).
+			AddRow(3, "teacher", "", time.Now()))
+
+	repo := NewUserRepository(db, QueryTimeouts{})
+	user, err := repo.UpdateUser(context.Background(), 10, "ivanova", "Иванова Мария", "ivanova@school.ru", 3, &schoolID)
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	if user.RoleID != 3 || user.SchoolID == nil || *user.SchoolID != schoolID {
+		t.Errorf("user = %+v, want role 3 in school %d", user, schoolID)
+	}
+	if user.Role == nil || user.Role.Name != "teacher" {
+		t.Errorf("role = %+v, want teacher", user.Role)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
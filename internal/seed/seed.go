@@ -0,0 +1,462 @@
+// Package seed наполняет базу демо-данными для разработки: школы, классы,
+// учителя, ученики с известными паролями и несколько недель правдоподобных попыток.
+// Данные создаются через интерфейсы репозиториев, поэтому работают и с PostgreSQL, и с хранилищем в памяти.
+package seed
+
+import (
+	"context"
+	"edugame/internal"
+	"edugame/internal/entity"
+	"edugame/internal/generator"
+	"edugame/internal/repository"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Password - пароль всех демо-учетных записей
+const Password = "demo123"
+
+// ErrAlreadySeeded - демо-данные уже загружены в эту базу
+var ErrAlreadySeeded = errors.New("демо-данные уже загружены")
+
+// Repos - репозитории, через которые создаются демо-данные
+type Repos struct {
+	Schools   repository.Schools
+	Classes   repository.Classes
+	Staff     repository.ClassStaff
+	Users     repository.Users
+	Guardians repository.Guardians
+	Types     repository.Types
+	Attempts  repository.Attempts
+}
+
+// Options - объем и воспроизводимость демо-данных
+type Options struct {
+	Weeks            int       // недель истории попыток
+	StudentsPerClass int       // учеников в каждом классе
+	Seed             int64     // зерно случайности: одинаковое зерно дает одинаковые данные
+	Now              time.Time // конец истории, по умолчанию текущий момент
+}
+
+// Account - созданная учетная запись
+type Account struct {
+	ID       int
+	Username string
+	FullName string
+	Role     string
+	Class    string
+}
+
+// Result - итоги наполнения
+type Result struct {
+	Accounts []Account
+	Schools  int
+	Classes  int
+	Attempts int
+}
+
+// Students возвращает учетные записи учеников
+func (r *Result) Students() []Account {
+	var students []Account
+	for _, a := range r.Accounts {
+		if a.Role == "student" {
+			students = append(students, a)
+		}
+	}
+	return students
+}
+
+type staffSpec struct {
+	username string
+	role     string // entity.StaffRole*
+}
+
+type classSpec struct {
+	name  string
+	grade int
+	lead  string
+	staff []staffSpec
+}
+
+type schoolSpec struct {
+	name, address, phone, email string
+	director                    Account
+	teachers                    []Account
+	classes                     []classSpec
+}
+
+// Демо-мир: у Сидорова два класса (переключатель классов), у Иванова - ассистент
+var world = []schoolSpec{
+	{
+		name:     "Школа №1 им. А.С. Пушкина",
+		address:  "г. Москва, ул. Пушкина, д. 1",
+		phone:    "+7 (495) 111-11-11",
+		email:    "school1@example.com",
+		director: Account{Username: "director1", FullName: "Орлова Наталья Викторовна"},
+		teachers: []Account{
+			{Username: "teacher1", FullName: "Сидоров Петр Алексеевич"},
+			{Username: "teacher2", FullName: "Иванова Анна Сергеевна"},
+		},
+		classes: []classSpec{
+			{name: "3А", grade: 3, lead: "teacher1"},
+			{name: "3Б", grade: 3, lead: "teacher1"},
+			{name: "4А", grade: 4, lead: "teacher2", staff: []staffSpec{
+				{username: "teacher1", role: entity.StaffRoleAssistant},
+			}},
+		},
+	},
+	{
+		name:     "Гимназия №5",
+		address:  "г. Москва, пр. Мира, д. 5",
+		phone:    "+7 (495) 555-55-55",
+		email:    "gymnasium5@example.com",
+		director: Account{Username: "director2", FullName: "Кузнецов Олег Игоревич"},
+		teachers: []Account{
+			{Username: "teacher3", FullName: "Петрова Мария Андреевна"},
+			{Username: "teacher4", FullName: "Смирнов Денис Павлович"},
+		},
+		classes: []classSpec{
+			{name: "3В", grade: 3, lead: "teacher3"},
+			{name: "4Б", grade: 4, lead: "teacher4"},
+		},
+	},
+}
+
+// Фамилии на -ов/-ев/-ин: женская форма получается добавлением "а"
+var (
+	lastNames  = []string{"Иванов", "Смирнов", "Кузнецов", "Попов", "Васильев", "Соколов", "Михайлов", "Новиков", "Федоров", "Морозов", "Волков", "Алексеев", "Лебедев", "Семенов", "Егоров", "Павлов", "Козлов", "Степанов", "Николаев", "Орлов", "Андреев", "Макаров", "Никитин", "Захаров"}
+	boyNames   = []string{"Артем", "Максим", "Иван", "Михаил", "Даниил", "Дмитрий", "Кирилл", "Андрей", "Егор", "Никита", "Илья", "Алексей", "Матвей", "Тимофей", "Роман"}
+	girlNames  = []string{"Анна", "Мария", "София", "Алиса", "Виктория", "Полина", "Елизавета", "Дарья", "Варвара", "Вероника", "Ксения", "Арина", "Василиса", "Милана", "Ева"}
+	parentName = "Морозова Ольга Николаевна"
+)
+
+// Run создает демо-мир и историю попыток. Повторный запуск возвращает ErrAlreadySeeded.
+func Run(ctx context.Context, repos Repos, opts Options) (*Result, error) {
+	if opts.Weeks <= 0 {
+		opts.Weeks = 6
+	}
+	if opts.StudentsPerClass <= 0 {
+		opts.StudentsPerClass = 12
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	schools, err := repos.Schools.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("проверка существующих школ: %w", err)
+	}
+	for _, s := range schools {
+		if s.Name == world[0].name {
+			return nil, ErrAlreadySeeded
+		}
+	}
+
+	types, err := repos.Types.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("получение типов уравнений: %w", err)
+	}
+
+	s := &seeder{
+		repos: repos,
+		opts:  opts,
+		rnd:   rand.New(rand.NewSource(opts.Seed)),
+		gen:   generator.NewSeededGenerator(opts.Seed),
+		users: make(map[string]int),
+		types: make(map[int][]generator.EquationType),
+	}
+	for _, t := range types {
+		if t.IsAvailable && generatable(t) {
+			s.types[t.Class] = append(s.types[t.Class], t)
+		}
+	}
+
+	if err := s.createWorld(ctx); err != nil {
+		return nil, err
+	}
+	return &s.result, nil
+}
+
+type seeder struct {
+	repos  Repos
+	opts   Options
+	rnd    *rand.Rand
+	gen    *generator.Generator
+	users  map[string]int // username -> id
+	types  map[int][]generator.EquationType
+	result Result
+	serial int // сквозной номер ученика для логина studentN
+}
+
+func (s *seeder) createWorld(ctx context.Context) error {
+	if _, err := s.register(ctx, Account{Username: "admin", FullName: "Администратор системы", Role: "admin"}, nil); err != nil {
+		return err
+	}
+	if _, err := s.register(ctx, Account{Username: "district", FullName: "Белова Ирина Юрьевна", Role: "district"}, nil); err != nil {
+		return err
+	}
+
+	for _, spec := range world {
+		school, err := s.repos.Schools.Create(ctx, spec.name, spec.address, spec.phone, spec.email)
+		if err != nil {
+			return fmt.Errorf("создание школы %s: %w", spec.name, err)
+		}
+		s.result.Schools++
+
+		director := spec.director
+		director.Role = "director"
+		if _, err := s.register(ctx, director, &school.ID); err != nil {
+			return err
+		}
+		for _, teacher := range spec.teachers {
+			teacher.Role = "teacher"
+			if _, err := s.register(ctx, teacher, &school.ID); err != nil {
+				return err
+			}
+		}
+
+		for _, cs := range spec.classes {
+			if err := s.createClass(ctx, cs, school.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.createParent(ctx)
+}
+
+// register создает учетную запись; сотрудников привязывает к школе
+func (s *seeder) register(ctx context.Context, acc Account, schoolID *int) (*entity.User, error) {
+	user, err := s.repos.Users.Register(ctx, acc.Username, Password, acc.Role, acc.FullName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("создание пользователя %s: %w", acc.Username, err)
+	}
+	if schoolID != nil {
+		if _, err := s.repos.Users.UpdateUser(ctx, user.ID, acc.Username, acc.FullName, "", user.RoleID, schoolID); err != nil {
+			return nil, fmt.Errorf("привязка %s к школе: %w", acc.Username, err)
+		}
+	}
+
+	acc.ID = user.ID
+	s.users[acc.Username] = user.ID
+	s.result.Accounts = append(s.result.Accounts, acc)
+	return user, nil
+}
+
+func (s *seeder) createClass(ctx context.Context, cs classSpec, schoolID int) error {
+	class, err := s.repos.Classes.Create(ctx, cs.name, cs.grade, s.users[cs.lead], &schoolID)
+	if err != nil {
+		return fmt.Errorf("создание класса %s: %w", cs.name, err)
+	}
+	s.result.Classes++
+
+	for _, member := range cs.staff {
+		if err := s.repos.Staff.Set(ctx, class.ID, s.users[member.username], member.role); err != nil {
+			return fmt.Errorf("добавление %s в класс %s: %w", member.username, cs.name, err)
+		}
+	}
+
+	for i := 0; i < s.opts.StudentsPerClass; i++ {
+		s.serial++
+		acc := Account{
+			Username: "student" + strconv.Itoa(s.serial),
+			FullName: s.studentName(),
+			Role:     "student",
+			Class:    cs.name,
+		}
+		user, err := s.repos.Users.Register(ctx, acc.Username, Password, acc.Role, acc.FullName, &class.ID)
+		if err != nil {
+			return fmt.Errorf("создание ученика %s: %w", acc.Username, err)
+		}
+		acc.ID = user.ID
+		s.users[acc.Username] = user.ID
+		s.result.Accounts = append(s.result.Accounts, acc)
+
+		if err := s.simulate(ctx, user.ID, s.types[cs.grade]); err != nil {
+			return fmt.Errorf("история попыток %s: %w", acc.Username, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *seeder) studentName() string {
+	last := lastNames[s.rnd.Intn(len(lastNames))]
+	if s.rnd.Intn(2) == 0 {
+		return last + " " + boyNames[s.rnd.Intn(len(boyNames))]
+	}
+	return last + "а " + girlNames[s.rnd.Intn(len(girlNames))]
+}
+
+// createParent привязывает родителя к первому ученику по коду, как это делает учитель
+func (s *seeder) createParent(ctx context.Context) error {
+	students := s.result.Students()
+	if len(students) == 0 || s.repos.Guardians == nil {
+		return nil
+	}
+
+	code, _, err := s.repos.Guardians.IssueCode(ctx, students[0].ID, s.users[world[0].classes[0].lead], internal.GuardianCodeTTL)
+	if err != nil {
+		return fmt.Errorf("код привязки родителя: %w", err)
+	}
+	parentID, _, err := s.repos.Guardians.RegisterParent(ctx, code, "parent1", Password, parentName)
+	if err != nil {
+		return fmt.Errorf("создание родителя: %w", err)
+	}
+
+	s.users["parent1"] = parentID
+	s.result.Accounts = append(s.result.Accounts, Account{ID: parentID, Username: "parent1", FullName: parentName, Role: "parent"})
+	return nil
+}
+
+// generatable отсекает типы, для которых генератор не найдет пример: без предела результата
+// (ResultMax = -1) сложение и умножение никогда не укладываются в границу
+func generatable(t generator.EquationType) bool {
+	if len(t.Operands) < t.NumOperands || t.NumOperands < 2 {
+		return false
+	}
+	return t.ResultMax >= 0 || strings.ContainsAny(t.Operation, "-/")
+}
+
+// learner - модель ученика: вероятность верного ответа по типу растет с числом решенных примеров
+// по кривой обучения p = ceiling - (ceiling - start) * exp(-n / pace)
+type learner struct {
+	ability    float64 // стартовая доля верных ответов на простом типе
+	ceiling    float64 // предел, к которому стремится ученик
+	pace       float64 // за сколько примеров закрывается ~63% разрыва
+	engagement float64 // вероятность позаниматься в учебный день
+	solved     map[int]int
+}
+
+func (s *seeder) newLearner() *learner {
+	ability := 0.45 + s.rnd.Float64()*0.35
+	return &learner{
+		ability:    ability,
+		ceiling:    math.Min(0.97, ability+0.15+s.rnd.Float64()*0.15),
+		pace:       40 + s.rnd.Float64()*80,
+		engagement: 0.25 + s.rnd.Float64()*0.6,
+		solved:     make(map[int]int),
+	}
+}
+
+// difficulty - насколько тип сложнее сложения: умножение, деление и лишние операнды снижают старт
+func difficulty(t generator.EquationType) float64 {
+	d := 0.0
+	for _, op := range t.Operation {
+		switch op {
+		case '*':
+			d = math.Max(d, 0.1)
+		case '/':
+			d = math.Max(d, 0.15)
+		}
+	}
+	if t.NumOperands > 2 {
+		d += 0.08 * float64(t.NumOperands-2)
+	}
+	return d
+}
+
+func (l *learner) chance(t generator.EquationType) float64 {
+	start := math.Max(0.15, l.ability-difficulty(t))
+	ceiling := math.Max(start, l.ceiling-difficulty(t)/3)
+	return ceiling - (ceiling-start)*math.Exp(-float64(l.solved[t.ID])/l.pace)
+}
+
+// simulate записывает историю ученика: занятия по учебным дням после уроков, по 10 примеров,
+// чаще по тем типам, где он ошибается (как адаптивный подбор)
+func (s *seeder) simulate(ctx context.Context, studentID int, types []generator.EquationType) error {
+	if len(types) == 0 {
+		return nil
+	}
+
+	l := s.newLearner()
+	loc := s.opts.Now.Location()
+	today := time.Date(s.opts.Now.Year(), s.opts.Now.Month(), s.opts.Now.Day(), 0, 0, 0, 0, loc)
+	first := today.AddDate(0, 0, -7*s.opts.Weeks)
+
+	for day := first; day.Before(today); day = day.AddDate(0, 0, 1) {
+		engagement := l.engagement
+		if wd := day.Weekday(); wd == time.Saturday || wd == time.Sunday {
+			engagement *= 0.3
+		}
+		if s.rnd.Float64() >= engagement {
+			continue
+		}
+
+		sessions := 1
+		if s.rnd.Float64() < 0.2 {
+			sessions = 2
+		}
+		at := day.Add(time.Duration(15*60+s.rnd.Intn(4*60)) * time.Minute)
+		form := (s.rnd.Float64() - 0.5) * 0.1 // самочувствие в этот день
+
+		for n := 0; n < sessions; n++ {
+			for i := 0; i < 10; i++ {
+				t := s.pickType(l, types)
+				eq, err := s.gen.GenerateEquation(t)
+				if err != nil {
+					return err
+				}
+
+				answer := eq.CorrectAnswer
+				if s.rnd.Float64() >= l.chance(t)+form {
+					answer = s.wrongAnswer(eq.CorrectAnswer)
+				}
+
+				attempt := entity.NewAttempt(studentID, t.ID, eq.Text, eq.CorrectAnswer, answer)
+				attempt.CreatedAt = at
+				if err := s.repos.Attempts.SaveAttempt(ctx, attempt); err != nil {
+					return err
+				}
+				l.solved[t.ID]++
+				s.result.Attempts++
+
+				at = at.Add(time.Duration(20+s.rnd.Intn(50)) * time.Second)
+			}
+			at = at.Add(time.Duration(30+s.rnd.Intn(90)) * time.Minute)
+		}
+	}
+
+	return nil
+}
+
+// pickType выбирает тип с весом, растущим с долей ошибок
+func (s *seeder) pickType(l *learner, types []generator.EquationType) generator.EquationType {
+	weights := make([]float64, len(types))
+	total := 0.0
+	for i, t := range types {
+		weights[i] = 1 - l.chance(t) + 0.2
+		total += weights[i]
+	}
+
+	x := s.rnd.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			return types[i]
+		}
+		x -= w
+	}
+	return types[len(types)-1]
+}
+
+// wrongAnswer - правдоподобная ошибка: промах на 1-3 или на десяток
+func (s *seeder) wrongAnswer(correct string) string {
+	value, err := strconv.Atoi(correct)
+	if err != nil {
+		return "0"
+	}
+
+	delta := 1 + s.rnd.Intn(3)
+	if s.rnd.Float64() < 0.2 {
+		delta = 10
+	}
+	if s.rnd.Intn(2) == 0 && value-delta >= 0 {
+		delta = -delta
+	}
+	return strconv.Itoa(value + delta)
+}
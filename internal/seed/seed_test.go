@@ -0,0 +1,108 @@
+package seed
+
+import (
+	"edugame/internal/generator"
+	"edugame/internal/repository/memory"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func newRepos() (*memory.Store, Repos) {
+	mem := memory.New()
+	mem.AddType(generator.EquationType{
+		Class:       3,
+		Name:        "Сложение и вычитание",
+		Operation:   "+-",
+		NumOperands: 2,
+		Operands:    []generator.OperandRange{{Order: 1, MinValue: 10, MaxValue: 99}, {Order: 2, MinValue: 10, MaxValue: 99}},
+		ResultMax:   100,
+		IsAvailable: true,
+	})
+	mem.AddType(generator.EquationType{
+		Class:       4,
+		Name:        "Умножение",
+		Operation:   "*",
+		NumOperands: 2,
+		Operands:    []generator.OperandRange{{Order: 1, MinValue: 2, MaxValue: 9}, {Order: 2, MinValue: 2, MaxValue: 9}},
+		ResultMax:   100,
+		IsAvailable: true,
+	})
+
+	return mem, Repos{
+		Schools:   mem.Schools(),
+		Classes:   mem.Classes(),
+		Staff:     mem.ClassStaff(),
+		Users:     mem.Users(),
+		Guardians: mem.Guardians(),
+		Types:     mem.Types(),
+		Attempts:  mem.Attempts(),
+	}
+}
+
+func TestRunCreatesWorldWithLearningHistory(t *testing.T) {
+	// Генератор пишет в лог каждую попытку подобрать пример
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	mem, repos := newRepos()
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+
+	result, err := Run(t.Context(), repos, Options{Weeks: 8, StudentsPerClass: 4, Seed: 7, Now: now})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Schools != 2 || result.Classes != 5 {
+		t.Fatalf("schools/classes = %d/%d, want 2/5", result.Schools, result.Classes)
+	}
+	if len(result.Students()) != 20 {
+		t.Fatalf("students = %d, want 20", len(result.Students()))
+	}
+
+	// Известный пароль подходит ко всем учетным записям
+	for _, username := range []string{"admin", "director1", "teacher1", "student1", "parent1"} {
+		if _, err := repos.Users.Login(t.Context(), username, Password); err != nil {
+			t.Errorf("login %s: %v", username, err)
+		}
+	}
+
+	start := now.AddDate(0, 0, -7*8)
+	half := now.AddDate(0, 0, -7*4)
+	var early, earlyOK, late, lateOK int
+	for _, student := range result.Students() {
+		attempts := mem.GetAttempts(student.ID)
+		if len(attempts) == 0 {
+			t.Errorf("%s has no attempts", student.Username)
+		}
+		for _, a := range attempts {
+			if a.CreatedAt.Before(start) || !a.CreatedAt.Before(now) {
+				t.Fatalf("attempt at %v outside history window", a.CreatedAt)
+			}
+			if a.CreatedAt.Before(half) {
+				early++
+				if a.IsCorrect {
+					earlyOK++
+				}
+			} else {
+				late++
+				if a.IsCorrect {
+					lateOK++
+				}
+			}
+		}
+	}
+
+	// Кривая обучения: во второй половине истории доля верных ответов выше
+	earlyRate := float64(earlyOK) / float64(early)
+	lateRate := float64(lateOK) / float64(late)
+	if lateRate <= earlyRate {
+		t.Errorf("accuracy early %.2f, late %.2f: want growth", earlyRate, lateRate)
+	}
+
+	if _, err := Run(t.Context(), repos, Options{Seed: 7, Now: now}); !errors.Is(err, ErrAlreadySeeded) {
+		t.Errorf("second Run error = %v, want ErrAlreadySeeded", err)
+	}
+}
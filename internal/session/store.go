@@ -1,6 +1,8 @@
 package session
 
 import (
+	"net/http"
+
 	"github.com/gorilla/sessions"
 )
 
@@ -10,6 +12,8 @@ var Store *sessions.CookieStore
 // InitStore инициализирует хранилище сессий с указанным секретным ключом
 func InitStore(secretKey string) {
 	Store = sessions.NewCookieStore([]byte(secretKey))
+	Store.Options.HttpOnly = true
+	Store.Options.SameSite = http.SameSiteLaxMode
 }
 
 // GetStore возвращает текущее хранилище сессий
@@ -22,6 +22,12 @@ function showNotification(message, type = 'success') {
     }, 3000);
 }
 
+// CSRF-токен текущей страницы для заголовка X-CSRF-Token
+function csrfToken() {
+    const meta = document.querySelector('meta[name="csrf-token"]');
+    return meta ? meta.getAttribute('content') : '';
+}
+
 // Форматирование процентов
 function formatPercent(correct, total) {
     if (total === 0) return '0%';